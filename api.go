@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"github.com/gorilla/mux"
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/asafron/meetings-scheduler/controllers"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/openapi"
+)
+
+var rangeQuery = []openapi.Param{
+	{Name: "from", Type: "integer", Description: "Unix time, only items ending after it"},
+	{Name: "to", Type: "integer", Description: "Unix time, only items starting before it"},
+	{Name: "limit", Type: "integer", Description: "Page size, 50 by default and at most 200"},
+	{Name: "cursor", Description: "next_cursor of the previous page"},
+}
+
+var idempotencyKeyParam = openapi.Param{Name: idempotencyKeyHeader,
+	Description: "Retries with the same key and request get the first response back, with an Idempotent-Replayed header"}
+
+// apiOperations documents the routes registered in main, the request and data
+// values are only used for their types
+var apiOperations = []openapi.Operation{
+	{Method: "GET", Path: "/ws/version", Tag: "server", Summary: "Version of the API", Public: true, Response: VersionResponse{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "server", Summary: "This document", Public: true, Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", Tag: "server", Summary: "Page rendering this document", Public: true, Response: ""},
+	{Method: "GET", Path: "/healthz", Tag: "server", Summary: "Answers while the process is alive", Public: true, Response: HealthResponse{}},
+	{Method: "GET", Path: "/readyz", Tag: "server", Summary: "Checks the database and the mail transport, 503 when one of them fails", Public: true, Response: HealthResponse{}},
+	{Method: "GET", Path: "/metrics", Tag: "server", Summary: "Metrics in the Prometheus text format", Public: true, Response: ""},
+
+	{Method: "POST", Path: "/users", Tag: "users", Summary: "Registers a user and sends the confirmation email", Public: true, Request: controllers.CreateUserRequest{}},
+	{Method: "GET", Path: "/users/confirm", Tag: "users", Summary: "Confirms the email of a user and redirects to the sign in page", Public: true, Redirect: true,
+		Query: []openapi.Param{{Name: "email", Required: true}, {Name: "token", Required: true}}},
+	{Method: "POST", Path: "/users/signIn", Tag: "users", Summary: "Signs a user in", Public: true, Request: controllers.LoginRequest{}, Response: models.User{}},
+	{Method: "DELETE", Path: "/users/signOut", Tag: "users", Summary: "Signs the current user out", Redirect: true},
+	{Method: "GET", Path: "/users/session/check", Tag: "users", Summary: "Returns the current user", Response: models.User{}},
+	{Method: "POST", Path: "/users/password", Tag: "users", Summary: "Sends a password recovery email", Public: true, Request: controllers.ForgotPasswordRequest{}},
+	{Method: "GET", Path: "/users/recover", Tag: "users", Summary: "Checks a recovery link and redirects to the password page", Public: true, Redirect: true,
+		Query: []openapi.Param{{Name: "email", Required: true}, {Name: "token", Required: true}}},
+	{Method: "POST", Path: "/users/password/recover", Tag: "users", Summary: "Sets a new password with a recovery token", Public: true, Redirect: true, Request: controllers.RecoverPasswordRequest{}},
+
+	{Method: "GET", Path: "/events", Tag: "events", Summary: "Lists every event of the current user with its slots and meetings, GET /v2/events pages through them",
+		Data: map[string]interface{}{"events": []models.Event{}}},
+	{Method: "POST", Path: "/events", Tag: "events", Summary: "Creates an event", Request: controllers.AddEventRequest{}, Data: map[string]interface{}{"event": models.Event{}}},
+	{Method: "DELETE", Path: "/events", Tag: "events", Summary: "Moves an event to the trash", Request: controllers.RemoveEventRequest{}},
+	{Method: "GET", Path: "/events/{id}/slots", Tag: "events", Summary: "Lists the slots of an event by start time", Query: rangeQuery,
+		Data: map[string]interface{}{"slots": []models.Slot{}, "next_cursor": ""}},
+	{Method: "GET", Path: "/events/{id}/meetings", Tag: "events", Summary: "Lists the meetings of an event by start time", Query: rangeQuery,
+		Data: map[string]interface{}{"meetings": []models.Meeting{}, "next_cursor": ""}},
+
+	{Method: "POST", Path: "/slots", Tag: "slots", Summary: "Adds slots to an event, merge joins them with the slots they touch", Request: controllers.AddSlotsToEventRequest{}},
+	{Method: "PUT", Path: "/slots", Tag: "slots", Summary: "Replaces slots of an event", Request: controllers.UpdateSlotsRequest{}, Data: map[string]interface{}{"slots": []models.Slot{}}},
+	{Method: "PATCH", Path: "/slots", Tag: "slots", Summary: "Changes fields of slots of an event", Request: controllers.UpdateSlotsRequest{}, Data: map[string]interface{}{"slots": []models.Slot{}}},
+	{Method: "DELETE", Path: "/slots", Tag: "slots", Summary: "Removes a slot from an event", Request: controllers.RemoveSlotFromEventRequest{}},
+
+	{Method: "DELETE", Path: "/meetings", Tag: "meetings", Summary: "Moves a meeting to the trash", Request: controllers.RemoveMeetingRequest{}},
+
+	{Method: "GET", Path: "/trash", Tag: "trash", Summary: "Lists the deleted events and meetings of the current user",
+		Data: map[string]interface{}{"events": []models.Event{}, "meetings": []models.Meeting{}}},
+	{Method: "POST", Path: "/trash/restore", Tag: "trash", Summary: "Restores an event or one of its meetings", Request: controllers.RestoreRequest{}},
+
+	{Method: "GET", Path: "/audit", Tag: "audit", Summary: "Lists audit entries, newest first",
+		Query: []openapi.Param{
+			{Name: "actor"}, {Name: "action"}, {Name: "target_type"}, {Name: "target_id"}, {Name: "event_display_id"},
+			{Name: "from", Type: "integer", Description: "Unix time"},
+			{Name: "to", Type: "integer", Description: "Unix time"},
+			{Name: "limit", Type: "integer", Description: "100 by default and at most 1000"},
+		},
+		Data: map[string]interface{}{"entries": []models.AuditEntry{}}},
+
+	{Method: "GET", Path: "/blackouts", Tag: "availability", Summary: "Lists the blackouts of the current user or of an event",
+		Query: []openapi.Param{{Name: "event_display_id"}}, Data: map[string]interface{}{"blackouts": []models.Blackout{}}},
+	{Method: "POST", Path: "/blackouts", Tag: "availability", Summary: "Adds a blackout", Request: controllers.AddBlackoutRequest{},
+		Data: map[string]interface{}{"blackouts": []models.Blackout{}}},
+	{Method: "DELETE", Path: "/blackouts", Tag: "availability", Summary: "Removes a blackout", Request: controllers.RemoveAvailabilityRuleRequest{}},
+	{Method: "POST", Path: "/blackouts/import", Tag: "availability", Summary: "Imports the entries of an ICS calendar as blackouts", RequestType: "text/calendar",
+		Query: []openapi.Param{{Name: "event_display_id"}, {Name: "time_zone", Description: "Time zone of the floating times of the calendar"}},
+		Data: map[string]interface{}{"blackouts": []models.Blackout{}}},
+	{Method: "GET", Path: "/overrides", Tag: "availability", Summary: "Lists the date overrides of the current user or of an event",
+		Query: []openapi.Param{{Name: "event_display_id"}}, Data: map[string]interface{}{"date_overrides": []models.DateOverride{}}},
+	{Method: "POST", Path: "/overrides", Tag: "availability", Summary: "Adds a date override", Request: controllers.AddDateOverrideRequest{},
+		Data: map[string]interface{}{"date_override": models.DateOverride{}}},
+	{Method: "DELETE", Path: "/overrides", Tag: "availability", Summary: "Removes a date override", Request: controllers.RemoveAvailabilityRuleRequest{}},
+
+	{Method: "POST", Path: "/freebusy", Tag: "scheduling", Summary: "Returns the busy and free times of users", Request: controllers.FreeBusyRequest{},
+		Data: map[string]interface{}{"busy": []availability.Interval{}, "free": []availability.Interval{}, "users": map[string]availability.Schedule{}}},
+	{Method: "POST", Path: "/suggestions", Tag: "scheduling", Summary: "Ranks candidate times for a meeting", Request: controllers.SuggestMeetingTimesRequest{},
+		Data: map[string]interface{}{"suggestions": []availability.Suggestion{}}},
+
+	{Method: "GET", Path: "/v2/events", Tag: "v2", Summary: "Lists the events of the current user a page at a time",
+		Query: []openapi.Param{
+			{Name: "name", Description: "Only events whose name contains it"},
+			{Name: "from", Type: "integer", Description: "Unix time, only events with a slot ending after it"},
+			{Name: "to", Type: "integer", Description: "Unix time, only events with a slot starting before it"},
+			{Name: "has_upcoming_meetings", Type: "boolean", Description: "Only events with meetings that didn't start yet"},
+			{Name: "sort", Description: "created_at, updated_at or name, prefixed with - for descending order"},
+			{Name: "fields", Description: "Comma separated event fields to return, slots and meetings are only loaded when asked for"},
+			{Name: "limit", Type: "integer", Description: "Page size, 50 by default and at most 200"},
+			{Name: "cursor", Description: "next_cursor of the previous page"},
+		},
+		Data: map[string]interface{}{"events": []models.Event{}, "next_cursor": ""}},
+	{Method: "POST", Path: "/v2/events", Tag: "v2", Summary: "Creates an event", Request: controllers.AddEventRequest{}, Data: map[string]interface{}{"event": models.Event{}}},
+	{Method: "GET", Path: "/v2/events/{id}", Tag: "v2", Summary: "Returns an event with its slots and meetings", Data: map[string]interface{}{"event": models.Event{}}},
+	{Method: "PATCH", Path: "/v2/events/{id}", Tag: "v2", Summary: "Renames an event", Request: controllers.UpdateEventRequest{}},
+	{Method: "DELETE", Path: "/v2/events/{id}", Tag: "v2", Summary: "Moves an event to the trash"},
+	{Method: "PUT", Path: "/v2/events/{id}/intake_form", Tag: "v2", Summary: "Replaces the intake form guests fill in when they book a meeting",
+		Request: controllers.UpdateIntakeFormRequest{}, Data: map[string]interface{}{"intake_form": []models.IntakeField{}}},
+	{Method: "GET", Path: "/v2/events/{id}/slots", Tag: "v2", Summary: "Lists the slots of an event by start time", Query: rangeQuery,
+		Data: map[string]interface{}{"slots": []models.Slot{}, "next_cursor": ""}},
+	{Method: "POST", Path: "/v2/events/{id}/slots", Tag: "v2", Summary: "Adds slots to an event", Request: controllers.AddSlotsToEventRequest{}},
+	{Method: "POST", Path: "/v2/events/{id}/slots/import", Tag: "v2", Summary: "Adds the slots of a CSV file with start, end, user, interval and time_zone columns", RequestType: "text/csv",
+		Query: []openapi.Param{
+			{Name: "time_zone", Description: "Time zone of the times without an offset in rows without a time zone, UTC by default"},
+			{Name: "merge", Type: "boolean", Description: "Joins overlapping and adjacent slots of the same user and interval, see POST /slots"},
+			{Name: "dry_run", Type: "boolean", Description: "Saves nothing and returns the slots with the errors of the rows"},
+		},
+		Data: map[string]interface{}{"slots": []models.Slot{}, "errors": []availability.SlotError{}}},
+	{Method: "GET", Path: "/v2/events/{id}/slots/{slot_id}", Tag: "v2", Summary: "Returns a slot", Data: map[string]interface{}{"slot": models.Slot{}}},
+	{Method: "PUT", Path: "/v2/events/{id}/slots/{slot_id}", Tag: "v2", Summary: "Replaces a slot", Request: controllers.SlotUpdateRequest{}, Data: map[string]interface{}{"slots": []models.Slot{}}},
+	{Method: "PATCH", Path: "/v2/events/{id}/slots/{slot_id}", Tag: "v2", Summary: "Changes fields of a slot", Request: controllers.SlotUpdateRequest{}, Data: map[string]interface{}{"slots": []models.Slot{}}},
+	{Method: "DELETE", Path: "/v2/events/{id}/slots/{slot_id}", Tag: "v2", Summary: "Removes a slot"},
+	{Method: "GET", Path: "/v2/events/{id}/meetings", Tag: "v2", Summary: "Lists the meetings of an event by start time", Query: rangeQuery,
+		Data: map[string]interface{}{"meetings": []models.Meeting{}, "next_cursor": ""}},
+	{Method: "GET", Path: "/v2/events/{id}/meetings/export", Tag: "v2", Summary: "Downloads the meetings of an event with their guests as CSV", ResponseType: "text/csv",
+		Query: []openapi.Param{{Name: "time_zone", Description: "Time zone of the meeting times, UTC by default"}}},
+	{Method: "GET", Path: "/v2/events/{id}/meetings/{meeting_id}", Tag: "v2", Summary: "Returns a meeting", Data: map[string]interface{}{"meeting": models.Meeting{}}},
+	{Method: "DELETE", Path: "/v2/events/{id}/meetings/{meeting_id}", Tag: "v2", Summary: "Moves a meeting to the trash"},
+	{Method: "GET", Path: "/v2/public/events/{id}", Tag: "public", Summary: "Returns the name and the intake form of an event to guests", Public: true,
+		Data: map[string]interface{}{"event": controllers.PublicEvent{}}},
+	{Method: "POST", Path: "/v2/public/events/{id}/intake_form/validate", Tag: "public", Summary: "Checks the answers of a guest against the intake form of an event",
+		Public: true, Request: controllers.IntakeAnswersRequest{}, Data: map[string]interface{}{"details": map[string]string{}}},
+	{Method: "POST", Path: "/v2/public/events/{id}/meetings", Tag: "public", Summary: "Books a meeting in a slot of an event and keeps the answers to its intake form",
+		Public: true, Request: controllers.BookMeetingRequest{}, Data: map[string]interface{}{"meeting": models.Meeting{}}},
+}
+
+// buildSpec documents every route of the router, routes missing from
+// apiOperations are listed without schemas
+func buildSpec(r *mux.Router) *openapi.Spec {
+	spec := openapi.NewSpec("Meetings Scheduler", "4", helpers.GeneralResponse{})
+	documented := make(map[string]openapi.Operation)
+	for _, element := range apiOperations {
+		documented[element.Method+" "+element.Path] = element
+	}
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method == "OPTIONS" {
+				continue
+			}
+			op, ok := documented[method+" "+path]
+			if !ok {
+				op = openapi.Operation{Method: method, Path: path}
+			}
+			if method == "POST" {
+				op.Headers = append(op.Headers, idempotencyKeyParam)
+			}
+			spec.Add(op)
+		}
+		return nil
+	})
+	return spec
+}
+
+// validateRequest checks the query and the body of a request against the
+// operation of the route it matched, it answers the request and returns false
+// when they don't match
+func validateRequest(spec *openapi.Spec, r *mux.Router, writer http.ResponseWriter, req *http.Request) bool {
+	var match mux.RouteMatch
+	if !r.Match(req, &match) || match.Route == nil {
+		return true
+	}
+	path, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return true
+	}
+	op, ok := spec.Operation(req.Method, path)
+	if !ok {
+		return true
+	}
+	fields := spec.ValidateQuery(op, req.URL.Query())
+	if op.Request != nil && op.RequestType == "" {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			// reading only fails past the body size limit or when the client is gone
+			helpers.ErrorResponse(writer, helpers.GeneralErrorBodyTooLarge)
+			return false
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fields = append(fields, spec.ValidateRequest(op, body)...)
+	}
+	if len(fields) == 0 {
+		return true
+	}
+	apiError := helpers.ToApiError(helpers.GeneralErrorInvalidRequest)
+	apiError.Fields = fields
+	helpers.ApiErrorResponse(writer, apiError, nil)
+	return false
+}
+
+func (s *MyServer) OpenApiDocument(writer http.ResponseWriter, req *http.Request) {
+	helpers.JsonResponse(writer, http.StatusOK, s.spec.Document())
+}
+
+func (s *MyServer) Docs(writer http.ResponseWriter, req *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Write([]byte(docsPage))
+}
+
+// docsPage renders /openapi.json without loading anything from elsewhere
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Meetings Scheduler API</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+h2 { border-bottom: 1px solid #ccc; padding-bottom: .2em; margin-top: 2em; }
+details { margin: .4em 0; border: 1px solid #ddd; border-radius: 4px; padding: .4em .8em; }
+summary { cursor: pointer; }
+.method { display: inline-block; width: 5em; font-weight: bold; font-family: monospace; }
+.path { font-family: monospace; }
+pre { background: #f6f6f6; padding: .6em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Meetings Scheduler API</h1>
+<p>Generated from <a href="/openapi.json">/openapi.json</a>. Requests are checked against it before they reach the handlers.</p>
+<div id="operations">Loading...</div>
+<script>
+function resolve(doc, schema, depth) {
+	if (!schema || depth > 6) return schema;
+	if (schema.$ref) return resolve(doc, doc.components.schemas[schema.$ref.split("/").pop()], depth + 1);
+	var copy = {};
+	for (var key in schema) {
+		var value = schema[key];
+		if (key === "properties") {
+			copy[key] = {};
+			for (var name in value) copy[key][name] = resolve(doc, value[name], depth + 1);
+		} else if (key === "items" || key === "additionalProperties") {
+			copy[key] = resolve(doc, value, depth + 1);
+		} else if (key === "allOf") {
+			copy[key] = value.map(function (part) { return resolve(doc, part, depth + 1); });
+		} else {
+			copy[key] = value;
+		}
+	}
+	return copy;
+}
+function block(title, value) {
+	return "<h4>" + title + "</h4><pre>" + JSON.stringify(value, null, 2).replace(/</g, "&lt;") + "</pre>";
+}
+fetch("/openapi.json").then(function (response) { return response.json(); }).then(function (doc) {
+	var byTag = {};
+	Object.keys(doc.paths).sort().forEach(function (path) {
+		Object.keys(doc.paths[path]).forEach(function (method) {
+			var op = doc.paths[path][method];
+			var tag = (op.tags || ["other"])[0];
+			(byTag[tag] = byTag[tag] || []).push({ path: path, method: method, op: op });
+		});
+	});
+	var html = "";
+	Object.keys(byTag).sort().forEach(function (tag) {
+		html += "<h2>" + tag + "</h2>";
+		byTag[tag].forEach(function (entry) {
+			var op = entry.op;
+			html += "<details><summary><span class=\"method\">" + entry.method.toUpperCase() + "</span> <span class=\"path\">" +
+				entry.path + "</span> " + (op.summary || "") + (op.security ? " (public)" : "") + "</summary>";
+			if (op.parameters) html += block("Parameters", op.parameters);
+			if (op.requestBody) {
+				var content = op.requestBody.content;
+				var type = Object.keys(content)[0];
+				html += block("Body (" + type + ")", resolve(doc, content[type].schema, 0));
+			}
+			var success = op.responses["200"];
+			if (success && success.content) html += block("Response", resolve(doc, success.content["application/json"].schema, 0));
+			html += "</details>";
+		});
+	});
+	document.getElementById("operations").innerHTML = html;
+});
+</script>
+</body>
+</html>
+`
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"golang.org/x/crypto/bcrypt"
 	"os/exec"
 	"strings"
@@ -10,23 +11,24 @@ import (
 	"github.com/asafron/meetings-scheduler/db"
 	"github.com/asafron/meetings-scheduler/helpers"
 	"github.com/asafron/meetings-scheduler/models"
-	"github.com/asafron/meetings-scheduler/config"
 )
 
 type Authenticator struct {
-	dal         *db.DAL
-	cookieJar   *sessions.CookieStore
+	dal              db.DAL
+	cookieJar        *sessions.CookieStore
+	dashboardBaseUrl string
 }
 
-func NewAuthenticator(dal *db.DAL, cookieKey string) *Authenticator {
+func NewAuthenticator(dal db.DAL, cookieKey string, dashboardBaseUrl string) *Authenticator {
 	a := Authenticator{}
 	a.dal = dal
 	a.cookieJar = sessions.NewCookieStore([]byte(cookieKey))
+	a.dashboardBaseUrl = dashboardBaseUrl
 	return &a
 }
 
 
-func (a *Authenticator) Register(email string , password string, firstName string , lastName string) (string, error) {
+func (a *Authenticator) Register(ctx context.Context, email string , password string, firstName string , lastName string) (string, error) {
 	if email == "" {
 		return "", helpers.AuthenticationErrorRegisterNoEmail
 	}
@@ -46,7 +48,7 @@ func (a *Authenticator) Register(email string , password string, firstName strin
 		return "", tokenErr
 	}
 	confirmationToken := strings.TrimRight(strings.ToLower(string(token)), "\n")
-	err = a.dal.InsertUser(email, hash, firstName, lastName, confirmationToken)
+	err = db.WithContext(a.dal, ctx).InsertUser(email, hash, firstName, lastName, confirmationToken)
 	if err != nil {
 		return "", helpers.AuthenticationErrorRegisterUserCreationFailed
 	}
@@ -58,14 +60,14 @@ func (a *Authenticator) Login(rw http.ResponseWriter, req *http.Request, email s
 	if session.Values["email"] != nil {
 		// Set the current user
 		username:= (session.Values["email"]).(string)
-		user, err := a.dal.FindActiveUserByEmail(username)
+		user, err := db.WithContext(a.dal, req.Context()).FindActiveUserByEmail(username)
 		if err == nil {
 			helpers.SetCurrentUser(req,*user)
 		}
 		return helpers.AuthenticationErrorLoginAlreadyAuthenticated
 	}
 	// Try to find the user, to see if it already logged in...
-	user, err := a.dal.FindActiveUserByEmail(email)
+	user, err := db.WithContext(a.dal, req.Context()).FindActiveUserByEmail(email)
 	if  err == nil {
 		verify := bcrypt.CompareHashAndPassword(user.Hash, []byte(password))
 		if verify != nil {
@@ -88,7 +90,7 @@ func (a *Authenticator) Authorize(rw http.ResponseWriter, req *http.Request) (*m
 	}
 	username := authSession.Values["email"]
 	if !authSession.IsNew && username != nil {
-		user, err = a.dal.FindActiveUserByEmail(username.(string))
+		user, err = db.WithContext(a.dal, req.Context()).FindActiveUserByEmail(username.(string))
 		if err == helpers.AuthenticationErrorLoginUserNotExists {
 			authSession.Options.MaxAge = -1 // kill the cookie
 			authSession.Save(req, rw)
@@ -104,6 +106,17 @@ func (a *Authenticator) Authorize(rw http.ResponseWriter, req *http.Request) (*m
 	return user,nil
 }
 
+// SessionEmail returns the email the request is signed in with, empty when it
+// has no valid session. Unlike Authorize it doesn't check the user.
+func (a *Authenticator) SessionEmail(req *http.Request) string {
+	session, err := a.cookieJar.Get(req, "auth")
+	if err != nil || session.IsNew {
+		return ""
+	}
+	email, _ := session.Values["email"].(string)
+	return email
+}
+
 func (a *Authenticator) Logout(rw http.ResponseWriter, req *http.Request) error {
 	session, _ := a.cookieJar.Get(req, "auth")
 	defer session.Save(req, rw)
@@ -111,23 +124,23 @@ func (a *Authenticator) Logout(rw http.ResponseWriter, req *http.Request) error
 	return nil
 }
 
-func (auth *Authenticator) ConfirmUser(email string, confirmationToken string) error {
+func (auth *Authenticator) ConfirmUser(ctx context.Context, email string, confirmationToken string) error {
 	// Locate the user
-	user, err := auth.dal.FindUserByConfirmationToken(confirmationToken, email)
-	if err != nil {
+	user, err := db.WithContext(auth.dal, ctx).FindUserByConfirmationToken(confirmationToken, email)
+	if err != nil || user.Status == models.USER_DISABLED {
 		return helpers.AuthenticationErrorConfirmationTokenNotValid
 	}
 	// If all is OK, confirm the user
-	err = auth.dal.UpdateUserConfirmation(user.Id, models.USER_CONFIRMED, models.CONFIRMATION_TOKEN_INVALID, true)
+	err = db.WithContext(auth.dal, ctx).UpdateUserConfirmation(user.Id, models.USER_CONFIRMED, models.CONFIRMATION_TOKEN_INVALID, true)
 	if err != nil {
 		return helpers.GeneralErrorInternal
 	}
 	return nil
 }
 
-func (auth *Authenticator) CreatePasswordRecovery(email string) (string,error) {
+func (auth *Authenticator) CreatePasswordRecovery(ctx context.Context, email string) (string,error) {
 	// Locate the user
-	user, err := auth.dal.FindActiveUserByEmail(email)
+	user, err := db.WithContext(auth.dal, ctx).FindActiveUserByEmail(email)
 	if err != nil {
 		return "", err
 	}
@@ -137,16 +150,16 @@ func (auth *Authenticator) CreatePasswordRecovery(email string) (string,error) {
 		return "", err
 	}
 	// Update user, set expiry to 24 hours from now
-	err = auth.dal.UpdateUserRecovery(user.Id, token, models.RECOVER_TOKEN_VALID, time.Now().UTC().Add(time.Hour * 24) )
+	err = db.WithContext(auth.dal, ctx).UpdateUserRecovery(user.Id, token, models.RECOVER_TOKEN_VALID, time.Now().UTC().Add(time.Hour * 24) )
 	if err!=nil {
 		return "", err
 	}
 	return token, nil
 }
 
-func (auth *Authenticator) UpdateUserPasswordFromRecovery(email string, token string, password string ) error {
+func (auth *Authenticator) UpdateUserPasswordFromRecovery(ctx context.Context, email string, token string, password string ) error {
 	//get the user
-	user, err := auth.dal.FindUserByRecoveryToken(token,email)
+	user, err := db.WithContext(auth.dal, ctx).FindUserByRecoveryToken(token,email)
 	if err != nil {
 		return err
 	}
@@ -156,23 +169,87 @@ func (auth *Authenticator) UpdateUserPasswordFromRecovery(email string, token st
 	if err != nil {
 		return helpers.AuthenticationErrorRegisterPasswordNotValid
 	}
-	err = auth.dal.UpdateUserPassword(user.Id,hash, models.RECOVER_TOKEN_INVALID, time.Now().UTC())
+	err = db.WithContext(auth.dal, ctx).UpdateUserPassword(user.Id,hash, models.RECOVER_TOKEN_INVALID, time.Now().UTC())
 	if err!=nil {
 		return err
 	}
 	return nil
 }
 
+// ConfirmUserWithoutToken confirms a user an admin vouches for, the
+// confirmation link sent to the user stops working
+func (auth *Authenticator) ConfirmUserWithoutToken(ctx context.Context, email string) (*models.User, error) {
+	user, err := db.WithContext(auth.dal, ctx).FindAnyUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status == models.USER_DISABLED {
+		return nil, helpers.UsersErrorDisabled
+	}
+	err = db.WithContext(auth.dal, ctx).UpdateUserConfirmation(user.Id, models.USER_CONFIRMED, models.CONFIRMATION_TOKEN_INVALID, true)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = models.USER_CONFIRMED
+	return user, nil
+}
+
+// SetUserDisabled disables a user, who can't sign in or use a session started
+// before, or enables the user again with the status the user had
+func (auth *Authenticator) SetUserDisabled(ctx context.Context, email string, disabled bool) (*models.User, error) {
+	user, err := db.WithContext(auth.dal, ctx).FindAnyUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	status := models.USER_DISABLED
+	if !disabled && user.Confirmed {
+		status = models.USER_CONFIRMED
+	} else if !disabled {
+		status = models.USER_NOT_CONFIRMED
+	}
+	err = db.WithContext(auth.dal, ctx).UpdateUserConfirmation(user.Id, status, user.ConfirmationTokenStatus, user.Confirmed)
+	if err != nil {
+		return nil, err
+	}
+	user.Status = status
+	return user, nil
+}
+
+// SetPassword replaces the password of an active user without the recovery
+// email, recovery links sent before stop working
+func (auth *Authenticator) SetPassword(ctx context.Context, email string, password string) error {
+	token, err := auth.CreatePasswordRecovery(ctx, email)
+	if err != nil {
+		return err
+	}
+	return auth.UpdateUserPasswordFromRecovery(ctx, email, token, password)
+}
+
 func (auth *Authenticator) AuthMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var user *models.User
 		var err error=nil
 		user, err = auth.Authorize(w, r)
 		if err != nil {
-			http.Redirect(w, r, config.GetConfigWrapper().GetCurrent().DashboardBaseUrl, http.StatusSeeOther)
+			// browsers navigating to a page are sent to the dashboard to sign in,
+			// API clients get the error
+			if isPageNavigation(r) {
+				http.Redirect(w, r, auth.dashboardBaseUrl, http.StatusSeeOther)
+				return
+			}
+			if err == helpers.AuthenticationErrorLoginUserNotExists {
+				err = helpers.AuthenticationErrorAuthorizeUserNotLoggedIn
+			}
+			helpers.ErrorResponse(w, err)
 			return
 		}
 		helpers.SetCurrentUser(r,*user)
+		helpers.SetLogField(r, "user_id", user.DisplayId)
 		h.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+// isPageNavigation reports whether the request comes from a browser loading a
+// page rather than from a script calling the API
+func isPageNavigation(r *http.Request) bool {
+	return r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), "text/html")
+}
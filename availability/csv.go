@@ -0,0 +1,135 @@
+package availability
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+var ErrInvalidSlotsCSV = errors.New("slots file is not a CSV file with start, end, user and interval columns")
+
+// SlotRow is a slot read from a row of a CSV file. Index is the position of
+// the row among the rows after the header and Row its row in the file, the
+// header being row 1. The user is the column as written, a display id or an
+// email.
+type SlotRow struct {
+	Index int
+	Row   int
+	Slot  models.Slot
+}
+
+// slotColumns maps the accepted header names to the fields they fill
+var slotColumns = map[string]string{
+	"start": "start_time",
+	"start_time": "start_time",
+	"end": "end_time",
+	"end_time": "end_time",
+	"user": "user",
+	"interval": "interval",
+	"time_zone": "time_zone",
+	"timezone": "time_zone",
+}
+
+var slotTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+// ParseSlotsCSV reads slots from a CSV file, such as one saved from a
+// spreadsheet. The header names the start, end, user and interval columns in
+// any order and an optional time_zone column. Times are RFC 3339 or local
+// times, read in the time zone of their row or else in the given location, and
+// intervals are minutes. Rows that can't be read become errors and are left
+// out of the slots, a file without the columns is ErrInvalidSlotsCSV.
+func ParseSlotsCSV(reader io.Reader, location *time.Location) ([]SlotRow, []SlotError, error) {
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+	header, err := records.Read()
+	if err != nil {
+		return nil, nil, ErrInvalidSlotsCSV
+	}
+	columns := make(map[string]int)
+	for index, name := range header {
+		// spreadsheets may start the file with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := slotColumns[name]; ok {
+			columns[field] = index
+		}
+	}
+	for _, field := range []string{"start_time", "end_time", "user", "interval"} {
+		if _, ok := columns[field]; !ok {
+			return nil, nil, ErrInvalidSlotsCSV
+		}
+	}
+
+	rows := []SlotRow{}
+	slotErrors := []SlotError{}
+	for index := 0; ; index++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, ErrInvalidSlotsCSV
+		}
+		value := func(field string) string {
+			column, ok := columns[field]
+			if !ok || column >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[column])
+		}
+		row := SlotRow{Index: index, Row: index + 2}
+		rowErrors := []SlotError{}
+		fail := func(field string, err error) {
+			rowErrors = append(rowErrors, SlotError{Index: row.Index, Row: row.Row, Field: field, Message: err.Error()})
+		}
+
+		rowLocation := location
+		if timeZone := value("time_zone"); timeZone != "" {
+			loaded, err := time.LoadLocation(timeZone)
+			if err != nil {
+				fail("time_zone", helpers.SuggestionsErrorInvalidTimeZone)
+			} else {
+				rowLocation = loaded
+			}
+		}
+		row.Slot.StartTime, err = parseSlotTime(value("start_time"), rowLocation)
+		if err != nil {
+			fail("start_time", err)
+		}
+		row.Slot.EndTime, err = parseSlotTime(value("end_time"), rowLocation)
+		if err != nil {
+			fail("end_time", err)
+		}
+		row.Slot.User = value("user")
+		if interval := value("interval"); interval != "" {
+			parsed, err := strconv.ParseUint(interval, 10, 32)
+			if err != nil {
+				fail("interval", helpers.SlotsErrorNoInterval)
+			}
+			row.Slot.Interval = uint(parsed)
+		}
+
+		if len(rowErrors) > 0 {
+			slotErrors = append(slotErrors, rowErrors...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, slotErrors, nil
+}
+
+func parseSlotTime(value string, location *time.Location) (time.Time, error) {
+	for _, layout := range slotTimeLayouts {
+		parsed, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+	return time.Time{}, helpers.SlotsErrorInvalidTime
+}
@@ -0,0 +1,92 @@
+package availability
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+func TestParseSlotsCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		slots  []string
+		errors []SlotError
+	}{
+		{
+			"header in any order with aliases and a byte order mark",
+			"\ufeffUser,Interval,Start,End\nu1,30,2030-03-04 09:00,2030-03-04T12:00:00Z\n",
+			[]string{"2: u1 30 2030-03-04T09:00:00Z 2030-03-04T12:00:00Z"},
+			[]SlotError{},
+		},
+		{
+			"time zone of the row",
+			"start_time,end_time,user,interval,time_zone\n2030-03-04T09:00,2030-03-04T12:00,u1,30,America/New_York\n2030-03-04T09:00,2030-03-04T12:00,u2,60,\n",
+			[]string{"2: u1 30 2030-03-04T14:00:00Z 2030-03-04T17:00:00Z", "3: u2 60 2030-03-04T09:00:00Z 2030-03-04T12:00:00Z"},
+			[]SlotError{},
+		},
+		{
+			"extra columns are ignored",
+			"notes,start,end,user,interval,room\nbring coffee,2030-03-04 09:00,2030-03-04 10:00,u1,15,blue\n",
+			[]string{"2: u1 15 2030-03-04T09:00:00Z 2030-03-04T10:00:00Z"},
+			[]SlotError{},
+		},
+		{
+			// the missing user and interval are left to ValidateSlots
+			"short rows leave their cells empty",
+			"start,end,user,interval\n2030-03-04 09:00,2030-03-04 10:00\n",
+			[]string{"2:  0 2030-03-04T09:00:00Z 2030-03-04T10:00:00Z"},
+			[]SlotError{},
+		},
+		{
+			"unknown time zone",
+			"start,end,user,interval,time_zone\n2030-03-04 09:00,2030-03-04 10:00,u1,30,Mars/Olympus\n",
+			[]string{},
+			[]SlotError{{Index: 0, Row: 2, Field: "time_zone", Message: helpers.SuggestionsErrorInvalidTimeZone.Error()}},
+		},
+		{
+			"unreadable cells of a row are all reported and other rows kept",
+			"start,end,user,interval\nyesterday,2030-03-04 10:00,u1,half an hour\n2030-03-04 09:00,2030-03-04 10:00,u1,30\n",
+			[]string{"3: u1 30 2030-03-04T09:00:00Z 2030-03-04T10:00:00Z"},
+			[]SlotError{
+				{Index: 0, Row: 2, Field: "start_time", Message: helpers.SlotsErrorInvalidTime.Error()},
+				{Index: 0, Row: 2, Field: "interval", Message: helpers.SlotsErrorNoInterval.Error()},
+			},
+		},
+	}
+	for _, test := range tests {
+		rows, slotErrors, err := ParseSlotsCSV(strings.NewReader(test.file), time.UTC)
+		if err != nil {
+			t.Errorf("%s: ParseSlotsCSV() failed: %v", test.name, err)
+			continue
+		}
+		slots := []string{}
+		for _, element := range rows {
+			slots = append(slots, strings.Join([]string{
+				strconv.Itoa(element.Row) + ":", element.Slot.User, strconv.Itoa(int(element.Slot.Interval)),
+				element.Slot.StartTime.Format(time.RFC3339), element.Slot.EndTime.Format(time.RFC3339),
+			}, " "))
+		}
+		if !reflect.DeepEqual(slots, test.slots) || !reflect.DeepEqual(slotErrors, test.errors) {
+			t.Errorf("%s: ParseSlotsCSV() = %v %v, want %v %v", test.name, slots, slotErrors, test.slots, test.errors)
+		}
+	}
+}
+
+func TestParseSlotsCSVMissingColumns(t *testing.T) {
+	for _, file := range []string{
+		"",
+		"start,end,user\n2030-03-04 09:00,2030-03-04 10:00,u1\n",
+		"begin,finish,user,interval\n",
+		"start,end,user,interval\n\"unterminated,2030-03-04 10:00,u1,30\n",
+	} {
+		_, _, err := ParseSlotsCSV(strings.NewReader(file), time.UTC)
+		if err != ErrInvalidSlotsCSV {
+			t.Errorf("ParseSlotsCSV(%q) = %v, want ErrInvalidSlotsCSV", file, err)
+		}
+	}
+}
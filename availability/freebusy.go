@@ -0,0 +1,74 @@
+package availability
+
+import (
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// Schedule holds the busy and free ranges of a single user.
+type Schedule struct {
+	Busy []Interval `json:"busy"`
+	Free []Interval `json:"free"`
+}
+
+// FreeBusy is the merged schedule of a group of users.
+type FreeBusy struct {
+	Busy  []Interval          `json:"busy"`
+	Free  []Interval          `json:"free"`
+	Users map[string]Schedule `json:"users"`
+}
+
+// BusyFromMeetings returns the meetings of the given user as intervals.
+func BusyFromMeetings(meetings []models.Meeting, user string) []Interval {
+	busy := []Interval{}
+	for _, element := range meetings {
+		if element.UserId == user {
+			busy = append(busy, Interval{Start: element.StartTime, End: element.EndTime})
+		}
+	}
+	return busy
+}
+
+// UserSchedule computes the schedule of a user inside the window. A user is
+// free during their slots, expanded with the rules of the slot's event and then
+// with the user's own rules, unless a meeting has already been booked there.
+// The user's own blackouts are reported as busy. Meetings and those blackouts,
+// including the ones imported from an ICS calendar, are the only busy times:
+// no external calendar is queried.
+func UserSchedule(user models.User, slots []models.Slot, meetings []models.Meeting, eventRules map[string]Rules, window Interval) Schedule {
+	freeByEvent := make(map[string][]Interval)
+	for _, element := range slots {
+		if element.User == user.DisplayId {
+			freeByEvent[element.EventDisplayId] = append(freeByEvent[element.EventDisplayId], slotInterval(element))
+		}
+	}
+	free := []Interval{}
+	for eventDisplayId, eventFree := range freeByEvent {
+		free = append(free, eventRules[eventDisplayId].Apply(eventFree)...)
+	}
+	rules := UserRules(user)
+	free = rules.Apply(free)
+	busy := append(BusyFromMeetings(meetings, user.DisplayId), rules.BlackoutIntervals()...)
+	busy = Clip(busy, window)
+	return Schedule{
+		Busy: busy,
+		Free: Subtract(Clip(free, window), busy),
+	}
+}
+
+// ComputeFreeBusy merges the schedules of all users, the free ranges are the
+// windows in which every one of the users is free.
+func ComputeFreeBusy(users []models.User, slots []models.Slot, meetings []models.Meeting, eventRules map[string]Rules, window Interval) FreeBusy {
+	result := FreeBusy{
+		Busy:  []Interval{},
+		Free:  []Interval{window},
+		Users: make(map[string]Schedule),
+	}
+	for _, user := range users {
+		schedule := UserSchedule(user, slots, meetings, eventRules, window)
+		result.Users[user.DisplayId] = schedule
+		result.Busy = append(result.Busy, schedule.Busy...)
+		result.Free = Intersect(result.Free, schedule.Free)
+	}
+	result.Busy = Merge(result.Busy)
+	return result
+}
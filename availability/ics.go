@@ -0,0 +1,220 @@
+package availability
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCalendar = errors.New("calendar is not a valid ICS file")
+
+// MaxICSLineLength bounds an unfolded line of a calendar, long descriptions
+// and embedded attachments go well past the 64 KiB a scanner reads by default
+const MaxICSLineLength = 4 * 1024 * 1024
+
+// CalendarEntry is a single VEVENT of an ICS calendar, or a single occurrence
+// of a recurring one.
+type CalendarEntry struct {
+	Summary string
+	Interval
+}
+
+// icsEvent is a VEVENT as read, its times in the time zone they were written
+// in so recurrences keep their wall clock time across DST changes
+type icsEvent struct {
+	summary      string
+	start        time.Time
+	end          time.Time
+	allDay       bool
+	uid          string
+	recurrenceId time.Time
+	rule         string
+	rdates       []time.Time
+	exdates      []time.Time
+	unsupported  string
+}
+
+// ParseICS reads the VEVENT entries of an ICS calendar, such as a public
+// holidays calendar. Floating times and all-day dates are read in the given
+// location and all-day entries without an end last for one day. Recurring
+// entries are expanded into their occurrences inside the window, see
+// expandRecurrence for the rules understood. Entries repeating in a way that
+// can't be expanded make the whole calendar fail with a *RecurrenceError
+// naming them.
+func ParseICS(reader io.Reader, location *time.Location, window Interval) ([]CalendarEntry, error) {
+	lines, err := unfoldICSLines(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []icsEvent{}
+	var current *icsEvent
+	calendar := false
+	for _, line := range lines {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			calendar = true
+		case name == "BEGIN" && value == "VEVENT":
+			current = &icsEvent{}
+		case name == "END" && value == "VEVENT":
+			if current == nil || current.start.IsZero() {
+				return nil, ErrInvalidCalendar
+			}
+			if current.end.IsZero() {
+				if current.allDay {
+					current.end = current.start.AddDate(0, 0, 1)
+				} else {
+					current.end = current.start
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "SUMMARY":
+			current.summary = strings.Replace(strings.Replace(value, "\\,", ",", -1), "\\;", ";", -1)
+		case name == "UID":
+			current.uid = value
+		case name == "DTSTART":
+			current.start, current.allDay, err = parseICSTime(params, value, location)
+			if err != nil {
+				return nil, err
+			}
+		case name == "DTEND":
+			current.end, _, err = parseICSTime(params, value, location)
+			if err != nil {
+				return nil, err
+			}
+		case name == "RECURRENCE-ID":
+			current.recurrenceId, _, err = parseICSTime(params, value, location)
+			if err != nil {
+				return nil, err
+			}
+		case name == "RRULE":
+			if current.rule != "" {
+				current.unsupported = "more than one RRULE"
+			}
+			current.rule = value
+		case name == "EXRULE":
+			current.unsupported = "EXRULE"
+		case name == "RDATE" || name == "EXDATE":
+			if params["VALUE"] == "PERIOD" {
+				current.unsupported = name + " periods"
+				continue
+			}
+			for _, element := range strings.Split(value, ",") {
+				parsed, _, err := parseICSTime(params, element, location)
+				if err != nil {
+					return nil, err
+				}
+				if name == "RDATE" {
+					current.rdates = append(current.rdates, parsed)
+				} else {
+					current.exdates = append(current.exdates, parsed)
+				}
+			}
+		}
+	}
+	if !calendar {
+		return nil, ErrInvalidCalendar
+	}
+
+	// occurrences moved by an entry with a RECURRENCE-ID are left out of the
+	// entry they belong to, the moved entry takes their place
+	moved := make(map[string][]time.Time)
+	for _, element := range events {
+		if !element.recurrenceId.IsZero() {
+			moved[element.uid] = append(moved[element.uid], element.recurrenceId)
+		}
+	}
+	entries := []CalendarEntry{}
+	recurrenceErr := &RecurrenceError{}
+	for _, element := range events {
+		if element.rule == "" && len(element.rdates) == 0 && element.unsupported == "" {
+			entry := CalendarEntry{Summary: element.summary, Interval: Interval{Start: element.start.UTC(), End: element.end.UTC()}}
+			if !entry.Empty() {
+				entries = append(entries, entry)
+			}
+			continue
+		}
+		if element.recurrenceId.IsZero() {
+			element.exdates = append(element.exdates, moved[element.uid]...)
+		}
+		occurrences, err := expandRecurrence(element, window)
+		if err != nil {
+			recurrenceErr.Entries = append(recurrenceErr.Entries, element.summary+": "+err.Error())
+			continue
+		}
+		entries = append(entries, occurrences...)
+	}
+	if len(recurrenceErr.Entries) > 0 {
+		return nil, recurrenceErr
+	}
+	return entries, nil
+}
+
+// unfoldICSLines joins continuation lines, which start with a space or a tab.
+func unfoldICSLines(reader io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxICSLineLength)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func splitICSLine(line string) (string, map[string]string, string) {
+	params := make(map[string]string)
+	colon := strings.Index(line, ":")
+	if colon == -1 {
+		return strings.ToUpper(line), params, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	for _, element := range parts[1:] {
+		pair := strings.SplitN(element, "=", 2)
+		if len(pair) == 2 {
+			params[strings.ToUpper(pair[0])] = strings.Trim(pair[1], "\"")
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseICSTime returns the time in the time zone it was written in, UTC for
+// times ending in Z
+func parseICSTime(params map[string]string, value string, location *time.Location) (time.Time, bool, error) {
+	if tzid, ok := params["TZID"]; ok {
+		loaded, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, ErrInvalidCalendar
+		}
+		location = loaded
+	}
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		parsed, err := time.ParseInLocation("20060102", value, location)
+		if err != nil {
+			return time.Time{}, false, ErrInvalidCalendar
+		}
+		return parsed, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		location = time.UTC
+		value = strings.TrimSuffix(value, "Z")
+	}
+	parsed, err := time.ParseInLocation("20060102T150405", value, location)
+	if err != nil {
+		return time.Time{}, false, ErrInvalidCalendar
+	}
+	return parsed, false, nil
+}
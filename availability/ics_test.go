@@ -0,0 +1,127 @@
+package availability
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func calendar(events ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + strings.Join(events, "") + "END:VCALENDAR\r\n"
+}
+
+func TestParseICS(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	window := Interval{Start: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2032, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name     string
+		calendar string
+		want     []string
+	}{
+		{
+			"single all-day entry",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:New Year\\, observed\r\nDTSTART;VALUE=DATE:20300101\r\nEND:VEVENT\r\n"),
+			[]string{"New Year, observed 2030-01-01 00:00 EST - 2030-01-02 00:00 EST"},
+		},
+		{
+			"folded line",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:Long\r\n  name\r\nDTSTART:20300102T150000Z\r\nDTEND:20300102T160000Z\r\nEND:VEVENT\r\n"),
+			[]string{"Long name 2030-01-02 10:00 EST - 2030-01-02 11:00 EST"},
+		},
+		{
+			"yearly holiday on a weekday of a month",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:Thanksgiving\r\nDTSTART;VALUE=DATE:20001123\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=4TH\r\nEND:VEVENT\r\n"),
+			[]string{
+				"Thanksgiving 2030-11-28 00:00 EST - 2030-11-29 00:00 EST",
+				"Thanksgiving 2031-11-27 00:00 EST - 2031-11-28 00:00 EST",
+			},
+		},
+		{
+			"weekly entry keeps its wall clock time across DST, with exceptions and a moved occurrence",
+			calendar(
+				"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\nDTSTART;TZID=America/New_York:20300304T090000\r\nDTEND;TZID=America/New_York:20300304T091500\r\n"+
+					"RRULE:FREQ=WEEKLY;COUNT=4\r\nEXDATE;TZID=America/New_York:20300318T090000\r\nEND:VEVENT\r\n",
+				"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup moved\r\nRECURRENCE-ID;TZID=America/New_York:20300311T090000\r\n"+
+					"DTSTART;TZID=America/New_York:20300311T100000\r\nDTEND;TZID=America/New_York:20300311T101500\r\nEND:VEVENT\r\n",
+			),
+			[]string{
+				"Standup 2030-03-04 09:00 EST - 2030-03-04 09:15 EST",
+				"Standup 2030-03-25 09:00 EDT - 2030-03-25 09:15 EDT",
+				"Standup moved 2030-03-11 10:00 EDT - 2030-03-11 10:15 EDT",
+			},
+		},
+		{
+			"monthly on the last friday until a date, with an added date",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:Review\r\nDTSTART:20300125T170000Z\r\nDTEND:20300125T180000Z\r\n" +
+				"RRULE:FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20300331T000000Z\r\nRDATE:20300601T170000Z\r\nEND:VEVENT\r\n"),
+			[]string{
+				"Review 2030-01-25 12:00 EST - 2030-01-25 13:00 EST",
+				"Review 2030-02-22 12:00 EST - 2030-02-22 13:00 EST",
+				"Review 2030-03-29 13:00 EDT - 2030-03-29 14:00 EDT",
+				"Review 2030-06-01 13:00 EDT - 2030-06-01 14:00 EDT",
+			},
+		},
+		{
+			"monthly skips months without the day",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:Month end\r\nDTSTART;VALUE=DATE:20300131\r\nRRULE:FREQ=MONTHLY;COUNT=3\r\nEND:VEVENT\r\n"),
+			[]string{
+				"Month end 2030-01-31 00:00 EST - 2030-02-01 00:00 EST",
+				"Month end 2030-03-31 00:00 EDT - 2030-04-01 00:00 EDT",
+				"Month end 2030-05-31 00:00 EDT - 2030-06-01 00:00 EDT",
+			},
+		},
+		{
+			"occurrences outside the window are left out",
+			calendar("BEGIN:VEVENT\r\nSUMMARY:Daily\r\nDTSTART;VALUE=DATE:20311229\r\nRRULE:FREQ=DAILY;INTERVAL=2\r\nEND:VEVENT\r\n"),
+			[]string{
+				"Daily 2031-12-29 00:00 EST - 2031-12-30 00:00 EST",
+				"Daily 2031-12-31 00:00 EST - 2032-01-01 00:00 EST",
+			},
+		},
+	}
+	for _, test := range tests {
+		entries, err := ParseICS(strings.NewReader(test.calendar), newYork, window)
+		if err != nil {
+			t.Errorf("%s: ParseICS() failed: %v", test.name, err)
+			continue
+		}
+		got := []string{}
+		for _, element := range entries {
+			got = append(got, element.Summary+" "+element.Start.In(newYork).Format("2006-01-02 15:04 MST")+" - "+element.End.In(newYork).Format("2006-01-02 15:04 MST"))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ParseICS() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	window := Interval{Start: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	_, err := ParseICS(strings.NewReader("BEGIN:VEVENT\r\nDTSTART:20300101\r\nEND:VEVENT\r\n"), time.UTC, window)
+	if err != ErrInvalidCalendar {
+		t.Errorf("without a calendar: got %v, want ErrInvalidCalendar", err)
+	}
+
+	_, err = ParseICS(strings.NewReader(calendar(
+		"BEGIN:VEVENT\r\nSUMMARY:Hourly\r\nDTSTART:20300101T090000Z\r\nRRULE:FREQ=HOURLY\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nSUMMARY:First monday\r\nDTSTART:20300101T090000Z\r\nRRULE:FREQ=MONTHLY;BYDAY=MO;BYSETPOS=1\r\nEND:VEVENT\r\n",
+		"BEGIN:VEVENT\r\nSUMMARY:Fine\r\nDTSTART:20300101T090000Z\r\nRRULE:FREQ=DAILY;COUNT=2\r\nEND:VEVENT\r\n",
+	)), time.UTC, window)
+	recurrenceErr, ok := err.(*RecurrenceError)
+	if !ok {
+		t.Fatalf("unsupported rules: got %v, want a *RecurrenceError", err)
+	}
+	if len(recurrenceErr.Entries) != 2 || !strings.HasPrefix(recurrenceErr.Entries[0], "Hourly:") || !strings.HasPrefix(recurrenceErr.Entries[1], "First monday:") {
+		t.Errorf("unsupported rules: got %v, want the hourly and the first monday entries", recurrenceErr.Entries)
+	}
+
+	long := "BEGIN:VEVENT\r\nDESCRIPTION:" + strings.Repeat("x", 200*1024) + "\r\nDTSTART:20300101T090000Z\r\nDTEND:20300101T100000Z\r\nEND:VEVENT\r\n"
+	entries, err := ParseICS(strings.NewReader(calendar(long)), time.UTC, window)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("line longer than 64 KiB: got %v entries and %v", len(entries), err)
+	}
+}
@@ -0,0 +1,107 @@
+package availability
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval is a half open time range [Start, End).
+type Interval struct {
+	Start time.Time `json:"start_time"`
+	End   time.Time `json:"end_time"`
+}
+
+func (i Interval) Empty() bool {
+	return !i.End.After(i.Start)
+}
+
+func (i Interval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+func (i Interval) Contains(other Interval) bool {
+	return !other.Start.Before(i.Start) && !other.End.After(i.End)
+}
+
+func (i Interval) Overlaps(other Interval) bool {
+	return i.Start.Before(other.End) && other.Start.Before(i.End)
+}
+
+// Merge sorts the intervals and joins the overlapping and adjacent ones.
+func Merge(intervals []Interval) []Interval {
+	sorted := []Interval{}
+	for _, element := range intervals {
+		if !element.Empty() {
+			sorted = append(sorted, element)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Start.Before(sorted[b].Start)
+	})
+
+	merged := []Interval{}
+	for _, element := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !element.Start.After(merged[last].End) {
+			if element.End.After(merged[last].End) {
+				merged[last].End = element.End
+			}
+			continue
+		}
+		merged = append(merged, element)
+	}
+	return merged
+}
+
+// Subtract removes every range in remove from the ranges in from.
+func Subtract(from []Interval, remove []Interval) []Interval {
+	remaining := Merge(from)
+	for _, cut := range Merge(remove) {
+		next := []Interval{}
+		for _, element := range remaining {
+			if !element.Overlaps(cut) {
+				next = append(next, element)
+				continue
+			}
+			if element.Start.Before(cut.Start) {
+				next = append(next, Interval{Start: element.Start, End: cut.Start})
+			}
+			if element.End.After(cut.End) {
+				next = append(next, Interval{Start: cut.End, End: element.End})
+			}
+		}
+		remaining = next
+	}
+	return remaining
+}
+
+// Intersect returns the ranges covered by both a and b.
+func Intersect(a []Interval, b []Interval) []Interval {
+	a = Merge(a)
+	b = Merge(b)
+	result := []Interval{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start := a[i].Start
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		end := a[i].End
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if start.Before(end) {
+			result = append(result, Interval{Start: start, End: end})
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// Clip cuts the intervals to the given window.
+func Clip(intervals []Interval, window Interval) []Interval {
+	return Intersect(intervals, []Interval{window})
+}
@@ -0,0 +1,101 @@
+package availability
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testDay = time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+
+// hours is the interval between two hours of testDay
+func hours(start float64, end float64) Interval {
+	return Interval{Start: testDay.Add(time.Duration(start * float64(time.Hour))), End: testDay.Add(time.Duration(end * float64(time.Hour)))}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		want      []Interval
+	}{
+		{"empty", []Interval{}, []Interval{}},
+		{"single", []Interval{hours(9, 10)}, []Interval{hours(9, 10)}},
+		{"disjoint are sorted", []Interval{hours(11, 12), hours(9, 10)}, []Interval{hours(9, 10), hours(11, 12)}},
+		{"adjacent are joined", []Interval{hours(9, 10), hours(10, 11)}, []Interval{hours(9, 11)}},
+		{"overlapping are joined", []Interval{hours(9, 11), hours(10, 12)}, []Interval{hours(9, 12)}},
+		{"contained is absorbed", []Interval{hours(9, 12), hours(10, 11)}, []Interval{hours(9, 12)}},
+		{"empty intervals are dropped", []Interval{hours(9, 9), hours(11, 10), hours(12, 13)}, []Interval{hours(12, 13)}},
+	}
+	for _, test := range tests {
+		got := Merge(test.intervals)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Merge() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   []Interval
+		remove []Interval
+		want   []Interval
+	}{
+		{"nothing to remove", []Interval{hours(9, 12)}, []Interval{}, []Interval{hours(9, 12)}},
+		{"nothing to remove from", []Interval{}, []Interval{hours(9, 12)}, []Interval{}},
+		{"middle splits", []Interval{hours(9, 12)}, []Interval{hours(10, 11)}, []Interval{hours(9, 10), hours(11, 12)}},
+		{"start cut", []Interval{hours(9, 12)}, []Interval{hours(8, 10)}, []Interval{hours(10, 12)}},
+		{"end cut", []Interval{hours(9, 12)}, []Interval{hours(11, 13)}, []Interval{hours(9, 11)}},
+		{"adjacent keeps everything", []Interval{hours(9, 12)}, []Interval{hours(12, 13), hours(8, 9)}, []Interval{hours(9, 12)}},
+		{"whole range removed", []Interval{hours(9, 12)}, []Interval{hours(9, 12)}, []Interval{}},
+		{"several cuts", []Interval{hours(9, 17)}, []Interval{hours(10, 11), hours(13, 14)}, []Interval{hours(9, 10), hours(11, 13), hours(14, 17)}},
+	}
+	for _, test := range tests {
+		got := Subtract(test.from, test.remove)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Subtract() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []Interval
+		b    []Interval
+		want []Interval
+	}{
+		{"empty", []Interval{}, []Interval{hours(9, 12)}, []Interval{}},
+		{"overlapping", []Interval{hours(9, 12)}, []Interval{hours(11, 14)}, []Interval{hours(11, 12)}},
+		{"adjacent share nothing", []Interval{hours(9, 12)}, []Interval{hours(12, 14)}, []Interval{}},
+		{"contained", []Interval{hours(9, 17)}, []Interval{hours(10, 11), hours(13, 14)}, []Interval{hours(10, 11), hours(13, 14)}},
+		{"several on both sides", []Interval{hours(9, 11), hours(13, 15)}, []Interval{hours(10, 14)}, []Interval{hours(10, 11), hours(13, 14)}},
+	}
+	for _, test := range tests {
+		got := Intersect(test.a, test.b)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Intersect() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClip(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		window    Interval
+		want      []Interval
+	}{
+		{"inside", []Interval{hours(10, 11)}, hours(9, 12), []Interval{hours(10, 11)}},
+		{"cut at both ends", []Interval{hours(8, 10), hours(11, 13)}, hours(9, 12), []Interval{hours(9, 10), hours(11, 12)}},
+		{"outside", []Interval{hours(6, 9), hours(12, 13)}, hours(9, 12), []Interval{}},
+		{"empty window", []Interval{hours(6, 9)}, hours(7, 7), []Interval{}},
+	}
+	for _, test := range tests {
+		got := Clip(test.intervals, test.window)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Clip() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package availability
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences bounds the occurrences a single recurring entry expands into
+const MaxOccurrences = 1000
+
+// RecurrenceError names the calendar entries whose recurrence can't be
+// expanded, rather than importing them as a single occurrence.
+type RecurrenceError struct {
+	Entries []string
+}
+
+func (err *RecurrenceError) Error() string {
+	return "calendar entries repeat in an unsupported way: " + strings.Join(err.Entries, "; ")
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// recurrenceRule is the part of an RRULE expandRecurrence understands
+type recurrenceRule struct {
+	frequency  string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []icsWeekday
+	byMonth    []int
+	byMonthDay []int
+	weekStart  time.Weekday
+}
+
+// icsWeekday is a BYDAY value, an ordinal of 0 stands for every such weekday
+type icsWeekday struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+// expandRecurrence returns the occurrences of a recurring entry that overlap
+// the window. RRULE is understood with a DAILY, WEEKLY, MONTHLY or YEARLY
+// frequency, INTERVAL, COUNT, UNTIL, WKST and the BYDAY, BYMONTH and
+// BYMONTHDAY parts, other parts are reported as unsupported. RDATE adds
+// occurrences and EXDATE removes them. Occurrences keep the wall clock time of
+// the first one in its time zone and its length.
+func expandRecurrence(event icsEvent, window Interval) ([]CalendarEntry, error) {
+	if event.unsupported != "" {
+		return nil, errors.New(event.unsupported)
+	}
+	starts := []time.Time{event.start}
+	if event.rule != "" {
+		rule, err := parseRecurrenceRule(event.rule, event.start.Location())
+		if err != nil {
+			return nil, err
+		}
+		starts = rule.starts(event.start, window.Start.Add(-event.end.Sub(event.start)), window.End)
+	}
+	starts = append(starts, event.rdates...)
+
+	excluded := make(map[int64]bool)
+	for _, element := range event.exdates {
+		excluded[element.Unix()] = true
+	}
+	seen := make(map[int64]bool)
+	entries := []CalendarEntry{}
+	for _, start := range starts {
+		if excluded[start.Unix()] || seen[start.Unix()] {
+			continue
+		}
+		seen[start.Unix()] = true
+		end := start.Add(event.end.Sub(event.start))
+		if event.allDay {
+			// whole days, which are not always 24 hours long
+			end = start.AddDate(0, 0, int(event.end.Sub(event.start).Hours()/24+0.5))
+		}
+		entry := CalendarEntry{Summary: event.summary, Interval: Interval{Start: start.UTC(), End: end.UTC()}}
+		if !entry.Empty() && entry.Overlaps(window) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Start.Before(entries[j].Start) })
+	return entries, nil
+}
+
+func parseRecurrenceRule(value string, location *time.Location) (recurrenceRule, error) {
+	rule := recurrenceRule{interval: 1, weekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return rule, fmt.Errorf("RRULE part %q is not valid", part)
+		}
+		name, value := strings.ToUpper(pair[0]), strings.ToUpper(pair[1])
+		var err error
+		switch name {
+		case "FREQ":
+			rule.frequency = value
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(value)
+			if err == nil && rule.interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(value)
+			if err == nil && rule.count < 1 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			rule.until, _, err = parseICSTime(map[string]string{}, value, location)
+		case "WKST":
+			weekday, ok := icsWeekdays[value]
+			if !ok {
+				err = errors.New("is not a weekday")
+			}
+			rule.weekStart = weekday
+		case "BYDAY":
+			for _, element := range strings.Split(value, ",") {
+				if len(element) < 2 {
+					err = errors.New("is not a weekday")
+					break
+				}
+				weekday, ok := icsWeekdays[element[len(element)-2:]]
+				if !ok {
+					err = errors.New("is not a weekday")
+					break
+				}
+				day := icsWeekday{weekday: weekday}
+				if ordinal := element[:len(element)-2]; ordinal != "" {
+					day.ordinal, err = strconv.Atoi(ordinal)
+					if err != nil || day.ordinal == 0 || day.ordinal < -5 || day.ordinal > 5 {
+						err = errors.New("has an ordinal outside of a month")
+						break
+					}
+				}
+				rule.byDay = append(rule.byDay, day)
+			}
+		case "BYMONTH":
+			rule.byMonth, err = parseRuleNumbers(value, 1, 12)
+		case "BYMONTHDAY":
+			rule.byMonthDay, err = parseRuleNumbers(value, -31, 31)
+		default:
+			return rule, fmt.Errorf("RRULE part %s is not supported", name)
+		}
+		if err != nil {
+			return rule, fmt.Errorf("RRULE part %s %s", name, err)
+		}
+	}
+	switch rule.frequency {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return rule, fmt.Errorf("RRULE frequency %q is not supported", rule.frequency)
+	}
+	for _, element := range rule.byDay {
+		if element.ordinal != 0 && (rule.frequency == "DAILY" || rule.frequency == "WEEKLY" || len(rule.byMonthDay) > 0) {
+			return rule, errors.New("RRULE part BYDAY with an ordinal is only supported by itself in a month")
+		}
+	}
+	if rule.frequency == "YEARLY" && len(rule.byDay) > 0 && len(rule.byMonth) == 0 {
+		return rule, errors.New("RRULE part BYDAY of a YEARLY rule is only supported with BYMONTH")
+	}
+	return rule, nil
+}
+
+func parseRuleNumbers(value string, min int, max int) ([]int, error) {
+	numbers := []int{}
+	for _, element := range strings.Split(value, ",") {
+		number, err := strconv.Atoi(element)
+		if err != nil || number == 0 || number < min || number > max {
+			return nil, fmt.Errorf("value %q is out of range", element)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// starts returns the start of every occurrence of the rule from the first
+// one, which is an occurrence whether or not it matches the rule, until the
+// rule ends or the window does. Occurrences starting before from are counted
+// for COUNT but left out.
+func (rule recurrenceRule) starts(first time.Time, from time.Time, before time.Time) []time.Time {
+	starts := []time.Time{first}
+	count := 1
+	for period := 0; len(starts) < MaxOccurrences; period++ {
+		candidates, periodStart := rule.period(first, period*rule.interval)
+		if !periodStart.Before(before) {
+			break
+		}
+		for _, element := range candidates {
+			if !element.After(first) {
+				continue
+			}
+			if (!rule.until.IsZero() && element.After(rule.until)) || (rule.count > 0 && count >= rule.count) || !element.Before(before) {
+				return starts
+			}
+			count++
+			if !element.Before(from) {
+				starts = append(starts, element)
+			}
+		}
+	}
+	return starts
+}
+
+// period returns the candidate starts of the period the given number of
+// frequency units after the first occurrence, sorted, and when the period
+// starts. Period 0 is the period of the first occurrence.
+func (rule recurrenceRule) period(first time.Time, units int) ([]time.Time, time.Time) {
+	year, month, day := first.Date()
+	hour, minute, second := first.Clock()
+	location := first.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, location)
+	}
+	candidates := []time.Time{}
+	var periodStart time.Time
+	switch rule.frequency {
+	case "DAILY":
+		periodStart = time.Date(year, month, day+units, 0, 0, 0, 0, location)
+		candidates = append(candidates, at(year, month, day+units))
+	case "WEEKLY":
+		offset := (int(first.Weekday()) - int(rule.weekStart) + 7) % 7
+		weekStart := day - offset + 7*units
+		periodStart = time.Date(year, month, weekStart, 0, 0, 0, 0, location)
+		weekdays := []time.Weekday{first.Weekday()}
+		if len(rule.byDay) > 0 {
+			weekdays = []time.Weekday{}
+			for _, element := range rule.byDay {
+				weekdays = append(weekdays, element.weekday)
+			}
+		}
+		for _, weekday := range weekdays {
+			candidates = append(candidates, at(year, month, weekStart+(int(weekday)-int(rule.weekStart)+7)%7))
+		}
+	case "MONTHLY":
+		periodStart = time.Date(year, month+time.Month(units), 1, 0, 0, 0, 0, location)
+		candidates = rule.monthDays(periodStart.Year(), periodStart.Month(), day, at)
+	case "YEARLY":
+		periodStart = time.Date(year+units, time.January, 1, 0, 0, 0, 0, location)
+		months := rule.byMonth
+		if len(months) == 0 {
+			months = []int{int(month)}
+		}
+		for _, element := range months {
+			candidates = append(candidates, rule.monthDays(year+units, time.Month(element), day, at)...)
+		}
+	}
+
+	filtered := []time.Time{}
+	for _, element := range candidates {
+		if rule.matches(element) {
+			filtered = append(filtered, element)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Before(filtered[j]) })
+	return filtered, periodStart
+}
+
+// monthDays returns the candidate days of a month, the BYMONTHDAY days, the
+// BYDAY days or else the day of the month of the first occurrence. Days the
+// month doesn't have are skipped.
+func (rule recurrenceRule) monthDays(year int, month time.Month, day int, at func(int, time.Month, int) time.Time) []time.Time {
+	length := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	days := []int{}
+	switch {
+	case len(rule.byMonthDay) > 0:
+		for _, element := range rule.byMonthDay {
+			if element < 0 {
+				element = length + element + 1
+			}
+			days = append(days, element)
+		}
+	case len(rule.byDay) > 0:
+		firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+		for _, element := range rule.byDay {
+			matching := []int{}
+			for candidate := 1 + (int(element.weekday)-int(firstWeekday)+7)%7; candidate <= length; candidate += 7 {
+				matching = append(matching, candidate)
+			}
+			switch {
+			case element.ordinal == 0:
+				days = append(days, matching...)
+			case element.ordinal > 0 && element.ordinal <= len(matching):
+				days = append(days, matching[element.ordinal-1])
+			case element.ordinal < 0 && -element.ordinal <= len(matching):
+				days = append(days, matching[len(matching)+element.ordinal])
+			}
+		}
+	default:
+		days = append(days, day)
+	}
+	candidates := []time.Time{}
+	for _, element := range days {
+		if element >= 1 && element <= length {
+			candidates = append(candidates, at(year, month, element))
+		}
+	}
+	return candidates
+}
+
+// matches applies the BY parts that limit the candidates of a period rather
+// than generate them
+func (rule recurrenceRule) matches(candidate time.Time) bool {
+	if len(rule.byMonth) > 0 && !containsInt(rule.byMonth, int(candidate.Month())) {
+		return false
+	}
+	generatedByMonthDay := rule.frequency == "MONTHLY" || rule.frequency == "YEARLY"
+	generatedByDay := rule.frequency == "WEEKLY" || (generatedByMonthDay && len(rule.byMonthDay) == 0)
+	if len(rule.byDay) > 0 && !generatedByDay {
+		found := false
+		for _, element := range rule.byDay {
+			if element.weekday == candidate.Weekday() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.byMonthDay) > 0 && !generatedByMonthDay {
+		length := time.Date(candidate.Year(), candidate.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		found := false
+		for _, element := range rule.byMonthDay {
+			if element == candidate.Day() || element == candidate.Day()-length-1 {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(values []int, value int) bool {
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
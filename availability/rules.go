@@ -0,0 +1,87 @@
+package availability
+
+import (
+	"time"
+
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+const overrideDateLayout = "2006-01-02"
+
+// Rules are the blackouts and date overrides of a user or of an event.
+type Rules struct {
+	Blackouts     []models.Blackout
+	DateOverrides []models.DateOverride
+}
+
+func UserRules(user models.User) Rules {
+	return Rules{Blackouts: user.Blackouts, DateOverrides: user.DateOverrides}
+}
+
+func EventRules(event models.Event) Rules {
+	return Rules{Blackouts: event.Blackouts, DateOverrides: event.DateOverrides}
+}
+
+// EventRulesByDisplayId maps the display id of every event to its rules
+func EventRulesByDisplayId(events []models.Event) map[string]Rules {
+	rules := make(map[string]Rules)
+	for _, element := range events {
+		rules[element.DisplayId] = EventRules(element)
+	}
+	return rules
+}
+
+// OverrideDay returns the whole day the override applies to, in the time zone
+// of the override.
+func OverrideDay(override models.DateOverride) (Interval, error) {
+	location, err := time.LoadLocation(override.TimeZone)
+	if err != nil {
+		return Interval{}, err
+	}
+	day, err := time.ParseInLocation(overrideDateLayout, override.Date, location)
+	if err != nil {
+		return Interval{}, err
+	}
+	return Interval{Start: day.UTC(), End: day.AddDate(0, 0, 1).UTC()}, nil
+}
+
+// OverrideHours returns the range between two clock times of the override's
+// day, e.g. 9:00 to 17:00. The times are wall clock times in the time zone of
+// the override, so they stay right on the days the clocks change.
+func OverrideHours(override models.DateOverride, start time.Duration, end time.Duration) (Interval, error) {
+	location, err := time.LoadLocation(override.TimeZone)
+	if err != nil {
+		return Interval{}, err
+	}
+	day, err := time.ParseInLocation(overrideDateLayout, override.Date, location)
+	if err != nil {
+		return Interval{}, err
+	}
+	clock := func(offset time.Duration) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, location).UTC()
+	}
+	return Interval{Start: clock(start), End: clock(end)}, nil
+}
+
+func (rules Rules) BlackoutIntervals() []Interval {
+	blackouts := []Interval{}
+	for _, element := range rules.Blackouts {
+		blackouts = append(blackouts, Interval{Start: element.StartTime, End: element.EndTime})
+	}
+	return blackouts
+}
+
+// Apply narrows the free ranges with the rules: on overridden days only the
+// free ranges inside the override hours are kept and blacked out ranges are
+// removed. The rules never make a user free outside of their slots.
+func (rules Rules) Apply(free []Interval) []Interval {
+	for _, element := range rules.DateOverrides {
+		day, err := OverrideDay(element)
+		if err != nil {
+			continue
+		}
+		hours := Clip([]Interval{{Start: element.StartTime, End: element.EndTime}}, day)
+		free = append(Subtract(free, []Interval{day}), Intersect(Clip(free, day), hours)...)
+	}
+	return Subtract(free, rules.BlackoutIntervals())
+}
@@ -0,0 +1,116 @@
+package availability
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func TestRulesApply(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the clocks in New York moved forward on 2030-03-10, a 23 hour day
+	shortDayStart := time.Date(2030, time.March, 10, 0, 0, 0, 0, newYork)
+	shortDay := Interval{Start: shortDayStart.UTC(), End: shortDayStart.AddDate(0, 0, 1).UTC()}
+	nineToFive := func(day time.Time) Interval {
+		return Interval{
+			Start: time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, day.Location()).UTC(),
+			End:   time.Date(day.Year(), day.Month(), day.Day(), 17, 0, 0, 0, day.Location()).UTC(),
+		}
+	}
+	tests := []struct {
+		name  string
+		rules Rules
+		free  []Interval
+		want  []Interval
+	}{
+		{"no rules", Rules{}, []Interval{hours(9, 12)}, []Interval{hours(9, 12)}},
+		{
+			"blackout cuts the free range",
+			Rules{Blackouts: []models.Blackout{{StartTime: hours(10, 11).Start, EndTime: hours(10, 11).End}}},
+			[]Interval{hours(9, 12)},
+			[]Interval{hours(9, 10), hours(11, 12)},
+		},
+		{
+			"adjacent blackout changes nothing",
+			Rules{Blackouts: []models.Blackout{{StartTime: hours(12, 13).Start, EndTime: hours(12, 13).End}}},
+			[]Interval{hours(9, 12)},
+			[]Interval{hours(9, 12)},
+		},
+		{
+			"override limits the hours of the day",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-04", TimeZone: "UTC", StartTime: hours(10, 16).Start, EndTime: hours(10, 16).End}}},
+			[]Interval{hours(9, 12), hours(24+9, 24+12)},
+			[]Interval{hours(10, 12), hours(24+9, 24+12)},
+		},
+		{
+			"override outside the free ranges leaves nothing free",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-04", TimeZone: "UTC", StartTime: hours(14, 16).Start, EndTime: hours(14, 16).End}}},
+			[]Interval{hours(9, 12), hours(24+9, 24+12)},
+			[]Interval{hours(24+9, 24+12)},
+		},
+		{
+			"override with equal times closes the day",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-04", TimeZone: "UTC", StartTime: hours(9, 9).Start, EndTime: hours(9, 9).Start}}},
+			[]Interval{hours(9, 12)},
+			[]Interval{},
+		},
+		{
+			"override only narrows its own day",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-04", TimeZone: "UTC", StartTime: hours(20, 26).Start, EndTime: hours(20, 26).End}}},
+			[]Interval{hours(18, 24+3)},
+			[]Interval{hours(20, 24+3)},
+		},
+		{
+			"override on a DST day covers the 23 hours of the day",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-10", TimeZone: "America/New_York", StartTime: nineToFive(shortDayStart).Start, EndTime: nineToFive(shortDayStart).End}}},
+			[]Interval{shortDay, {Start: shortDay.End, End: shortDay.End.Add(time.Hour)}},
+			[]Interval{nineToFive(shortDayStart), {Start: shortDay.End, End: shortDay.End.Add(time.Hour)}},
+		},
+		{
+			"override with an unknown time zone is ignored",
+			Rules{DateOverrides: []models.DateOverride{{Date: "2030-03-04", TimeZone: "Mars/Olympus", StartTime: hours(14, 16).Start, EndTime: hours(14, 16).End}}},
+			[]Interval{hours(9, 12)},
+			[]Interval{hours(9, 12)},
+		},
+	}
+	for _, test := range tests {
+		got := test.rules.Apply(test.free)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Apply() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOverrideHours(t *testing.T) {
+	tests := []struct {
+		name     string
+		override models.DateOverride
+		want     Interval
+	}{
+		{"UTC", models.DateOverride{Date: "2030-03-04", TimeZone: "UTC"}, hours(9, 17)},
+		{
+			"clocks move forward in the night",
+			models.DateOverride{Date: "2030-03-10", TimeZone: "America/New_York"},
+			Interval{Start: time.Date(2030, time.March, 10, 13, 0, 0, 0, time.UTC), End: time.Date(2030, time.March, 10, 21, 0, 0, 0, time.UTC)},
+		},
+		{
+			"clocks move back in the night",
+			models.DateOverride{Date: "2030-11-03", TimeZone: "America/New_York"},
+			Interval{Start: time.Date(2030, time.November, 3, 14, 0, 0, 0, time.UTC), End: time.Date(2030, time.November, 3, 22, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, test := range tests {
+		got, err := OverrideHours(test.override, 9*time.Hour, 17*time.Hour)
+		if err != nil || got != test.want {
+			t.Errorf("%s: OverrideHours() = %v %v, want %v", test.name, got, err, test.want)
+		}
+	}
+	if _, err := OverrideHours(models.DateOverride{Date: "2030-03-04", TimeZone: "Mars/Olympus"}, 9*time.Hour, 17*time.Hour); err == nil {
+		t.Errorf("OverrideHours() with an unknown time zone succeeded")
+	}
+}
@@ -0,0 +1,172 @@
+package availability
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// SlotError describes why a single slot was rejected. Index is the position of
+// the slot in the request, Row its row in an imported CSV file.
+type SlotError struct {
+	Index     int    `json:"index"`
+	Row       int    `json:"row,omitempty"`
+	DisplayId string `json:"display_id,omitempty"`
+	Field     string `json:"field"`
+	Message   string `json:"message"`
+}
+
+func slotInterval(slot models.Slot) Interval {
+	return Interval{Start: slot.StartTime, End: slot.EndTime}
+}
+
+func newSlotError(index int, slot models.Slot, field string, err error) SlotError {
+	return SlotError{Index: index, DisplayId: slot.DisplayId, Field: field, Message: err.Error()}
+}
+
+// ValidateSlots checks the added slots on their own and against the existing
+// slots and the added slots before them. In merge mode overlapping and
+// adjacent slots of the same user and interval are accepted since MergeSlots
+// joins them.
+func ValidateSlots(existing []models.Slot, added []models.Slot, merge bool) []SlotError {
+	errors := []SlotError{}
+	for index, slot := range added {
+		if slot.User == "" {
+			errors = append(errors, newSlotError(index, slot, "user", helpers.SlotsErrorNoUser))
+		}
+		if slot.Interval == 0 {
+			errors = append(errors, newSlotError(index, slot, "interval", helpers.SlotsErrorNoInterval))
+		}
+		if slotInterval(slot).Empty() {
+			errors = append(errors, newSlotError(index, slot, "end_time", helpers.SlotsErrorInvalidRange))
+			continue
+		}
+		if time.Duration(slot.Interval)*time.Minute > slotInterval(slot).Duration() {
+			errors = append(errors, newSlotError(index, slot, "interval", helpers.SlotsErrorIntervalTooLong))
+		}
+
+		others := append(append([]models.Slot{}, existing...), added[:index]...)
+		for _, other := range others {
+			if other.User != slot.User || slotInterval(other).Empty() {
+				continue
+			}
+			if other.StartTime.Equal(slot.StartTime) && other.EndTime.Equal(slot.EndTime) && !merge {
+				errors = append(errors, newSlotError(index, slot, "start_time", helpers.SlotsErrorDuplicate))
+				break
+			}
+			if slotInterval(other).Overlaps(slotInterval(slot)) && !(merge && other.Interval == slot.Interval) {
+				errors = append(errors, newSlotError(index, slot, "start_time", helpers.SlotsErrorOverlap))
+				break
+			}
+		}
+	}
+	return errors
+}
+
+// MergeSlots normalizes the overlapping and adjacent slots of the same user and
+// interval into canonical ranges. A merged slot keeps the id of its earliest
+// existing part, so existing slots keep their display ids even when an added
+// slot extends them to an earlier start, and the id of its earliest added
+// part when it has no existing one.
+func MergeSlots(existing []models.Slot, added []models.Slot) []models.Slot {
+	type part struct {
+		slot     models.Slot
+		existing bool
+	}
+	sorted := []part{}
+	for _, element := range existing {
+		sorted = append(sorted, part{slot: element, existing: true})
+	}
+	for _, element := range added {
+		sorted = append(sorted, part{slot: element})
+	}
+	sort.SliceStable(sorted, func(a, b int) bool {
+		if sorted[a].slot.User != sorted[b].slot.User {
+			return sorted[a].slot.User < sorted[b].slot.User
+		}
+		if sorted[a].slot.Interval != sorted[b].slot.Interval {
+			return sorted[a].slot.Interval < sorted[b].slot.Interval
+		}
+		return sorted[a].slot.StartTime.Before(sorted[b].slot.StartTime)
+	})
+
+	merged := []models.Slot{}
+	survivorExisting := false
+	for _, element := range sorted {
+		slot := element.slot
+		last := len(merged) - 1
+		if last >= 0 && merged[last].User == slot.User && merged[last].Interval == slot.Interval && !slot.StartTime.After(merged[last].EndTime) {
+			if element.existing && !survivorExisting {
+				// the existing slot takes over the range and keeps its id
+				slot.StartTime = merged[last].StartTime
+				if merged[last].EndTime.After(slot.EndTime) {
+					slot.EndTime = merged[last].EndTime
+				}
+				slot.UpdatedAt = time.Now().UTC()
+				merged[last] = slot
+				survivorExisting = true
+				continue
+			}
+			if slot.EndTime.After(merged[last].EndTime) {
+				merged[last].EndTime = slot.EndTime
+				merged[last].UpdatedAt = time.Now().UTC()
+			}
+			continue
+		}
+		merged = append(merged, slot)
+		survivorExisting = element.existing
+	}
+	return merged
+}
+
+// OrphanedMeetings returns the meetings that were booked inside one of the
+// slots before a change and no longer fit inside a slot of their user after it.
+func OrphanedMeetings(before []models.Slot, after []models.Slot, meetings []models.Meeting) []models.Meeting {
+	orphaned := []models.Meeting{}
+	for _, meeting := range meetings {
+		booked := Interval{Start: meeting.StartTime, End: meeting.EndTime}
+		if !insideUserSlot(before, meeting.UserId, booked) {
+			continue
+		}
+		if !insideUserSlot(after, meeting.UserId, booked) {
+			orphaned = append(orphaned, meeting)
+		}
+	}
+	return orphaned
+}
+
+func insideUserSlot(slots []models.Slot, user string, booked Interval) bool {
+	for _, slot := range slots {
+		if slot.User == user && slotInterval(slot).Contains(booked) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bookable tells whether a meeting can be booked with the user: it has to take
+// one interval of a slot of the user, starting a whole number of intervals
+// after the start of the slot, and lie inside the free ranges of the user.
+func Bookable(slots []models.Slot, user string, booked Interval, free []Interval) bool {
+	inFree := false
+	for _, element := range free {
+		if element.Contains(booked) {
+			inFree = true
+		}
+	}
+	if !inFree {
+		return false
+	}
+	for _, slot := range slots {
+		interval := time.Duration(slot.Interval) * time.Minute
+		if slot.User != user || interval <= 0 || !slotInterval(slot).Contains(booked) {
+			continue
+		}
+		if booked.Duration() == interval && booked.Start.Sub(slot.StartTime)%interval == 0 {
+			return true
+		}
+	}
+	return false
+}
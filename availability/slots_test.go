@@ -0,0 +1,185 @@
+package availability
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func testSlot(displayId string, user string, interval uint, span Interval) models.Slot {
+	return models.Slot{DisplayId: displayId, User: user, Interval: interval, StartTime: span.Start, EndTime: span.End}
+}
+
+func TestValidateSlots(t *testing.T) {
+	existing := []models.Slot{testSlot("a", "u1", 30, hours(9, 12))}
+	tests := []struct {
+		name  string
+		added []models.Slot
+		merge bool
+		want  []SlotError
+	}{
+		{"valid", []models.Slot{testSlot("", "u1", 30, hours(13, 14))}, false, []SlotError{}},
+		{"adjacent is valid", []models.Slot{testSlot("", "u1", 30, hours(12, 13))}, false, []SlotError{}},
+		{"other user may overlap", []models.Slot{testSlot("", "u2", 30, hours(10, 11))}, false, []SlotError{}},
+		{
+			"missing user and interval",
+			[]models.Slot{testSlot("", "", 0, hours(13, 14))},
+			false,
+			[]SlotError{
+				{Index: 0, Field: "user", Message: helpers.SlotsErrorNoUser.Error()},
+				{Index: 0, Field: "interval", Message: helpers.SlotsErrorNoInterval.Error()},
+			},
+		},
+		{"empty range", []models.Slot{testSlot("", "u1", 30, hours(14, 14))}, false, []SlotError{{Index: 0, Field: "end_time", Message: helpers.SlotsErrorInvalidRange.Error()}}},
+		{"interval too long", []models.Slot{testSlot("", "u1", 90, hours(13, 14))}, false, []SlotError{{Index: 0, Field: "interval", Message: helpers.SlotsErrorIntervalTooLong.Error()}}},
+		{"overlapping", []models.Slot{testSlot("", "u1", 30, hours(11, 13))}, false, []SlotError{{Index: 0, Field: "start_time", Message: helpers.SlotsErrorOverlap.Error()}}},
+		{"duplicate", []models.Slot{testSlot("", "u1", 30, hours(9, 12))}, false, []SlotError{{Index: 0, Field: "start_time", Message: helpers.SlotsErrorDuplicate.Error()}}},
+		{
+			"overlapping an earlier added slot",
+			[]models.Slot{testSlot("", "u1", 30, hours(13, 15)), testSlot("", "u1", 30, hours(14, 16))},
+			false,
+			[]SlotError{{Index: 1, Field: "start_time", Message: helpers.SlotsErrorOverlap.Error()}},
+		},
+		{"merge accepts overlapping", []models.Slot{testSlot("", "u1", 30, hours(11, 13))}, true, []SlotError{}},
+		{"merge accepts duplicate", []models.Slot{testSlot("", "u1", 30, hours(9, 12))}, true, []SlotError{}},
+		{"merge rejects another interval", []models.Slot{testSlot("", "u1", 60, hours(11, 13))}, true, []SlotError{{Index: 0, Field: "start_time", Message: helpers.SlotsErrorOverlap.Error()}}},
+	}
+	for _, test := range tests {
+		got := ValidateSlots(existing, test.added, test.merge)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ValidateSlots() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeSlots(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []models.Slot
+		added    []models.Slot
+		want     []Interval
+		ids      []string
+	}{
+		{"nothing", []models.Slot{}, []models.Slot{}, []Interval{}, []string{}},
+		{
+			"disjoint are kept",
+			[]models.Slot{testSlot("a", "u1", 30, hours(9, 10))},
+			[]models.Slot{testSlot("new", "u1", 30, hours(11, 12))},
+			[]Interval{hours(9, 10), hours(11, 12)},
+			[]string{"a", "new"},
+		},
+		{
+			"adjacent are joined",
+			[]models.Slot{testSlot("a", "u1", 30, hours(9, 10))},
+			[]models.Slot{testSlot("new", "u1", 30, hours(10, 11))},
+			[]Interval{hours(9, 11)},
+			[]string{"a"},
+		},
+		{
+			"an earlier added slot keeps the existing id",
+			[]models.Slot{testSlot("a", "u1", 30, hours(10, 12))},
+			[]models.Slot{testSlot("new", "u1", 30, hours(9, 11))},
+			[]Interval{hours(9, 12)},
+			[]string{"a"},
+		},
+		{
+			"a contained existing slot takes over the range",
+			[]models.Slot{testSlot("a", "u1", 30, hours(10, 11))},
+			[]models.Slot{testSlot("new", "u1", 30, hours(9, 12))},
+			[]Interval{hours(9, 12)},
+			[]string{"a"},
+		},
+		{
+			"two existing slots joined by an added one keep the earliest id",
+			[]models.Slot{testSlot("b", "u1", 30, hours(11, 12)), testSlot("a", "u1", 30, hours(9, 10))},
+			[]models.Slot{testSlot("new", "u1", 30, hours(10, 11))},
+			[]Interval{hours(9, 12)},
+			[]string{"a"},
+		},
+		{
+			"added slots alone keep the first id",
+			[]models.Slot{},
+			[]models.Slot{testSlot("new1", "u1", 30, hours(9, 10)), testSlot("new2", "u1", 30, hours(9.5, 11))},
+			[]Interval{hours(9, 11)},
+			[]string{"new1"},
+		},
+		{
+			"other users and intervals are not joined",
+			[]models.Slot{testSlot("a", "u1", 30, hours(9, 10))},
+			[]models.Slot{testSlot("new1", "u2", 30, hours(9, 10)), testSlot("new2", "u1", 60, hours(10, 11))},
+			[]Interval{hours(9, 10), hours(10, 11), hours(9, 10)},
+			[]string{"a", "new2", "new1"},
+		},
+	}
+	for _, test := range tests {
+		merged := MergeSlots(test.existing, test.added)
+		got := []Interval{}
+		ids := []string{}
+		for _, element := range merged {
+			got = append(got, slotInterval(element))
+			ids = append(ids, element.DisplayId)
+		}
+		if !reflect.DeepEqual(got, test.want) || !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: MergeSlots() = %v %v, want %v %v", test.name, ids, got, test.ids, test.want)
+		}
+	}
+}
+
+func TestOrphanedMeetings(t *testing.T) {
+	meeting := func(displayId string, user string, span Interval) models.Meeting {
+		return models.Meeting{DisplayId: displayId, UserId: user, StartTime: span.Start, EndTime: span.End}
+	}
+	before := []models.Slot{testSlot("a", "u1", 30, hours(9, 12))}
+	tests := []struct {
+		name     string
+		after    []models.Slot
+		meetings []models.Meeting
+		want     []string
+	}{
+		{"unchanged", before, []models.Meeting{meeting("m", "u1", hours(9, 9.5))}, []string{}},
+		{"slot removed", []models.Slot{}, []models.Meeting{meeting("m", "u1", hours(9, 9.5))}, []string{"m"}},
+		{
+			"slot shortened up to the meeting",
+			[]models.Slot{testSlot("a", "u1", 30, hours(9, 9.5))},
+			[]models.Meeting{meeting("m", "u1", hours(9, 9.5)), meeting("n", "u1", hours(11, 11.5))},
+			[]string{"n"},
+		},
+		{"slot given to another user", []models.Slot{testSlot("a", "u2", 30, hours(9, 12))}, []models.Meeting{meeting("m", "u1", hours(9, 9.5))}, []string{"m"}},
+		{"meeting outside the slots before is not reported", []models.Slot{}, []models.Meeting{meeting("m", "u1", hours(13, 13.5))}, []string{}},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, element := range OrphanedMeetings(before, test.after, test.meetings) {
+			got = append(got, element.DisplayId)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: OrphanedMeetings() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBookable(t *testing.T) {
+	slots := []models.Slot{testSlot("a", "u1", 30, hours(9, 11))}
+	free := []Interval{hours(9, 10), hours(10.5, 11)}
+	tests := []struct {
+		name   string
+		user   string
+		booked Interval
+		want   bool
+	}{
+		{"first interval", "u1", hours(9, 9.5), true},
+		{"last interval", "u1", hours(10.5, 11), true},
+		{"not on an interval boundary", "u1", hours(9.25, 9.75), false},
+		{"two intervals", "u1", hours(9, 10), false},
+		{"not free", "u1", hours(10, 10.5), false},
+		{"outside the slot", "u1", hours(11, 11.5), false},
+		{"another user", "u2", hours(9, 9.5), false},
+	}
+	for _, test := range tests {
+		if got := Bookable(slots, test.user, test.booked, free); got != test.want {
+			t.Errorf("%s: Bookable() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package availability
+
+import (
+	"sort"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+const defaultSuggestionStep = 15 * time.Minute
+const defaultSuggestionLimit = 10
+
+// minSuggestionStep, MaxSuggestionWindow and MaxSuggestionLimit bound the
+// number of candidates Suggest checks and returns
+const minSuggestionStep = 5 * time.Minute
+const MaxSuggestionWindow = 90 * 24 * time.Hour
+const MaxSuggestionLimit = 100
+
+// Attendee is a participant of a suggested meeting. Hosts are only available
+// inside their free ranges, guests are available whenever they are not busy.
+type Attendee struct {
+	Id       string
+	Host     bool
+	Required bool
+	Free     []Interval
+	Busy     []Interval
+}
+
+// WorkingHours is the daily range, as wall clock times given as the hours and
+// minutes since midnight, in which meetings can be suggested.
+type WorkingHours struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+type SuggestOptions struct {
+	Window       Interval
+	Duration     time.Duration
+	Buffer       time.Duration
+	Step         time.Duration
+	WorkingHours WorkingHours
+	Location     *time.Location
+	Limit        int
+}
+
+type Suggestion struct {
+	Interval
+	Attendees []string `json:"attendees"`
+	Missing   []string `json:"missing"`
+	Score     int      `json:"score"`
+}
+
+// BusyFromGuestMeetings returns the meetings booked by the guest with the given email.
+func BusyFromGuestMeetings(meetings []models.Meeting, email string) []Interval {
+	busy := []Interval{}
+	for _, element := range meetings {
+		if element.Guest.Email == email {
+			busy = append(busy, Interval{Start: element.StartTime, End: element.EndTime})
+		}
+	}
+	return busy
+}
+
+// Available reports whether the attendee can attend the candidate meeting,
+// keeping the buffer free around it.
+func (attendee Attendee) Available(candidate Interval, buffer time.Duration) bool {
+	padded := Interval{Start: candidate.Start.Add(-buffer), End: candidate.End.Add(buffer)}
+	for _, element := range attendee.Busy {
+		if element.Overlaps(padded) {
+			return false
+		}
+	}
+	if !attendee.Host {
+		return true
+	}
+	for _, element := range attendee.Free {
+		if element.Contains(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains compares the candidate with the working hours of its day as wall
+// clock times, so a day on which the clocks change keeps the same hours
+func (hours WorkingHours) contains(candidate Interval, location *time.Location) bool {
+	start := candidate.Start.In(location)
+	return !start.Before(hours.at(start, hours.Start)) && !candidate.End.After(hours.at(start, hours.End))
+}
+
+func (hours WorkingHours) at(day time.Time, offset time.Duration) time.Time {
+	minutes := int(offset / time.Minute)
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+// Suggest returns candidate times ranked by the number of optional attendees
+// that can make it, then by start time. Candidates that one of the required
+// attendees can't attend are dropped. Only the first MaxSuggestionWindow of
+// the window is searched.
+func Suggest(attendees []Attendee, options SuggestOptions) []Suggestion {
+	if options.Step <= 0 {
+		options.Step = defaultSuggestionStep
+	} else if options.Step < minSuggestionStep {
+		options.Step = minSuggestionStep
+	}
+	if options.Limit <= 0 {
+		options.Limit = defaultSuggestionLimit
+	} else if options.Limit > MaxSuggestionLimit {
+		options.Limit = MaxSuggestionLimit
+	}
+	if options.Window.End.Sub(options.Window.Start) > MaxSuggestionWindow {
+		options.Window.End = options.Window.Start.Add(MaxSuggestionWindow)
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+
+	suggestions := []Suggestion{}
+	if options.Duration <= 0 {
+		return suggestions
+	}
+	first := options.Window.Start.Truncate(options.Step)
+	if first.Before(options.Window.Start) {
+		first = first.Add(options.Step)
+	}
+	for start := first; !start.Add(options.Duration).After(options.Window.End); start = start.Add(options.Step) {
+		candidate := Interval{Start: start, End: start.Add(options.Duration)}
+		if !options.WorkingHours.contains(candidate, options.Location) {
+			continue
+		}
+		suggestion := Suggestion{Interval: candidate, Attendees: []string{}, Missing: []string{}}
+		possible := true
+		for _, attendee := range attendees {
+			if attendee.Available(candidate, options.Buffer) {
+				suggestion.Attendees = append(suggestion.Attendees, attendee.Id)
+				if !attendee.Required {
+					suggestion.Score++
+				}
+			} else if attendee.Required {
+				possible = false
+				break
+			} else {
+				suggestion.Missing = append(suggestion.Missing, attendee.Id)
+			}
+		}
+		if possible {
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(a, b int) bool {
+		return suggestions[a].Score > suggestions[b].Score
+	})
+	if len(suggestions) > options.Limit {
+		suggestions = suggestions[:options.Limit]
+	}
+	return suggestions
+}
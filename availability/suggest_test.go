@@ -0,0 +1,127 @@
+package availability
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func suggestedStarts(suggestions []Suggestion, location *time.Location) []string {
+	starts := []string{}
+	for _, element := range suggestions {
+		starts = append(starts, element.Start.In(location).Format("2006-01-02 15:04"))
+	}
+	return starts
+}
+
+func TestSuggest(t *testing.T) {
+	workingHours := WorkingHours{Start: 9 * time.Hour, End: 12 * time.Hour}
+	tests := []struct {
+		name      string
+		attendees []Attendee
+		options   SuggestOptions
+		want      []string
+	}{
+		{
+			"host free ranges",
+			[]Attendee{{Id: "host", Host: true, Required: true, Free: []Interval{hours(9, 10), hours(11, 12)}}},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, Step: 30 * time.Minute, WorkingHours: workingHours},
+			[]string{"2030-03-04 09:00", "2030-03-04 11:00"},
+		},
+		{
+			"guest busy adjacent to a candidate",
+			[]Attendee{{Id: "guest", Required: true, Busy: []Interval{hours(10, 11)}}},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, Step: time.Hour, WorkingHours: workingHours},
+			[]string{"2030-03-04 09:00", "2030-03-04 11:00"},
+		},
+		{
+			"buffer keeps away from busy ranges",
+			[]Attendee{{Id: "guest", Required: true, Busy: []Interval{hours(10, 11)}}},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, Step: time.Hour, Buffer: 15 * time.Minute, WorkingHours: workingHours},
+			[]string{},
+		},
+		{
+			"optional attendees rank candidates",
+			[]Attendee{
+				{Id: "guest", Required: true},
+				{Id: "optional", Busy: []Interval{hours(9, 10)}},
+			},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, Step: time.Hour, WorkingHours: workingHours},
+			[]string{"2030-03-04 10:00", "2030-03-04 11:00", "2030-03-04 09:00"},
+		},
+		{
+			"no attendees are free",
+			[]Attendee{{Id: "host", Host: true, Required: true}},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, WorkingHours: workingHours},
+			[]string{},
+		},
+		{
+			"limit",
+			[]Attendee{{Id: "guest", Required: true}},
+			SuggestOptions{Window: hours(0, 24), Duration: time.Hour, Step: time.Hour, WorkingHours: workingHours, Limit: 1},
+			[]string{"2030-03-04 09:00"},
+		},
+		{
+			"no duration",
+			[]Attendee{{Id: "guest", Required: true}},
+			SuggestOptions{Window: hours(0, 24), WorkingHours: workingHours},
+			[]string{},
+		},
+	}
+	for _, test := range tests {
+		got := suggestedStarts(Suggest(test.attendees, test.options), time.UTC)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Suggest() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// On the days the clocks change the working hours stay the same wall clock
+// hours, not the same offsets from midnight.
+func TestSuggestAcrossDSTChanges(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := []Attendee{{Id: "guest", Required: true}}
+	for _, day := range []time.Time{
+		time.Date(2030, time.March, 10, 0, 0, 0, 0, newYork),
+		time.Date(2030, time.November, 3, 0, 0, 0, 0, newYork),
+	} {
+		options := SuggestOptions{
+			Window:       Interval{Start: day.UTC(), End: day.AddDate(0, 0, 1).UTC()},
+			Duration:     time.Hour,
+			Step:         time.Hour,
+			WorkingHours: WorkingHours{Start: 9 * time.Hour, End: 11 * time.Hour},
+			Location:     newYork,
+		}
+		date := day.Format("2006-01-02")
+		want := []string{date + " 09:00", date + " 10:00"}
+		got := suggestedStarts(Suggest(guest, options), newYork)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Suggest() = %v, want %v", date, got, want)
+		}
+	}
+}
+
+func TestSuggestBounds(t *testing.T) {
+	guest := []Attendee{{Id: "guest", Required: true}}
+	allDay := WorkingHours{Start: 0, End: 24 * time.Hour}
+
+	options := SuggestOptions{Window: hours(0, 24), Duration: time.Minute, Step: time.Nanosecond, WorkingHours: allDay, Limit: 1000}
+	got := Suggest(guest, options)
+	if len(got) != MaxSuggestionLimit {
+		t.Errorf("Suggest() with a limit of 1000 returned %d suggestions, want %d", len(got), MaxSuggestionLimit)
+	}
+	if got[1].Start.Sub(got[0].Start) != minSuggestionStep {
+		t.Errorf("Suggest() with a step of 1ns put the candidates %v apart, want %v", got[1].Start.Sub(got[0].Start), minSuggestionStep)
+	}
+
+	// a guest who is only free a year from now is out of reach
+	later := testDay.AddDate(1, 0, 0)
+	busy := []Attendee{{Id: "guest", Required: true, Busy: []Interval{{Start: testDay, End: later}}}}
+	options = SuggestOptions{Window: Interval{Start: testDay, End: later.Add(time.Hour)}, Duration: time.Hour, WorkingHours: allDay}
+	if got := Suggest(busy, options); len(got) != 0 {
+		t.Errorf("Suggest() searched past %v: %v", MaxSuggestionWindow, suggestedStarts(got, time.UTC))
+	}
+}
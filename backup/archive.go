@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// Format names the archives, Version is bumped when their layout changes in
+// a way older importers can't read
+const Format = "meetings-scheduler-archive"
+const Version = 1
+
+// Archive is a portable copy of the data. Events carry their slots and
+// meetings, users and events their availability rules, deleted records are
+// kept with their deletion time so the trash survives a restore.
+type Archive struct {
+	Format    string         `json:"format"`
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	// Secrets tells whether password hashes and confirmation tokens were exported
+	Secrets   bool           `json:"secrets"`
+	Users     []User         `json:"users"`
+	Events    []models.Event `json:"events"`
+}
+
+// User adds the fields the API never shows to the user, the secrets among
+// them are only filled in archives made with secrets
+type User struct {
+	models.User
+	Status                  models.UserStatusType              `json:"status"`
+	Confirmed               bool                               `json:"confirmed"`
+	ConfirmationTokenStatus models.ConfirmationTokenStatusType `json:"confirmation_token_status"`
+	ConfirmationToken       string                             `json:"confirmation_token,omitempty"`
+	Hash                    []byte                             `json:"hash,omitempty"`
+}
+
+// Export copies every user and event, with password hashes and confirmation
+// tokens only when secrets is set. Pending password recoveries are never
+// exported.
+func Export(dal db.DAL, secrets bool) (*Archive, error) {
+	archive := &Archive{Format: Format, Version: Version, CreatedAt: time.Now().UTC(), Secrets: secrets, Users: []User{}}
+	users, err := dal.ExportUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range users {
+		user := User{User: element, Status: element.Status, Confirmed: element.Confirmed, ConfirmationTokenStatus: element.ConfirmationTokenStatus}
+		if secrets {
+			user.Hash = element.Hash
+			user.ConfirmationToken = element.ConfirmationToken
+		} else if user.ConfirmationTokenStatus == models.CONFIRMATION_TOKEN_VALID {
+			// the link can't work without its token
+			user.ConfirmationTokenStatus = models.CONFIRMATION_TOKEN_INVALID
+		}
+		archive.Users = append(archive.Users, user)
+	}
+
+	archive.Events, err = dal.ExportEvents()
+	if err != nil {
+		return nil, err
+	}
+	slots, err := dal.ExportSlots()
+	if err != nil {
+		return nil, err
+	}
+	meetings, err := dal.ExportMeetings()
+	if err != nil {
+		return nil, err
+	}
+	byDisplayId := make(map[string]int)
+	for index := range archive.Events {
+		archive.Events[index].Slots = []models.Slot{}
+		archive.Events[index].Meetings = []models.Meeting{}
+		byDisplayId[archive.Events[index].DisplayId] = index
+	}
+	for _, element := range slots {
+		if index, ok := byDisplayId[element.EventDisplayId]; ok {
+			archive.Events[index].Slots = append(archive.Events[index].Slots, element)
+		}
+	}
+	for _, element := range meetings {
+		if index, ok := byDisplayId[element.EventDisplayId]; ok {
+			archive.Events[index].Meetings = append(archive.Events[index].Meetings, element)
+		}
+	}
+	return archive, nil
+}
+
+func (a *Archive) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(a)
+}
+
+// Read decodes an archive and checks that this version can import it
+func Read(r io.Reader) (*Archive, error) {
+	archive := &Archive{}
+	err := json.NewDecoder(r).Decode(archive)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid archive: %s", err)
+	}
+	if archive.Format != Format {
+		return nil, fmt.Errorf("not a valid archive: format is %q instead of %q", archive.Format, Format)
+	}
+	if archive.Version < 1 || archive.Version > Version {
+		return nil, fmt.Errorf("archive version %d can't be imported, versions up to %d can", archive.Version, Version)
+	}
+	return archive, nil
+}
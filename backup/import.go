@@ -0,0 +1,409 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// Conflict strategies, for the records of an archive that already exist:
+// users with the same email and events with the same display id. Records
+// whose ids are taken by other records are imported under new ids whatever
+// the strategy, and the references to them are changed to match.
+const (
+	// CONFLICT_FAIL imports nothing when any record exists
+	CONFLICT_FAIL = "fail"
+	// CONFLICT_SKIP keeps the existing records, events with their slots and meetings
+	CONFLICT_SKIP = "skip"
+	// CONFLICT_OVERWRITE replaces the existing records by the archived ones
+	CONFLICT_OVERWRITE = "overwrite"
+	// CONFLICT_COPY imports the events again under new ids, users are kept
+	// as with CONFLICT_SKIP since their emails are unique
+	CONFLICT_COPY = "copy"
+)
+
+var ConflictStrategies = []string{CONFLICT_FAIL, CONFLICT_SKIP, CONFLICT_OVERWRITE, CONFLICT_COPY}
+
+type Options struct {
+	OnConflict string
+	// DryRun reports what the import would do without writing anything
+	DryRun bool
+}
+
+// Counts are the records of a kind by what the import did with them
+type Counts struct {
+	Imported int
+	Replaced int
+	Skipped  int
+	// Remapped counts the imported records that got new ids
+	Remapped int
+}
+
+// Report tells what an import did, or would do on a dry run
+type Report struct {
+	Users     Counts
+	Events    Counts
+	Slots     Counts
+	Meetings  Counts
+	Conflicts []string
+	// WithoutPassword counts the imported users who have to have their
+	// password reset before they can sign in, archives without secrets have
+	// no password hashes
+	WithoutPassword int
+}
+
+// Import restores the archive into the storage, the users first so the
+// events can refer to their new ids. The report comes with the error when
+// conflicts stopped the import, nothing was written then.
+func Import(dal db.DAL, archive *Archive, options Options) (*Report, error) {
+	valid := false
+	for _, element := range ConflictStrategies {
+		valid = valid || element == options.OnConflict
+	}
+	if !valid {
+		return nil, fmt.Errorf("on conflict must be one of %s, got %q", strings.Join(ConflictStrategies, ", "), options.OnConflict)
+	}
+	taken, err := loadTaken(dal)
+	if err != nil {
+		return nil, err
+	}
+	plan := &importPlan{options: options, taken: taken, report: &Report{Conflicts: []string{}}, userDisplayIds: make(map[string]string)}
+	for _, element := range archive.Users {
+		plan.addUser(element, archive.Secrets)
+	}
+	for _, element := range archive.Events {
+		plan.addEvent(element)
+	}
+
+	if options.OnConflict == CONFLICT_FAIL && len(plan.report.Conflicts) > 0 {
+		return plan.report, fmt.Errorf("%d records of the archive already exist, nothing was imported", len(plan.report.Conflicts))
+	}
+	if options.DryRun {
+		return plan.report, nil
+	}
+	for _, element := range plan.users {
+		err = dal.ImportUser(element.user, element.replace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user %s: %s", element.user.Email, err)
+		}
+	}
+	for _, element := range plan.events {
+		err = dal.ImportEvent(element.event, element.replace)
+		if err == nil {
+			err = dal.ImportSlots(element.slots, element.replace)
+		}
+		if err == nil {
+			err = dal.ImportMeetings(element.meetings, element.replace)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to import event %s: %s", element.event.DisplayId, err)
+		}
+	}
+	return plan.report, nil
+}
+
+// taken holds the records of the storage and the ids in use, ids are unique
+// by kind of record
+type taken struct {
+	usersByEmail map[string]models.User
+	events       map[string]models.Event
+	slots        map[string]models.Slot
+	meetings     map[string]models.Meeting
+	ids          map[string]map[bson.ObjectId]bool
+	displayIds   map[string]map[string]bool
+}
+
+const (
+	kindUser    = "user"
+	kindEvent   = "event"
+	kindSlot    = "slot"
+	kindMeeting = "meeting"
+	kindRule    = "rule"
+)
+
+func loadTaken(dal db.DAL) (*taken, error) {
+	t := &taken{
+		usersByEmail: make(map[string]models.User),
+		events: make(map[string]models.Event),
+		slots: make(map[string]models.Slot),
+		meetings: make(map[string]models.Meeting),
+		ids: make(map[string]map[bson.ObjectId]bool),
+		displayIds: make(map[string]map[string]bool),
+	}
+	for _, kind := range []string{kindUser, kindEvent, kindSlot, kindMeeting, kindRule} {
+		t.ids[kind] = make(map[bson.ObjectId]bool)
+		t.displayIds[kind] = make(map[string]bool)
+	}
+	users, err := dal.ExportUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range users {
+		t.usersByEmail[strings.ToLower(element.Email)] = element
+		t.take(kindUser, element.Id, element.DisplayId)
+		t.takeRules(element.Blackouts, element.DateOverrides)
+	}
+	events, err := dal.ExportEvents()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range events {
+		t.events[element.DisplayId] = element
+		t.take(kindEvent, element.Id, element.DisplayId)
+		t.takeRules(element.Blackouts, element.DateOverrides)
+	}
+	slots, err := dal.ExportSlots()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range slots {
+		t.slots[element.DisplayId] = element
+		t.take(kindSlot, element.Id, element.DisplayId)
+	}
+	meetings, err := dal.ExportMeetings()
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range meetings {
+		t.meetings[element.DisplayId] = element
+		t.take(kindMeeting, element.Id, element.DisplayId)
+	}
+	return t, nil
+}
+
+func (t *taken) take(kind string, id bson.ObjectId, displayId string) {
+	t.ids[kind][id] = true
+	t.displayIds[kind][displayId] = true
+}
+
+func (t *taken) takeRules(blackouts []models.Blackout, overrides []models.DateOverride) {
+	for _, element := range blackouts {
+		t.take(kindRule, element.Id, element.DisplayId)
+	}
+	for _, element := range overrides {
+		t.take(kindRule, element.Id, element.DisplayId)
+	}
+}
+
+// release frees the ids of a record about to be replaced
+func (t *taken) release(kind string, id bson.ObjectId, displayId string) {
+	delete(t.ids[kind], id)
+	delete(t.displayIds[kind], displayId)
+}
+
+func (t *taken) releaseRules(blackouts []models.Blackout, overrides []models.DateOverride) {
+	for _, element := range blackouts {
+		t.release(kindRule, element.Id, element.DisplayId)
+	}
+	for _, element := range overrides {
+		t.release(kindRule, element.Id, element.DisplayId)
+	}
+}
+
+// claim takes the ids for a new record, or new ids when they are taken or
+// fresh is set, and reports whether the ids changed
+func (t *taken) claim(kind string, id *bson.ObjectId, displayId *string, fresh bool) bool {
+	changed := false
+	if fresh || len(*id) == 0 || t.ids[kind][*id] {
+		*id = bson.NewObjectId()
+		changed = true
+	}
+	if fresh || *displayId == "" || t.displayIds[kind][*displayId] {
+		*displayId = helpers.RandStringBytesMaskImprSrc(8)
+		for t.displayIds[kind][*displayId] {
+			*displayId = helpers.RandStringBytesMaskImprSrc(8)
+		}
+		changed = true
+	}
+	t.take(kind, *id, *displayId)
+	return changed
+}
+
+func (t *taken) claimRules(blackouts []models.Blackout, overrides []models.DateOverride, fresh bool) {
+	for index := range blackouts {
+		t.claim(kindRule, &blackouts[index].Id, &blackouts[index].DisplayId, fresh)
+	}
+	for index := range overrides {
+		t.claim(kindRule, &overrides[index].Id, &overrides[index].DisplayId, fresh)
+	}
+}
+
+type plannedUser struct {
+	user    models.User
+	replace bool
+}
+
+type plannedEvent struct {
+	event    models.Event
+	slots    []models.Slot
+	meetings []models.Meeting
+	replace  bool
+}
+
+// importPlan decides what happens to every record before anything is written,
+// so conflicts are all known up front
+type importPlan struct {
+	options        Options
+	taken          *taken
+	report         *Report
+	users          []plannedUser
+	events         []plannedEvent
+	// userDisplayIds maps the display ids of the archived users to the ones
+	// they have in the storage
+	userDisplayIds map[string]string
+}
+
+func (p *importPlan) userDisplayId(archived string) string {
+	if current, ok := p.userDisplayIds[archived]; ok {
+		return current
+	}
+	return archived
+}
+
+func (p *importPlan) addUser(archived User, secrets bool) {
+	user := archived.User
+	user.Email = strings.ToLower(user.Email)
+	user.Status = archived.Status
+	user.Confirmed = archived.Confirmed
+	user.ConfirmationTokenStatus = archived.ConfirmationTokenStatus
+	user.ConfirmationToken = archived.ConfirmationToken
+	user.Hash = archived.Hash
+	user.RecoverToken = ""
+	user.RecoverTokenStatus = models.RECOVER_TOKEN_INVALID
+	normalizeUser(&user)
+
+	archivedDisplayId := user.DisplayId
+	replace := false
+	if current, ok := p.taken.usersByEmail[user.Email]; ok {
+		p.report.Conflicts = append(p.report.Conflicts, "user "+user.Email)
+		p.userDisplayIds[archivedDisplayId] = current.DisplayId
+		switch p.options.OnConflict {
+		case CONFLICT_OVERWRITE:
+			replace = true
+			user.Id = current.Id
+			user.DisplayId = current.DisplayId
+			if !secrets {
+				// an archive without secrets doesn't take the password away
+				user.Hash = current.Hash
+				user.ConfirmationToken = current.ConfirmationToken
+				user.ConfirmationTokenStatus = current.ConfirmationTokenStatus
+			}
+			p.taken.releaseRules(current.Blackouts, current.DateOverrides)
+			p.taken.claimRules(user.Blackouts, user.DateOverrides, false)
+			p.report.Users.Replaced++
+			p.users = append(p.users, plannedUser{user: user, replace: true})
+		case CONFLICT_SKIP, CONFLICT_COPY:
+			p.report.Users.Skipped++
+		}
+		return
+	}
+
+	if p.taken.claim(kindUser, &user.Id, &user.DisplayId, false) {
+		p.report.Users.Remapped++
+	}
+	p.taken.claimRules(user.Blackouts, user.DateOverrides, false)
+	p.userDisplayIds[archivedDisplayId] = user.DisplayId
+	if len(user.Hash) == 0 {
+		p.report.WithoutPassword++
+	}
+	p.report.Users.Imported++
+	p.users = append(p.users, plannedUser{user: user, replace: replace})
+}
+
+func (p *importPlan) addEvent(event models.Event) {
+	slots, meetings := event.Slots, event.Meetings
+	event.Slots, event.Meetings = nil, nil
+	if event.Blackouts == nil {
+		event.Blackouts = []models.Blackout{}
+	}
+	if event.DateOverrides == nil {
+		event.DateOverrides = []models.DateOverride{}
+	}
+	if event.IntakeForm == nil {
+		event.IntakeForm = []models.IntakeField{}
+	}
+
+	replace, fresh := false, false
+	if current, ok := p.taken.events[event.DisplayId]; ok {
+		p.report.Conflicts = append(p.report.Conflicts, "event "+event.DisplayId)
+		switch p.options.OnConflict {
+		case CONFLICT_FAIL:
+			return
+		case CONFLICT_SKIP:
+			p.report.Events.Skipped++
+			p.report.Slots.Skipped += len(slots)
+			p.report.Meetings.Skipped += len(meetings)
+			return
+		case CONFLICT_OVERWRITE:
+			replace = true
+			event.Id = current.Id
+			p.taken.releaseRules(current.Blackouts, current.DateOverrides)
+			p.report.Events.Replaced++
+		case CONFLICT_COPY:
+			fresh = true
+		}
+	}
+	if !replace {
+		if p.taken.claim(kindEvent, &event.Id, &event.DisplayId, fresh) {
+			p.report.Events.Remapped++
+		}
+		p.report.Events.Imported++
+	}
+	p.taken.claimRules(event.Blackouts, event.DateOverrides, fresh)
+	event.AdminUser = p.userDisplayId(event.AdminUser)
+
+	planned := plannedEvent{event: event, replace: replace}
+	for _, element := range slots {
+		element.EventDisplayId = event.DisplayId
+		element.User = p.userDisplayId(element.User)
+		if replace && p.replaces(p.taken.slots[element.DisplayId].EventDisplayId, event.DisplayId) {
+			element.Id = p.taken.slots[element.DisplayId].Id
+			p.report.Slots.Replaced++
+		} else {
+			if p.taken.claim(kindSlot, &element.Id, &element.DisplayId, fresh) {
+				p.report.Slots.Remapped++
+			}
+			p.report.Slots.Imported++
+		}
+		planned.slots = append(planned.slots, element)
+	}
+	for _, element := range meetings {
+		element.EventDisplayId = event.DisplayId
+		element.UserId = p.userDisplayId(element.UserId)
+		if element.Guest.Details == nil {
+			element.Guest.Details = map[string]string{}
+		}
+		if replace && p.replaces(p.taken.meetings[element.DisplayId].EventDisplayId, event.DisplayId) {
+			element.Id = p.taken.meetings[element.DisplayId].Id
+			p.report.Meetings.Replaced++
+		} else {
+			if p.taken.claim(kindMeeting, &element.Id, &element.DisplayId, fresh) {
+				p.report.Meetings.Remapped++
+			}
+			p.report.Meetings.Imported++
+		}
+		planned.meetings = append(planned.meetings, element)
+	}
+	p.events = append(p.events, planned)
+}
+
+// replaces tells whether an existing slot or meeting, by the event it belongs
+// to, is the one an archived record of the replaced event stands for
+func (p *importPlan) replaces(currentEventDisplayId string, eventDisplayId string) bool {
+	return currentEventDisplayId != "" && currentEventDisplayId == eventDisplayId
+}
+
+func normalizeUser(user *models.User) {
+	if user.Teams == nil {
+		user.Teams = []string{}
+	}
+	if user.Blackouts == nil {
+		user.Blackouts = []models.Blackout{}
+	}
+	if user.DateOverrides == nil {
+		user.DateOverrides = []models.DateOverride{}
+	}
+}
@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// newTestDAL opens an empty SQLite database with the schema migrated
+func newTestDAL(t *testing.T) *db.SQLDAL {
+	dal := db.NewSQLDatabaseAccessor(db.SQLDialectSQLite, filepath.Join(t.TempDir(), "meetings.db"))
+	if err := dal.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return dal
+}
+
+// seed stores a host with an event, a slot and a meeting with a guest
+func seed(t *testing.T, dal db.DAL) *models.Event {
+	if err := dal.InsertUser("host@example.com", []byte("hash"), "Host", "User", "token"); err != nil {
+		t.Fatal(err)
+	}
+	host, err := dal.FindAnyUserByEmail("host@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dal.UpdateUserConfirmation(host.Id, models.USER_CONFIRMED, models.CONFIRMATION_TOKEN_INVALID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := dal.InsertEvent("Interviews", host.DisplayId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2030, time.March, 4, 9, 0, 0, 0, time.UTC)
+	now := time.Now().UTC()
+	slot := models.Slot{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), StartTime: start, EndTime: start.Add(3 * time.Hour),
+		User: host.DisplayId, Interval: 30, CreatedAt: now, UpdatedAt: now}
+	if err = dal.InsertSlots(event.DisplayId, []models.Slot{slot}); err != nil {
+		t.Fatal(err)
+	}
+	meeting := models.Meeting{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), EventDisplayId: event.DisplayId,
+		StartTime: start, EndTime: start.Add(30 * time.Minute), UserId: host.DisplayId,
+		Guest: models.Guest{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), Email: "guest@example.com",
+			Details: map[string]string{"company": "Acme"}, CreatedAt: now, UpdatedAt: now},
+		CreatedAt: now, UpdatedAt: now}
+	if err = dal.InsertMeeting(meeting); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// exported writes and reads back the archive of the storage, as the export and
+// import commands do
+func exported(t *testing.T, dal db.DAL) *Archive {
+	archive, err := Export(dal, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err = archive.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+// contents counts the records of the storage
+func contents(t *testing.T, dal db.DAL) [4]int {
+	users, err := dal.ExportUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := dal.ExportEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slots, err := dal.ExportSlots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meetings, err := dal.ExportMeetings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return [4]int{len(users), len(events), len(slots), len(meetings)}
+}
+
+func TestImportIntoEmptyStorage(t *testing.T) {
+	source := newTestDAL(t)
+	event := seed(t, source)
+	archive := exported(t, source)
+
+	target := newTestDAL(t)
+	report, err := Import(target, archive, Options{OnConflict: CONFLICT_FAIL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Report{Users: Counts{Imported: 1}, Events: Counts{Imported: 1}, Slots: Counts{Imported: 1}, Meetings: Counts{Imported: 1}, Conflicts: []string{}}
+	if !reflect.DeepEqual(*report, want) {
+		t.Errorf("Import() = %+v, want %+v", *report, want)
+	}
+	if got := contents(t, target); got != [4]int{1, 1, 1, 1} {
+		t.Errorf("storage holds %v users, events, slots and meetings, want one of each", got)
+	}
+
+	host, err := target.FindActiveUserByEmail("host@example.com")
+	if err != nil {
+		t.Fatalf("imported host can't be found: %v", err)
+	}
+	if string(host.Hash) != "hash" {
+		t.Errorf("imported host has hash %q, want the archived one", host.Hash)
+	}
+	imported, err := target.GetEventByDisplayId(event.DisplayId)
+	if err != nil || imported.Name != "Interviews" || imported.AdminUser != host.DisplayId {
+		t.Errorf("imported event = %+v %v, want Interviews of the host", imported, err)
+	}
+	meetings, err := target.GetMeetingsForEvents([]string{event.DisplayId})
+	if err != nil || len(meetings) != 1 || meetings[0].Guest.Details["company"] != "Acme" {
+		t.Errorf("imported meetings = %+v %v, want the meeting with its guest details", meetings, err)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	tests := []struct {
+		strategy string
+		dryRun   bool
+		fails    bool
+		report   Report
+		contents [4]int
+		name     string
+	}{
+		{
+			strategy: CONFLICT_FAIL,
+			fails:    true,
+			report:   Report{Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 1, 1, 1},
+			name:     "Renamed",
+		},
+		{
+			strategy: CONFLICT_SKIP,
+			report:   Report{Users: Counts{Skipped: 1}, Events: Counts{Skipped: 1}, Slots: Counts{Skipped: 1}, Meetings: Counts{Skipped: 1}, Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 1, 1, 1},
+			name:     "Renamed",
+		},
+		{
+			strategy: CONFLICT_OVERWRITE,
+			report:   Report{Users: Counts{Replaced: 1}, Events: Counts{Replaced: 1}, Slots: Counts{Replaced: 1}, Meetings: Counts{Replaced: 1}, Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 1, 1, 1},
+			name:     "Interviews",
+		},
+		{
+			strategy: CONFLICT_OVERWRITE,
+			dryRun:   true,
+			report:   Report{Users: Counts{Replaced: 1}, Events: Counts{Replaced: 1}, Slots: Counts{Replaced: 1}, Meetings: Counts{Replaced: 1}, Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 1, 1, 1},
+			name:     "Renamed",
+		},
+		{
+			strategy: CONFLICT_COPY,
+			report: Report{Users: Counts{Skipped: 1}, Events: Counts{Imported: 1, Remapped: 1}, Slots: Counts{Imported: 1, Remapped: 1},
+				Meetings: Counts{Imported: 1, Remapped: 1}, Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 2, 2, 2},
+			name:     "Renamed",
+		},
+		{
+			strategy: CONFLICT_COPY,
+			dryRun:   true,
+			report: Report{Users: Counts{Skipped: 1}, Events: Counts{Imported: 1, Remapped: 1}, Slots: Counts{Imported: 1, Remapped: 1},
+				Meetings: Counts{Imported: 1, Remapped: 1}, Conflicts: []string{"user host@example.com", "event "}},
+			contents: [4]int{1, 1, 1, 1},
+			name:     "Renamed",
+		},
+	}
+	for _, test := range tests {
+		label := test.strategy
+		if test.dryRun {
+			label += " dry run"
+		}
+		// the archive is imported back into its own storage after the event
+		// was renamed, so every record conflicts
+		dal := newTestDAL(t)
+		event := seed(t, dal)
+		archive := exported(t, dal)
+		if _, err := dal.UpdateEvent(event.DisplayId, event.Version, "Renamed", event.AdminUser); err != nil {
+			t.Fatal(err)
+		}
+		test.report.Conflicts[1] += event.DisplayId
+
+		report, err := Import(dal, archive, Options{OnConflict: test.strategy, DryRun: test.dryRun})
+		if (err != nil) != test.fails {
+			t.Errorf("%s: Import() error = %v, want failure %v", label, err, test.fails)
+		}
+		if report == nil || !reflect.DeepEqual(*report, test.report) {
+			t.Errorf("%s: Import() = %+v, want %+v", label, report, test.report)
+		}
+		if got := contents(t, dal); got != test.contents {
+			t.Errorf("%s: storage holds %v users, events, slots and meetings, want %v", label, got, test.contents)
+		}
+		current, err := dal.GetEventByDisplayId(event.DisplayId)
+		if err != nil || current.Name != test.name {
+			t.Errorf("%s: event is named %q %v, want %q", label, current.Name, err, test.name)
+		}
+	}
+}
+
+func TestImportRejectsUnknownStrategy(t *testing.T) {
+	report, err := Import(newTestDAL(t), &Archive{Format: Format, Version: Version}, Options{OnConflict: "merge"})
+	if err == nil || report != nil {
+		t.Errorf("Import() = %v %v, want an error", report, err)
+	}
+}
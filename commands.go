@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/auth"
+	"github.com/asafron/meetings-scheduler/config"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+const commandsUsage = `commands:
+  migrate up                       apply all pending migrations
+  migrate down [steps]             revert the latest applied migrations, 1 by default
+  migrate status                   list the applied and pending migrations
+  user create [-first_name name] [-last_name name] [-confirmed] <email>
+                                   create a user, the password is read from standard input,
+                                   the confirmation email is sent unless -confirmed is given
+  user show <email>                print a user
+  user confirm <email>             confirm a user without the confirmation link
+  user disable <email>             keep a user from signing in
+  user enable <email>              let a disabled user sign in again
+  user reset-password <email>      set the password of a user, read from standard input
+  user resend-confirmation <email> send the confirmation email again
+  user add-team -team name <email> add a user to a team, members of a team may query
+                                   each other's free/busy times
+  user remove-team -team name <email>
+                                   remove a user from a team
+  event list <owner email>         list the events of a user
+  event show <display id>          print an event with its slots and meetings
+  event delete <display id>        move an event to the trash
+  export [-with_passwords] [-o file]
+                                   write all the data as a JSON archive, to standard output
+                                   unless a file is given, password hashes only with -with_passwords
+  import [-on_conflict fail|skip|overwrite|copy] [-dry_run] <file>
+                                   restore an archive, the users and events that already exist
+                                   fail the import by default, -dry_run only reports what would change`
+
+// commandActor is recorded in the audit log and the trash as the author of
+// the changes made by commands
+const commandActor = "cli"
+
+// runCommand runs the command given after the flags instead of the server,
+// e.g. "-config config.yml -env production migrate up". Commands go through
+// the same DAL and authenticator as the requests.
+func runCommand(dal db.DAL, cfg *config.EnvConfig, args []string) error {
+	authorizer := auth.NewAuthenticator(dal, cfg.SessionKey, cfg.DashboardBaseUrl)
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(dal, args[1:])
+	case "user":
+		return userCommand(dal, authorizer, cfg, args[1:])
+	case "event":
+		return eventCommand(dal, args[1:])
+	case "export":
+		return exportCommand(dal, args[1:])
+	case "import":
+		return importCommand(dal, args[1:])
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], commandsUsage)
+}
+
+func migrateCommand(dal db.DAL, args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "up":
+		return dal.MigrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+			steps = parsed
+		}
+		return dal.MigrateDown(steps)
+	case "status":
+		status, err := dal.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, element := range status {
+			if element.Applied {
+				fmt.Printf("applied  %3d  %s  %s\n", element.Version, element.AppliedAt.Format("2006-01-02 15:04:05"), element.Name)
+			} else {
+				fmt.Printf("pending  %3d  %s\n", element.Version, element.Name)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate action %q\n%s", action, commandsUsage)
+}
+
+// commandFlags parses the flags of a command, which come before its single
+// argument
+func commandFlags(name string, args []string, define func(flags *flag.FlagSet)) (string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if define != nil {
+		define(flags)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s\n%s", name, err, commandsUsage)
+	}
+	if flags.NArg() != 1 {
+		return "", fmt.Errorf("%s takes a single argument\n%s", name, commandsUsage)
+	}
+	return flags.Arg(0), nil
+}
+
+// readSecret reads a line of standard input, so secrets don't end up in the
+// shell history
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("nothing to read from standard input")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// recordCommandAudit appends an audit entry for a change made by a command,
+// like recordAudit does for requests
+func recordCommandAudit(dal db.DAL, action models.AuditActionType, targetType models.AuditTargetType, eventDisplayId string, targetId string, changes map[string]models.AuditChange) {
+	if changes == nil {
+		changes = map[string]models.AuditChange{}
+	}
+	err := dal.InsertAuditEntry(models.AuditEntry{
+		Id: bson.NewObjectId(),
+		Actor: commandActor,
+		Action: action,
+		TargetType: targetType,
+		TargetId: targetId,
+		EventDisplayId: eventDisplayId,
+		Changes: changes,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to record the audit entry: %s\n", err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"github.com/asafron/meetings-scheduler/backup"
+	"github.com/asafron/meetings-scheduler/db"
+)
+
+// exportCommand writes the archive to standard output unless a file is given
+func exportCommand(dal db.DAL, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	secrets := flags.Bool("with_passwords", false, "")
+	output := flags.String("o", "", "")
+	err := flags.Parse(args)
+	if err != nil {
+		return fmt.Errorf("export: %s\n%s", err, commandsUsage)
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("export takes no argument\n%s", commandsUsage)
+	}
+
+	archive, err := backup.Export(dal, *secrets)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		// the archive may hold password hashes, only the owner reads it
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	err = archive.Write(w)
+	if err != nil {
+		return err
+	}
+	slots, meetings := 0, 0
+	for _, element := range archive.Events {
+		slots += len(element.Slots)
+		meetings += len(element.Meetings)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d users, %d events, %d slots and %d meetings\n", len(archive.Users), len(archive.Events), slots, meetings)
+	return nil
+}
+
+func importCommand(dal db.DAL, args []string) error {
+	options := backup.Options{}
+	path, err := commandFlags("import", args, func(flags *flag.FlagSet) {
+		flags.StringVar(&options.OnConflict, "on_conflict", backup.CONFLICT_FAIL, "")
+		flags.BoolVar(&options.DryRun, "dry_run", false, "")
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	archive, err := backup.Read(file)
+	if err != nil {
+		return err
+	}
+
+	report, err := backup.Import(dal, archive, options)
+	if report != nil {
+		printImportReport(report, options)
+	}
+	return err
+}
+
+func printImportReport(report *backup.Report, options backup.Options) {
+	if len(report.Conflicts) > 0 {
+		fmt.Printf("already existing: %s\n", strings.Join(report.Conflicts, ", "))
+	}
+	verb := "imported"
+	if options.DryRun {
+		verb = "would import"
+	}
+	for _, element := range []struct {
+		name   string
+		counts backup.Counts
+	}{{"users", report.Users}, {"events", report.Events}, {"slots", report.Slots}, {"meetings", report.Meetings}} {
+		fmt.Printf("%-9s %s %d (%d under new ids), replaced %d, skipped %d\n", element.name, verb,
+			element.counts.Imported, element.counts.Remapped, element.counts.Replaced, element.counts.Skipped)
+	}
+	if report.WithoutPassword > 0 {
+		fmt.Printf("%d users have no password, set one with \"user reset-password <email>\"\n", report.WithoutPassword)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func eventCommand(dal db.DAL, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("event needs an action\n%s", commandsUsage)
+	}
+	action := args[0]
+	switch action {
+	case "list", "show", "delete":
+	default:
+		return fmt.Errorf("unknown event action %q\n%s", action, commandsUsage)
+	}
+	argument, err := commandFlags("event "+action, args[1:], nil)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		owner, err := dal.FindAnyUserByEmail(strings.ToLower(argument))
+		if err != nil {
+			return err
+		}
+		events := *dal.GetEventsForUser(owner.DisplayId)
+		err = db.AttachSlotsAndMeetings(dal, events)
+		if err != nil {
+			return err
+		}
+		for _, element := range events {
+			fmt.Printf("%s  %3d slots  %3d meetings  %s\n", element.DisplayId, len(element.Slots), len(element.Meetings), element.Name)
+		}
+		return nil
+	case "show":
+		event, err := dal.GetEventByDisplayId(argument)
+		if err != nil {
+			return err
+		}
+		events := []models.Event{*event}
+		err = db.AttachSlotsAndMeetings(dal, events)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(events[0])
+	case "delete":
+		event, err := dal.GetEventByDisplayId(argument)
+		if err != nil {
+			return err
+		}
+		err = dal.RemoveEvent(event.DisplayId, event.Version, commandActor)
+		if err != nil {
+			return err
+		}
+		recordCommandAudit(dal, models.AUDIT_DELETE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, nil)
+		fmt.Printf("%s was moved to the trash of its owner\n", event.DisplayId)
+		return nil
+	}
+	return nil
+}
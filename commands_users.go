@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"github.com/asafron/meetings-scheduler/auth"
+	"github.com/asafron/meetings-scheduler/config"
+	"github.com/asafron/meetings-scheduler/controllers"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// minPasswordLength is the shortest password CreateUser accepts too
+const minPasswordLength = 6
+
+func userCommand(dal db.DAL, authorizer *auth.Authenticator, cfg *config.EnvConfig, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("user needs an action\n%s", commandsUsage)
+	}
+	ctx := context.Background()
+	action := args[0]
+	switch action {
+	case "create":
+		var firstName, lastName string
+		var confirmed bool
+		email, err := commandFlags("user create", args[1:], func(flags *flag.FlagSet) {
+			flags.StringVar(&firstName, "first_name", "", "")
+			flags.StringVar(&lastName, "last_name", "", "")
+			flags.BoolVar(&confirmed, "confirmed", false, "")
+		})
+		if err != nil {
+			return err
+		}
+		return createUser(ctx, dal, authorizer, cfg, strings.ToLower(email), firstName, lastName, confirmed)
+	case "add-team", "remove-team":
+		var team string
+		email, err := commandFlags("user "+action, args[1:], func(flags *flag.FlagSet) {
+			flags.StringVar(&team, "team", "", "")
+		})
+		if err != nil {
+			return err
+		}
+		team = strings.TrimSpace(team)
+		if team == "" {
+			return fmt.Errorf("user %s needs a -team\n%s", action, commandsUsage)
+		}
+		return updateUserTeams(dal, strings.ToLower(email), team, action == "add-team")
+	case "show", "confirm", "disable", "enable", "reset-password", "resend-confirmation":
+	default:
+		return fmt.Errorf("unknown user action %q\n%s", action, commandsUsage)
+	}
+
+	email, err := commandFlags("user "+action, args[1:], nil)
+	if err != nil {
+		return err
+	}
+	email = strings.ToLower(email)
+	switch action {
+	case "show":
+		user, err := dal.FindAnyUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id          %s\nemail       %s\nname        %s %s\nstatus      %s\nteams       %s\ncreated at  %s\n",
+			user.DisplayId, user.Email, user.FirstName, user.LastName, user.Status, strings.Join(user.Teams, ", "), user.CreatedAt.Format("2006-01-02 15:04:05"))
+		return nil
+	case "confirm":
+		before, err := dal.FindAnyUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		if before.Status == models.USER_CONFIRMED {
+			return helpers.UsersErrorAlreadyConfirmed
+		}
+		user, err := authorizer.ConfirmUserWithoutToken(ctx, email)
+		if err != nil {
+			return err
+		}
+		recordCommandAudit(dal, models.AUDIT_CONFIRM, models.AUDIT_TARGET_USER, "", user.DisplayId, statusChange(before.Status, user.Status))
+		fmt.Printf("%s is confirmed\n", email)
+		return nil
+	case "disable", "enable":
+		before, err := dal.FindAnyUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		user, err := authorizer.SetUserDisabled(ctx, email, action == "disable")
+		if err != nil {
+			return err
+		}
+		recordCommandAudit(dal, models.AUDIT_UPDATE, models.AUDIT_TARGET_USER, "", user.DisplayId, statusChange(before.Status, user.Status))
+		fmt.Printf("%s is %s\n", email, user.Status)
+		return nil
+	case "reset-password":
+		user, err := dal.FindActiveUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		err = authorizer.SetPassword(ctx, email, password)
+		if err != nil {
+			return err
+		}
+		recordCommandAudit(dal, models.AUDIT_PASSWORD_RESET, models.AUDIT_TARGET_USER, "", user.DisplayId, nil)
+		fmt.Printf("the password of %s was reset\n", email)
+		return nil
+	case "resend-confirmation":
+		user, err := dal.FindAnyUserByEmail(email)
+		if err != nil {
+			return err
+		}
+		if user.Status == models.USER_DISABLED {
+			return helpers.UsersErrorDisabled
+		}
+		if user.Status != models.USER_NOT_CONFIRMED || user.ConfirmationTokenStatus != models.CONFIRMATION_TOKEN_VALID {
+			return helpers.UsersErrorAlreadyConfirmed
+		}
+		return sendConfirmation(ctx, cfg, email, user.ConfirmationToken)
+	}
+	return nil
+}
+
+func createUser(ctx context.Context, dal db.DAL, authorizer *auth.Authenticator, cfg *config.EnvConfig, email string, firstName string, lastName string, confirmed bool) error {
+	_, err := dal.FindAnyUserByEmail(email)
+	if err == nil {
+		return helpers.UsersErrorEmailTaken
+	} else if err != helpers.AuthenticationErrorLoginUserNotExists {
+		return err
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+	confirmationToken, err := authorizer.Register(ctx, email, password, firstName, lastName)
+	if err != nil {
+		return err
+	}
+	user, err := dal.FindAnyUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	recordCommandAudit(dal, models.AUDIT_CREATE, models.AUDIT_TARGET_USER, "", user.DisplayId, nil)
+	fmt.Printf("created %s with id %s\n", email, user.DisplayId)
+	if confirmed {
+		user, err = authorizer.ConfirmUserWithoutToken(ctx, email)
+		if err != nil {
+			return err
+		}
+		recordCommandAudit(dal, models.AUDIT_CONFIRM, models.AUDIT_TARGET_USER, "", user.DisplayId, statusChange(models.USER_NOT_CONFIRMED, user.Status))
+		fmt.Printf("%s is confirmed\n", email)
+		return nil
+	}
+	return sendConfirmation(ctx, cfg, email, confirmationToken)
+}
+
+// updateUserTeams adds the user to the team or removes them from it. Members
+// of a team may query each other's free/busy times.
+func updateUserTeams(dal db.DAL, email string, team string, join bool) error {
+	user, err := dal.FindAnyUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	teams := []string{}
+	member := false
+	for _, element := range user.Teams {
+		if element == team {
+			member = true
+			if !join {
+				continue
+			}
+		}
+		teams = append(teams, element)
+	}
+	if member == join {
+		fmt.Printf("%s teams: %s\n", email, strings.Join(user.Teams, ", "))
+		return nil
+	}
+	if join {
+		teams = append(teams, team)
+	}
+	err = dal.UpdateUserTeams(user.Id, teams)
+	if err != nil {
+		return err
+	}
+	recordCommandAudit(dal, models.AUDIT_UPDATE, models.AUDIT_TARGET_USER, "", user.DisplayId,
+		map[string]models.AuditChange{"teams": {Before: user.Teams, After: teams}})
+	fmt.Printf("%s teams: %s\n", email, strings.Join(teams, ", "))
+	return nil
+}
+
+// sendConfirmation mails the confirmation link, or prints it when no mail
+// server is configured
+func sendConfirmation(ctx context.Context, cfg *config.EnvConfig, email string, confirmationToken string) error {
+	if cfg.EmailServerAddress == "" {
+		fmt.Printf("no mail server is configured, the confirmation link is %s\n", controllers.ConfirmationLink(cfg, email, confirmationToken))
+		return nil
+	}
+	err := controllers.SendConfirmationMail(ctx, cfg, email, confirmationToken)
+	if err != nil {
+		return fmt.Errorf("failed to send the confirmation email: %s", err)
+	}
+	fmt.Printf("a confirmation email was sent to %s\n", email)
+	return nil
+}
+
+func readPassword() (string, error) {
+	password, err := readSecret("password: ")
+	if err != nil {
+		return "", err
+	}
+	if len(password) < minPasswordLength {
+		return "", helpers.UsersErrorInvalidPassword
+	}
+	return password, nil
+}
+
+func statusChange(before models.UserStatusType, after models.UserStatusType) map[string]models.AuditChange {
+	return map[string]models.AuditChange{"status": {Before: before, After: after}}
+}
@@ -0,0 +1,77 @@
+package config
+
+// Config is the file layer of the configuration, it has a section per
+// environment and only the section of the running environment is used
+type Config struct {
+	Development EnvConfig `yaml:"development"`
+	Test        EnvConfig `yaml:"test"`
+	Production  EnvConfig `yaml:"production"`
+}
+
+// EnvConfig is the configuration of the server. Fields are named in the file
+// by their yaml keys, in the environment by MEETINGS_ and the upper cased key,
+// e.g. MEETINGS_SQL_DSN, and on the command line by flags named after the key,
+// e.g. -sql_dsn, boolean flags may be given bare. Secret fields can be read from a file named by the
+// MEETINGS_<KEY>_FILE variable or the -<key>_file flag instead.
+type EnvConfig struct {
+	Storage                      string   `yaml:"storage"`
+	MongoHost                    string   `yaml:"mongo_host" secret:"true"`
+	SqlDsn                       string   `yaml:"sql_dsn" secret:"true"`
+	Env                          string   `yaml:"env"`
+	EmailServerAddress           string   `yaml:"email_server_address"`
+	EmailServerPort              int      `yaml:"email_server_port"`
+	EmailServerUsername          string   `yaml:"email_server_username"`
+	EmailServerPassword          string   `yaml:"email_server_password" secret:"true"`
+	EmailServerFrom              string   `yaml:"email_server_from"`
+	EmailServerBcc               string   `yaml:"email_server_bcc"`
+	LogPath                      string   `yaml:"log_path"`
+	LogFormat                    string   `yaml:"log_format"`
+	LogLevel                     string   `yaml:"log_level"`
+	LogMaxSizeMb                 int      `yaml:"log_max_size_mb"`
+	LogMaxBackups                int      `yaml:"log_max_backups"`
+	AdminAuth                    string   `yaml:"admin_auth" secret:"true"`
+	DashboardBaseUrl             string   `yaml:"dashboard_base_url"`
+	SessionKey                   string   `yaml:"session_key" secret:"true"`
+	GuestWebsiteUrl              string   `yaml:"guest_website_url"`
+	DisableStartupMigrations     bool     `yaml:"disable_startup_migrations"`
+	TrashRetentionDays           int      `yaml:"trash_retention_days"`
+	Admins                       []string `yaml:"admins"`
+	IdempotencyKeyTtlHours       int      `yaml:"idempotency_key_ttl_hours"`
+	ListenAddress                string   `yaml:"listen_address"`
+	ReadTimeoutSeconds           int      `yaml:"read_timeout_seconds"`
+	WriteTimeoutSeconds          int      `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds           int      `yaml:"idle_timeout_seconds"`
+	ShutdownTimeoutSeconds       int      `yaml:"shutdown_timeout_seconds"`
+	TlsCertFile                  string   `yaml:"tls_cert_file"`
+	TlsKeyFile                   string   `yaml:"tls_key_file"`
+	MaxBodyBytes                 int64    `yaml:"max_body_bytes"`
+	TraceExporter                string   `yaml:"trace_exporter"`
+	TraceEndpoint                string   `yaml:"trace_endpoint"`
+	TraceServiceName             string   `yaml:"trace_service_name"`
+	TraceSamplePercent           int      `yaml:"trace_sample_percent"`
+}
+
+// Defaults is the first layer of the configuration, every other layer
+// overrides it
+func Defaults() EnvConfig {
+	return EnvConfig{
+		Storage: "mongo",
+		MongoHost: "localhost",
+		TrashRetentionDays: 30,
+		IdempotencyKeyTtlHours: 24,
+		ListenAddress: ":4000",
+		ReadTimeoutSeconds: 15,
+		WriteTimeoutSeconds: 30,
+		IdleTimeoutSeconds: 120,
+		ShutdownTimeoutSeconds: 30,
+		MaxBodyBytes: 10 << 20,
+		LogFormat: "text",
+		LogLevel: "info",
+		LogMaxSizeMb: 100,
+		LogMaxBackups: 5,
+		TraceExporter: "none",
+		TraceEndpoint: "http://localhost:4318/v1/traces",
+		TraceServiceName: "meetings-scheduler",
+		TraceSamplePercent: 100,
+	}
+}
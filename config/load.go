@@ -0,0 +1,209 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the names of the environment variables of the configuration
+const EnvPrefix = "MEETINGS_"
+
+// Load builds the configuration of the environment chosen by -env or
+// MEETINGS_ENV out of its layers: the defaults, the section of the file given
+// by -config or MEETINGS_CONFIG, the environment variables and the flags, each
+// overriding the previous one. It returns the arguments left after the flags
+// and fails when the result isn't valid.
+func Load(name string, args []string) (*EnvConfig, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv(EnvPrefix+"CONFIG"), "configuration file (.yml) path")
+	env := flags.String("env", os.Getenv(EnvPrefix+"ENV"), "environment: development | test | production")
+	overrides := map[string]*string{}
+	switches := map[string]*bool{}
+	for _, field := range fields() {
+		// boolean flags are switches, a bare -disable_startup_migrations sets it
+		if field.kind == reflect.Bool {
+			overrides[field.key] = new(string)
+			switches[field.key] = flags.Bool(field.key, false, "overrides "+field.key)
+			continue
+		}
+		names := []string{field.key}
+		if field.secret {
+			names = append(names, field.key+"_file")
+		}
+		for _, name := range names {
+			value := new(string)
+			overrides[name] = value
+			flags.Var(stringFlag{value}, name, "overrides "+field.key)
+		}
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	for key, value := range switches {
+		*overrides[key] = strconv.FormatBool(*value)
+	}
+
+	cfg, err := fileLayer(*configPath, *env)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Env = *env
+
+	values := reflect.ValueOf(cfg).Elem()
+	for _, field := range fields() {
+		variable := EnvPrefix + strings.ToUpper(field.key)
+		raw, ok, err := layerValue(os.Getenv(variable), os.Getenv(variable+"_FILE"), field.secret)
+		if err == nil && ok {
+			err = setField(values.Field(field.index), raw)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", variable, err)
+		}
+
+		if !given[field.key] && !given[field.key+"_file"] {
+			continue
+		}
+		file := ""
+		if field.secret {
+			file = *overrides[field.key+"_file"]
+		}
+		raw, _, err = layerValue(*overrides[field.key], file, field.secret)
+		if err == nil {
+			err = setField(values.Field(field.index), raw)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("-%s: %s", field.key, err)
+		}
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// fileLayer lays the section of the environment over the defaults, keys that
+// aren't known are rejected so typos don't go unnoticed
+func fileLayer(path string, env string) (*EnvConfig, error) {
+	defaults := Defaults()
+	if path == "" {
+		return &defaults, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the configuration file: %s", err)
+	}
+	file := Config{Development: Defaults(), Test: Defaults(), Production: Defaults()}
+	err = yaml.UnmarshalStrict(content, &file)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the configuration file %s: %s", path, err)
+	}
+	switch env {
+	case "development":
+		return &file.Development, nil
+	case "test":
+		return &file.Test, nil
+	case "production":
+		return &file.Production, nil
+	}
+	// an unknown env is reported by Validate along with the other problems
+	return &defaults, nil
+}
+
+// layerValue picks the value of a layer, given directly or, for secrets, read
+// from a file. The value is missing when neither is given.
+func layerValue(value string, file string, secret bool) (string, bool, error) {
+	if file == "" || !secret {
+		return value, value != "", nil
+	}
+	if value != "" {
+		return "", false, fmt.Errorf("given both directly and from a file")
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("reading the secret file: %s", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+type configField struct {
+	index  int
+	key    string
+	kind   reflect.Kind
+	secret bool
+}
+
+// fields lists the fields of EnvConfig set by the layers, env isn't one of
+// them since it chooses the section of the file
+func fields() []configField {
+	list := []configField{}
+	t := reflect.TypeOf(EnvConfig{})
+	for index := 0; index < t.NumField(); index++ {
+		key := t.Field(index).Tag.Get("yaml")
+		if key == "" || key == "env" {
+			continue
+		}
+		list = append(list, configField{index: index, key: key, kind: t.Field(index).Type.Kind(), secret: t.Field(index).Tag.Get("secret") == "true"})
+	}
+	return list
+}
+
+// setField parses a value of the environment or the command line, lists are
+// comma separated
+func setField(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", raw)
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", raw)
+		}
+		field.SetInt(parsed)
+	case reflect.Slice:
+		list := []string{}
+		for _, element := range strings.Split(raw, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				list = append(list, element)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// stringFlag keeps the raw value of a flag, it is parsed once the layers
+// below it are known
+type stringFlag struct {
+	value *string
+}
+
+func (f stringFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f stringFlag) Set(value string) error {
+	*f.value = value
+	return nil
+}
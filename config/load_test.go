@@ -0,0 +1,144 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file in the test's temporary directory and returns its path
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfigFile = `
+test:
+  session_key: file-session-key
+  listen_address: ":5000"
+  trash_retention_days: 7
+  log_level: warning
+  admins: [file@example.com]
+production:
+  listen_address: ":6000"
+`
+
+func TestLoadLayers(t *testing.T) {
+	t.Setenv("MEETINGS_CONFIG", writeFile(t, "config.yml", testConfigFile))
+	t.Setenv("MEETINGS_ENV", "test")
+	t.Setenv("MEETINGS_TRASH_RETENTION_DAYS", "14")
+	t.Setenv("MEETINGS_LOG_LEVEL", "error")
+	t.Setenv("MEETINGS_ADMINS", "env@example.com, other@example.com")
+
+	cfg, args, err := Load("server", []string{"-log_level", "debug", "migrate", "up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ReadTimeoutSeconds != 15 || cfg.Storage != "mongo" {
+		t.Errorf("read_timeout_seconds = %d and storage = %q, want the defaults", cfg.ReadTimeoutSeconds, cfg.Storage)
+	}
+	if cfg.ListenAddress != ":5000" || cfg.SessionKey != "file-session-key" {
+		t.Errorf("listen_address = %q and session_key = %q, want the test section of the file", cfg.ListenAddress, cfg.SessionKey)
+	}
+	if cfg.TrashRetentionDays != 14 || !reflect.DeepEqual(cfg.Admins, []string{"env@example.com", "other@example.com"}) {
+		t.Errorf("trash_retention_days = %d and admins = %v, want the environment over the file", cfg.TrashRetentionDays, cfg.Admins)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("log_level = %q, want the flag over the environment and the file", cfg.LogLevel)
+	}
+	if cfg.Env != "test" || !reflect.DeepEqual(args, []string{"migrate", "up"}) {
+		t.Errorf("env = %q and args = %v, want test and the arguments after the flags", cfg.Env, args)
+	}
+}
+
+func TestLoadBooleanFlags(t *testing.T) {
+	tests := []struct {
+		env  string
+		args []string
+		want bool
+	}{
+		{"", []string{}, false},
+		{"", []string{"-disable_startup_migrations"}, true},
+		{"", []string{"-disable_startup_migrations", "serve"}, true},
+		{"true", []string{"-disable_startup_migrations=false"}, false},
+		{"true", []string{}, true},
+	}
+	t.Setenv("MEETINGS_CONFIG", "")
+	for _, test := range tests {
+		t.Setenv("MEETINGS_DISABLE_STARTUP_MIGRATIONS", test.env)
+		cfg, args, err := Load("server", append([]string{"-env", "test", "-session_key", "key"}, test.args...))
+		if err != nil {
+			t.Errorf("%v: %v", test.args, err)
+			continue
+		}
+		if cfg.DisableStartupMigrations != test.want {
+			t.Errorf("%v with MEETINGS_DISABLE_STARTUP_MIGRATIONS=%q: disable_startup_migrations = %v, want %v", test.args, test.env, cfg.DisableStartupMigrations, test.want)
+		}
+		if len(test.args) > 0 && test.args[len(test.args)-1] == "serve" && !reflect.DeepEqual(args, []string{"serve"}) {
+			t.Errorf("%v: args = %v, want the command after the switch", test.args, args)
+		}
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	t.Setenv("MEETINGS_CONFIG", "")
+	t.Setenv("MEETINGS_ENV", "test")
+	t.Setenv("MEETINGS_SESSION_KEY_FILE", writeFile(t, "session_key", "env-file-session-key\n"))
+	t.Setenv("MEETINGS_SQL_DSN_FILE", writeFile(t, "sql_dsn", "file:env.db"))
+
+	cfg, _, err := Load("server", []string{"-sql_dsn_file", writeFile(t, "flag_sql_dsn", "file:flag.db\r\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SessionKey != "env-file-session-key" {
+		t.Errorf("session_key = %q, want the content of the file without the line break", cfg.SessionKey)
+	}
+	if cfg.SqlDsn != "file:flag.db" {
+		t.Errorf("sql_dsn = %q, want the file of the flag over the file of the environment", cfg.SqlDsn)
+	}
+
+	// a flag given directly replaces a secret file of the environment
+	cfg, _, err = Load("server", []string{"-sql_dsn", "file:direct.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SqlDsn != "file:direct.db" {
+		t.Errorf("sql_dsn = %q, want the flag", cfg.SqlDsn)
+	}
+}
+
+func TestLoadSecretFileErrors(t *testing.T) {
+	t.Setenv("MEETINGS_CONFIG", "")
+	t.Setenv("MEETINGS_ENV", "test")
+	t.Setenv("MEETINGS_SESSION_KEY", "key")
+	t.Setenv("MEETINGS_SESSION_KEY_FILE", writeFile(t, "session_key", "other-key"))
+	if _, _, err := Load("server", nil); err == nil || !strings.Contains(err.Error(), "MEETINGS_SESSION_KEY") {
+		t.Errorf("Load() with a secret given directly and from a file = %v, want an error naming the variable", err)
+	}
+
+	t.Setenv("MEETINGS_SESSION_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("MEETINGS_SESSION_KEY", "")
+	if _, _, err := Load("server", nil); err == nil || !strings.Contains(err.Error(), "reading the secret file") {
+		t.Errorf("Load() with a missing secret file = %v, want a read error", err)
+	}
+
+	// only secrets can be read from files
+	t.Setenv("MEETINGS_SESSION_KEY_FILE", "")
+	t.Setenv("MEETINGS_SESSION_KEY", "key")
+	t.Setenv("MEETINGS_LOG_LEVEL_FILE", writeFile(t, "log_level", "debug"))
+	cfg, _, err := Load("server", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "info" {
+		t.Errorf("log_level = %q, want the default with a file ignored", cfg.LogLevel)
+	}
+	if _, _, err = Load("server", []string{"-log_level_file", "log_level"}); err == nil {
+		t.Errorf("Load() with -log_level_file succeeded, want an unknown flag")
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Validate reports every problem of the configuration at once
+func (cfg *EnvConfig) Validate() error {
+	problems := []string{}
+	problem := func(message string) {
+		problems = append(problems, message)
+	}
+
+	switch cfg.Env {
+	case "development", "test", "production":
+	case "":
+		problem("env is required, set -env or MEETINGS_ENV to development, test or production")
+	default:
+		problem("env must be development, test or production, got " + cfg.Env)
+	}
+
+	switch cfg.Storage {
+	case "mongo":
+		if cfg.MongoHost == "" {
+			problem("mongo_host is required with mongo storage")
+		}
+	case "sqlite", "postgres":
+		if cfg.SqlDsn == "" {
+			problem("sql_dsn is required with " + cfg.Storage + " storage")
+		}
+	default:
+		problem("storage must be mongo, sqlite or postgres, got " + cfg.Storage)
+	}
+
+	if cfg.SessionKey == "" {
+		problem("session_key is required to sign the session cookies")
+	} else if cfg.Env == "production" && len(cfg.SessionKey) < 32 {
+		problem("session_key must be at least 32 characters long in production")
+	}
+	urls := []struct{ key, value string }{{"dashboard_base_url", cfg.DashboardBaseUrl}, {"guest_website_url", cfg.GuestWebsiteUrl}}
+	for _, element := range urls {
+		if element.value == "" {
+			continue
+		}
+		parsed, err := url.Parse(element.value)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problem(element.key + " must be an absolute URL, got " + element.value)
+		}
+	}
+	if cfg.EmailServerAddress != "" {
+		if cfg.EmailServerPort <= 0 || cfg.EmailServerPort > 65535 {
+			problem("email_server_port must be a port number when email_server_address is set")
+		}
+		if cfg.EmailServerFrom == "" {
+			problem("email_server_from is required when email_server_address is set")
+		}
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		problem("log_format must be text or json, got " + cfg.LogFormat)
+	}
+	switch cfg.LogLevel {
+	case "debug", "info", "warning", "error":
+	default:
+		problem("log_level must be debug, info, warning or error, got " + cfg.LogLevel)
+	}
+	if cfg.LogMaxBackups < 0 {
+		problem("log_max_backups must not be negative")
+	}
+
+	switch cfg.TraceExporter {
+	case "none", "stdout":
+	case "otlp":
+		parsed, err := url.Parse(cfg.TraceEndpoint)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problem("trace_endpoint must be an absolute URL with the otlp exporter, got " + cfg.TraceEndpoint)
+		}
+	default:
+		problem("trace_exporter must be none, stdout or otlp, got " + cfg.TraceExporter)
+	}
+	if cfg.TraceSamplePercent < 0 || cfg.TraceSamplePercent > 100 {
+		problem("trace_sample_percent must be between 0 and 100")
+	}
+
+	if cfg.ListenAddress == "" {
+		problem("listen_address is required")
+	}
+	if (cfg.TlsCertFile == "") != (cfg.TlsKeyFile == "") {
+		problem("tls_cert_file and tls_key_file must be set together")
+	}
+	positive := []struct {
+		key   string
+		value int64
+	}{
+		{"trash_retention_days", int64(cfg.TrashRetentionDays)},
+		{"idempotency_key_ttl_hours", int64(cfg.IdempotencyKeyTtlHours)},
+		{"read_timeout_seconds", int64(cfg.ReadTimeoutSeconds)},
+		{"write_timeout_seconds", int64(cfg.WriteTimeoutSeconds)},
+		{"idle_timeout_seconds", int64(cfg.IdleTimeoutSeconds)},
+		{"shutdown_timeout_seconds", int64(cfg.ShutdownTimeoutSeconds)},
+		{"max_body_bytes", cfg.MaxBodyBytes},
+		{"log_max_size_mb", int64(cfg.LogMaxSizeMb)},
+	}
+	for _, element := range positive {
+		if element.value <= 0 {
+			problem(element.key + " must be positive")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+}
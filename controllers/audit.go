@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"github.com/asafron/meetings-scheduler/db"
+	"net/http"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const auditDefaultLimit = 100
+const auditMaxLimit = 1000
+
+type (
+	AuditController struct {
+		dal    db.DAL
+		admins []string
+	}
+)
+
+func NewAuditController(dal db.DAL, admins []string) *AuditController {
+	return &AuditController{dal : dal, admins : admins}
+}
+
+/**
+Lists the audit entries, newest first. Admins may list all of them, everyone else has to ask for the entries of an event they are the admin of, including events in their trash
+ */
+func (ac AuditController) GetAuditEntries(writer http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := db.AuditFilter{
+		Actor: query.Get("actor"),
+		Action: query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetId: query.Get("target_id"),
+		EventDisplayId: query.Get("event_display_id"),
+		Limit: auditDefaultLimit,
+	}
+	var err error
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit < 1 || filter.Limit > auditMaxLimit {
+			helpers.ErrorResponse(writer, helpers.AuditErrorInvalidFilter)
+			return
+		}
+	}
+	for param, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(param); value != "" {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				helpers.ErrorResponse(writer, helpers.AuditErrorInvalidFilter)
+				return
+			}
+			*bound = time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	currentUser := helpers.GetCurrentUser(req)
+	if !ac.isAdmin(currentUser) {
+		allowed, err := ac.ownsEvent(req, currentUser, filter.EventDisplayId)
+		if err != nil {
+			helpers.ErrorResponse(writer, err)
+			return
+		}
+		if !allowed {
+			helpers.ErrorResponse(writer, helpers.AuditErrorNotAllowed)
+			return
+		}
+	}
+
+	entries, err := storage(ac.dal, req).GetAuditEntries(filter)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	m := make(map[string]interface{})
+	m["entries"] = entries
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+// ownsEvent reports whether the user is the admin of the event, whether it
+// was deleted or not
+func (ac AuditController) ownsEvent(req *http.Request, user models.User, eventDisplayId string) (bool, error) {
+	if eventDisplayId == "" {
+		return false, nil
+	}
+	event, err := storage(ac.dal, req).GetEventByDisplayId(eventDisplayId)
+	if err == nil {
+		return event.AdminUser == user.DisplayId, nil
+	}
+	deleted, err := storage(ac.dal, req).GetDeletedEventsForUser(user.DisplayId)
+	if err != nil {
+		return false, err
+	}
+	for _, element := range deleted {
+		if element.DisplayId == eventDisplayId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isAdmin reports whether the user is one of the configured admins
+func (ac AuditController) isAdmin(user models.User) bool {
+	for _, email := range ac.admins {
+		if email == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAudit appends an audit entry for a mutation that already happened, a
+// failure to record it is logged and doesn't fail the request. Before and
+// after are the target as it was and as it became, nil when it didn't exist.
+func recordAudit(dal db.DAL, req *http.Request, actor string, action models.AuditActionType, targetType models.AuditTargetType, eventDisplayId string, targetId string, before interface{}, after interface{}) {
+	entry := models.AuditEntry{
+		Id: bson.NewObjectId(),
+		Actor: actor,
+		Action: action,
+		TargetType: targetType,
+		TargetId: targetId,
+		EventDisplayId: eventDisplayId,
+		Changes: auditChanges(before, after),
+		Ip: helpers.ClientIp(req),
+		CreatedAt: time.Now().UTC(),
+	}
+	err := storage(dal, req).InsertAuditEntry(entry)
+	if err != nil {
+		log.Warnf("failed to record audit entry %s %s %s: %s", action, targetType, targetId, err)
+	}
+}
+
+// auditChanges compares the JSON fields of before and after, the fields that
+// are hidden from JSON, like password hashes, never show up in the audit log
+func auditChanges(before interface{}, after interface{}) map[string]models.AuditChange {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	changes := make(map[string]models.AuditChange)
+	for field, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[field]) {
+			changes[field] = models.AuditChange{Before: value, After: afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes[field] = models.AuditChange{After: value}
+		}
+	}
+	delete(changes, "updated_at")
+	return changes
+}
+
+func auditFields(target interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if target == nil {
+		return fields
+	}
+	encoded, err := json.Marshal(target)
+	if err != nil {
+		log.Warn(err)
+		return fields
+	}
+	json.Unmarshal(encoded, &fields)
+	return fields
+}
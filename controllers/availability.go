@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"github.com/asafron/meetings-scheduler/db"
+	"net/http"
+	"encoding/json"
+	"time"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/availability"
+)
+
+type (
+	AvailabilityController struct {
+		dal db.DAL
+	}
+)
+
+type AddBlackoutRequest struct {
+	EventDisplayId string `json:"event_display_id"`
+	StartTime      int64  `json:"start_time" validate:"required"`
+	EndTime        int64  `json:"end_time" validate:"required"`
+	Reason         string `json:"reason"`
+}
+
+type AddDateOverrideRequest struct {
+	EventDisplayId string `json:"event_display_id"`
+	Date           string `json:"date" validate:"required"`
+	TimeZone       string `json:"time_zone"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+}
+
+type RemoveAvailabilityRuleRequest struct {
+	EventDisplayId string `json:"event_display_id"`
+	DisplayId      string `json:"display_id" validate:"required"`
+}
+
+func NewAvailabilityController(dal db.DAL) *AvailabilityController {
+	return &AvailabilityController{dal : dal}
+}
+
+/**
+Rules without an event display id belong to the current user, otherwise they belong to the event and only its admin may see or change them
+ */
+func (ac AvailabilityController) rules(req *http.Request, eventDisplayId string) (availability.Rules, error) {
+	currentUser := helpers.GetCurrentUser(req)
+	if eventDisplayId == "" {
+		return availability.UserRules(currentUser), nil
+	}
+	event, err := ownedEvent(storage(ac.dal, req), eventDisplayId, currentUser)
+	if err != nil {
+		return availability.Rules{}, err
+	}
+	return availability.EventRules(*event), nil
+}
+
+func (ac AvailabilityController) GetBlackouts(writer http.ResponseWriter, req *http.Request) {
+	rules, err := ac.rules(req, req.URL.Query().Get("event_display_id"))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	m := make(map[string]interface{})
+	m["blackouts"] = rules.Blackouts
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+func (ac AvailabilityController) AddBlackout(writer http.ResponseWriter, req *http.Request) {
+	var request AddBlackoutRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	blackout := models.Blackout{
+		StartTime: time.Unix(request.StartTime, 0).UTC(),
+		EndTime: time.Unix(request.EndTime, 0).UTC(),
+		Reason: request.Reason,
+	}
+	if !blackout.EndTime.After(blackout.StartTime) {
+		helpers.ErrorResponse(writer, helpers.BlackoutsErrorInvalidRange)
+		return
+	}
+	ac.insertBlackouts(writer, req, request.EventDisplayId, []models.Blackout{blackout})
+}
+
+// holidayHorizon is how far ahead recurring calendar entries are imported
+const holidayHorizon = 2
+
+/**
+Imports the entries of an ICS calendar, e.g. public holidays, as blackouts. The calendar is the request body. Recurring entries are imported as their occurrences of the next two years, entries repeating in a way that can't be expanded fail the import and are named in the error
+ */
+func (ac AvailabilityController) ImportHolidays(writer http.ResponseWriter, req *http.Request) {
+	location := time.UTC
+	if timeZone := req.URL.Query().Get("time_zone"); timeZone != "" {
+		loaded, err := time.LoadLocation(timeZone)
+		if err != nil {
+			helpers.ErrorResponse(writer, helpers.SuggestionsErrorInvalidTimeZone)
+			return
+		}
+		location = loaded
+	}
+	now := time.Now().UTC()
+	window := availability.Interval{Start: now, End: now.AddDate(holidayHorizon, 0, 0)}
+	entries, err := availability.ParseICS(req.Body, location, window)
+	if recurrenceErr, ok := err.(*availability.RecurrenceError); ok {
+		apiError := helpers.ToApiError(helpers.BlackoutsErrorUnsupportedRecurrence)
+		for _, element := range recurrenceErr.Entries {
+			apiError.Fields = append(apiError.Fields, helpers.FieldError{Field: "RRULE", Message: element})
+		}
+		helpers.ApiErrorResponse(writer, apiError, nil)
+		return
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.BlackoutsErrorInvalidCalendar)
+		return
+	}
+	blackouts := []models.Blackout{}
+	for _, element := range entries {
+		blackouts = append(blackouts, models.Blackout{
+			StartTime: element.Start,
+			EndTime: element.End,
+			Reason: element.Summary,
+		})
+	}
+	ac.insertBlackouts(writer, req, req.URL.Query().Get("event_display_id"), blackouts)
+}
+
+func (ac AvailabilityController) insertBlackouts(writer http.ResponseWriter, req *http.Request, eventDisplayId string, blackouts []models.Blackout) {
+	if _, err := ac.rules(req, eventDisplayId); err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	currentUser := helpers.GetCurrentUser(req)
+	inserted, err := storage(ac.dal, req).InsertBlackouts(currentUser.DisplayId, eventDisplayId, blackouts)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	for _, element := range inserted {
+		recordAudit(ac.dal, req, currentUser.DisplayId, models.AUDIT_CREATE, models.AUDIT_TARGET_BLACKOUT, eventDisplayId, element.DisplayId, nil, element)
+	}
+	m := make(map[string]interface{})
+	m["blackouts"] = inserted
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+func (ac AvailabilityController) RemoveBlackout(writer http.ResponseWriter, req *http.Request) {
+	var request RemoveAvailabilityRuleRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	rules, err := ac.rules(req, request.EventDisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	currentUser := helpers.GetCurrentUser(req)
+	err = storage(ac.dal, req).RemoveBlackout(currentUser.DisplayId, request.EventDisplayId, request.DisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	for _, element := range rules.Blackouts {
+		if element.DisplayId == request.DisplayId {
+			recordAudit(ac.dal, req, currentUser.DisplayId, models.AUDIT_DELETE, models.AUDIT_TARGET_BLACKOUT, request.EventDisplayId, element.DisplayId, element, nil)
+		}
+	}
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
+
+func (ac AvailabilityController) GetDateOverrides(writer http.ResponseWriter, req *http.Request) {
+	rules, err := ac.rules(req, req.URL.Query().Get("event_display_id"))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	m := make(map[string]interface{})
+	m["date_overrides"] = rules.DateOverrides
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Sets custom hours for a single day, the slots of the day are only available between start and end, given as wall clock times in the time zone of the override. Leaving start and end empty makes the whole day unavailable
+ */
+func (ac AvailabilityController) AddDateOverride(writer http.ResponseWriter, req *http.Request) {
+	var request AddDateOverrideRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	override := models.DateOverride{Date: request.Date, TimeZone: request.TimeZone}
+	day, err := availability.OverrideDay(override)
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.DateOverridesErrorInvalidDate)
+		return
+	}
+	override.StartTime = day.Start
+	override.EndTime = day.Start
+	if request.Start != "" || request.End != "" {
+		start, startErr := parseClock(request.Start, "")
+		end, endErr := parseClock(request.End, "")
+		if startErr != nil || endErr != nil || end <= start {
+			helpers.ErrorResponse(writer, helpers.DateOverridesErrorInvalidHours)
+			return
+		}
+		hours, err := availability.OverrideHours(override, start, end)
+		if err != nil {
+			helpers.ErrorResponse(writer, helpers.DateOverridesErrorInvalidDate)
+			return
+		}
+		override.StartTime = hours.Start
+		override.EndTime = hours.End
+	}
+	if _, err := ac.rules(req, request.EventDisplayId); err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	currentUser := helpers.GetCurrentUser(req)
+	inserted, err := storage(ac.dal, req).InsertDateOverride(currentUser.DisplayId, request.EventDisplayId, override)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	recordAudit(ac.dal, req, currentUser.DisplayId, models.AUDIT_CREATE, models.AUDIT_TARGET_DATE_OVERRIDE, request.EventDisplayId, inserted.DisplayId, nil, inserted)
+	m := make(map[string]interface{})
+	m["date_override"] = inserted
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+func (ac AvailabilityController) RemoveDateOverride(writer http.ResponseWriter, req *http.Request) {
+	var request RemoveAvailabilityRuleRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	rules, err := ac.rules(req, request.EventDisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	currentUser := helpers.GetCurrentUser(req)
+	err = storage(ac.dal, req).RemoveDateOverride(currentUser.DisplayId, request.EventDisplayId, request.DisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	for _, element := range rules.DateOverrides {
+		if element.DisplayId == request.DisplayId {
+			recordAudit(ac.dal, req, currentUser.DisplayId, models.AUDIT_DELETE, models.AUDIT_TARGET_DATE_OVERRIDE, request.EventDisplayId, element.DisplayId, element, nil)
+		}
+	}
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
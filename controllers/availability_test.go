@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func TestAddDateOverrideOnDSTDays(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	ac := NewAvailabilityController(dal)
+	tests := []struct {
+		name  string
+		date  string
+		start time.Time
+		end   time.Time
+	}{
+		{"clocks move forward", "2030-03-10", time.Date(2030, time.March, 10, 13, 0, 0, 0, time.UTC), time.Date(2030, time.March, 10, 21, 0, 0, 0, time.UTC)},
+		{"clocks move back", "2030-11-03", time.Date(2030, time.November, 3, 14, 0, 0, 0, time.UTC), time.Date(2030, time.November, 3, 22, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		body := `{"date": "` + test.date + `", "time_zone": "America/New_York", "start": "09:00", "end": "17:00"}`
+		recorder := call(ac.AddDateOverride, host, "POST", nil, body, nil)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: got %d %s, want 200", test.name, recorder.Code, recorder.Body.String())
+			continue
+		}
+		var response struct {
+			Data struct {
+				DateOverride models.DateOverride `json:"date_override"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		override := response.Data.DateOverride
+		if !override.StartTime.Equal(test.start) || !override.EndTime.Equal(test.end) {
+			t.Errorf("%s: override from %v to %v, want 9:00 to 17:00 New York time, %v to %v", test.name, override.StartTime, override.EndTime, test.start, test.end)
+		}
+	}
+}
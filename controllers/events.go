@@ -1,19 +1,28 @@
 package controllers
 
 import (
+	"encoding/csv"
 	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/asafron/meetings-scheduler/intake"
 	"net/http"
+	"net/mail"
 	"github.com/asafron/meetings-scheduler/helpers"
 	"encoding/json"
-	log "github.com/Sirupsen/logrus"
 	"github.com/asafron/meetings-scheduler/models"
 	"fmt"
-	"github.com/asafron/meetings-scheduler/config"
+	"github.com/gorilla/mux"
+	"strings"
+	"strconv"
+	"time"
+	"sort"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type (
 	EventsController struct {
-		dal *db.DAL
+		dal             db.DAL
+		guestWebsiteUrl string
 	}
 )
 
@@ -22,21 +31,245 @@ type AddEventRequest struct {
 }
 
 type RemoveEventRequest struct {
-	DisplayId string        `json:"display_id"`
+	DisplayId string        `json:"display_id" validate:"required"`
 }
 
-func NewEventsController(dal *db.DAL) *EventsController {
-	return &EventsController{dal : dal}
+type UpdateEventRequest struct {
+	Name string `json:"name" validate:"required"`
 }
 
+// UpdateIntakeFormRequest replaces the intake form of an event, no fields
+// removes it
+type UpdateIntakeFormRequest struct {
+	Fields []models.IntakeField `json:"fields" validate:"required"`
+}
+
+// IntakeAnswersRequest holds the answers of a guest by field key
+type IntakeAnswersRequest struct {
+	Details map[string]string `json:"details" validate:"required"`
+}
+
+// BookMeetingRequest books a meeting of an event with one of its users, the
+// details are the answers to the intake form
+type BookMeetingRequest struct {
+	StartTime time.Time         `json:"start_time" validate:"required"`
+	EndTime   time.Time         `json:"end_time" validate:"required"`
+	User      string            `json:"user" validate:"required"`
+	FirstName string            `json:"first_name"`
+	LastName  string            `json:"last_name"`
+	Email     string            `json:"email" validate:"required"`
+	Phone     string            `json:"phone"`
+	Details   map[string]string `json:"details"`
+}
+
+// PublicEvent is what guests see of an event before they book a meeting
+type PublicEvent struct {
+	DisplayId  string               `json:"display_id"`
+	Name       string               `json:"name"`
+	IntakeForm []models.IntakeField `json:"intake_form"`
+}
+
+func NewEventsController(dal db.DAL, guestWebsiteUrl string) *EventsController {
+	return &EventsController{dal : dal, guestWebsiteUrl : guestWebsiteUrl}
+}
+
+// eventFields are the fields of an event that can be asked for with the
+// fields query parameter
+var eventFields = map[string]bool{
+	"id": true, "display_id": true, "admin_user": true, "name": true, "slots": true, "meetings": true,
+	"blackouts": true, "date_overrides": true, "guest_website": true, "intake_form": true, "version": true, "created_at": true, "updated_at": true,
+}
+
+/**
+Lists every event of the current user with its slots and meetings, ListEventsForUser pages through them
+ */
 func (ec EventsController) GetEventsForUser(writer http.ResponseWriter, req *http.Request) {
-	events := *ec.dal.GetEventsForUser(helpers.GetCurrentUser(req).DisplayId)
+	events := *storage(ec.dal, req).GetEventsForUser(helpers.GetCurrentUser(req).DisplayId)
+	err := db.AttachSlotsAndMeetings(storage(ec.dal, req), events)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	for index, element := range events {
+		events[index].GuestWebsite = fmt.Sprintf("%s/%s", ec.guestWebsiteUrl, element.DisplayId)
+	}
+
+	m := make(map[string]interface{})
+	m["events"] = events
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Lists the events of the current user a page at a time. The events can be filtered by name, by having slots between from and to and by having upcoming meetings, sorted with sort and narrowed down to some of their fields with fields. next_cursor is set when there are more events to fetch with the cursor parameter
+ */
+func (ec EventsController) ListEventsForUser(writer http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	query := db.EventsQuery{
+		AdminUser: helpers.GetCurrentUser(req).DisplayId,
+		Name: params.Get("name"),
+		Sort: db.EventsSortCreatedAt,
+	}
+	sort := params.Get("sort")
+	if sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.Sort = strings.TrimPrefix(sort, "-")
+		if query.Sort != db.EventsSortCreatedAt && query.Sort != db.EventsSortUpdatedAt && query.Sort != db.EventsSortName {
+			helpers.ErrorResponse(writer, helpers.EventsErrorInvalidSort)
+			return
+		}
+	} else {
+		sort = query.Sort
+	}
+	fields := []string{}
+	requested := map[string]bool{}
+	if value := params.Get("fields"); value != "" {
+		fields = strings.Split(value, ",")
+		for _, field := range fields {
+			if !eventFields[field] {
+				helpers.ErrorResponse(writer, helpers.EventsErrorInvalidFields)
+				return
+			}
+			requested[field] = true
+		}
+	}
+	var err error
+	if query.SlotsFrom, err = pageTime(req, "from"); err == nil {
+		query.SlotsTo, err = pageTime(req, "to")
+	}
+	if err == nil {
+		query.Limit, err = pageLimit(req)
+	}
+	if err == nil {
+		query.After, err = pageCursor(req, sort)
+	}
+	if err == nil {
+		if value := params.Get("has_upcoming_meetings"); value != "" {
+			var upcoming bool
+			upcoming, err = strconv.ParseBool(value)
+			if err != nil {
+				err = helpers.PagesErrorInvalidFilter
+			} else if upcoming {
+				query.UpcomingAfter = time.Now().UTC()
+			}
+		}
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	// one more event than asked for tells whether there is a next page
+	query.Limit++
+	events, err := storage(ec.dal, req).QueryEvents(query)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	var next *db.PageCursor
+	if len(events) == query.Limit {
+		events = events[:len(events)-1]
+		last := events[len(events)-1]
+		next = &db.PageCursor{Sort: sort, Time: last.CreatedAt, DisplayId: last.DisplayId}
+		if query.Sort == db.EventsSortUpdatedAt {
+			next.Time = last.UpdatedAt
+		} else if query.Sort == db.EventsSortName {
+			next = &db.PageCursor{Sort: sort, Name: last.Name, DisplayId: last.DisplayId}
+		}
+	}
+	if len(fields) == 0 || requested["slots"] || requested["meetings"] {
+		err = db.AttachSlotsAndMeetings(storage(ec.dal, req), events)
+		if err != nil {
+			helpers.ErrorResponse(writer, err)
+			return
+		}
+	}
 	for index, element := range events {
-		events[index].GuestWebsite = fmt.Sprintf("%s/%s", config.GetConfigWrapper().GetCurrent().GuestWebsiteUrl, element.DisplayId)
+		events[index].GuestWebsite = fmt.Sprintf("%s/%s", ec.guestWebsiteUrl, element.DisplayId)
 	}
 
 	m := make(map[string]interface{})
 	m["events"] = events
+	if len(fields) > 0 {
+		m["events"], err = sparseFields(events, fields)
+		if err != nil {
+			helpers.ErrorResponse(writer, err)
+			return
+		}
+	}
+	if next != nil {
+		m["next_cursor"] = encodeCursor(*next)
+	}
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Lists the slots of an event the current user is the admin of by start time, a page at a time. from and to keep the slots overlapping the range
+ */
+func (ec EventsController) GetEventSlots(writer http.ResponseWriter, req *http.Request) {
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	query, err := pageRange(req, event.DisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	query.Limit++
+	slots, err := storage(ec.dal, req).QuerySlots(query)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	m := make(map[string]interface{})
+	if len(slots) == query.Limit {
+		slots = slots[:len(slots)-1]
+		last := slots[len(slots)-1]
+		m["next_cursor"] = encodeCursor(db.PageCursor{Sort: db.RangeSortStartTime, Time: last.StartTime, DisplayId: last.DisplayId})
+	}
+	m["slots"] = slots
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Lists the meetings of an event the current user is the admin of by start time, a page at a time. from and to keep the meetings overlapping the range
+ */
+func (ec EventsController) GetEventMeetings(writer http.ResponseWriter, req *http.Request) {
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	query, err := pageRange(req, event.DisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	query.Limit++
+	meetings, err := storage(ec.dal, req).QueryMeetings(query)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	m := make(map[string]interface{})
+	if len(meetings) == query.Limit {
+		meetings = meetings[:len(meetings)-1]
+		last := meetings[len(meetings)-1]
+		m["next_cursor"] = encodeCursor(db.PageCursor{Sort: db.RangeSortStartTime, Time: last.StartTime, DisplayId: last.DisplayId})
+	}
+	m["meetings"] = meetings
 	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
 		Success: true,
 		Data: m,
@@ -48,22 +281,25 @@ func (ec EventsController) AddEventForUser(writer http.ResponseWriter, req *http
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&request)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 
-	err := ec.dal.InsertEvent(request.Name, helpers.GetCurrentUser(req).DisplayId, []models.Slot{}, []models.Meeting{})
+	currentUser := helpers.GetCurrentUser(req)
+	event, err := storage(ec.dal, req).InsertEvent(request.Name, currentUser.DisplayId)
 	if err != nil {
-		log.Fatal(err)
-		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
-			Success: false,
-			Message: helpers.GeneralErrorInternal.Error(),
-		})
+		helpers.RequestLogger(req).Error(err)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
 		return
 	}
+	recordAudit(ec.dal, req, currentUser.DisplayId, models.AUDIT_CREATE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, nil, event)
 
+	m := make(map[string]interface{})
+	m["event"] = event
+	writer.Header().Set("ETag", helpers.ETag(event.Version))
 	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
 		Success: true,
+		Data: m,
 	})
 }
 
@@ -72,20 +308,463 @@ func (ec EventsController) RemoveEvent(writer http.ResponseWriter, req *http.Req
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&request)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	ec.removeEvent(writer, req, request.DisplayId)
+}
+
+/**
+Moves the event of the path to the trash
+ */
+func (ec EventsController) RemoveEventById(writer http.ResponseWriter, req *http.Request) {
+	ec.removeEvent(writer, req, mux.Vars(req)["id"])
+}
+
+func (ec EventsController) removeEvent(writer http.ResponseWriter, req *http.Request, displayId string) {
+	event, err := ownedEvent(storage(ec.dal, req), displayId, helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	version, err := expectedEventVersion(req, event)
+	if err == nil {
+		err = storage(ec.dal, req).RemoveEvent(event.DisplayId, version, helpers.GetCurrentUser(req).DisplayId)
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	recordAudit(ec.dal, req, helpers.GetCurrentUser(req).DisplayId, models.AUDIT_DELETE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, event, nil)
+
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
+
+/**
+Returns an event the current user is the admin of with its slots and meetings, its version is the ETag
+ */
+func (ec EventsController) GetEvent(writer http.ResponseWriter, req *http.Request) {
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	events := []models.Event{*event}
+	err = db.AttachSlotsAndMeetings(storage(ec.dal, req), events)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	events[0].GuestWebsite = fmt.Sprintf("%s/%s", ec.guestWebsiteUrl, event.DisplayId)
+
+	m := make(map[string]interface{})
+	m["event"] = events[0]
+	writer.Header().Set("ETag", helpers.ETag(event.Version))
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Renames an event the current user is the admin of, If-Match guards against overwriting a concurrent change
+ */
+func (ec EventsController) UpdateEvent(writer http.ResponseWriter, req *http.Request) {
+	var request UpdateEventRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 
-	err := ec.dal.RemoveEvent(request.DisplayId)
+	currentUser := helpers.GetCurrentUser(req)
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], currentUser)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	version, err := expectedEventVersion(req, event)
+	if err == nil {
+		version, err = storage(ec.dal, req).UpdateEvent(event.DisplayId, version, request.Name, event.AdminUser)
+	}
 	if err != nil {
-		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
-			Success: false,
-			Message: helpers.GeneralErrorInternal.Error(),
-		})
+		helpers.ErrorResponse(writer, err)
 		return
 	}
+	updated := *event
+	updated.Name = request.Name
+	updated.Version = version
+	recordAudit(ec.dal, req, currentUser.DisplayId, models.AUDIT_UPDATE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, event, updated)
 
+	writer.Header().Set("ETag", helpers.ETag(version))
 	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
 		Success: true,
 	})
+}
+
+/**
+Returns one meeting of an event the current user is the admin of
+ */
+func (ec EventsController) GetEventMeeting(writer http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	event, err := ownedEvent(storage(ec.dal, req), vars["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	meetings, err := storage(ec.dal, req).GetMeetingsForEvents([]string{event.DisplayId})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	for _, element := range meetings {
+		if element.DisplayId == vars["meeting_id"] {
+			m := make(map[string]interface{})
+			m["meeting"] = element
+			helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+				Success: true,
+				Data: m,
+			})
+			return
+		}
+	}
+	helpers.ErrorResponse(writer, helpers.MeetingsErrorNotFound)
+}
+
+/**
+Replaces the intake form guests fill in when they book a meeting of an event the current user is the admin of, If-Match guards against overwriting a concurrent change
+ */
+func (ec EventsController) UpdateEventIntakeForm(writer http.ResponseWriter, req *http.Request) {
+	var request UpdateIntakeFormRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	if request.Fields == nil {
+		request.Fields = []models.IntakeField{}
+	}
+	if fieldErrors := intake.ValidateForm(request.Fields); len(fieldErrors) > 0 {
+		apiError := helpers.ToApiError(helpers.EventsErrorInvalidIntakeForm)
+		apiError.Fields = fieldErrors
+		helpers.ApiErrorResponse(writer, apiError, nil)
+		return
+	}
+
+	currentUser := helpers.GetCurrentUser(req)
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], currentUser)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	version, err := expectedEventVersion(req, event)
+	if err == nil {
+		version, err = storage(ec.dal, req).UpdateEventIntakeForm(event.DisplayId, version, request.Fields)
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	updated := *event
+	updated.IntakeForm = request.Fields
+	updated.Version = version
+	recordAudit(ec.dal, req, currentUser.DisplayId, models.AUDIT_UPDATE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, event, updated)
+
+	m := make(map[string]interface{})
+	m["intake_form"] = request.Fields
+	writer.Header().Set("ETag", helpers.ETag(version))
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Returns the name and the intake form of an event to guests, without a session
+ */
+func (ec EventsController) GetPublicEvent(writer http.ResponseWriter, req *http.Request) {
+	event, err := storage(ec.dal, req).GetEventByDisplayId(mux.Vars(req)["id"])
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.EventsErrorNotFound)
+		return
+	}
+	m := make(map[string]interface{})
+	m["event"] = publicEvent(event)
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Checks the answers of a guest against the intake form of an event, without a session, and returns them as they are stored in the guest details of the meeting
+ */
+func (ec EventsController) ValidateIntakeAnswers(writer http.ResponseWriter, req *http.Request) {
+	var request IntakeAnswersRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	event, err := storage(ec.dal, req).GetEventByDisplayId(mux.Vars(req)["id"])
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.EventsErrorNotFound)
+		return
+	}
+	details, fieldErrors := intake.ValidateAnswers(event.IntakeForm, request.Details)
+	if len(fieldErrors) > 0 {
+		apiError := helpers.ToApiError(helpers.MeetingsErrorInvalidAnswers)
+		apiError.Fields = fieldErrors
+		helpers.ApiErrorResponse(writer, apiError, nil)
+		return
+	}
+	m := make(map[string]interface{})
+	m["details"] = details
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Books a meeting of an event for a guest, without a session. The meeting takes one interval of a slot of the user the guest is free in and the answers to the intake form are kept in the guest details
+ */
+func (ec EventsController) BookMeeting(writer http.ResponseWriter, req *http.Request) {
+	var request BookMeetingRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	event, err := storage(ec.dal, req).GetEventByDisplayId(mux.Vars(req)["id"])
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.EventsErrorNotFound)
+		return
+	}
+	details, fieldErrors := intake.ValidateAnswers(event.IntakeForm, request.Details)
+	if address, err := mail.ParseAddress(request.Email); err != nil || address.Address != request.Email {
+		fieldErrors = append(fieldErrors, helpers.FieldError{Field: "email", Message: "must be an email address"})
+	}
+	if len(fieldErrors) > 0 {
+		apiError := helpers.ToApiError(helpers.MeetingsErrorInvalidAnswers)
+		apiError.Fields = fieldErrors
+		helpers.ApiErrorResponse(writer, apiError, nil)
+		return
+	}
+
+	booked := availability.Interval{Start: request.StartTime.UTC(), End: request.EndTime.UTC()}
+	if booked.Empty() {
+		helpers.ErrorResponse(writer, helpers.MeetingsErrorUnavailable)
+		return
+	}
+	users, err := storage(ec.dal, req).FindActiveUsersByDisplayIds([]string{request.User})
+	if err != nil || len(users) == 0 {
+		helpers.ErrorResponse(writer, helpers.MeetingsErrorUnavailable)
+		return
+	}
+	slots, err := storage(ec.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	meetings, err := storage(ec.dal, req).GetMeetingsForUsers([]string{request.User}, booked.Start, booked.End)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	eventRules := map[string]availability.Rules{event.DisplayId: availability.EventRules(*event)}
+	schedule := availability.UserSchedule(users[0], slots, meetings, eventRules, booked)
+	// checked again by InsertMeeting, a concurrent booking of the same time
+	// makes it fail with MeetingsErrorTimeTaken
+	if !availability.Bookable(slots, request.User, booked, schedule.Free) {
+		helpers.ErrorResponse(writer, helpers.MeetingsErrorUnavailable)
+		return
+	}
+
+	now := time.Now().UTC()
+	meeting := models.Meeting{
+		Id: bson.NewObjectId(),
+		DisplayId: helpers.RandStringBytesMaskImprSrc(8),
+		EventDisplayId: event.DisplayId,
+		StartTime: booked.Start,
+		EndTime: booked.End,
+		UserId: request.User,
+		Guest: models.Guest{
+			Id: bson.NewObjectId(),
+			DisplayId: helpers.RandStringBytesMaskImprSrc(8),
+			FirstName: strings.TrimSpace(request.FirstName),
+			LastName: strings.TrimSpace(request.LastName),
+			Email: request.Email,
+			Phone: strings.TrimSpace(request.Phone),
+			Details: details,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	err = claimEventVersion(ec.dal, writer, req, event, func(dal db.DAL) error {
+		return dal.InsertMeeting(meeting)
+	})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	recordAudit(ec.dal, req, meeting.Guest.Email, models.AUDIT_CREATE, models.AUDIT_TARGET_MEETING, event.DisplayId, meeting.DisplayId, nil, meeting)
+
+	m := make(map[string]interface{})
+	m["meeting"] = meeting
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+func publicEvent(event *models.Event) PublicEvent {
+	form := event.IntakeForm
+	if form == nil {
+		form = []models.IntakeField{}
+	}
+	return PublicEvent{DisplayId: event.DisplayId, Name: event.Name, IntakeForm: form}
+}
+
+/**
+Downloads the meetings of an event as a CSV file with a row per meeting, its times in the time_zone of the query and its guest fields. Every key of the guest details gets its own details.<key> column
+ */
+func (ec EventsController) ExportEventMeetings(writer http.ResponseWriter, req *http.Request) {
+	event, err := ownedEvent(storage(ec.dal, req), mux.Vars(req)["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	location := time.UTC
+	if timeZone := req.URL.Query().Get("time_zone"); timeZone != "" {
+		location, err = time.LoadLocation(timeZone)
+		if err != nil {
+			helpers.ErrorResponse(writer, helpers.SuggestionsErrorInvalidTimeZone)
+			return
+		}
+	}
+	meetings, err := storage(ec.dal, req).GetMeetingsForEvents([]string{event.DisplayId})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	sort.SliceStable(meetings, func(a, b int) bool {
+		return meetings[a].StartTime.Before(meetings[b].StartTime)
+	})
+
+	detailKeys := []string{}
+	seen := make(map[string]bool)
+	for _, element := range meetings {
+		for key := range element.Guest.Details {
+			if !seen[key] {
+				seen[key] = true
+				detailKeys = append(detailKeys, key)
+			}
+		}
+	}
+	sort.Strings(detailKeys)
+	header := []string{"display_id", "start_time", "end_time", "user", "first_name", "last_name", "email", "phone"}
+	for _, key := range detailKeys {
+		header = append(header, "details."+key)
+	}
+
+	writer.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-meetings.csv\"", event.DisplayId))
+	records := csv.NewWriter(writer)
+	records.Write(header)
+	for _, element := range meetings {
+		guest := element.Guest
+		record := []string{element.DisplayId, element.StartTime.In(location).Format(time.RFC3339), element.EndTime.In(location).Format(time.RFC3339),
+			element.UserId, csvText(guest.FirstName), csvText(guest.LastName), csvText(guest.Email), csvText(guest.Phone)}
+		for _, key := range detailKeys {
+			record = append(record, csvText(guest.Details[key]))
+		}
+		records.Write(record)
+	}
+	records.Flush()
+	if err := records.Error(); err != nil {
+		helpers.RequestLogger(req).Warn(err)
+	}
+}
+
+// csvText keeps text the guests typed from being taken for a formula by
+// spreadsheets
+func csvText(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+// storage is the DAL as used on behalf of the request, so its calls are traced
+// as part of it
+func storage(dal db.DAL, req *http.Request) db.DAL {
+	return db.WithContext(dal, req.Context())
+}
+
+// ownedEvent loads the event and makes sure the user is its admin
+func ownedEvent(dal db.DAL, displayId string, user models.User) (*models.Event, error) {
+	event, err := dal.GetEventByDisplayId(displayId)
+	if err != nil {
+		return nil, helpers.EventsErrorNotFound
+	}
+	if event.AdminUser != user.DisplayId {
+		return nil, helpers.EventsErrorNotAllowed
+	}
+	return event, nil
+}
+
+// expectedEventVersion is the version the client asked for with If-Match, or
+// the version the event had when it was loaded. An If-Match the loaded event
+// is already past fails the precondition, a change made after the event was
+// loaded is reported as a conflict by the storage.
+func expectedEventVersion(req *http.Request, event *models.Event) (int, error) {
+	version, ok, err := helpers.IfMatchVersion(req)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return event.Version, nil
+	}
+	if version != event.Version {
+		return 0, helpers.EventsErrorStaleVersion
+	}
+	return version, nil
+}
+
+// claimEventVersion moves the event to its next version and then writes its
+// slots or meetings with write, so a concurrent change of the same event fails
+// with a conflict instead of being silently overwritten. A failed write gives
+// the version back, unless part of it was saved, so clients holding the ETag
+// don't have to reload for a change that didn't happen. The new ETag is set on
+// the response once the write is done.
+func claimEventVersion(dal db.DAL, writer http.ResponseWriter, req *http.Request, event *models.Event, write func(dal db.DAL) error) error {
+	version, err := expectedEventVersion(req, event)
+	if err != nil {
+		return err
+	}
+	version, err = storage(dal, req).IncrementEventVersion(event.DisplayId, version)
+	if err != nil {
+		return err
+	}
+	err = write(storage(dal, req))
+	if err != nil {
+		if err != helpers.SlotsErrorPartialMerge && err != helpers.SlotsErrorPartialUpdate {
+			if revertErr := storage(dal, req).RevertEventVersion(event.DisplayId, version); revertErr != nil {
+				helpers.RequestLogger(req).Warn(revertErr)
+			}
+		}
+		return err
+	}
+	event.Version = version
+	writer.Header().Set("ETag", helpers.ETag(version))
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// newTestDAL opens an empty SQLite database with the schema migrated
+func newTestDAL(t *testing.T) *db.SQLDAL {
+	dal := db.NewSQLDatabaseAccessor(db.SQLDialectSQLite, filepath.Join(t.TempDir(), "meetings.db"))
+	if err := dal.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dal.Close)
+	return dal
+}
+
+// newTestUser stores a confirmed user
+func newTestUser(t *testing.T, dal db.DAL, email string) models.User {
+	if err := dal.InsertUser(email, []byte("hash"), "Test", "User", "token-"+email); err != nil {
+		t.Fatal(err)
+	}
+	user, err := dal.FindAnyUserByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dal.UpdateUserConfirmation(user.Id, models.USER_CONFIRMED, models.CONFIRMATION_TOKEN_INVALID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Status = models.USER_CONFIRMED
+	return *user
+}
+
+// newTestEvent stores an event of the user with a slot of the user from 9 to
+// 12 on March 4th 2030
+func newTestEvent(t *testing.T, dal db.DAL, user models.User) (*models.Event, models.Slot) {
+	event, err := dal.InsertEvent("Interviews", user.DisplayId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2030, time.March, 4, 9, 0, 0, 0, time.UTC)
+	now := time.Now().UTC()
+	slot := models.Slot{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), EventDisplayId: event.DisplayId,
+		StartTime: start, EndTime: start.Add(3 * time.Hour), User: user.DisplayId, Interval: 30, CreatedAt: now, UpdatedAt: now}
+	if err = dal.InsertSlots(event.DisplayId, []models.Slot{slot}); err != nil {
+		t.Fatal(err)
+	}
+	return event, slot
+}
+
+// call runs the handler as the route with the path variables would, on behalf
+// of the user unless the user is empty
+func call(handler http.HandlerFunc, user models.User, method string, vars map[string]string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req = mux.SetURLVars(req, vars)
+	if user.DisplayId != "" {
+		helpers.SetCurrentUser(req, user)
+	}
+	recorder := httptest.NewRecorder()
+	handler(recorder, req)
+	return recorder
+}
+
+// errorCode is the code of the API error of a failed response
+func errorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var response helpers.GeneralResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	if response.Error == nil {
+		return ""
+	}
+	return response.Error.Code
+}
+
+func eventVersion(t *testing.T, dal db.DAL, displayId string) int {
+	event, err := dal.GetEventByDisplayId(displayId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event.Version
+}
+
+func TestUpdateEventIfMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+		code    string
+		etag    string
+	}{
+		{"without If-Match", "", http.StatusOK, "", `"2"`},
+		{"current version", `"1"`, http.StatusOK, "", `"2"`},
+		{"weak current version", `W/"1"`, http.StatusOK, "", `"2"`},
+		{"any version", "*", http.StatusOK, "", `"2"`},
+		{"stale version", `"0"`, http.StatusPreconditionFailed, "stale_version", ""},
+		{"future version", `"7"`, http.StatusPreconditionFailed, "stale_version", ""},
+		{"not a version", `"one"`, http.StatusBadRequest, "invalid_if_match", ""},
+	}
+	for _, test := range tests {
+		dal := newTestDAL(t)
+		host := newTestUser(t, dal, "host@example.com")
+		event, _ := newTestEvent(t, dal, host)
+		ec := NewEventsController(dal, "https://guests.example.com")
+
+		header := http.Header{}
+		if test.ifMatch != "" {
+			header.Set("If-Match", test.ifMatch)
+		}
+		recorder := call(ec.UpdateEvent, host, "PATCH", map[string]string{"id": event.DisplayId}, `{"name": "Renamed"}`, header)
+		if recorder.Code != test.status || errorCode(t, recorder) != test.code {
+			t.Errorf("%s: got %d %s, want %d %q", test.name, recorder.Code, recorder.Body.String(), test.status, test.code)
+		}
+		if etag := recorder.Header().Get("ETag"); etag != test.etag {
+			t.Errorf("%s: ETag = %q, want %q", test.name, etag, test.etag)
+		}
+		wantVersion := 1
+		if test.status == http.StatusOK {
+			wantVersion = 2
+		}
+		if version := eventVersion(t, dal, event.DisplayId); version != wantVersion {
+			t.Errorf("%s: event is at version %d, want %d", test.name, version, wantVersion)
+		}
+	}
+}
+
+func TestRemoveSlotWithStaleVersion(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	event, slot := newTestEvent(t, dal, host)
+	sc := NewSlotsController(dal)
+	vars := map[string]string{"id": event.DisplayId, "slot_id": slot.DisplayId}
+
+	// the event moves on after the client read it
+	if _, err := dal.UpdateEvent(event.DisplayId, 1, "Renamed", host.DisplayId); err != nil {
+		t.Fatal(err)
+	}
+	recorder := call(sc.RemoveEventSlot, host, "DELETE", vars, "", http.Header{"If-Match": {`"1"`}})
+	if recorder.Code != http.StatusPreconditionFailed || errorCode(t, recorder) != "stale_version" {
+		t.Errorf("stale If-Match: got %d %s, want 412 stale_version", recorder.Code, recorder.Body.String())
+	}
+	slots, err := dal.GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil || len(slots) != 1 {
+		t.Errorf("slots after a stale removal = %v %v, want the slot kept", slots, err)
+	}
+
+	recorder = call(sc.RemoveEventSlot, host, "DELETE", vars, "", http.Header{"If-Match": {`"2"`}})
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"3"` {
+		t.Errorf("current If-Match: got %d ETag %q %s, want 200 with ETag \"3\"", recorder.Code, recorder.Header().Get("ETag"), recorder.Body.String())
+	}
+}
+
+func TestClaimEventVersion(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	event, _ := newTestEvent(t, dal, host)
+	claim := func(loaded int, write func(dal db.DAL) error) (error, string) {
+		req := httptest.NewRequest("POST", "/", nil)
+		recorder := httptest.NewRecorder()
+		copied := *event
+		copied.Version = loaded
+		return claimEventVersion(dal, recorder, req, &copied, write), recorder.Header().Get("ETag")
+	}
+	succeed := func(dal db.DAL) error { return nil }
+
+	failure := errors.New("disk full")
+	err, etag := claim(1, func(dal db.DAL) error { return failure })
+	if err != failure || etag != "" {
+		t.Errorf("failed write: got %v with ETag %q, want the write error without an ETag", err, etag)
+	}
+	if version := eventVersion(t, dal, event.DisplayId); version != 1 {
+		t.Errorf("failed write left the event at version %d, want 1", version)
+	}
+
+	err, etag = claim(1, succeed)
+	if err != nil || etag != `"2"` {
+		t.Errorf("write: got %v with ETag %q, want ETag \"2\"", err, etag)
+	}
+
+	// a client that loaded the event before the last change conflicts with it
+	err, _ = claim(1, succeed)
+	if err != helpers.EventsErrorVersionConflict {
+		t.Errorf("concurrent change: got %v, want a version conflict", err)
+	}
+
+	err, _ = claim(2, func(dal db.DAL) error { return helpers.SlotsErrorPartialMerge })
+	if err != helpers.SlotsErrorPartialMerge {
+		t.Errorf("partial write: got %v, want SlotsErrorPartialMerge", err)
+	}
+	if version := eventVersion(t, dal, event.DisplayId); version != 3 {
+		t.Errorf("partial write left the event at version %d, want the claimed version 3", version)
+	}
+}
+
+// Two guests booking the same time of a host, through two events of the host,
+// at the same time: only one of them gets the meeting.
+func TestBookMeetingRace(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	first, _ := newTestEvent(t, dal, host)
+	second, _ := newTestEvent(t, dal, host)
+	ec := NewEventsController(dal, "https://guests.example.com")
+
+	results := make(chan *httptest.ResponseRecorder)
+	for index, event := range []*models.Event{first, second} {
+		body := fmt.Sprintf(`{"start_time": "2030-03-04T09:00:00Z", "end_time": "2030-03-04T09:30:00Z", "user": %q, "email": "guest%d@example.com"}`, host.DisplayId, index)
+		go func(displayId string, body string) {
+			results <- call(ec.BookMeeting, models.User{}, "POST", map[string]string{"id": displayId}, body, nil)
+		}(event.DisplayId, body)
+	}
+	statuses := map[int]int{}
+	for range []int{0, 1} {
+		recorder := <-results
+		statuses[recorder.Code]++
+		if recorder.Code == http.StatusConflict {
+			if code := errorCode(t, recorder); code != "meeting_time_taken" && code != "meeting_time_unavailable" {
+				t.Errorf("losing booking failed with %s, want the time taken or unavailable", code)
+			}
+		}
+	}
+	if statuses[http.StatusOK] != 1 || statuses[http.StatusConflict] != 1 {
+		t.Errorf("bookings answered %v, want one 200 and one 409", statuses)
+	}
+	meetings, err := dal.GetMeetingsForUsers([]string{host.DisplayId}, time.Time{}, time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(meetings) != 1 {
+		t.Errorf("host has meetings %+v %v, want one", meetings, err)
+	}
+}
+
+// The legacy GET /events keeps returning every event in one response, the
+// paging is on GET /v2/events
+func TestListEventsPagingIsOnlyOnV2(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	ec := NewEventsController(dal, "https://guests.example.com")
+	newTestEvent(t, dal, host)
+	for count := 1; count <= 50; count++ {
+		if _, err := dal.InsertEvent("Interviews", host.DisplayId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(handler http.HandlerFunc) (int, []models.Event, map[string]interface{}) {
+		recorder := call(handler, host, "GET", nil, "", nil)
+		var response struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		events := []models.Event{}
+		if err := json.Unmarshal(response.Data["events"], &events); err != nil {
+			t.Fatal(err)
+		}
+		data := map[string]interface{}{}
+		for key := range response.Data {
+			data[key] = true
+		}
+		return recorder.Code, events, data
+	}
+
+	code, events, data := list(ec.GetEventsForUser)
+	if code != http.StatusOK || len(events) != 51 || data["next_cursor"] != nil {
+		t.Errorf("GET /events got %d with %d events and %v, want all 51 events without a cursor", code, len(events), data)
+	}
+	slots := 0
+	for _, event := range events {
+		slots += len(event.Slots)
+	}
+	if slots != 1 {
+		t.Errorf("GET /events returned %d slots, want the events with their slots", slots)
+	}
+
+	code, events, data = list(ec.ListEventsForUser)
+	if code != http.StatusOK || len(events) != 50 || data["next_cursor"] == nil {
+		t.Errorf("GET /v2/events got %d with %d events and %v, want a page of 50 and a cursor", code, len(events), data)
+	}
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"github.com/asafron/meetings-scheduler/db"
+	"net/http"
+	"encoding/json"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+type (
+	FreeBusyController struct {
+		dal db.DAL
+	}
+)
+
+type FreeBusyRequest struct {
+	Users     []string `json:"users" validate:"required"`
+	StartTime int64    `json:"start_time" validate:"required"`
+	EndTime   int64    `json:"end_time" validate:"required"`
+}
+
+func NewFreeBusyController(dal db.DAL) *FreeBusyController {
+	return &FreeBusyController{dal : dal}
+}
+
+/**
+Returns the merged busy intervals and the common free windows of the requested users. The busy times are the booked meetings and the users' blackouts, calendars imported as ICS included; no external calendar is queried. Users may query themselves and the members of their teams, teams are managed with the user add-team and remove-team commands
+ */
+func (fc FreeBusyController) QueryFreeBusy(writer http.ResponseWriter, req *http.Request) {
+	var request FreeBusyRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	//validate request
+	if len(request.Users) == 0 {
+		helpers.ErrorResponse(writer, helpers.FreeBusyErrorNoUsers)
+		return
+	}
+	window := availability.Interval{Start: time.Unix(request.StartTime, 0).UTC(), End: time.Unix(request.EndTime, 0).UTC()}
+	if window.Empty() {
+		helpers.ErrorResponse(writer, helpers.FreeBusyErrorInvalidRange)
+		return
+	}
+
+	//users may only query themselves and their colleagues
+	currentUser := helpers.GetCurrentUser(req)
+	users, err := storage(fc.dal, req).FindActiveUsersByDisplayIds(request.Users)
+	if err != nil {
+		log.Warn(err)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+		return
+	}
+	found := make(map[string]bool)
+	for _, element := range users {
+		if element.DisplayId != currentUser.DisplayId && !currentUser.SharesTeamWith(element) {
+			helpers.ErrorResponse(writer, helpers.FreeBusyErrorNotColleague)
+			return
+		}
+		found[element.DisplayId] = true
+	}
+	for _, element := range request.Users {
+		if !found[element] {
+			helpers.ErrorResponse(writer, helpers.FreeBusyErrorUserNotFound)
+			return
+		}
+	}
+
+	schedules, err := loadSchedules(storage(fc.dal, req), request.Users, window)
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+		return
+	}
+	freeBusy := availability.ComputeFreeBusy(users, schedules.slots, schedules.meetings, schedules.eventRules, window)
+
+	m := make(map[string]interface{})
+	m["busy"] = freeBusy.Busy
+	m["free"] = freeBusy.Free
+	m["users"] = freeBusy.Users
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+
+// schedules are the slots and meetings of a group of users inside a window,
+// with the rules of the events they belong to
+type schedules struct {
+	slots      []models.Slot
+	meetings   []models.Meeting
+	eventRules map[string]availability.Rules
+}
+
+func (s schedules) eventDisplayIds() []string {
+	displayIds := []string{}
+	for _, element := range s.slots {
+		displayIds = append(displayIds, element.EventDisplayId)
+	}
+	for _, element := range s.meetings {
+		displayIds = append(displayIds, element.EventDisplayId)
+	}
+	return displayIds
+}
+
+func loadSchedules(dal db.DAL, userDisplayIds []string, window availability.Interval) (schedules, error) {
+	result := schedules{}
+	var err error
+	result.slots, err = dal.GetSlotsForUsers(userDisplayIds, window.Start, window.End)
+	if err != nil {
+		return result, err
+	}
+	result.meetings, err = dal.GetMeetingsForUsers(userDisplayIds, window.Start, window.End)
+	if err != nil {
+		return result, err
+	}
+	events, err := dal.GetEventsByDisplayIds(result.eventDisplayIds())
+	if err != nil {
+		return result, err
+	}
+	result.eventRules = availability.EventRulesByDisplayId(*events)
+	return result, nil
+}
\ No newline at end of file
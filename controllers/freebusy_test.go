@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// joinTeams puts the user in the teams
+func joinTeams(t *testing.T, dal db.DAL, user models.User, teams ...string) models.User {
+	if err := dal.UpdateUserTeams(user.Id, teams); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := dal.FindAnyUserByEmail(user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *updated
+}
+
+func TestQueryFreeBusyTeams(t *testing.T) {
+	dal := newTestDAL(t)
+	host := joinTeams(t, dal, newTestUser(t, dal, "host@example.com"), "sales", "support")
+	colleague := joinTeams(t, dal, newTestUser(t, dal, "colleague@example.com"), "support")
+	stranger := joinTeams(t, dal, newTestUser(t, dal, "stranger@example.com"), "engineering")
+	newTestEvent(t, dal, colleague)
+	fc := NewFreeBusyController(dal)
+
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		users  []models.User
+		status int
+		code   string
+	}{
+		{"themselves", []models.User{host}, http.StatusOK, ""},
+		{"same team", []models.User{host, colleague}, http.StatusOK, ""},
+		{"different team", []models.User{stranger}, http.StatusForbidden, "not_colleague"},
+		{"some of another team", []models.User{colleague, stranger}, http.StatusForbidden, "not_colleague"},
+	}
+	for _, test := range tests {
+		users := ""
+		for index, element := range test.users {
+			if index > 0 {
+				users += ", "
+			}
+			users += fmt.Sprintf("%q", element.DisplayId)
+		}
+		body := fmt.Sprintf(`{"users": [%s], "start_time": %d, "end_time": %d}`, users, day.Unix(), day.Add(24*time.Hour).Unix())
+		recorder := call(fc.QueryFreeBusy, host, "POST", nil, body, nil)
+		if recorder.Code != test.status || errorCode(t, recorder) != test.code {
+			t.Errorf("%s: got %d %s, want %d %q", test.name, recorder.Code, recorder.Body.String(), test.status, test.code)
+		}
+	}
+}
+
+func TestQueryFreeBusyAfterLeavingTeam(t *testing.T) {
+	dal := newTestDAL(t)
+	host := joinTeams(t, dal, newTestUser(t, dal, "host@example.com"), "support")
+	colleague := joinTeams(t, dal, newTestUser(t, dal, "colleague@example.com"), "support")
+	fc := NewFreeBusyController(dal)
+	body := fmt.Sprintf(`{"users": [%q], "start_time": 1900000000, "end_time": 1900086400}`, colleague.DisplayId)
+
+	if recorder := call(fc.QueryFreeBusy, host, "POST", nil, body, nil); recorder.Code != http.StatusOK {
+		t.Errorf("colleague: got %d %s, want 200", recorder.Code, recorder.Body.String())
+	}
+	host = joinTeams(t, dal, host)
+	recorder := call(fc.QueryFreeBusy, host, "POST", nil, body, nil)
+	if recorder.Code != http.StatusForbidden || errorCode(t, recorder) != "not_colleague" {
+		t.Errorf("former colleague: got %d %s, want 403 not_colleague", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+const pageDefaultLimit = 50
+const pageMaxLimit = 200
+
+// pageLimit reads the limit query parameter
+func pageLimit(req *http.Request) (int, error) {
+	value := req.URL.Query().Get("limit")
+	if value == "" {
+		return pageDefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > pageMaxLimit {
+		return 0, helpers.PagesErrorInvalidLimit
+	}
+	return limit, nil
+}
+
+// pageCursor reads the cursor query parameter, a cursor made for another
+// ordering is rejected
+func pageCursor(req *http.Request, sort string) (*db.PageCursor, error) {
+	value := req.URL.Query().Get("cursor")
+	if value == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, helpers.PagesErrorInvalidCursor
+	}
+	cursor := db.PageCursor{}
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.Sort != sort || cursor.DisplayId == "" {
+		return nil, helpers.PagesErrorInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// encodeCursor is the opaque form of a cursor handed to clients
+func encodeCursor(cursor db.PageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// pageTime reads a unix time query parameter, a missing one is the zero time
+func pageTime(req *http.Request, param string) (time.Time, error) {
+	value := req.URL.Query().Get(param)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, helpers.PagesErrorInvalidFilter
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// pageRange reads the from, to, limit and cursor query parameters of a page
+// of the slots or meetings of an event
+func pageRange(req *http.Request, eventDisplayId string) (db.RangeQuery, error) {
+	query := db.RangeQuery{EventDisplayId: eventDisplayId}
+	var err error
+	if query.From, err = pageTime(req, "from"); err != nil {
+		return query, err
+	}
+	if query.To, err = pageTime(req, "to"); err != nil {
+		return query, err
+	}
+	if query.Limit, err = pageLimit(req); err != nil {
+		return query, err
+	}
+	query.After, err = pageCursor(req, db.RangeSortStartTime)
+	return query, err
+}
+
+// sparseFields keeps only the requested JSON fields of each item, the display
+// id is always kept
+func sparseFields(items interface{}, fields []string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	all := []map[string]interface{}{}
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+	sparse := []map[string]interface{}{}
+	for _, item := range all {
+		kept := map[string]interface{}{"display_id": item["display_id"]}
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				kept[field] = value
+			}
+		}
+		sparse = append(sparse, kept)
+	}
+	return sparse, nil
+}
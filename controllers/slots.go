@@ -2,38 +2,63 @@ package controllers
 
 import (
 	"github.com/asafron/meetings-scheduler/db"
-	"log"
 	"time"
 	"encoding/json"
 	"net/http"
 	"github.com/asafron/meetings-scheduler/helpers"
 	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/availability"
+	"gopkg.in/mgo.v2/bson"
+	"github.com/gorilla/mux"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type (
 	SlotsController struct {
-		dal *db.DAL
+		dal db.DAL
 	}
 )
 
+// AddSlotsToEventRequest adds slots to an event, in merge mode overlapping and
+// adjacent slots of the same user and interval are joined into a single slot
 type AddSlotsToEventRequest struct {
 	DisplayId string         `json:"display_id"`
-	Slots     []SlotsRequest `json:"slots"`
+	Slots     []SlotsRequest `json:"slots" validate:"required"`
+	Merge     bool           `json:"merge"`
 }
 
 type SlotsRequest struct {
-	StartTime int64  `json:"start_time"`
-	EndTime   int64  `json:"end_time"`
-	User      string `json:"user"`
+	StartTime int64  `json:"start_time" validate:"required"`
+	EndTime   int64  `json:"end_time" validate:"required"`
+	User      string `json:"user" validate:"required"`
 	Interval  uint   `json:"interval"`
 }
 
+type UpdateSlotsRequest struct {
+	EventDisplayId string              `json:"event_display_id" validate:"required"`
+	Slots          []SlotUpdateRequest `json:"slots" validate:"required"`
+}
+
+// SlotUpdateRequest changes a single slot, shift moves the whole slot by the
+// given number of seconds
+type SlotUpdateRequest struct {
+	DisplayId string  `json:"display_id"`
+	StartTime *int64  `json:"start_time"`
+	EndTime   *int64  `json:"end_time"`
+	Shift     int64   `json:"shift"`
+	User      *string `json:"user"`
+	Interval  *uint   `json:"interval"`
+}
+
 type RemoveSlotFromEventRequest struct {
-	EventDisplayId string `json:"event_display_id"`
-	DisplayId      string `json:"display_id"`
+	EventDisplayId string `json:"event_display_id" validate:"required"`
+	DisplayId      string `json:"display_id" validate:"required"`
 }
 
-func NewSlotsController(dal *db.DAL) *SlotsController {
+func NewSlotsController(dal db.DAL) *SlotsController {
 	return &SlotsController{dal : dal}
 }
 
@@ -42,43 +67,417 @@ func (sc SlotsController) AddSlotsToEvent(writer http.ResponseWriter, req *http.
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&request)
 	if decodeErr != nil {
-		log.Fatal(decodeErr)
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
+	sc.addSlots(writer, req, request)
+}
 
-	event, err := sc.dal.GetEventByDisplayId(request.DisplayId)
+/**
+Adds slots to the event of the path, the body is the one of POST /slots without the event display id
+ */
+func (sc SlotsController) AddEventSlots(writer http.ResponseWriter, req *http.Request) {
+	var request AddSlotsToEventRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	request.DisplayId = mux.Vars(req)["id"]
+	sc.addSlots(writer, req, request)
+}
+
+func (sc SlotsController) addSlots(writer http.ResponseWriter, req *http.Request, request AddSlotsToEventRequest) {
+	event, err := ownedEvent(storage(sc.dal, req), request.DisplayId, helpers.GetCurrentUser(req))
 	if err != nil {
-		log.Fatal(err)
-		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
-			Success: false,
-			Message: helpers.EventsErrorNotFound.Error(),
-		})
+		helpers.ErrorResponse(writer, err)
 		return
 	}
 
-	slots := event.Slots
+	added := []models.Slot{}
 	for _, element := range request.Slots {
 		sl := &models.Slot{}
+		sl.Id = bson.NewObjectId()
+		sl.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
 		sl.User = element.User
 		sl.Interval = element.Interval
-		sl.StartTime = time.Unix(element.StartTime, 0)
-		sl.EndTime = time.Unix(element.EndTime, 0)
-		slots = append(slots, *sl)
+		sl.StartTime = time.Unix(element.StartTime, 0).UTC()
+		sl.EndTime = time.Unix(element.EndTime, 0).UTC()
+		sl.CreatedAt = time.Now().UTC()
+		sl.UpdatedAt = time.Now().UTC()
+		added = append(added, *sl)
+	}
+	existing, err := storage(sc.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	slotErrors := availability.ValidateSlots(existing, added, request.Merge)
+	if len(slotErrors) > 0 {
+		slotErrorResponse(writer, helpers.SlotsErrorInvalid, slotErrors)
+		return
 	}
+	sc.saveSlots(writer, req, event, existing, added, request.Merge)
+}
 
-	err = sc.dal.UpdateEvent(event.DisplayId, event.Name, event.AdminUser, slots, event.Meetings)
+// saveSlots adds validated slots to the event, merging them with the existing
+// slots in merge mode
+func (sc SlotsController) saveSlots(writer http.ResponseWriter, req *http.Request, event *models.Event, existing []models.Slot, added []models.Slot, merge bool) {
+	err := claimEventVersion(sc.dal, writer, req, event, func(dal db.DAL) error {
+		if merge {
+			return sc.saveMergedSlots(req, dal, event.DisplayId, existing, availability.MergeSlots(existing, added))
+		}
+		return dal.InsertSlots(event.DisplayId, added)
+	})
 	if err != nil {
-		log.Fatal(err)
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	if !merge {
+		for _, element := range added {
+			element.EventDisplayId = event.DisplayId
+			recordAudit(sc.dal, req, helpers.GetCurrentUser(req).DisplayId, models.AUDIT_CREATE, models.AUDIT_TARGET_SLOT, event.DisplayId, element.DisplayId, nil, element)
+		}
+	}
+
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
+
+/**
+Adds the slots of a CSV file to the event of the path. The header of the file names the start, end, user and interval columns and an optional time_zone column, users are display ids or emails. Either all the rows are added or none, with dry_run nothing is saved and the slots are returned with the errors of the rows
+ */
+func (sc SlotsController) ImportEventSlots(writer http.ResponseWriter, req *http.Request) {
+	event, err := ownedEvent(storage(sc.dal, req), mux.Vars(req)["id"], helpers.GetCurrentUser(req))
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	query := req.URL.Query()
+	location := time.UTC
+	if timeZone := query.Get("time_zone"); timeZone != "" {
+		location, err = time.LoadLocation(timeZone)
+		if err != nil {
+			helpers.ErrorResponse(writer, helpers.SuggestionsErrorInvalidTimeZone)
+			return
+		}
+	}
+	dryRun, _ := strconv.ParseBool(query.Get("dry_run"))
+	merge, _ := strconv.ParseBool(query.Get("merge"))
+
+	rows, slotErrors, err := availability.ParseSlotsCSV(req.Body, location)
+	if err != nil {
+		helpers.ErrorResponse(writer, helpers.SlotsErrorInvalidCSV)
+		return
+	}
+	rows, userErrors, err := sc.resolveSlotUsers(req, rows)
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	slotErrors = append(slotErrors, userErrors...)
+	added := []models.Slot{}
+	for _, element := range rows {
+		sl := element.Slot
+		sl.Id = bson.NewObjectId()
+		sl.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+		sl.EventDisplayId = event.DisplayId
+		sl.CreatedAt = time.Now().UTC()
+		sl.UpdatedAt = time.Now().UTC()
+		added = append(added, sl)
+	}
+	existing, err := storage(sc.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	//the slots were validated by their position among the readable rows
+	for _, element := range availability.ValidateSlots(existing, added, merge) {
+		element.Row = rows[element.Index].Row
+		element.Index = rows[element.Index].Index
+		slotErrors = append(slotErrors, element)
+	}
+	sort.SliceStable(slotErrors, func(a, b int) bool {
+		return slotErrors[a].Index < slotErrors[b].Index
+	})
+
+	if dryRun {
+		m := make(map[string]interface{})
+		m["slots"] = added
+		m["errors"] = slotErrors
 		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
-			Success: false,
-			Message: helpers.GeneralErrorInternal.Error(),
+			Success: true,
+			Data: m,
 		})
 		return
 	}
+	if len(slotErrors) > 0 {
+		slotErrorResponse(writer, helpers.SlotsErrorInvalid, slotErrors)
+		return
+	}
+	sc.saveSlots(writer, req, event, existing, added, merge)
+}
 
+// resolveSlotUsers replaces the emails of the rows by the display ids of their
+// users, the rows whose user doesn't exist become errors
+func (sc SlotsController) resolveSlotUsers(req *http.Request, rows []availability.SlotRow) ([]availability.SlotRow, []availability.SlotError, error) {
+	displayIds := []string{}
+	for index, element := range rows {
+		if strings.Contains(element.Slot.User, "@") {
+			user, err := storage(sc.dal, req).FindActiveUserByEmail(strings.ToLower(element.Slot.User))
+			if err != nil && err != helpers.AuthenticationErrorLoginUserNotExists {
+				return nil, nil, err
+			}
+			if err == nil {
+				rows[index].Slot.User = user.DisplayId
+			}
+		}
+		displayIds = append(displayIds, rows[index].Slot.User)
+	}
+	users, err := storage(sc.dal, req).FindActiveUsersByDisplayIds(displayIds)
+	if err != nil {
+		return nil, nil, err
+	}
+	known := make(map[string]bool)
+	for _, element := range users {
+		known[element.DisplayId] = true
+	}
+	resolved := []availability.SlotRow{}
+	slotErrors := []availability.SlotError{}
+	for _, element := range rows {
+		switch {
+		case element.Slot.User == "":
+			// ValidateSlots reports the missing user
+			resolved = append(resolved, element)
+		case !known[element.Slot.User]:
+			slotErrors = append(slotErrors, availability.SlotError{Index: element.Index, Row: element.Row, Field: "user", Message: helpers.SlotsErrorUnknownUser.Error()})
+		default:
+			resolved = append(resolved, element)
+		}
+	}
+	return resolved, slotErrors, nil
+}
+
+// checkSlotUsers makes sure the users edited slots are given to exist, the
+// slots whose user didn't change are not checked again
+func (sc SlotsController) checkSlotUsers(req *http.Request, original []models.Slot, changed []models.Slot) ([]availability.SlotError, error) {
+	displayIds := []string{}
+	for index, element := range changed {
+		if element.User != "" && element.User != original[index].User {
+			displayIds = append(displayIds, element.User)
+		}
+	}
+	slotErrors := []availability.SlotError{}
+	if len(displayIds) == 0 {
+		return slotErrors, nil
+	}
+	users, err := storage(sc.dal, req).FindActiveUsersByDisplayIds(displayIds)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, element := range users {
+		known[element.DisplayId] = true
+	}
+	for index, element := range changed {
+		if element.User != "" && element.User != original[index].User && !known[element.User] {
+			slotErrors = append(slotErrors, availability.SlotError{Index: index, Field: "user", Message: helpers.SlotsErrorUnknownUser.Error()})
+		}
+	}
+	return slotErrors, nil
+}
+
+// saveMergedSlots stores the result of merging the existing slots of the event
+// with new ones in one call, slots that were absorbed by another slot are
+// removed
+func (sc SlotsController) saveMergedSlots(req *http.Request, dal db.DAL, eventDisplayId string, existing []models.Slot, merged []models.Slot) error {
+	actor := helpers.GetCurrentUser(req).DisplayId
+	before := make(map[string]models.Slot)
+	for _, element := range existing {
+		before[element.DisplayId] = element
+	}
+	inserted := []models.Slot{}
+	updated := []models.Slot{}
+	for _, element := range merged {
+		previous, ok := before[element.DisplayId]
+		if !ok {
+			inserted = append(inserted, element)
+			continue
+		}
+		delete(before, element.DisplayId)
+		if !previous.StartTime.Equal(element.StartTime) || !previous.EndTime.Equal(element.EndTime) {
+			updated = append(updated, element)
+		}
+	}
+	absorbed := []string{}
+	for displayId := range before {
+		absorbed = append(absorbed, displayId)
+	}
+	sort.Strings(absorbed)
+	if err := dal.SaveMergedSlots(eventDisplayId, inserted, updated, absorbed); err != nil {
+		return err
+	}
+
+	for _, element := range inserted {
+		element.EventDisplayId = eventDisplayId
+		recordAudit(sc.dal, req, actor, models.AUDIT_CREATE, models.AUDIT_TARGET_SLOT, eventDisplayId, element.DisplayId, nil, element)
+	}
+	for _, element := range updated {
+		for _, previous := range existing {
+			if previous.DisplayId == element.DisplayId {
+				recordAudit(sc.dal, req, actor, models.AUDIT_UPDATE, models.AUDIT_TARGET_SLOT, eventDisplayId, element.DisplayId, previous, element)
+			}
+		}
+	}
+	for _, displayId := range absorbed {
+		recordAudit(sc.dal, req, actor, models.AUDIT_DELETE, models.AUDIT_TARGET_SLOT, eventDisplayId, displayId, before[displayId], nil)
+	}
+	return nil
+}
+
+/**
+Edits one or more slots of an event in place, keeping their display ids. PUT replaces all the fields of each slot and PATCH changes only the given ones
+ */
+func (sc SlotsController) UpdateSlots(writer http.ResponseWriter, req *http.Request) {
+	var request UpdateSlotsRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	sc.updateSlots(writer, req, request)
+}
+
+/**
+Edits the slot of the path in place, the body is one slot of PUT or PATCH /slots without its display id
+ */
+func (sc SlotsController) UpdateEventSlot(writer http.ResponseWriter, req *http.Request) {
+	var slot SlotUpdateRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&slot)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	vars := mux.Vars(req)
+	slot.DisplayId = vars["slot_id"]
+	sc.updateSlots(writer, req, UpdateSlotsRequest{EventDisplayId: vars["id"], Slots: []SlotUpdateRequest{slot}})
+}
+
+func (sc SlotsController) updateSlots(writer http.ResponseWriter, req *http.Request, request UpdateSlotsRequest) {
+	partial := req.Method == "PATCH"
+
+	event, err := ownedEvent(storage(sc.dal, req), request.EventDisplayId, helpers.GetCurrentUser(req))
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+
+	existing, err := storage(sc.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	slots := make([]models.Slot, len(existing))
+	copy(slots, existing)
+	edited := []int{}
+	for _, element := range request.Slots {
+		index := -1
+		for slotIndex, slot := range slots {
+			if slot.DisplayId == element.DisplayId {
+				index = slotIndex
+				break
+			}
+		}
+		if index == -1 {
+			slotErrorResponse(writer, helpers.SlotsErrorNotFound, nil)
+			return
+		}
+		if !partial && (element.StartTime == nil || element.EndTime == nil || element.User == nil || element.Interval == nil || element.Shift != 0) {
+			slotErrorResponse(writer, helpers.SlotsErrorIncompleteUpdate, nil)
+			return
+		}
+		if element.StartTime != nil {
+			slots[index].StartTime = time.Unix(*element.StartTime, 0).UTC()
+		}
+		if element.EndTime != nil {
+			slots[index].EndTime = time.Unix(*element.EndTime, 0).UTC()
+		}
+		if element.Shift != 0 {
+			slots[index].StartTime = slots[index].StartTime.Add(time.Duration(element.Shift) * time.Second)
+			slots[index].EndTime = slots[index].EndTime.Add(time.Duration(element.Shift) * time.Second)
+		}
+		if element.User != nil {
+			slots[index].User = *element.User
+		}
+		if element.Interval != nil {
+			slots[index].Interval = *element.Interval
+		}
+		slots[index].UpdatedAt = time.Now().UTC()
+		edited = append(edited, index)
+	}
+
+	//validate the edited slots, in request order, against the ones that were left as they are
+	changed := []models.Slot{}
+	original := []models.Slot{}
+	isEdited := make(map[int]bool)
+	for _, index := range edited {
+		if !isEdited[index] {
+			changed = append(changed, slots[index])
+			original = append(original, existing[index])
+			isEdited[index] = true
+		}
+	}
+	unchanged := []models.Slot{}
+	for index, slot := range slots {
+		if !isEdited[index] {
+			unchanged = append(unchanged, slot)
+		}
+	}
+	slotErrors := availability.ValidateSlots(unchanged, changed, false)
+	userErrors, err := sc.checkSlotUsers(req, original, changed)
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	slotErrors = append(slotErrors, userErrors...)
+	sort.SliceStable(slotErrors, func(a, b int) bool {
+		return slotErrors[a].Index < slotErrors[b].Index
+	})
+	if len(slotErrors) > 0 {
+		slotErrorResponse(writer, helpers.SlotsErrorInvalid, slotErrors)
+		return
+	}
+	meetings, err := storage(sc.dal, req).GetMeetingsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	orphaned := availability.OrphanedMeetings(existing, slots, meetings)
+	if len(orphaned) > 0 {
+		slotErrorResponse(writer, helpers.SlotsErrorOrphansMeetings, orphaned)
+		return
+	}
+
+	err = claimEventVersion(sc.dal, writer, req, event, func(dal db.DAL) error {
+		return dal.UpdateSlots(event.DisplayId, changed)
+	})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	for index, element := range changed {
+		recordAudit(sc.dal, req, helpers.GetCurrentUser(req).DisplayId, models.AUDIT_UPDATE, models.AUDIT_TARGET_SLOT, event.DisplayId, element.DisplayId, original[index], element)
+	}
+
+	m := make(map[string]interface{})
+	m["slots"] = changed
 	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
 		Success: true,
+		Data: m,
 	})
 }
 
@@ -87,22 +486,102 @@ func (sc SlotsController) RemoveSlotFromEvent(writer http.ResponseWriter, req *h
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&request)
 	if decodeErr != nil {
-		log.Fatal(decodeErr)
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
+	sc.removeSlot(writer, req, request)
+}
 
-	err := sc.dal.RemoveSlotFromEvent(request.EventDisplayId, request.DisplayId)
+/**
+Removes the slot of the path from its event
+ */
+func (sc SlotsController) RemoveEventSlot(writer http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	sc.removeSlot(writer, req, RemoveSlotFromEventRequest{EventDisplayId: vars["id"], DisplayId: vars["slot_id"]})
+}
+
+/**
+Returns one slot of an event the current user is the admin of
+ */
+func (sc SlotsController) GetEventSlot(writer http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	event, err := ownedEvent(storage(sc.dal, req), vars["id"], helpers.GetCurrentUser(req))
 	if err != nil {
-		log.Fatal(err)
-		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
-			Success: false,
-			Message: helpers.GeneralErrorInternal.Error(),
-		})
+		slotErrorResponse(writer, err, nil)
 		return
 	}
+	slots, err := storage(sc.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	for _, element := range slots {
+		if element.DisplayId == vars["slot_id"] {
+			m := make(map[string]interface{})
+			m["slot"] = element
+			helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+				Success: true,
+				Data: m,
+			})
+			return
+		}
+	}
+	slotErrorResponse(writer, helpers.SlotsErrorNotFound, nil)
+}
+
+func (sc SlotsController) removeSlot(writer http.ResponseWriter, req *http.Request, request RemoveSlotFromEventRequest) {
+	event, err := ownedEvent(storage(sc.dal, req), request.EventDisplayId, helpers.GetCurrentUser(req))
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	slots, err := storage(sc.dal, req).GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	var removed *models.Slot
+	for index := range slots {
+		if slots[index].DisplayId == request.DisplayId {
+			removed = &slots[index]
+		}
+	}
+	// an unknown slot leaves the version of the event as it is
+	if removed == nil {
+		slotErrorResponse(writer, helpers.SlotsErrorNotFound, nil)
+		return
+	}
+	err = claimEventVersion(sc.dal, writer, req, event, func(dal db.DAL) error {
+		return dal.RemoveSlotFromEvent(event.DisplayId, request.DisplayId)
+	})
+	if err != nil {
+		slotErrorResponse(writer, err, nil)
+		return
+	}
+	recordAudit(sc.dal, req, helpers.GetCurrentUser(req).DisplayId, models.AUDIT_DELETE, models.AUDIT_TARGET_SLOT, event.DisplayId, removed.DisplayId, *removed, nil)
 
 	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
 		Success: true,
 	})
-}
\ No newline at end of file
+}
+
+// slotErrorResponse writes the error, details are either the per slot
+// validation errors, which also become field errors, or the meetings a change
+// would orphan
+func slotErrorResponse(writer http.ResponseWriter, err error, details interface{}) {
+	apiError := helpers.ToApiError(err)
+	var data map[string]interface{}
+	switch typed := details.(type) {
+	case []availability.SlotError:
+		data = map[string]interface{}{"errors": details}
+		for _, element := range typed {
+			apiError.Fields = append(apiError.Fields, helpers.FieldError{
+				Field: fmt.Sprintf("slots[%d].%s", element.Index, element.Field),
+				Message: element.Message,
+			})
+		}
+	case []models.Meeting:
+		data = map[string]interface{}{"meetings": details}
+	}
+	helpers.ApiErrorResponse(writer, apiError, data)
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// failingSlotsDAL fails every slot edit
+type failingSlotsDAL struct {
+	db.DAL
+}
+
+func (dal failingSlotsDAL) UpdateSlots(eventDisplayId string, slots []models.Slot) error {
+	return errors.New("connection lost")
+}
+
+func TestUpdateSlotsUsers(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	colleague := newTestUser(t, dal, "colleague@example.com")
+	event, slot := newTestEvent(t, dal, host)
+	second := slot
+	second.Id = bson.NewObjectId()
+	second.DisplayId = "second"
+	second.StartTime = slot.StartTime.Add(24 * time.Hour)
+	second.EndTime = slot.EndTime.Add(24 * time.Hour)
+	if err := dal.InsertSlots(event.DisplayId, []models.Slot{second}); err != nil {
+		t.Fatal(err)
+	}
+	sc := NewSlotsController(dal)
+
+	body := fmt.Sprintf(`{"event_display_id": %q, "slots": [{"display_id": %q, "user": %q}, {"display_id": %q, "user": "nobody"}]}`,
+		event.DisplayId, slot.DisplayId, colleague.DisplayId, second.DisplayId)
+	recorder := call(sc.UpdateSlots, host, "PATCH", nil, body, nil)
+	if recorder.Code != http.StatusBadRequest || errorCode(t, recorder) != "invalid_slots" {
+		t.Errorf("unknown user: got %d %s, want 400 invalid_slots", recorder.Code, recorder.Body.String())
+	}
+	slots, err := dal.GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil || len(slots) != 2 || slots[0].User != host.DisplayId || slots[1].User != host.DisplayId {
+		t.Errorf("slots after a rejected edit = %+v %v, want both left to the host", slots, err)
+	}
+
+	body = fmt.Sprintf(`{"event_display_id": %q, "slots": [{"display_id": %q, "user": %q}]}`, event.DisplayId, second.DisplayId, colleague.DisplayId)
+	recorder = call(sc.UpdateSlots, host, "PATCH", nil, body, nil)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("known user: got %d %s, want 200", recorder.Code, recorder.Body.String())
+	}
+	slots, err = dal.GetSlotsForEvents([]string{event.DisplayId})
+	if err != nil || len(slots) != 2 || slots[1].User != colleague.DisplayId {
+		t.Errorf("slots after the edit = %+v %v, want the second given to the colleague", slots, err)
+	}
+}
+
+func TestUpdateSlotsFailureKeepsVersion(t *testing.T) {
+	dal := newTestDAL(t)
+	host := newTestUser(t, dal, "host@example.com")
+	event, slot := newTestEvent(t, dal, host)
+	sc := NewSlotsController(failingSlotsDAL{dal})
+
+	body := fmt.Sprintf(`{"event_display_id": %q, "slots": [{"display_id": %q, "interval": 60}]}`, event.DisplayId, slot.DisplayId)
+	recorder := call(sc.UpdateSlots, host, "PATCH", nil, body, http.Header{"If-Match": {`"1"`}})
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("ETag") != "" {
+		t.Errorf("failed edit: got %d ETag %q, want 500 without an ETag", recorder.Code, recorder.Header().Get("ETag"))
+	}
+	if version := eventVersion(t, dal, event.DisplayId); version != 1 {
+		t.Errorf("failed edit left the event at version %d, want 1", version)
+	}
+}
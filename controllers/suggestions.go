@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"github.com/asafron/meetings-scheduler/db"
+	"net/http"
+	"encoding/json"
+	"strings"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+const defaultWorkingHoursStart = "09:00"
+const defaultWorkingHoursEnd = "17:00"
+
+type (
+	SuggestionsController struct {
+		dal db.DAL
+	}
+)
+
+type SuggestMeetingTimesRequest struct {
+	Required          []string `json:"required"`
+	Optional          []string `json:"optional"`
+	Duration          uint     `json:"duration" validate:"required"`
+	Buffer            uint     `json:"buffer"`
+	StartTime         int64    `json:"start_time" validate:"required"`
+	EndTime           int64    `json:"end_time" validate:"required"`
+	WorkingHoursStart string   `json:"working_hours_start"`
+	WorkingHoursEnd   string   `json:"working_hours_end"`
+	TimeZone          string   `json:"time_zone"`
+	Limit             int      `json:"limit"`
+}
+
+func NewSuggestionsController(dal db.DAL) *SuggestionsController {
+	return &SuggestionsController{dal : dal}
+}
+
+/**
+Ranks candidate times for a meeting between hosts and guests, duration and buffer are in minutes. The window may span up to 90 days and at most 100 suggestions are returned
+ */
+func (sc SuggestionsController) SuggestMeetingTimes(writer http.ResponseWriter, req *http.Request) {
+	var request SuggestMeetingTimesRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	options, err := suggestOptionsFromRequest(request)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	//resolve the attendees, emails of active users are hosts and everyone else is a guest
+	currentUser := helpers.GetCurrentUser(req)
+	attendees := []availability.Attendee{}
+	hostUsers := make(map[int]models.User)
+	hosts := []string{currentUser.DisplayId}
+	guests := []string{}
+	for _, group := range []struct {
+		emails   []string
+		required bool
+	}{{request.Required, true}, {request.Optional, false}} {
+		for _, email := range group.emails {
+			email = strings.ToLower(email)
+			user, err := storage(sc.dal, req).FindActiveUserByEmail(email)
+			if err != nil && err != helpers.AuthenticationErrorLoginUserNotExists {
+				log.Warn(err)
+				helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+				return
+			}
+			if err == nil {
+				if user.DisplayId != currentUser.DisplayId && !currentUser.SharesTeamWith(*user) {
+					helpers.ErrorResponse(writer, helpers.FreeBusyErrorNotColleague)
+					return
+				}
+				hostUsers[len(attendees)] = *user
+				hosts = append(hosts, user.DisplayId)
+			} else {
+				guests = append(guests, email)
+			}
+			attendees = append(attendees, availability.Attendee{Id: email, Required: group.required})
+		}
+	}
+	if len(attendees) == 0 {
+		helpers.ErrorResponse(writer, helpers.SuggestionsErrorNoAttendees)
+		return
+	}
+
+	//guests' meetings are only visible in events the hosts take part in and in the current user's events
+	hostSchedules, err := loadSchedules(storage(sc.dal, req), hosts, options.Window)
+	if err != nil {
+		log.Warn(err)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+		return
+	}
+	visibleEvents := hostSchedules.eventDisplayIds()
+	for _, element := range *storage(sc.dal, req).GetEventsForUser(currentUser.DisplayId) {
+		visibleEvents = append(visibleEvents, element.DisplayId)
+	}
+	guestMeetings, err := storage(sc.dal, req).GetMeetingsForGuests(guests, visibleEvents, options.Window.Start, options.Window.End)
+	if err != nil {
+		log.Warn(err)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+		return
+	}
+	for index, attendee := range attendees {
+		if user, ok := hostUsers[index]; ok {
+			schedule := availability.UserSchedule(user, hostSchedules.slots, hostSchedules.meetings, hostSchedules.eventRules, options.Window)
+			attendees[index].Host = true
+			attendees[index].Free = schedule.Free
+			attendees[index].Busy = schedule.Busy
+			continue
+		}
+		attendees[index].Busy = availability.BusyFromGuestMeetings(guestMeetings, attendee.Id)
+	}
+
+	m := make(map[string]interface{})
+	m["suggestions"] = availability.Suggest(attendees, options)
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+func suggestOptionsFromRequest(request SuggestMeetingTimesRequest) (availability.SuggestOptions, error) {
+	options := availability.SuggestOptions{
+		Window: availability.Interval{Start: time.Unix(request.StartTime, 0).UTC(), End: time.Unix(request.EndTime, 0).UTC()},
+		Duration: time.Duration(request.Duration) * time.Minute,
+		Buffer: time.Duration(request.Buffer) * time.Minute,
+		Limit: request.Limit,
+		Location: time.UTC,
+	}
+	if options.Window.Empty() {
+		return options, helpers.FreeBusyErrorInvalidRange
+	}
+	if options.Window.End.Sub(options.Window.Start) > availability.MaxSuggestionWindow {
+		return options, helpers.SuggestionsErrorWindowTooLong
+	}
+	if options.Limit > availability.MaxSuggestionLimit {
+		options.Limit = availability.MaxSuggestionLimit
+	}
+	if options.Duration <= 0 {
+		return options, helpers.SuggestionsErrorInvalidDuration
+	}
+	if request.TimeZone != "" {
+		location, err := time.LoadLocation(request.TimeZone)
+		if err != nil {
+			return options, helpers.SuggestionsErrorInvalidTimeZone
+		}
+		options.Location = location
+	}
+	start, err := parseClock(request.WorkingHoursStart, defaultWorkingHoursStart)
+	if err != nil {
+		return options, helpers.SuggestionsErrorInvalidWorkingHours
+	}
+	end, err := parseClock(request.WorkingHoursEnd, defaultWorkingHoursEnd)
+	if err != nil || end <= start {
+		return options, helpers.SuggestionsErrorInvalidWorkingHours
+	}
+	options.WorkingHours = availability.WorkingHours{Start: start, End: end}
+	return options, nil
+}
+
+// parseClock converts an "HH:MM" value to the offset from midnight
+func parseClock(value string, fallback string) (time.Duration, error) {
+	if value == "" {
+		value = fallback
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour()) * time.Hour + time.Duration(clock.Minute()) * time.Minute, nil
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+func TestSuggestOptionsFromRequest(t *testing.T) {
+	start := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	days := func(count int) int64 {
+		return start.AddDate(0, 0, count).Unix()
+	}
+	tests := []struct {
+		name    string
+		request SuggestMeetingTimesRequest
+		err     error
+		limit   int
+	}{
+		{"a week", SuggestMeetingTimesRequest{Duration: 30, StartTime: start.Unix(), EndTime: days(7), Limit: 5}, nil, 5},
+		{"90 days", SuggestMeetingTimesRequest{Duration: 30, StartTime: start.Unix(), EndTime: days(90)}, nil, 0},
+		{"over 90 days", SuggestMeetingTimesRequest{Duration: 30, StartTime: start.Unix(), EndTime: days(91)}, helpers.SuggestionsErrorWindowTooLong, 0},
+		{"over the limit", SuggestMeetingTimesRequest{Duration: 30, StartTime: start.Unix(), EndTime: days(7), Limit: 100000}, nil, availability.MaxSuggestionLimit},
+		{"empty window", SuggestMeetingTimesRequest{Duration: 30, StartTime: days(7), EndTime: start.Unix()}, helpers.FreeBusyErrorInvalidRange, 0},
+		{"no duration", SuggestMeetingTimesRequest{StartTime: start.Unix(), EndTime: days(7)}, helpers.SuggestionsErrorInvalidDuration, 0},
+	}
+	for _, test := range tests {
+		options, err := suggestOptionsFromRequest(test.request)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && options.Limit != test.limit {
+			t.Errorf("%s: limit %d, want %d", test.name, options.Limit, test.limit)
+		}
+	}
+}
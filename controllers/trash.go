@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"github.com/asafron/meetings-scheduler/db"
+	"net/http"
+	"encoding/json"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/availability"
+	"github.com/gorilla/mux"
+)
+
+type (
+	TrashController struct {
+		dal db.DAL
+	}
+)
+
+type RemoveMeetingRequest struct {
+	EventDisplayId string `json:"event_display_id" validate:"required"`
+	DisplayId      string `json:"display_id" validate:"required"`
+}
+
+// RestoreRequest restores a deleted event, or a single deleted meeting of an
+// event when a meeting display id is given
+type RestoreRequest struct {
+	EventDisplayId   string `json:"event_display_id" validate:"required"`
+	MeetingDisplayId string `json:"meeting_display_id"`
+}
+
+func NewTrashController(dal db.DAL) *TrashController {
+	return &TrashController{dal : dal}
+}
+
+/**
+Moves a meeting of an event the current user is the admin of to the trash
+ */
+func (tc TrashController) RemoveMeeting(writer http.ResponseWriter, req *http.Request) {
+	var request RemoveMeetingRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+	tc.removeMeeting(writer, req, request)
+}
+
+/**
+Moves the meeting of the path to the trash
+ */
+func (tc TrashController) RemoveEventMeeting(writer http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	tc.removeMeeting(writer, req, RemoveMeetingRequest{EventDisplayId: vars["id"], DisplayId: vars["meeting_id"]})
+}
+
+func (tc TrashController) removeMeeting(writer http.ResponseWriter, req *http.Request, request RemoveMeetingRequest) {
+	currentUser := helpers.GetCurrentUser(req)
+	event, err := ownedEvent(storage(tc.dal, req), request.EventDisplayId, currentUser)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	meetings, err := storage(tc.dal, req).GetMeetingsForEvents([]string{event.DisplayId})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	var meeting *models.Meeting
+	for index := range meetings {
+		if meetings[index].DisplayId == request.DisplayId {
+			meeting = &meetings[index]
+		}
+	}
+	if meeting == nil {
+		helpers.ErrorResponse(writer, helpers.MeetingsErrorNotFound)
+		return
+	}
+	err = claimEventVersion(tc.dal, writer, req, event, func(dal db.DAL) error {
+		return dal.RemoveMeeting(event.DisplayId, meeting.DisplayId, currentUser.DisplayId)
+	})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	recordAudit(tc.dal, req, currentUser.DisplayId, models.AUDIT_DELETE, models.AUDIT_TARGET_MEETING, event.DisplayId, meeting.DisplayId, meeting, nil)
+
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
+
+/**
+Lists the deleted events of the current user and the meetings deleted from the events they still have
+ */
+func (tc TrashController) GetTrash(writer http.ResponseWriter, req *http.Request) {
+	currentUser := helpers.GetCurrentUser(req)
+	events, err := storage(tc.dal, req).GetDeletedEventsForUser(currentUser.DisplayId)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	displayIds := []string{}
+	for _, element := range *storage(tc.dal, req).GetEventsForUser(currentUser.DisplayId) {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	meetings, err := storage(tc.dal, req).GetDeletedMeetingsForEvents(displayIds)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	m := make(map[string]interface{})
+	m["events"] = events
+	m["meetings"] = meetings
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+		Data: m,
+	})
+}
+
+/**
+Takes an event, with everything deleted along with it, or a single meeting out of the trash. A meeting is only restored when its host wasn't booked again at the same time
+ */
+func (tc TrashController) Restore(writer http.ResponseWriter, req *http.Request) {
+	var request RestoreRequest
+	decoder := json.NewDecoder(req.Body)
+	decodeErr := decoder.Decode(&request)
+	if decodeErr != nil {
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
+		return
+	}
+
+	currentUser := helpers.GetCurrentUser(req)
+	if request.MeetingDisplayId == "" {
+		event, err := tc.ownedDeletedEvent(req, request.EventDisplayId, currentUser)
+		if err != nil {
+			helpers.ErrorResponse(writer, err)
+			return
+		}
+		version, err := storage(tc.dal, req).RestoreEvent(event.DisplayId, currentUser.DisplayId)
+		if err != nil {
+			helpers.ErrorResponse(writer, err)
+			return
+		}
+		restored := *event
+		restored.DeletedAt = nil
+		restored.DeletedBy = ""
+		restored.Version = version
+		recordAudit(tc.dal, req, currentUser.DisplayId, models.AUDIT_RESTORE, models.AUDIT_TARGET_EVENT, event.DisplayId, event.DisplayId, event, restored)
+		writer.Header().Set("ETag", helpers.ETag(version))
+		helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+			Success: true,
+		})
+		return
+	}
+
+	event, err := ownedEvent(storage(tc.dal, req), request.EventDisplayId, currentUser)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	deleted, err := storage(tc.dal, req).GetDeletedMeetingsForEvents([]string{event.DisplayId})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	var meeting *models.Meeting
+	for index := range deleted {
+		if deleted[index].DisplayId == request.MeetingDisplayId {
+			meeting = &deleted[index]
+		}
+	}
+	if meeting == nil {
+		helpers.ErrorResponse(writer, helpers.MeetingsErrorNotFound)
+		return
+	}
+	booked, err := storage(tc.dal, req).GetMeetingsForUsers([]string{meeting.UserId}, meeting.StartTime, meeting.EndTime)
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	interval := availability.Interval{Start: meeting.StartTime, End: meeting.EndTime}
+	for _, element := range booked {
+		if interval.Overlaps(availability.Interval{Start: element.StartTime, End: element.EndTime}) {
+			helpers.ErrorResponse(writer, helpers.MeetingsErrorTimeTaken)
+			return
+		}
+	}
+	err = claimEventVersion(tc.dal, writer, req, event, func(dal db.DAL) error {
+		return dal.RestoreMeeting(event.DisplayId, meeting.DisplayId)
+	})
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	restored := *meeting
+	restored.DeletedAt = nil
+	restored.DeletedBy = ""
+	recordAudit(tc.dal, req, currentUser.DisplayId, models.AUDIT_RESTORE, models.AUDIT_TARGET_MEETING, event.DisplayId, meeting.DisplayId, meeting, restored)
+
+	helpers.JsonResponse(writer, http.StatusOK, &helpers.GeneralResponse{
+		Success: true,
+	})
+}
+
+// ownedDeletedEvent finds an event in the trash of the user, the events of
+// other users are not found so their trash isn't revealed
+func (tc TrashController) ownedDeletedEvent(req *http.Request, displayId string, user models.User) (*models.Event, error) {
+	deleted, err := storage(tc.dal, req).GetDeletedEventsForUser(user.DisplayId)
+	if err != nil {
+		return nil, err
+	}
+	for index := range deleted {
+		if deleted[index].DisplayId == displayId {
+			return &deleted[index], nil
+		}
+	}
+	return nil, helpers.EventsErrorNotFound
+}
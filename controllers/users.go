@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"github.com/asafron/meetings-scheduler/db"
 	"github.com/asafron/meetings-scheduler/auth"
 	"encoding/json"
@@ -9,42 +10,43 @@ import (
 	"github.com/asafron/meetings-scheduler/helpers"
 	"github.com/asafron/meetings-scheduler/config"
 	"github.com/asafron/meetings-scheduler/mailer"
-	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
 )
 
 type (
 	UserController struct {
-		dal        *db.DAL
+		dal        db.DAL
 		authorizer *auth.Authenticator
+		cfg        *config.EnvConfig
 	}
 )
 
-func NewUserController(dal *db.DAL, auth *auth.Authenticator) *UserController {
-	return &UserController{dal : dal, authorizer : auth}
+func NewUserController(dal db.DAL, auth *auth.Authenticator, cfg *config.EnvConfig) *UserController {
+	return &UserController{dal : dal, authorizer : auth, cfg : cfg}
 }
 
 type CreateUserRequest struct {
-	Email                string `json:"email"`
-	Password             string `json:"password"`
-	PasswordConfirmation string `json:"password_confirmation"`
+	Email                string `json:"email" validate:"required"`
+	Password             string `json:"password" validate:"required"`
+	PasswordConfirmation string `json:"password_confirmation" validate:"required"`
 	FirstName            string `json:"first_name"`
 	LastName             string `json:"last_name"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type ForgotPasswordRequest struct {
-	Email string `json:"email"`
+	Email string `json:"email" validate:"required"`
 }
 
 type RecoverPasswordRequest struct {
-	Email                string `json:"email"`
-	Password             string `json:"password"`
-	PasswordConfirmation string `json:"password_confirmation"`
-	Token                string `json:"token"`
+	Email                string `json:"email" validate:"required"`
+	Password             string `json:"password" validate:"required"`
+	PasswordConfirmation string `json:"password_confirmation" validate:"required"`
+	Token                string `json:"token" validate:"required"`
 }
 
 func (uc UserController) CreateUser(writer http.ResponseWriter, req *http.Request) {
@@ -52,65 +54,45 @@ func (uc UserController) CreateUser(writer http.ResponseWriter, req *http.Reques
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&createRequest)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 	//validate request
 	if createRequest.Email == "" || createRequest.Password == "" || createRequest.PasswordConfirmation == "" {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "Email, password or password confirmation are missing"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorMissingFields)
 		return
 	}
 	//password validation
 	if createRequest.Password != createRequest.PasswordConfirmation || len(createRequest.Password) < 6 {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "Password is to short or doesn't match the password confirmation"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorInvalidPassword)
 		return
 	}
 	//see if this user already exists
 	email := strings.ToLower(createRequest.Email)
 	// Validate username
-	_, err := uc.dal.FindAnyUserByEmail(email)
+	_, err := storage(uc.dal, req).FindAnyUserByEmail(email)
 	if err == nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "A user with this email already exists, please try another email"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorEmailTaken)
 		return
 	} else if err != helpers.AuthenticationErrorLoginUserNotExists {
-		if err != nil {
-			log.Fatal(err)
-			http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-			return
-		}
-		log.Fatal(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		helpers.RequestLogger(req).Error(err)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
 	//create the user
-	confirmationToken, err := uc.authorizer.Register(email, createRequest.Password, createRequest.FirstName, createRequest.LastName)
+	confirmationToken, err := uc.authorizer.Register(req.Context(), email, createRequest.Password, createRequest.FirstName, createRequest.LastName)
 	if err != nil {
-		log.Fatal(err)
-		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		helpers.RequestLogger(req).Warn(err)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
+	if user, err := storage(uc.dal, req).FindAnyUserByEmail(email); err == nil {
+		recordAudit(uc.dal, req, user.DisplayId, models.AUDIT_CREATE, models.AUDIT_TARGET_USER, "", user.DisplayId, nil, user)
+	}
 	//send the token
-	configWrapper :=config.GetConfigWrapper().GetCurrent()
-	subject := "Greetings from PushApps"
-	body := "To Get started, please confirm your email address by clicking on the following link:\n"
-	body += config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "/users/confirm?email=" + email + "&token=" + confirmationToken + "\n"
-	body+= "Once your registration is completeted, you can login at https://my.pushapps.mobi, you should probably want to visit our documentation at https://docs.pushapps.mobi to see how to start the integration with one of our SDK's.\nRegards,\nThe PushApps team"
-	to := []string{email }
-	err = mailer.SendMail(to, subject, body, configWrapper.EmailServerFrom,configWrapper.EmailServerUsername,configWrapper.EmailServerPassword,configWrapper.EmailServerAddress,configWrapper.EmailServerPort,configWrapper.EmailServerBcc)
+	err = SendConfirmationMail(req.Context(), uc.cfg, email, confirmationToken)
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "The user has been registered but the confirmation email sending has failed , please try again or contect the system administrator with this message"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorConfirmationNotSent)
 		return
 	}
 	message := "A confirmation email was sent to " + email + ". Please check your mail and follow the instructions to finish the registration process."
@@ -119,20 +101,32 @@ func (uc UserController) CreateUser(writer http.ResponseWriter, req *http.Reques
 	return
 }
 
+// ConfirmationLink is the link a new user follows to confirm the email address
+func ConfirmationLink(cfg *config.EnvConfig, email string, confirmationToken string) string {
+	return cfg.DashboardBaseUrl + "/users/confirm?email=" + email + "&token=" + confirmationToken
+}
+
+// SendConfirmationMail sends the confirmation link to a new user
+func SendConfirmationMail(ctx context.Context, cfg *config.EnvConfig, email string, confirmationToken string) error {
+	subject := "Greetings from PushApps"
+	body := "To Get started, please confirm your email address by clicking on the following link:\n"
+	body += ConfirmationLink(cfg, email, confirmationToken) + "\n"
+	body+= "Once your registration is completeted, you can login at https://my.pushapps.mobi, you should probably want to visit our documentation at https://docs.pushapps.mobi to see how to start the integration with one of our SDK's.\nRegards,\nThe PushApps team"
+	to := []string{email }
+	return mailer.SendMail(ctx, to, subject, body, cfg.EmailServerFrom, cfg.EmailServerUsername, cfg.EmailServerPassword, cfg.EmailServerAddress, cfg.EmailServerPort, cfg.EmailServerBcc)
+}
+
 func (uc UserController) Login(writer http.ResponseWriter, req *http.Request) {
 	var loginRequest LoginRequest
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&loginRequest)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 	//validate request
 	if loginRequest.Email == "" || loginRequest.Password == "" {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "Email or password are missing"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorLoginMissingFields)
 		return
 	}
 	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -144,15 +138,8 @@ func (uc UserController) Login(writer http.ResponseWriter, req *http.Request) {
 			currentUser := helpers.GetCurrentUser(req)
 			json.NewEncoder(writer).Encode(&currentUser)
 			return
-		case helpers.AuthenticationErrorLoginWrongEmailPassword, helpers.AuthenticationErrorLoginUserNotExists:
-			writer.WriteHeader(http.StatusBadRequest)
-			errorResponse := helpers.GeneralResponse{Message: err.Error()}
-			json.NewEncoder(writer).Encode(errorResponse)
-			return
 		default:
-			writer.WriteHeader(http.StatusInternalServerError)
-			errorResponse := helpers.GeneralResponse{Message: helpers.GeneralErrorInternal.Error()}
-			json.NewEncoder(writer).Encode(errorResponse)
+			helpers.ErrorResponse(writer, err)
 			return
 		}
 	}
@@ -165,13 +152,10 @@ func (uc UserController) Logout(writer http.ResponseWriter, req *http.Request) {
 	err := uc.authorizer.Logout(writer, req)
 	if err != nil {
 		//shouldn't happen
-		writer.WriteHeader(http.StatusInternalServerError)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: err.Error()}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
-	http.Redirect(writer, req, config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
+	http.Redirect(writer, req, uc.cfg.DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
 }
 /**
 If we got here after the auth middleware then we are authenticated...
@@ -190,17 +174,21 @@ func (uc UserController) ConfirmUser(writer http.ResponseWriter, req *http.Reque
 	email := req.URL.Query().Get("email")
 	token := req.URL.Query().Get("token")
 	if email == "" || token == "" {
-		http.Error(writer, "Confirmation link is invalid", http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.UsersErrorInvalidConfirmationLink)
 		return
 	}
 	email = strings.ToLower(email)
-	err := uc.authorizer.ConfirmUser(email, token)
+	err := uc.authorizer.ConfirmUser(req.Context(), email, token)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
+	if user, err := storage(uc.dal, req).FindAnyUserByEmail(email); err == nil {
+		recordAudit(uc.dal, req, user.DisplayId, models.AUDIT_CONFIRM, models.AUDIT_TARGET_USER, "", user.DisplayId,
+			map[string]interface{}{"status": models.USER_NOT_CONFIRMED}, map[string]interface{}{"status": user.Status})
+	}
 	//redirect to login page
-	http.Redirect(writer, req, config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
+	http.Redirect(writer, req, uc.cfg.DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
 }
 
 /**
@@ -211,28 +199,29 @@ func (uc UserController) ForgotPassword(writer http.ResponseWriter, req *http.Re
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&forgotPasswordRequest)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 	email := strings.ToLower(forgotPasswordRequest.Email)
-	token, err := uc.authorizer.CreatePasswordRecovery(email)
+	token, err := uc.authorizer.CreatePasswordRecovery(req.Context(), email)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
+	//anyone may ask for a recovery email, so there is no actor
+	if user, err := storage(uc.dal, req).FindAnyUserByEmail(email); err == nil {
+		recordAudit(uc.dal, req, "", models.AUDIT_PASSWORD_RECOVERY, models.AUDIT_TARGET_USER, "", user.DisplayId, nil, nil)
+	}
 	//send email
-	configWrapper :=config.GetConfigWrapper().GetCurrent()
+	configWrapper := uc.cfg
 	subject := "Password recovery"
 	body := "We all forget our passwords sometimes... Please follow this link to reset your password:\n"
-	body += config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "/users/recover?email=" + email + "&token=" + token + "\n"
+	body += uc.cfg.DashboardBaseUrl + "/users/recover?email=" + email + "&token=" + token + "\n"
 	body += "If you didn't request a new password please contact us as soon as possible."
 	to := []string{email }
-	err = mailer.SendMail(to, subject, body, configWrapper.EmailServerFrom,configWrapper.EmailServerUsername,configWrapper.EmailServerPassword,configWrapper.EmailServerAddress,configWrapper.EmailServerPort,configWrapper.EmailServerBcc)
+	err = mailer.SendMail(req.Context(), to, subject, body, configWrapper.EmailServerFrom,configWrapper.EmailServerUsername,configWrapper.EmailServerPassword,configWrapper.EmailServerAddress,configWrapper.EmailServerPort,configWrapper.EmailServerBcc)
 	if err != nil {
-		writer.WriteHeader(http.StatusInternalServerError)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "We couldn't send your password recovery email, please try again or contect the system administrator with this message"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorRecoveryNotSent)
 		return
 	}
 	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -246,16 +235,16 @@ func (uc UserController) ValidateRecoverLink(writer http.ResponseWriter, req *ht
 	email := req.URL.Query().Get("email")
 	token := req.URL.Query().Get("token")
 	if email == "" || token == "" {
-		http.Error(writer, "Forgot Password link is invalid", http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.UsersErrorInvalidRecoveryLink)
 		return
 	}
-	_, err := uc.dal.FindUserByRecoveryToken(token, email)
+	_, err := storage(uc.dal, req).FindUserByRecoveryToken(token, email)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
 	//if link is valid, redirect to forgot password pages
-	http.Redirect(writer, req, config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "#/pages/forgot_password?token=" + token, http.StatusSeeOther)
+	http.Redirect(writer, req, uc.cfg.DashboardBaseUrl + "#/pages/forgot_password?token=" + token, http.StatusSeeOther)
 }
 
 /**
@@ -266,30 +255,27 @@ func (uc UserController) RecoverUser(writer http.ResponseWriter, req *http.Reque
 	decoder := json.NewDecoder(req.Body)
 	decodeErr := decoder.Decode(&recoverPasswordRequest)
 	if decodeErr != nil {
-		http.Error(writer, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInvalidBody)
 		return
 	}
 	//validate request
 	if recoverPasswordRequest.Email == "" || recoverPasswordRequest.Password == "" || recoverPasswordRequest.PasswordConfirmation == "" {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "Email, password or password confirmation are missing"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorMissingFields)
 		return
 	}
 	//password validation
 	if recoverPasswordRequest.Password != recoverPasswordRequest.PasswordConfirmation || len(recoverPasswordRequest.Password) < 6 {
-		writer.WriteHeader(http.StatusBadRequest)
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		errorResponse := helpers.GeneralResponse{Message: "Password is to short or doesn't match the password confirmation"}
-		json.NewEncoder(writer).Encode(errorResponse)
+		helpers.ErrorResponse(writer, helpers.UsersErrorInvalidPassword)
 		return
 	}
-	err := uc.authorizer.UpdateUserPasswordFromRecovery(recoverPasswordRequest.Email, recoverPasswordRequest.Token, recoverPasswordRequest.Password)
+	err := uc.authorizer.UpdateUserPasswordFromRecovery(req.Context(), recoverPasswordRequest.Email, recoverPasswordRequest.Token, recoverPasswordRequest.Password)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
+	if user, err := storage(uc.dal, req).FindAnyUserByEmail(recoverPasswordRequest.Email); err == nil {
+		recordAudit(uc.dal, req, user.DisplayId, models.AUDIT_PASSWORD_RESET, models.AUDIT_TARGET_USER, "", user.DisplayId, nil, nil)
+	}
 	//redirect to login page
-	http.Redirect(writer, req, config.GetConfigWrapper().GetCurrent().DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
+	http.Redirect(writer, req, uc.cfg.DashboardBaseUrl + "#/pages/signin", http.StatusSeeOther)
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Audit */
+
+// AuditFilter narrows the audit entries down, empty fields and zero times
+// don't filter. Entries are returned newest first, at most Limit of them
+// when it is positive
+type AuditFilter struct {
+	Actor          string
+	Action         string
+	TargetType     string
+	TargetId       string
+	EventDisplayId string
+	From           time.Time
+	To             time.Time
+	Limit          int
+}
+
+func (dal *MongoDAL) InsertAuditEntry(entry models.AuditEntry) error {
+	err := dal.session.DB(dbName).C(dbCollectionAudit).Insert(entry)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) GetAuditEntries(filter AuditFilter) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	query := bson.M{}
+	fields := map[string]string{
+		"actor": filter.Actor,
+		"action": filter.Action,
+		"target_type": filter.TargetType,
+		"target_id": filter.TargetId,
+		"event_display_id": filter.EventDisplayId}
+	for field, value := range fields {
+		if value != "" {
+			query[field] = value
+		}
+	}
+	createdAt := bson.M{}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		createdAt["$lt"] = filter.To
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+	err := dal.session.DB(dbName).C(dbCollectionAudit).Find(query).Sort("-created_at").Limit(filter.Limit).All(&entries)
+	if err != nil {
+		log.Info(err)
+		return entries, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Backup */
+
+func (dal *MongoDAL) ExportUsers() ([]models.User, error) {
+	users := []models.User{}
+	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(nil).Sort("created_at").All(&users)
+	return users, err
+}
+
+func (dal *MongoDAL) ExportEvents() ([]models.Event, error) {
+	events := []models.Event{}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(nil).Sort("created_at").All(&events)
+	return events, err
+}
+
+func (dal *MongoDAL) ExportSlots() ([]models.Slot, error) {
+	slots := []models.Slot{}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Find(nil).Sort(dbFieldStartTime).All(&slots)
+	return slots, err
+}
+
+func (dal *MongoDAL) ExportMeetings() ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(nil).Sort(dbFieldStartTime).All(&meetings)
+	return meetings, err
+}
+
+func (dal *MongoDAL) ImportUser(user models.User, replace bool) error {
+	return dal.importDocument(dbCollectionUsers, user.Id, user, replace)
+}
+
+func (dal *MongoDAL) ImportEvent(event models.Event, replace bool) error {
+	return dal.importDocument(dbCollectionEvents, event.Id, event, replace)
+}
+
+func (dal *MongoDAL) ImportSlots(slots []models.Slot, replace bool) error {
+	for _, element := range slots {
+		err := dal.importDocument(dbCollectionSlots, element.Id, element, replace)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dal *MongoDAL) ImportMeetings(meetings []models.Meeting, replace bool) error {
+	for _, element := range meetings {
+		err := dal.importDocument(dbCollectionMeetings, element.Id, element, replace)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importDocument inserts the document, or replaces the one with its id
+func (dal *MongoDAL) importDocument(collection string, id bson.ObjectId, document interface{}, replace bool) error {
+	c := dal.session.DB(dbName).C(collection)
+	var err error
+	if replace {
+		_, err = c.UpsertId(id, document)
+	} else {
+		err = c.Insert(document)
+	}
+	if err != nil {
+		log.Warn(err)
+	}
+	return err
+}
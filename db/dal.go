@@ -15,6 +15,10 @@ const dbName = "meeting-scheduler"
 // Collections
 const dbCollectionUsers = "users"
 const dbCollectionEvents = "events"
+const dbCollectionSlots = "slots"
+const dbCollectionMeetings = "meetings"
+const dbCollectionAudit = "audit"
+const dbCollectionIdempotencyKeys = "idempotency_keys"
 
 // Fields
 const dbFieldUsersEmail = "email"
@@ -22,19 +26,45 @@ const dbFieldUsersDisplayId = "display_id"
 
 const dbFieldEventsDisplayId = "display_id"
 
-type DAL struct {
+const dbFieldSlotsDisplayId = "display_id"
+const dbFieldSlotsEventDisplayId = "event_display_id"
+const dbFieldSlotsUser = "user"
+
+const dbFieldMeetingsDisplayId = "display_id"
+const dbFieldMeetingsEventDisplayId = "event_display_id"
+const dbFieldMeetingsUserId = "user_id"
+const dbFieldMeetingsGuestEmail = "guest.email"
+
+const dbFieldStartTime = "start_time"
+const dbFieldEndTime = "end_time"
+const dbFieldDeletedAt = "deleted_at"
+
+// notDeleted hides the documents that were moved to the trash
+func notDeleted(query bson.M) bson.M {
+	query[dbFieldDeletedAt] = nil
+	return query
+}
+
+// deleted matches the documents in the trash
+func deleted(query bson.M) bson.M {
+	query[dbFieldDeletedAt] = bson.M{"$ne": nil}
+	return query
+}
+
+// MongoDAL stores the data in MongoDB
+type MongoDAL struct {
 	session *mgo.Session
 }
 
-func NewDatabaseAccessor(url string) *DAL {
+func NewDatabaseAccessor(url string) *MongoDAL {
 	session, err := mgo.Dial(url)
 	if err!=nil {
 		panic(err)
 	}
-	return &DAL{session : session}
+	return &MongoDAL{session : session}
 }
 
-func (dal *DAL) Initialize() (error) {
+func (dal *MongoDAL) Initialize() (error) {
 	usersCollection := dal.session.DB(dbName).C(dbCollectionUsers)
 	uniqueIndexes := [][]string {[]string{dbFieldUsersEmail}, []string{dbFieldUsersDisplayId}}
 	for _, element := range uniqueIndexes {
@@ -67,25 +97,80 @@ func (dal *DAL) Initialize() (error) {
 		}
 	}
 
+	// slots and meetings are looked up by event and by time range of a host or a guest
+	rangeIndexes := map[string][][]string {
+		dbCollectionSlots: [][]string {
+			[]string{dbFieldSlotsEventDisplayId, dbFieldStartTime},
+			[]string{dbFieldSlotsUser, dbFieldStartTime, dbFieldEndTime}},
+		dbCollectionMeetings: [][]string {
+			[]string{dbFieldMeetingsEventDisplayId, dbFieldStartTime},
+			[]string{dbFieldMeetingsUserId, dbFieldStartTime, dbFieldEndTime},
+			[]string{dbFieldMeetingsGuestEmail, dbFieldStartTime, dbFieldEndTime}}}
+	uniqueDisplayIds := map[string]string {
+		dbCollectionSlots: dbFieldSlotsDisplayId,
+		dbCollectionMeetings: dbFieldMeetingsDisplayId}
+	for collection, keys := range rangeIndexes {
+		c := dal.session.DB(dbName).C(collection)
+		err := c.EnsureIndex(mgo.Index{Key: []string{uniqueDisplayIds[collection]}, Unique: true})
+		if err != nil {
+			return err
+		}
+		for _, element := range keys {
+			err = c.EnsureIndex(mgo.Index{Key: element})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// audit entries are listed newest first, by event or by target
+	auditCollection := dal.session.DB(dbName).C(dbCollectionAudit)
+	for _, element := range [][]string{[]string{"event_display_id", "-created_at"}, []string{"target_id", "-created_at"}, []string{"-created_at"}} {
+		err := auditCollection.EnsureIndex(mgo.Index{Key: element})
+		if err != nil {
+			return err
+		}
+	}
+
+	// idempotency keys are unique per scope and purged once they expire
+	idempotencyCollection := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys)
+	err := idempotencyCollection.EnsureIndex(mgo.Index{Key: []string{"scope", "key"}, Unique: true})
+	if err != nil {
+		return err
+	}
+	err = idempotencyCollection.EnsureIndex(mgo.Index{Key: []string{"expires_at"}})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func(dal *DAL) Close() {
+func(dal *MongoDAL) Close() {
 	dal.session.Close()
 }
 
+func (dal *MongoDAL) Ping() error {
+	return dal.session.Ping()
+}
+
 /* Users */
 
-func (dal *DAL) FindActiveUserByEmail(email string)  (*models.User, error) {
+// FindActiveUserByEmail fails with AuthenticationErrorLoginUserNotExists only
+// when there is no such user, storage failures are returned as they are
+func (dal *MongoDAL) FindActiveUserByEmail(email string)  (*models.User, error) {
 	user := models.User{}
 	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(bson.M{"email": email, "status" : models.USER_CONFIRMED}).One(&user)
-	if (err != nil) {
+	if err == mgo.ErrNotFound {
 		return &user, helpers.AuthenticationErrorLoginUserNotExists
+	} else if err != nil {
+		log.Warn(err)
+		return &user, err
 	}
 	return &user, nil
 }
 
-func (dal *DAL) FindAnyUserByEmail(email string)  (*models.User, error) {
+func (dal *MongoDAL) FindAnyUserByEmail(email string)  (*models.User, error) {
 	user := models.User{}
 	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(bson.M{"email": email}).One(&user)
 	if (err != nil) {
@@ -94,7 +179,7 @@ func (dal *DAL) FindAnyUserByEmail(email string)  (*models.User, error) {
 	return &user, nil
 }
 
-func (dal *DAL) InsertUser(email string,hash []byte, firstName string , lastName string, confirmationToken string) error {
+func (dal *MongoDAL) InsertUser(email string,hash []byte, firstName string , lastName string, confirmationToken string) error {
 	user := models.User{
 		Id: bson.NewObjectId(),
 		DisplayId: helpers.RandStringBytesMaskImprSrc(8),
@@ -103,6 +188,9 @@ func (dal *DAL) InsertUser(email string,hash []byte, firstName string , lastName
 		LastName: lastName,
 		Hash: hash,
 		ConfirmationToken: confirmationToken,
+		Teams: []string{},
+		Blackouts: []models.Blackout{},
+		DateOverrides: []models.DateOverride{},
 		ConfirmationTokenStatus: models.CONFIRMATION_TOKEN_VALID,
 		Confirmed: false,
 		Status: models.USER_NOT_CONFIRMED,
@@ -117,7 +205,7 @@ func (dal *DAL) InsertUser(email string,hash []byte, firstName string , lastName
 	return  nil
 }
 
-func (dal *DAL) FindUserByConfirmationToken(confirmationToken string, email string)  (*models.User, error) {
+func (dal *MongoDAL) FindUserByConfirmationToken(confirmationToken string, email string)  (*models.User, error) {
 	user := models.User{}
 	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(bson.M{"confirmation_token": confirmationToken, "confirmation_token_status" : models.CONFIRMATION_TOKEN_VALID, "email" : email }).One(&user)
 	if (err != nil) {
@@ -126,7 +214,7 @@ func (dal *DAL) FindUserByConfirmationToken(confirmationToken string, email stri
 	return &user, nil
 }
 
-func (dal *DAL) FindUserByRecoveryToken(recoveryToken string, email string)  (*models.User, error) {
+func (dal *MongoDAL) FindUserByRecoveryToken(recoveryToken string, email string)  (*models.User, error) {
 	user := models.User{}
 	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(bson.M{"email" : email, "recovery_token": recoveryToken, "recovery_token_status" : models.RECOVER_TOKEN_VALID, "recovery_token_expiry" : bson.M{ "$gt" : time.Now().UTC()} }).One(&user)
 	if (err != nil) {
@@ -135,7 +223,7 @@ func (dal *DAL) FindUserByRecoveryToken(recoveryToken string, email string)  (*m
 	return &user, nil
 }
 
-func (dal *DAL) UpdateUserConfirmation(userId bson.ObjectId, userStatus models.UserStatusType, confirmationTokenStatus models.ConfirmationTokenStatusType, confirmed bool) (error) {
+func (dal *MongoDAL) UpdateUserConfirmation(userId bson.ObjectId, userStatus models.UserStatusType, confirmationTokenStatus models.ConfirmationTokenStatusType, confirmed bool) (error) {
 	colQueried := bson.M{"_id" : userId}
 	change := bson.M{"$set": bson.M{
 		"confirmation_token_status": confirmationTokenStatus,
@@ -149,7 +237,7 @@ func (dal *DAL) UpdateUserConfirmation(userId bson.ObjectId, userStatus models.U
 	return nil
 }
 
-func (dal *DAL) UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) (error) {
+func (dal *MongoDAL) UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) (error) {
 	colQueried := bson.M{"_id" : userId, "recovery_token_expiry" : bson.M{ "$gt" : time.Now().UTC()}, "recovery_token_status" : models.RECOVER_TOKEN_VALID}
 	change := bson.M{"$set": bson.M{
 		"recovery_token_status": recoveryTokenStatus,
@@ -163,7 +251,7 @@ func (dal *DAL) UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTo
 	return nil
 }
 
-func (dal *DAL) UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
+func (dal *MongoDAL) UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
 	colQueried := bson.M{"_id" : userId}
 	change := bson.M{"$set": bson.M{
 		"updated_at": time.Now().UTC(),
@@ -177,74 +265,191 @@ func (dal *DAL) UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, r
 	return nil
 }
 
+func (dal *MongoDAL) UpdateUserTeams(userId bson.ObjectId, teams []string) error {
+	colQueried := bson.M{"_id" : userId}
+	change := bson.M{"$set": bson.M{
+		"updated_at": time.Now().UTC(),
+		"teams": teams}}
+	err := dal.session.DB(dbName).C(dbCollectionUsers).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.AuthenticationErrorLoginUserNotExists
+	}
+	return err
+}
+
+func (dal *MongoDAL) FindActiveUsersByDisplayIds(displayIds []string) ([]models.User, error) {
+	users := []models.User{}
+	err := dal.session.DB(dbName).C(dbCollectionUsers).Find(bson.M{"display_id": bson.M{"$in": displayIds}, "status" : models.USER_CONFIRMED}).All(&users)
+	if err != nil {
+		log.Info(err)
+		return users, err
+	}
+	return users, nil
+}
+
 /* Events */
 
-func (dal *DAL) GetEventsForUser(displayId string) *[]models.Event {
+func (dal *MongoDAL) GetEventsForUser(displayId string) *[]models.Event {
 	events := []models.Event{}
-	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(bson.M{"admin_user": displayId}).All(&events)
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(notDeleted(bson.M{"admin_user": displayId})).All(&events)
 	if err != nil {
 		log.Info(err)
 	}
 	return &events
 }
 
-func (dal *DAL) InsertEvent(name string, adminUser string, slots []models.Slot, meetings []models.Meeting) error {
+func (dal *MongoDAL) GetEventsByDisplayIds(displayIds []string) (*[]models.Event, error) {
+	events := []models.Event{}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(notDeleted(bson.M{"display_id": bson.M{"$in": displayIds}})).All(&events)
+	if err != nil {
+		log.Info(err)
+		return &events, err
+	}
+	return &events, nil
+}
+
+func (dal *MongoDAL) InsertEvent(name string, adminUser string) (*models.Event, error) {
 	event := models.Event{
 		Id: bson.NewObjectId(),
 		DisplayId: helpers.RandStringBytesMaskImprSrc(8),
 		Name: name,
 		AdminUser: adminUser,
-		Slots: slots,
-		Meetings: meetings,
+		Blackouts: []models.Blackout{},
+		DateOverrides: []models.DateOverride{},
+		IntakeForm: []models.IntakeField{},
+		Version: 1,
 		CreatedAt:time.Now().UTC(),
 		UpdatedAt:time.Now().UTC()}
 
 	err := dal.session.DB(dbName).C(dbCollectionEvents).Insert(event)
 	if (err != nil) {
-		log.Fatal(err)
+		log.Warn(err)
+		return nil, err
+	}
+	return &event, nil
+}
+
+// versionConflict tells a stale version apart from a missing event after a
+// conditional update didn't match
+func (dal *MongoDAL) versionConflict(displayId string) error {
+	count, err := dal.session.DB(dbName).C(dbCollectionEvents).Find(notDeleted(bson.M{"display_id": displayId})).Count()
+	if err != nil {
 		return err
 	}
-	return  nil
+	if count == 0 {
+		return helpers.EventsErrorNotFound
+	}
+	return helpers.EventsErrorVersionConflict
 }
 
-func (dal *DAL) UpdateEvent(displayId string, name string, adminUser string, slots []models.Slot, meetings []models.Meeting) error {
-	slotsToDb := []models.Slot{}
-	for _, element := range slots {
-		if len(element.Id) == 0 {
-			element.Id = bson.NewObjectId()
-			element.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
-		}
-		slotsToDb = append(slotsToDb, element)
+func (dal *MongoDAL) UpdateEvent(displayId string, version int, name string, adminUser string) (int, error) {
+	colQueried := notDeleted(bson.M{"display_id" : displayId, "version": version})
+	change := bson.M{
+		"$set": bson.M{
+			"name": name,
+			"admin_user" : adminUser,
+			"updated_at": time.Now().UTC()},
+		"$inc": bson.M{"version": 1}}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
 	}
+	return version + 1, nil
+}
 
-	colQueried := bson.M{"display_id" : displayId}
-	change := bson.M{"$set": bson.M{
-		"name": name,
-		"admin_user" : adminUser,
-		"slots" : slotsToDb,
-		"meetings" : meetings,
-		"updated_at": time.Now().UTC()}}
+func (dal *MongoDAL) UpdateEventIntakeForm(displayId string, version int, form []models.IntakeField) (int, error) {
+	colQueried := notDeleted(bson.M{"display_id" : displayId, "version": version})
+	change := bson.M{
+		"$set": bson.M{
+			"intake_form": form,
+			"updated_at": time.Now().UTC()},
+		"$inc": bson.M{"version": 1}}
 	err := dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, change)
-	if err != nil {
-		log.Fatal(err)
+	if err == mgo.ErrNotFound {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// IncrementEventVersion claims the next version of the event before its slots
+// or meetings are changed, it fails when the event is no longer at the
+// expected version
+func (dal *MongoDAL) IncrementEventVersion(displayId string, version int) (int, error) {
+	colQueried := notDeleted(bson.M{"display_id" : displayId, "version": version})
+	change := bson.M{
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+		"$inc": bson.M{"version": 1}}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// RevertEventVersion moves the event back from the version claimed by
+// IncrementEventVersion when the change it was claimed for failed. The event is
+// left as it is when it moved on to a later version in the meantime.
+func (dal *MongoDAL) RevertEventVersion(displayId string, version int) error {
+	colQueried := notDeleted(bson.M{"display_id" : displayId, "version": version})
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, bson.M{"$inc": bson.M{"version": -1}})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Warn(err)
 		return err
 	}
 	return nil
 }
 
-func (dal *DAL) RemoveEvent(displayId string) error {
-	colQueried := bson.M{"display_id" : displayId}
-	err := dal.session.DB(dbName).C(dbCollectionEvents).Remove(colQueried)
-	if err != nil {
-		log.Fatal(err)
+// RemoveEvent moves the event to the trash together with its slots and
+// meetings, they share the deletion time so restoring the event brings back
+// exactly what was deleted with it. The event is what records the deletion:
+// once it is in the trash the removal succeeded, slots and meetings that
+// failed to follow it are moved by the next PurgeDeleted.
+func (dal *MongoDAL) RemoveEvent(displayId string, version int, deletedBy string) error {
+	now := time.Now().UTC()
+	colQueried := notDeleted(bson.M{"display_id" : displayId, "version": version})
+	change := bson.M{
+		"$set": bson.M{
+			"deleted_at": now,
+			"deleted_by": deletedBy,
+			"updated_at": now},
+		"$inc": bson.M{"version": 1}}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return dal.versionConflict(displayId)
+	} else if err != nil {
+		log.Warn(err)
 		return err
 	}
+	err = dal.trashEventContents(displayId, now, deletedBy)
+	if err != nil {
+		log.WithField("event", displayId).Warnf("the event is in the trash, its slots and meetings will follow on the next purge: %s", err)
+	}
 	return nil
 }
 
-func (dal *DAL) GetEventByDisplayId(displayId string) (*models.Event, error) {
+// trashEventContents moves the slots and meetings of the event that aren't in
+// the trash yet there, with the deletion time of the event
+func (dal *MongoDAL) trashEventContents(displayId string, deletedAt time.Time, deletedBy string) error {
+	_, err := dal.session.DB(dbName).C(dbCollectionSlots).UpdateAll(notDeleted(bson.M{"event_display_id": displayId}), bson.M{"$set": bson.M{"deleted_at": deletedAt}})
+	if err != nil {
+		return err
+	}
+	_, err = dal.session.DB(dbName).C(dbCollectionMeetings).UpdateAll(notDeleted(bson.M{"event_display_id": displayId}), bson.M{"$set": bson.M{"deleted_at": deletedAt, "deleted_by": deletedBy}})
+	return err
+}
+
+func (dal *MongoDAL) GetEventByDisplayId(displayId string) (*models.Event, error) {
 	event := models.Event{}
-	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(bson.M{"display_id": displayId}).One(&event)
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(notDeleted(bson.M{"display_id": displayId})).One(&event)
 	if err != nil {
 		log.Info(err)
 		return nil, err
@@ -252,32 +457,176 @@ func (dal *DAL) GetEventByDisplayId(displayId string) (*models.Event, error) {
 	return &event, nil
 }
 
-func (dal *DAL) RemoveSlotFromEvent(eventDisplayId string, displayId string) error {
-	event, err := dal.GetEventByDisplayId(eventDisplayId)
+/* Availability rules */
+
+// rulesOwner returns the collection and the query of the document holding the
+// rules, the event when an event display id is given and the user otherwise
+func rulesOwner(userDisplayId string, eventDisplayId string) (string, bson.M) {
+	if eventDisplayId != "" {
+		return dbCollectionEvents, notDeleted(bson.M{"display_id": eventDisplayId})
+	}
+	return dbCollectionUsers, bson.M{"display_id": userDisplayId}
+}
+
+// rulesChange adds the bookkeeping of the owner to a change of its rules,
+// events get a new version
+func rulesChange(collection string, change bson.M) bson.M {
+	change["$set"] = bson.M{"updated_at": time.Now().UTC()}
+	if collection == dbCollectionEvents {
+		change["$inc"] = bson.M{"version": 1}
+	}
+	return change
+}
+
+func (dal *MongoDAL) InsertBlackouts(userDisplayId string, eventDisplayId string, blackouts []models.Blackout) ([]models.Blackout, error) {
+	for index := range blackouts {
+		blackouts[index].Id = bson.NewObjectId()
+		blackouts[index].DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+		blackouts[index].CreatedAt = time.Now().UTC()
+		blackouts[index].UpdatedAt = time.Now().UTC()
+	}
+	collection, colQueried := rulesOwner(userDisplayId, eventDisplayId)
+	change := rulesChange(collection, bson.M{"$push": bson.M{"blackouts": bson.M{"$each": blackouts}}})
+	err := dal.session.DB(dbName).C(collection).Update(colQueried, change)
 	if err != nil {
-		log.Fatal(err)
+		log.Warn(err)
+		return nil, err
+	}
+	return blackouts, nil
+}
+
+func (dal *MongoDAL) RemoveBlackout(userDisplayId string, eventDisplayId string, displayId string) error {
+	collection, colQueried := rulesOwner(userDisplayId, eventDisplayId)
+	colQueried["blackouts.display_id"] = displayId
+	change := rulesChange(collection, bson.M{"$pull": bson.M{"blackouts": bson.M{"display_id": displayId}}})
+	err := dal.session.DB(dbName).C(collection).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.BlackoutsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
 		return err
 	}
+	return nil
+}
 
-	indexToDelete := -1
-	for index, element := range event.Slots {
-		if element.DisplayId == displayId {
-			indexToDelete = index
-			break
-		}
+func (dal *MongoDAL) InsertDateOverride(userDisplayId string, eventDisplayId string, override models.DateOverride) (*models.DateOverride, error) {
+	override.Id = bson.NewObjectId()
+	override.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+	override.CreatedAt = time.Now().UTC()
+	override.UpdatedAt = time.Now().UTC()
+	collection, colQueried := rulesOwner(userDisplayId, eventDisplayId)
+	change := rulesChange(collection, bson.M{"$push": bson.M{"date_overrides": override}})
+	err := dal.session.DB(dbName).C(collection).Update(colQueried, change)
+	if err != nil {
+		log.Warn(err)
+		return nil, err
 	}
+	return &override, nil
+}
 
-	if indexToDelete == -1 {
-		log.Fatal(helpers.SlotsErrorNotFound)
-		return helpers.SlotsErrorNotFound
+func (dal *MongoDAL) RemoveDateOverride(userDisplayId string, eventDisplayId string, displayId string) error {
+	collection, colQueried := rulesOwner(userDisplayId, eventDisplayId)
+	colQueried["date_overrides.display_id"] = displayId
+	change := rulesChange(collection, bson.M{"$pull": bson.M{"date_overrides": bson.M{"display_id": displayId}}})
+	err := dal.session.DB(dbName).C(collection).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.DateOverridesErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return err
 	}
+	return nil
+}
 
-	event.Slots = append(event.Slots[:indexToDelete], event.Slots[indexToDelete+1:]...)
+/* Trash */
 
-	err = dal.UpdateEvent(event.DisplayId, event.Name, event.AdminUser, event.Slots, event.Meetings)
+func (dal *MongoDAL) GetDeletedEventsForUser(displayId string) ([]models.Event, error) {
+	events := []models.Event{}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(deleted(bson.M{"admin_user": displayId})).Sort("-deleted_at").All(&events)
+	if err != nil {
+		log.Info(err)
+		return events, err
+	}
+	return events, nil
+}
+
+// RestoreEvent takes the event of the admin out of the trash with the slots and
+// meetings that were deleted with it, and returns its new version. They are
+// restored before the event, so a failure leaves the event in the trash and
+// the restore can be tried again; the slots and meetings already restored are
+// moved back by the next PurgeDeleted otherwise.
+func (dal *MongoDAL) RestoreEvent(displayId string, adminUser string) (int, error) {
+	event := models.Event{}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(deleted(bson.M{"display_id": displayId, "admin_user": adminUser})).One(&event)
+	if err == mgo.ErrNotFound {
+		return 0, helpers.EventsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	withEvent := bson.M{"event_display_id": displayId, "deleted_at": event.DeletedAt}
+	_, err = dal.session.DB(dbName).C(dbCollectionSlots).UpdateAll(withEvent, bson.M{"$unset": bson.M{"deleted_at": ""}})
+	if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	_, err = dal.session.DB(dbName).C(dbCollectionMeetings).UpdateAll(withEvent, bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}})
+	if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	colQueried := bson.M{"display_id": displayId, "deleted_at": event.DeletedAt}
+	change := bson.M{
+		"$unset": bson.M{"deleted_at": "", "deleted_by": ""},
+		"$set": bson.M{"updated_at": time.Now().UTC()},
+		"$inc": bson.M{"version": 1}}
+	err = dal.session.DB(dbName).C(dbCollectionEvents).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return 0, helpers.EventsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	return event.Version + 1, nil
+}
+
+// PurgeDeleted removes for good what was moved to the trash before the given
+// time. It first moves to the trash the slots and meetings left out of it by
+// a removal or a restore of their event that stopped halfway, so the trash of
+// the event is complete before it expires.
+func (dal *MongoDAL) PurgeDeleted(before time.Time) error {
+	trashed := []models.Event{}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(deleted(bson.M{})).Select(bson.M{"display_id": 1, "deleted_at": 1, "deleted_by": 1}).All(&trashed)
 	if err != nil {
-		log.Fatal(err)
 		return err
 	}
-	return nil
-}
\ No newline at end of file
+	for _, element := range trashed {
+		if element.DeletedAt == nil {
+			continue
+		}
+		err = dal.trashEventContents(element.DisplayId, *element.DeletedAt, element.DeletedBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	expired := bson.M{"deleted_at": bson.M{"$ne": nil, "$lt": before}}
+	events := []models.Event{}
+	err = dal.session.DB(dbName).C(dbCollectionEvents).Find(expired).Select(bson.M{"display_id": 1}).All(&events)
+	if err != nil {
+		return err
+	}
+	displayIds := []string{}
+	for _, element := range events {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	withEvents := bson.M{"$or": []bson.M{expired, bson.M{"event_display_id": bson.M{"$in": displayIds}}}}
+	for _, collection := range []string{dbCollectionSlots, dbCollectionMeetings} {
+		_, err = dal.session.DB(dbName).C(collection).RemoveAll(withEvents)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = dal.session.DB(dbName).C(dbCollectionEvents).RemoveAll(bson.M{"display_id": bson.M{"$in": displayIds}})
+	return err
+}
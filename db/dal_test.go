@@ -0,0 +1,192 @@
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// newTestMongoDAL connects to the MongoDB server of MONGO_TEST_URL and empties
+// the database of the service on it, the test is skipped without one. Never
+// point it at a server holding data.
+func newTestMongoDAL(t *testing.T) *MongoDAL {
+	url := os.Getenv("MONGO_TEST_URL")
+	if url == "" {
+		t.Skip("MONGO_TEST_URL isn't set")
+	}
+	dal := NewDatabaseAccessor(url)
+	drop := func() {
+		if err := dal.session.DB(dbName).DropDatabase(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop()
+	t.Cleanup(func() {
+		drop()
+		dal.session.Close()
+	})
+	return dal
+}
+
+// mongoCounts returns how many slots and meetings of the event are visible
+func mongoCounts(t *testing.T, dal *MongoDAL, eventDisplayId string) (int, int) {
+	slots, err := dal.GetSlotsForEvents([]string{eventDisplayId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meetings, err := dal.GetMeetingsForEvents([]string{eventDisplayId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(slots), len(meetings)
+}
+
+// A removal that stops after the event was moved to the trash leaves its slots
+// and meetings out of it; restoring and purging the event still work.
+func TestMongoTrashAfterPartialRemoval(t *testing.T) {
+	dal := newTestMongoDAL(t)
+	event, err := dal.InsertEvent("Interviews", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.InsertSlots(event.DisplayId, []models.Slot{testSlot("slot", 9, 12)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.InsertMeeting(testMeeting(event.DisplayId, 9*time.Hour, 10*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	removeEventOnly := func(version int) {
+		now := time.Now().UTC()
+		change := bson.M{"$set": bson.M{"deleted_at": now, "deleted_by": "u1"}, "$inc": bson.M{"version": 1}}
+		err := dal.session.DB(dbName).C(dbCollectionEvents).Update(bson.M{"display_id": event.DisplayId, "version": version}, change)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeEventOnly(1)
+	version, err := dal.RestoreEvent(event.DisplayId, "u1")
+	if err != nil || version != 3 {
+		t.Fatalf("RestoreEvent() after a partial removal = %d %v, want version 3", version, err)
+	}
+	if slots, meetings := mongoCounts(t, dal, event.DisplayId); slots != 1 || meetings != 1 {
+		t.Errorf("restored event shows %d slots and %d meetings, want 1 and 1", slots, meetings)
+	}
+
+	// the purge completes the removal before anything expires
+	removeEventOnly(3)
+	if err = dal.PurgeDeleted(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if slots, meetings := mongoCounts(t, dal, event.DisplayId); slots != 0 || meetings != 0 {
+		t.Errorf("after the purge the removed event shows %d slots and %d meetings, want none", slots, meetings)
+	}
+	if version, err = dal.RestoreEvent(event.DisplayId, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if slots, meetings := mongoCounts(t, dal, event.DisplayId); slots != 1 || meetings != 1 {
+		t.Errorf("event restored after the purge shows %d slots and %d meetings, want 1 and 1", slots, meetings)
+	}
+
+	if err = dal.RemoveEvent(event.DisplayId, version, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.PurgeDeleted(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dal.RestoreEvent(event.DisplayId, "u1"); err != helpers.EventsErrorNotFound {
+		t.Errorf("RestoreEvent() after the event expired = %v, want EventsErrorNotFound", err)
+	}
+	for _, collection := range []string{dbCollectionSlots, dbCollectionMeetings} {
+		count, err := dal.session.DB(dbName).C(collection).Find(bson.M{"event_display_id": event.DisplayId}).Count()
+		if err != nil || count != 0 {
+			t.Errorf("%s of the purged event: %d %v, want none", collection, count, err)
+		}
+	}
+}
+
+// An event document as the baseline stored it, with one slot that never got an
+// id, is split into the collections; running the split again changes nothing.
+func TestMongoSplitEmbeddedSlotsAndMeetings(t *testing.T) {
+	dal := newTestMongoDAL(t)
+	database := dal.session.DB(dbName)
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	slotId, meetingId := bson.NewObjectId(), bson.NewObjectId()
+	event := bson.M{
+		"_id": bson.NewObjectId(), "display_id": "legacy", "admin_user": "u1", "name": "Interviews",
+		"slots": []bson.M{
+			{"_id": slotId, "display_id": "slot1", "start_time": day.Add(9 * time.Hour), "end_time": day.Add(12 * time.Hour), "user": "u1", "interval": 30},
+			{"display_id": "slot2", "start_time": day.Add(13 * time.Hour), "end_time": day.Add(15 * time.Hour), "user": "u1", "interval": 30},
+		},
+		"meetings": []bson.M{
+			{"_id": meetingId, "display_id": "meeting1", "start_time": day.Add(9 * time.Hour), "end_time": day.Add(10 * time.Hour), "user_id": "u1",
+				"guest": bson.M{"_id": bson.NewObjectId(), "display_id": "guest1", "email": "guest@example.com"}},
+		},
+		"created_at": day, "updated_at": day,
+	}
+	empty := bson.M{"_id": bson.NewObjectId(), "display_id": "empty", "admin_user": "u1", "name": "Demos",
+		"slots": []bson.M{}, "meetings": []bson.M{}, "created_at": day, "updated_at": day}
+	if err := database.C(dbCollectionEvents).Insert(event, empty); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(run string) {
+		for _, collection := range []string{dbCollectionSlots, dbCollectionMeetings} {
+			count, err := database.C(collection).Find(bson.M{"event_display_id": "empty"}).Count()
+			if err != nil || count != 0 {
+				t.Errorf("%s: %s of the empty event: %d %v, want none", run, collection, count, err)
+			}
+		}
+		embedded, err := database.C(dbCollectionEvents).Find(bson.M{"$or": []bson.M{
+			{"slots": bson.M{"$exists": true}}, {"meetings": bson.M{"$exists": true}}}}).Count()
+		if err != nil || embedded != 0 {
+			t.Errorf("%s: %d events still embed slots or meetings %v", run, embedded, err)
+		}
+		slots := []models.Slot{}
+		if err = database.C(dbCollectionSlots).Find(nil).Sort("start_time").All(&slots); err != nil {
+			t.Fatal(err)
+		}
+		if len(slots) != 2 || slots[0].Id != slotId || slots[0].EventDisplayId != "legacy" || len(slots[1].Id) == 0 || slots[1].EventDisplayId != "legacy" {
+			t.Errorf("%s: slots = %+v, want both in the collection under the event, the one without an id given one", run, slots)
+		}
+		meetings := []models.Meeting{}
+		if err = database.C(dbCollectionMeetings).Find(nil).All(&meetings); err != nil {
+			t.Fatal(err)
+		}
+		if len(meetings) != 1 || meetings[0].Id != meetingId || meetings[0].EventDisplayId != "legacy" || meetings[0].Guest.Email != "guest@example.com" {
+			t.Errorf("%s: meetings = %+v, want the meeting with its guest under the event", run, meetings)
+		}
+	}
+	if err := splitEmbeddedSlotsAndMeetings(database); err != nil {
+		t.Fatal(err)
+	}
+	check("first run")
+	if err := splitEmbeddedSlotsAndMeetings(database); err != nil {
+		t.Fatal(err)
+	}
+	check("second run")
+
+	// the whole runner brings the legacy event up to date, twice in a row
+	for run := 0; run < 2; run++ {
+		if err := dal.MigrateUp(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending, err := dal.CheckSchemaVersion(); err != nil || pending {
+		t.Errorf("CheckSchemaVersion() = %v %v, want nothing pending", pending, err)
+	}
+	migrated, err := dal.GetEventByDisplayId("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.IntakeForm == nil {
+		t.Errorf("migrated event = %+v, want an empty intake form", migrated)
+	}
+	if slots, meetings := mongoCounts(t, dal, "legacy"); slots != 2 || meetings != 1 {
+		t.Errorf("migrated event shows %d slots and %d meetings, want 2 and 1", slots, meetings)
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Idempotency keys */
+
+// InsertIdempotencyKey reserves the key of the scope, expired keys are
+// replaced and keys that are still kept fail with IdempotencyErrorKeyInUse
+func (dal *MongoDAL) InsertIdempotencyKey(key models.IdempotencyKey) error {
+	c := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys)
+	_, err := c.RemoveAll(bson.M{"scope": key.Scope, "key": key.Key, "expires_at": bson.M{"$lte": time.Now().UTC()}})
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	err = c.Insert(key)
+	if mgo.IsDup(err) {
+		return helpers.IdempotencyErrorKeyInUse
+	}
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) FindIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	record := models.IdempotencyKey{}
+	query := bson.M{"scope": scope, "key": key, "expires_at": bson.M{"$gt": time.Now().UTC()}}
+	err := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys).Find(query).One(&record)
+	if err == mgo.ErrNotFound {
+		return nil, helpers.IdempotencyErrorNotFound
+	}
+	if err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that reserved the
+// key and keeps it until its new expiry
+func (dal *MongoDAL) CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	update := bson.M{"$set": bson.M{"status": key.Status, "header": key.Header, "body": key.Body, "expires_at": key.ExpiresAt}}
+	err := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys).UpdateId(key.Id, update)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+// RemoveIdempotencyKey releases a key so it can be used again
+func (dal *MongoDAL) RemoveIdempotencyKey(scope string, key string) error {
+	_, err := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys).RemoveAll(bson.M{"scope": scope, "key": key})
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) PurgeIdempotencyKeys(before time.Time) error {
+	_, err := dal.session.DB(dbName).C(dbCollectionIdempotencyKeys).RemoveAll(bson.M{"expires_at": bson.M{"$lt": before}})
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
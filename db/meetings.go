@@ -0,0 +1,136 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+/* Meetings */
+
+func (dal *MongoDAL) GetMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(notDeleted(bson.M{"event_display_id": bson.M{"$in": eventDisplayIds}})).Sort("start_time").All(&meetings)
+	if err != nil {
+		log.Info(err)
+		return meetings, err
+	}
+	return meetings, nil
+}
+
+func (dal *MongoDAL) GetMeetingsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	query := notDeleted(overlapping(from, to))
+	query["user_id"] = bson.M{"$in": userDisplayIds}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(query).Sort("start_time").All(&meetings)
+	if err != nil {
+		log.Info(err)
+		return meetings, err
+	}
+	return meetings, nil
+}
+
+// GetMeetingsForGuests returns the meetings booked by the guests inside the given events
+func (dal *MongoDAL) GetMeetingsForGuests(emails []string, eventDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	query := notDeleted(overlapping(from, to))
+	query["guest.email"] = bson.M{"$in": emails}
+	query["event_display_id"] = bson.M{"$in": eventDisplayIds}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(query).Sort("start_time").All(&meetings)
+	if err != nil {
+		log.Info(err)
+		return meetings, err
+	}
+	return meetings, nil
+}
+
+// InsertMeeting books the meeting without a transaction: the meeting is
+// inserted and then looked for among the meetings of its user. When another
+// meeting overlaps it the new one is removed again, so of two concurrent
+// bookings of the same time the later check always sees the other booking and
+// at most one of them stays.
+func (dal *MongoDAL) InsertMeeting(meeting models.Meeting) error {
+	collection := dal.session.DB(dbName).C(dbCollectionMeetings)
+	colQueried := notDeleted(overlapping(meeting.StartTime, meeting.EndTime))
+	colQueried["user_id"] = meeting.UserId
+	count, err := collection.Find(colQueried).Count()
+	if err == nil && count > 0 {
+		return helpers.MeetingsErrorTimeTaken
+	}
+	if err == nil {
+		err = collection.Insert(meeting)
+	}
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	colQueried["_id"] = bson.M{"$ne": meeting.Id}
+	count, err = collection.Find(colQueried).Count()
+	if err == nil && count == 0 {
+		return nil
+	}
+	if err != nil {
+		log.Warn(err)
+	}
+	removeErr := collection.RemoveId(meeting.Id)
+	if removeErr != nil {
+		log.Warn(removeErr)
+		return removeErr
+	}
+	if err != nil {
+		return err
+	}
+	return helpers.MeetingsErrorTimeTaken
+}
+
+// RemoveMeeting moves the meeting to the trash
+func (dal *MongoDAL) RemoveMeeting(eventDisplayId string, displayId string, deletedBy string) error {
+	colQueried := notDeleted(bson.M{"event_display_id": eventDisplayId, "display_id": displayId})
+	change := bson.M{"$set": bson.M{
+		"deleted_at": time.Now().UTC(),
+		"deleted_by": deletedBy}}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.MeetingsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+// GetDeletedMeetingsForEvents returns the meetings of the events that are in the trash
+func (dal *MongoDAL) GetDeletedMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(deleted(bson.M{"event_display_id": bson.M{"$in": eventDisplayIds}})).Sort("-deleted_at").All(&meetings)
+	if err != nil {
+		log.Info(err)
+		return meetings, err
+	}
+	return meetings, nil
+}
+
+func (dal *MongoDAL) RestoreMeeting(eventDisplayId string, displayId string) error {
+	colQueried := deleted(bson.M{"event_display_id": eventDisplayId, "display_id": displayId})
+	change := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.MeetingsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) CountMeetings(from time.Time) (int, error) {
+	count, err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(notDeleted(bson.M{"start_time": bson.M{"$gte": from}})).Count()
+	if err != nil {
+		log.Info(err)
+		return 0, err
+	}
+	return count, nil
+}
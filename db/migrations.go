@@ -0,0 +1,126 @@
+package db
+
+import (
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+// Migration identifies one step in the evolution of a backend's schema
+type Migration struct {
+	Version int
+	Name    string
+}
+
+// AppliedMigration is the record a backend keeps for every migration that was run
+type AppliedMigration struct {
+	Version   int       `json:"version" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	AppliedAt time.Time `json:"applied_at" bson:"applied_at"`
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// migrator is implemented by each backend, up and down run a single migration
+// and update the record of the applied migrations
+type migrator interface {
+	migrations() []Migration
+	appliedMigrations() ([]AppliedMigration, error)
+	up(version int) error
+	down(version int) error
+}
+
+func schemaVersion(m migrator) (int, error) {
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+func latestSchemaVersion(m migrator) int {
+	known := m.migrations()
+	return known[len(known)-1].Version
+}
+
+// checkSchemaVersion refuses to work with a database that was migrated by a
+// newer build, and reports whether migrations are pending
+func checkSchemaVersion(m migrator) (bool, error) {
+	version, err := schemaVersion(m)
+	if err != nil {
+		return false, err
+	}
+	if version > latestSchemaVersion(m) {
+		log.Errorf("database schema version %d is newer than the latest known version %d", version, latestSchemaVersion(m))
+		return false, helpers.MigrationsErrorSchemaTooNew
+	}
+	return version < latestSchemaVersion(m), nil
+}
+
+// migrateUp runs every migration that wasn't applied yet
+func migrateUp(m migrator) error {
+	if _, err := checkSchemaVersion(m); err != nil {
+		return err
+	}
+	version, err := schemaVersion(m)
+	if err != nil {
+		return err
+	}
+	for _, element := range m.migrations() {
+		if element.Version <= version {
+			continue
+		}
+		log.Infof("applying migration %d: %s", element.Version, element.Name)
+		err = m.up(element.Version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDown reverts the given number of the latest applied migrations
+func migrateDown(m migrator, steps int) error {
+	if _, err := checkSchemaVersion(m); err != nil {
+		return err
+	}
+	for ; steps > 0; steps-- {
+		version, err := schemaVersion(m)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil
+		}
+		log.Infof("reverting migration %d", version)
+		err = m.down(version)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrationStatus(m migrator) ([]MigrationStatus, error) {
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	for _, element := range applied {
+		appliedAt[element.Version] = element.AppliedAt
+	}
+	status := []MigrationStatus{}
+	for _, element := range m.migrations() {
+		at, ok := appliedAt[element.Version]
+		status = append(status, MigrationStatus{Migration: element, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
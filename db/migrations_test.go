@@ -0,0 +1,200 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+// fakeMigrator keeps the applied migrations in memory and records the calls
+// the runner makes
+type fakeMigrator struct {
+	known   []Migration
+	applied []AppliedMigration
+	calls   []string
+	failUp  int
+}
+
+func newFakeMigrator(versions ...int) *fakeMigrator {
+	m := &fakeMigrator{}
+	for _, version := range versions {
+		m.known = append(m.known, Migration{Version: version, Name: "migration"})
+	}
+	return m
+}
+
+func (m *fakeMigrator) migrations() []Migration {
+	return m.known
+}
+
+func (m *fakeMigrator) appliedMigrations() ([]AppliedMigration, error) {
+	return m.applied, nil
+}
+
+func (m *fakeMigrator) up(version int) error {
+	m.calls = append(m.calls, fmt.Sprintf("up %d", version))
+	if version == m.failUp {
+		return errors.New("migration failed")
+	}
+	m.applied = append(m.applied, AppliedMigration{Version: version, Name: "migration", AppliedAt: time.Now().UTC()})
+	return nil
+}
+
+func (m *fakeMigrator) down(version int) error {
+	m.calls = append(m.calls, fmt.Sprintf("down %d", version))
+	m.applied = m.applied[:len(m.applied)-1]
+	return nil
+}
+
+func (m *fakeMigrator) takeCalls() []string {
+	calls := m.calls
+	m.calls = nil
+	return calls
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	m := newFakeMigrator(1, 2, 3)
+	if pending, err := checkSchemaVersion(m); err != nil || !pending {
+		t.Errorf("checkSchemaVersion() of an empty database = %v %v, want pending", pending, err)
+	}
+	if err := migrateUp(m); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"up 1", "up 2", "up 3"}) {
+		t.Errorf("migrateUp() ran %v, want every migration in order", calls)
+	}
+	if err := migrateUp(m); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); len(calls) != 0 {
+		t.Errorf("migrateUp() of a current database ran %v, want nothing", calls)
+	}
+	if pending, err := checkSchemaVersion(m); err != nil || pending {
+		t.Errorf("checkSchemaVersion() of a current database = %v %v, want nothing pending", pending, err)
+	}
+
+	if err := migrateDown(m, 2); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"down 3", "down 2"}) {
+		t.Errorf("migrateDown(2) ran %v, want the latest two reverted", calls)
+	}
+	if err := migrateDown(m, 5); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"down 1"}) {
+		t.Errorf("migrateDown(5) ran %v, want it to stop at an empty database", calls)
+	}
+
+	// a new migration is applied on top of the ones already run
+	if err := migrateUp(m); err != nil {
+		t.Fatal(err)
+	}
+	m.known = append(m.known, Migration{Version: 4, Name: "migration"})
+	m.takeCalls()
+	if err := migrateUp(m); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"up 4"}) {
+		t.Errorf("migrateUp() after a new migration ran %v, want only the new one", calls)
+	}
+}
+
+func TestMigrateUpStopsAtAFailure(t *testing.T) {
+	m := newFakeMigrator(1, 2, 3)
+	m.failUp = 2
+	if err := migrateUp(m); err == nil {
+		t.Errorf("migrateUp() with a failing migration succeeded")
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"up 1", "up 2"}) {
+		t.Errorf("migrateUp() ran %v, want it to stop at the failure", calls)
+	}
+
+	m.failUp = 0
+	if err := migrateUp(m); err != nil {
+		t.Fatal(err)
+	}
+	if calls := m.takeCalls(); !reflect.DeepEqual(calls, []string{"up 2", "up 3"}) {
+		t.Errorf("migrateUp() after the failure was fixed ran %v, want it to resume", calls)
+	}
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	m := newFakeMigrator(1, 2)
+	m.applied = []AppliedMigration{{Version: 1}, {Version: 2}, {Version: 3}}
+	if _, err := checkSchemaVersion(m); err != helpers.MigrationsErrorSchemaTooNew {
+		t.Errorf("checkSchemaVersion() = %v, want MigrationsErrorSchemaTooNew", err)
+	}
+	if err := migrateUp(m); err != helpers.MigrationsErrorSchemaTooNew {
+		t.Errorf("migrateUp() = %v, want MigrationsErrorSchemaTooNew", err)
+	}
+	if err := migrateDown(m, 1); err != helpers.MigrationsErrorSchemaTooNew {
+		t.Errorf("migrateDown() = %v, want MigrationsErrorSchemaTooNew", err)
+	}
+	if calls := m.takeCalls(); len(calls) != 0 {
+		t.Errorf("a database of a newer build was migrated: %v", calls)
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	m := newFakeMigrator(1, 2)
+	if err := m.up(1); err != nil {
+		t.Fatal(err)
+	}
+	status, err := migrationStatus(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || !status[0].Applied || status[0].AppliedAt.IsZero() || status[1].Applied || !status[1].AppliedAt.IsZero() {
+		t.Errorf("migrationStatus() = %+v, want the first applied and the second pending", status)
+	}
+}
+
+// The SQL migrations run again after being reverted, and reverting the latest
+// keeps the data of the older tables.
+func TestSQLMigrationsUpDownUp(t *testing.T) {
+	dal := newTestDAL(t)
+	if err := dal.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp() of a current database = %v", err)
+	}
+	event, err := dal.InsertEvent("Interviews", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dal.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := dal.CheckSchemaVersion(); err != nil || !pending {
+		t.Errorf("CheckSchemaVersion() after reverting one = %v %v, want pending", pending, err)
+	}
+	if err = dal.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dal.GetEventByDisplayId(event.DisplayId); err != nil {
+		t.Errorf("event after reverting and reapplying the latest migration: %v", err)
+	}
+
+	if err = dal.MigrateDown(len(sqlMigrations)); err != nil {
+		t.Fatal(err)
+	}
+	status, err := dal.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range status {
+		if element.Applied {
+			t.Errorf("migration %d is applied after reverting them all", element.Version)
+		}
+	}
+	if err = dal.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp() after reverting them all = %v", err)
+	}
+	if pending, err := dal.CheckSchemaVersion(); err != nil || pending {
+		t.Errorf("CheckSchemaVersion() = %v %v, want nothing pending", pending, err)
+	}
+}
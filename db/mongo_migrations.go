@@ -0,0 +1,216 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+const dbCollectionMigrations = "migrations"
+
+// mongoMigration evolves the shape of the documents from one schema version to
+// the next, Down reverts what Up did
+type mongoMigration struct {
+	Migration
+	Up   func(database *mgo.Database) error
+	Down func(database *mgo.Database) error
+}
+
+// mongoMigrations must be kept in version order, new migrations are appended
+var mongoMigrations = []mongoMigration{
+	{
+		Migration: Migration{Version: 1, Name: "move embedded slots and meetings into their own collections"},
+		Up: splitEmbeddedSlotsAndMeetings,
+		Down: embedSlotsAndMeetings,
+	},
+	{
+		Migration: Migration{Version: 2, Name: "add event versions"},
+		Up: func(database *mgo.Database) error {
+			_, err := database.C(dbCollectionEvents).UpdateAll(bson.M{"version": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"version": 0}})
+			return err
+		},
+		Down: func(database *mgo.Database) error {
+			_, err := database.C(dbCollectionEvents).UpdateAll(bson.M{}, bson.M{"$unset": bson.M{"version": ""}})
+			return err
+		},
+	},
+	{
+		Migration: Migration{Version: 3, Name: "add event intake forms"},
+		Up: func(database *mgo.Database) error {
+			_, err := database.C(dbCollectionEvents).UpdateAll(bson.M{"intake_form": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"intake_form": []models.IntakeField{}}})
+			return err
+		},
+		Down: func(database *mgo.Database) error {
+			_, err := database.C(dbCollectionEvents).UpdateAll(bson.M{}, bson.M{"$unset": bson.M{"intake_form": ""}})
+			return err
+		},
+	},
+}
+
+func (dal *MongoDAL) CheckSchemaVersion() (bool, error) {
+	return checkSchemaVersion(dal)
+}
+
+func (dal *MongoDAL) MigrateUp() error {
+	return migrateUp(dal)
+}
+
+func (dal *MongoDAL) MigrateDown(steps int) error {
+	return migrateDown(dal, steps)
+}
+
+func (dal *MongoDAL) MigrationStatus() ([]MigrationStatus, error) {
+	return migrationStatus(dal)
+}
+
+func (dal *MongoDAL) migrations() []Migration {
+	known := []Migration{}
+	for _, element := range mongoMigrations {
+		known = append(known, element.Migration)
+	}
+	return known
+}
+
+func (dal *MongoDAL) appliedMigrations() ([]AppliedMigration, error) {
+	applied := []AppliedMigration{}
+	err := dal.session.DB(dbName).C(dbCollectionMigrations).Find(nil).Sort("_id").All(&applied)
+	if err != nil {
+		return applied, err
+	}
+	return applied, nil
+}
+
+func (dal *MongoDAL) up(version int) error {
+	database := dal.session.DB(dbName)
+	for _, element := range mongoMigrations {
+		if element.Version != version {
+			continue
+		}
+		err := element.Up(database)
+		if err != nil {
+			return err
+		}
+		return database.C(dbCollectionMigrations).Insert(AppliedMigration{Version: element.Version, Name: element.Name, AppliedAt: time.Now().UTC()})
+	}
+	return helpers.MigrationsErrorSchemaTooNew
+}
+
+func (dal *MongoDAL) down(version int) error {
+	database := dal.session.DB(dbName)
+	for _, element := range mongoMigrations {
+		if element.Version != version {
+			continue
+		}
+		err := element.Down(database)
+		if err != nil {
+			return err
+		}
+		return database.C(dbCollectionMigrations).RemoveId(element.Version)
+	}
+	return helpers.MigrationsErrorSchemaTooNew
+}
+
+// embeddedEvent is the old event document shape, with the slots and the
+// meetings embedded in it
+type embeddedEvent struct {
+	Id        bson.ObjectId    `bson:"_id"`
+	DisplayId string           `bson:"display_id"`
+	Slots     []models.Slot    `bson:"slots"`
+	Meetings  []models.Meeting `bson:"meetings"`
+}
+
+// splitEmbeddedSlotsAndMeetings moves the slots and meetings that are still
+// embedded in event documents into their own collections. Documents are
+// upserted by id before the arrays are removed from the event, so running it
+// again after a failure is safe.
+func splitEmbeddedSlotsAndMeetings(database *mgo.Database) error {
+	events := database.C(dbCollectionEvents)
+	slots := database.C(dbCollectionSlots)
+	meetings := database.C(dbCollectionMeetings)
+
+	query := bson.M{"$or": []bson.M{
+		bson.M{"slots": bson.M{"$exists": true}},
+		bson.M{"meetings": bson.M{"$exists": true}}}}
+	iter := events.Find(query).Iter()
+	event := embeddedEvent{}
+	migrated := 0
+	for iter.Next(&event) {
+		for _, element := range event.Slots {
+			if len(element.Id) == 0 {
+				element.Id = bson.NewObjectId()
+				element.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+			}
+			element.EventDisplayId = event.DisplayId
+			if _, err := slots.UpsertId(element.Id, element); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		for _, element := range event.Meetings {
+			if len(element.Id) == 0 {
+				element.Id = bson.NewObjectId()
+				element.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+			}
+			element.EventDisplayId = event.DisplayId
+			if _, err := meetings.UpsertId(element.Id, element); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+		err := events.UpdateId(event.Id, bson.M{"$unset": bson.M{"slots": "", "meetings": ""}})
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		migrated++
+		event = embeddedEvent{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if migrated > 0 {
+		log.Infof("moved the slots and meetings of %d events into their own collections", migrated)
+	}
+	return nil
+}
+
+// embedSlotsAndMeetings puts the slots and meetings back into their event
+// documents
+func embedSlotsAndMeetings(database *mgo.Database) error {
+	events := database.C(dbCollectionEvents)
+	slots := database.C(dbCollectionSlots)
+	meetings := database.C(dbCollectionMeetings)
+
+	iter := events.Find(nil).Iter()
+	event := embeddedEvent{}
+	for iter.Next(&event) {
+		eventSlots := []models.Slot{}
+		eventMeetings := []models.Meeting{}
+		query := bson.M{"event_display_id": event.DisplayId}
+		if err := slots.Find(query).Sort("start_time").All(&eventSlots); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := meetings.Find(query).Sort("start_time").All(&eventMeetings); err != nil {
+			iter.Close()
+			return err
+		}
+		err := events.UpdateId(event.Id, bson.M{"$set": bson.M{"slots": eventSlots, "meetings": eventMeetings}})
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		event = embeddedEvent{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if _, err := slots.RemoveAll(nil); err != nil {
+		return err
+	}
+	_, err := meetings.RemoveAll(nil)
+	return err
+}
@@ -0,0 +1,509 @@
+package db
+
+import (
+	"context"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// Observer is told about every call to the DAL, it is called when the call
+// starts and the function it returns when the call is over. The context is
+// the one of the request the call is made for, when it is known.
+type Observer func(ctx context.Context, operation string) func(err error)
+
+// ObservedDAL passes every call on to the DAL it wraps and tells the observer
+// about it, the measurements of the storage layer are taken here so they are
+// the same for every backend
+type ObservedDAL struct {
+	wrapped DAL
+	observe Observer
+	ctx     context.Context
+}
+
+func NewObservedDAL(dal DAL, observe Observer) *ObservedDAL {
+	return &ObservedDAL{wrapped: dal, observe: observe, ctx: context.Background()}
+}
+
+// WithContext returns the DAL observed on behalf of the given context
+func (dal *ObservedDAL) WithContext(ctx context.Context) DAL {
+	return &ObservedDAL{wrapped: dal.wrapped, observe: dal.observe, ctx: ctx}
+}
+
+// WithContext ties the calls made through the returned DAL to the context, so
+// they are observed as part of the request it belongs to. DALs that aren't
+// observed are returned as they are.
+func WithContext(dal DAL, ctx context.Context) DAL {
+	if contextual, ok := dal.(interface{ WithContext(context.Context) DAL }); ok {
+		return contextual.WithContext(ctx)
+	}
+	return dal
+}
+
+func (dal *ObservedDAL) Initialize() error {
+	done := dal.observe(dal.ctx, "Initialize")
+	err := dal.wrapped.Initialize()
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) Close() {
+	done := dal.observe(dal.ctx, "Close")
+	dal.wrapped.Close()
+	done(nil)
+}
+
+func (dal *ObservedDAL) Ping() error {
+	done := dal.observe(dal.ctx, "Ping")
+	err := dal.wrapped.Ping()
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) FindActiveUserByEmail(email string) (*models.User, error) {
+	done := dal.observe(dal.ctx, "FindActiveUserByEmail")
+	result, err := dal.wrapped.FindActiveUserByEmail(email)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) FindAnyUserByEmail(email string) (*models.User, error) {
+	done := dal.observe(dal.ctx, "FindAnyUserByEmail")
+	result, err := dal.wrapped.FindAnyUserByEmail(email)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertUser(email string, hash []byte, firstName string, lastName string, confirmationToken string) error {
+	done := dal.observe(dal.ctx, "InsertUser")
+	err := dal.wrapped.InsertUser(email, hash, firstName, lastName, confirmationToken)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) FindUserByConfirmationToken(confirmationToken string, email string) (*models.User, error) {
+	done := dal.observe(dal.ctx, "FindUserByConfirmationToken")
+	result, err := dal.wrapped.FindUserByConfirmationToken(confirmationToken, email)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) FindUserByRecoveryToken(recoveryToken string, email string) (*models.User, error) {
+	done := dal.observe(dal.ctx, "FindUserByRecoveryToken")
+	result, err := dal.wrapped.FindUserByRecoveryToken(recoveryToken, email)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) UpdateUserConfirmation(userId bson.ObjectId, userStatus models.UserStatusType, confirmationTokenStatus models.ConfirmationTokenStatusType, confirmed bool) error {
+	done := dal.observe(dal.ctx, "UpdateUserConfirmation")
+	err := dal.wrapped.UpdateUserConfirmation(userId, userStatus, confirmationTokenStatus, confirmed)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
+	done := dal.observe(dal.ctx, "UpdateUserPassword")
+	err := dal.wrapped.UpdateUserPassword(userId, hash, recoveryTokenStatus, recoveryTokenExpiry)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
+	done := dal.observe(dal.ctx, "UpdateUserRecovery")
+	err := dal.wrapped.UpdateUserRecovery(userId, recoveryToken, recoveryTokenStatus, recoveryTokenExpiry)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) UpdateUserTeams(userId bson.ObjectId, teams []string) error {
+	done := dal.observe(dal.ctx, "UpdateUserTeams")
+	err := dal.wrapped.UpdateUserTeams(userId, teams)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) FindActiveUsersByDisplayIds(displayIds []string) ([]models.User, error) {
+	done := dal.observe(dal.ctx, "FindActiveUsersByDisplayIds")
+	result, err := dal.wrapped.FindActiveUsersByDisplayIds(displayIds)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetEventsForUser(displayId string) *[]models.Event {
+	done := dal.observe(dal.ctx, "GetEventsForUser")
+	result := dal.wrapped.GetEventsForUser(displayId)
+	done(nil)
+	return result
+}
+
+func (dal *ObservedDAL) GetEventsByDisplayIds(displayIds []string) (*[]models.Event, error) {
+	done := dal.observe(dal.ctx, "GetEventsByDisplayIds")
+	result, err := dal.wrapped.GetEventsByDisplayIds(displayIds)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertEvent(name string, adminUser string) (*models.Event, error) {
+	done := dal.observe(dal.ctx, "InsertEvent")
+	result, err := dal.wrapped.InsertEvent(name, adminUser)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) UpdateEvent(displayId string, version int, name string, adminUser string) (int, error) {
+	done := dal.observe(dal.ctx, "UpdateEvent")
+	result, err := dal.wrapped.UpdateEvent(displayId, version, name, adminUser)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) UpdateEventIntakeForm(displayId string, version int, form []models.IntakeField) (int, error) {
+	done := dal.observe(dal.ctx, "UpdateEventIntakeForm")
+	result, err := dal.wrapped.UpdateEventIntakeForm(displayId, version, form)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) IncrementEventVersion(displayId string, version int) (int, error) {
+	done := dal.observe(dal.ctx, "IncrementEventVersion")
+	result, err := dal.wrapped.IncrementEventVersion(displayId, version)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) RevertEventVersion(displayId string, version int) error {
+	done := dal.observe(dal.ctx, "RevertEventVersion")
+	err := dal.wrapped.RevertEventVersion(displayId, version)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) RemoveEvent(displayId string, version int, deletedBy string) error {
+	done := dal.observe(dal.ctx, "RemoveEvent")
+	err := dal.wrapped.RemoveEvent(displayId, version, deletedBy)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) GetEventByDisplayId(displayId string) (*models.Event, error) {
+	done := dal.observe(dal.ctx, "GetEventByDisplayId")
+	result, err := dal.wrapped.GetEventByDisplayId(displayId)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) QueryEvents(query EventsQuery) ([]models.Event, error) {
+	done := dal.observe(dal.ctx, "QueryEvents")
+	result, err := dal.wrapped.QueryEvents(query)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertBlackouts(userDisplayId string, eventDisplayId string, blackouts []models.Blackout) ([]models.Blackout, error) {
+	done := dal.observe(dal.ctx, "InsertBlackouts")
+	result, err := dal.wrapped.InsertBlackouts(userDisplayId, eventDisplayId, blackouts)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) RemoveBlackout(userDisplayId string, eventDisplayId string, displayId string) error {
+	done := dal.observe(dal.ctx, "RemoveBlackout")
+	err := dal.wrapped.RemoveBlackout(userDisplayId, eventDisplayId, displayId)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) InsertDateOverride(userDisplayId string, eventDisplayId string, override models.DateOverride) (*models.DateOverride, error) {
+	done := dal.observe(dal.ctx, "InsertDateOverride")
+	result, err := dal.wrapped.InsertDateOverride(userDisplayId, eventDisplayId, override)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) RemoveDateOverride(userDisplayId string, eventDisplayId string, displayId string) error {
+	done := dal.observe(dal.ctx, "RemoveDateOverride")
+	err := dal.wrapped.RemoveDateOverride(userDisplayId, eventDisplayId, displayId)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) GetSlotsForEvents(eventDisplayIds []string) ([]models.Slot, error) {
+	done := dal.observe(dal.ctx, "GetSlotsForEvents")
+	result, err := dal.wrapped.GetSlotsForEvents(eventDisplayIds)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetSlotsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Slot, error) {
+	done := dal.observe(dal.ctx, "GetSlotsForUsers")
+	result, err := dal.wrapped.GetSlotsForUsers(userDisplayIds, from, to)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertSlots(eventDisplayId string, slots []models.Slot) error {
+	done := dal.observe(dal.ctx, "InsertSlots")
+	err := dal.wrapped.InsertSlots(eventDisplayId, slots)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) UpdateSlot(slot models.Slot) error {
+	done := dal.observe(dal.ctx, "UpdateSlot")
+	err := dal.wrapped.UpdateSlot(slot)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) UpdateSlots(eventDisplayId string, slots []models.Slot) error {
+	done := dal.observe(dal.ctx, "UpdateSlots")
+	err := dal.wrapped.UpdateSlots(eventDisplayId, slots)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) RemoveSlots(eventDisplayId string, displayIds []string) error {
+	done := dal.observe(dal.ctx, "RemoveSlots")
+	err := dal.wrapped.RemoveSlots(eventDisplayId, displayIds)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) SaveMergedSlots(eventDisplayId string, inserted []models.Slot, updated []models.Slot, removed []string) error {
+	done := dal.observe(dal.ctx, "SaveMergedSlots")
+	err := dal.wrapped.SaveMergedSlots(eventDisplayId, inserted, updated, removed)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) RemoveSlotFromEvent(eventDisplayId string, displayId string) error {
+	done := dal.observe(dal.ctx, "RemoveSlotFromEvent")
+	err := dal.wrapped.RemoveSlotFromEvent(eventDisplayId, displayId)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) QuerySlots(query RangeQuery) ([]models.Slot, error) {
+	done := dal.observe(dal.ctx, "QuerySlots")
+	result, err := dal.wrapped.QuerySlots(query)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "GetMeetingsForEvents")
+	result, err := dal.wrapped.GetMeetingsForEvents(eventDisplayIds)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetMeetingsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "GetMeetingsForUsers")
+	result, err := dal.wrapped.GetMeetingsForUsers(userDisplayIds, from, to)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetMeetingsForGuests(emails []string, eventDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "GetMeetingsForGuests")
+	result, err := dal.wrapped.GetMeetingsForGuests(emails, eventDisplayIds, from, to)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertMeeting(meeting models.Meeting) error {
+	done := dal.observe(dal.ctx, "InsertMeeting")
+	err := dal.wrapped.InsertMeeting(meeting)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) RemoveMeeting(eventDisplayId string, displayId string, deletedBy string) error {
+	done := dal.observe(dal.ctx, "RemoveMeeting")
+	err := dal.wrapped.RemoveMeeting(eventDisplayId, displayId, deletedBy)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) QueryMeetings(query RangeQuery) ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "QueryMeetings")
+	result, err := dal.wrapped.QueryMeetings(query)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) CountMeetings(from time.Time) (int, error) {
+	done := dal.observe(dal.ctx, "CountMeetings")
+	result, err := dal.wrapped.CountMeetings(from)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetDeletedEventsForUser(displayId string) ([]models.Event, error) {
+	done := dal.observe(dal.ctx, "GetDeletedEventsForUser")
+	result, err := dal.wrapped.GetDeletedEventsForUser(displayId)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) GetDeletedMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "GetDeletedMeetingsForEvents")
+	result, err := dal.wrapped.GetDeletedMeetingsForEvents(eventDisplayIds)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) RestoreEvent(displayId string, adminUser string) (int, error) {
+	done := dal.observe(dal.ctx, "RestoreEvent")
+	result, err := dal.wrapped.RestoreEvent(displayId, adminUser)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) RestoreMeeting(eventDisplayId string, displayId string) error {
+	done := dal.observe(dal.ctx, "RestoreMeeting")
+	err := dal.wrapped.RestoreMeeting(eventDisplayId, displayId)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) PurgeDeleted(before time.Time) error {
+	done := dal.observe(dal.ctx, "PurgeDeleted")
+	err := dal.wrapped.PurgeDeleted(before)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) InsertAuditEntry(entry models.AuditEntry) error {
+	done := dal.observe(dal.ctx, "InsertAuditEntry")
+	err := dal.wrapped.InsertAuditEntry(entry)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) GetAuditEntries(filter AuditFilter) ([]models.AuditEntry, error) {
+	done := dal.observe(dal.ctx, "GetAuditEntries")
+	result, err := dal.wrapped.GetAuditEntries(filter)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) InsertIdempotencyKey(key models.IdempotencyKey) error {
+	done := dal.observe(dal.ctx, "InsertIdempotencyKey")
+	err := dal.wrapped.InsertIdempotencyKey(key)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) FindIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	done := dal.observe(dal.ctx, "FindIdempotencyKey")
+	result, err := dal.wrapped.FindIdempotencyKey(scope, key)
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	done := dal.observe(dal.ctx, "CompleteIdempotencyKey")
+	err := dal.wrapped.CompleteIdempotencyKey(key)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) RemoveIdempotencyKey(scope string, key string) error {
+	done := dal.observe(dal.ctx, "RemoveIdempotencyKey")
+	err := dal.wrapped.RemoveIdempotencyKey(scope, key)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) PurgeIdempotencyKeys(before time.Time) error {
+	done := dal.observe(dal.ctx, "PurgeIdempotencyKeys")
+	err := dal.wrapped.PurgeIdempotencyKeys(before)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) ExportUsers() ([]models.User, error) {
+	done := dal.observe(dal.ctx, "ExportUsers")
+	result, err := dal.wrapped.ExportUsers()
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) ExportEvents() ([]models.Event, error) {
+	done := dal.observe(dal.ctx, "ExportEvents")
+	result, err := dal.wrapped.ExportEvents()
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) ExportSlots() ([]models.Slot, error) {
+	done := dal.observe(dal.ctx, "ExportSlots")
+	result, err := dal.wrapped.ExportSlots()
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) ExportMeetings() ([]models.Meeting, error) {
+	done := dal.observe(dal.ctx, "ExportMeetings")
+	result, err := dal.wrapped.ExportMeetings()
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) ImportUser(user models.User, replace bool) error {
+	done := dal.observe(dal.ctx, "ImportUser")
+	err := dal.wrapped.ImportUser(user, replace)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) ImportEvent(event models.Event, replace bool) error {
+	done := dal.observe(dal.ctx, "ImportEvent")
+	err := dal.wrapped.ImportEvent(event, replace)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) ImportSlots(slots []models.Slot, replace bool) error {
+	done := dal.observe(dal.ctx, "ImportSlots")
+	err := dal.wrapped.ImportSlots(slots, replace)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) ImportMeetings(meetings []models.Meeting, replace bool) error {
+	done := dal.observe(dal.ctx, "ImportMeetings")
+	err := dal.wrapped.ImportMeetings(meetings, replace)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) CheckSchemaVersion() (bool, error) {
+	done := dal.observe(dal.ctx, "CheckSchemaVersion")
+	result, err := dal.wrapped.CheckSchemaVersion()
+	done(err)
+	return result, err
+}
+
+func (dal *ObservedDAL) MigrateUp() error {
+	done := dal.observe(dal.ctx, "MigrateUp")
+	err := dal.wrapped.MigrateUp()
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) MigrateDown(steps int) error {
+	done := dal.observe(dal.ctx, "MigrateDown")
+	err := dal.wrapped.MigrateDown(steps)
+	done(err)
+	return err
+}
+
+func (dal *ObservedDAL) MigrationStatus() ([]MigrationStatus, error) {
+	done := dal.observe(dal.ctx, "MigrationStatus")
+	result, err := dal.wrapped.MigrationStatus()
+	done(err)
+	return result, err
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Pages */
+
+// Sort keys of event listings
+const EventsSortCreatedAt = "created_at"
+const EventsSortUpdatedAt = "updated_at"
+const EventsSortName = "name"
+
+// Sort key of slot and meeting listings
+const RangeSortStartTime = "start_time"
+
+// PageCursor points right after the last item of the previous page, by the
+// value of the sort key of that item and its display id which breaks ties.
+// Sort is the ordering the cursor was made for, it can't be used with another.
+type PageCursor struct {
+	Sort      string    `json:"s"`
+	Time      time.Time `json:"t"`
+	Name      string    `json:"n,omitempty"`
+	DisplayId string    `json:"id"`
+}
+
+// EventsQuery lists the events of an admin a page at a time, zero values
+// don't filter
+type EventsQuery struct {
+	AdminUser string
+	// Name matches the events whose name contains it, ignoring case
+	Name string
+	// SlotsFrom and SlotsTo match the events with a slot overlapping the range
+	SlotsFrom time.Time
+	SlotsTo   time.Time
+	// UpcomingAfter matches the events with a meeting that starts after it
+	UpcomingAfter time.Time
+	// Sort is one of the EventsSort keys, it is part of the query text
+	Sort       string
+	Descending bool
+	After      *PageCursor
+	Limit      int
+}
+
+// RangeQuery lists the slots or meetings of an event by start time a page at
+// a time, a zero From or To leaves the range open on that side
+type RangeQuery struct {
+	EventDisplayId string
+	From           time.Time
+	To             time.Time
+	After          *PageCursor
+	Limit          int
+}
+
+// afterCursor matches the documents that come after the cursor in the order
+// of the sort field, ties are broken by display id
+func afterCursor(field string, value interface{}, displayId string, descending bool) bson.M {
+	operator := "$gt"
+	if descending {
+		operator = "$lt"
+	}
+	return bson.M{"$or": []bson.M{
+		bson.M{field: bson.M{operator: value}},
+		bson.M{field: value, "display_id": bson.M{operator: displayId}}}}
+}
+
+// rangeFilter matches the documents of the event overlapping the range of the
+// query and coming after its cursor
+func rangeFilter(query RangeQuery) bson.M {
+	filter := notDeleted(bson.M{"event_display_id": query.EventDisplayId})
+	conditions := []bson.M{filter}
+	if !query.From.IsZero() {
+		conditions = append(conditions, bson.M{"end_time": bson.M{"$gt": query.From}})
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, bson.M{"start_time": bson.M{"$lt": query.To}})
+	}
+	if query.After != nil {
+		conditions = append(conditions, afterCursor(RangeSortStartTime, query.After.Time, query.After.DisplayId, false))
+	}
+	return bson.M{"$and": conditions}
+}
+
+func (dal *MongoDAL) QueryEvents(query EventsQuery) ([]models.Event, error) {
+	events := []models.Event{}
+	conditions := []bson.M{notDeleted(bson.M{"admin_user": query.AdminUser})}
+	if query.Name != "" {
+		conditions = append(conditions, bson.M{"name": bson.RegEx{Pattern: regexp.QuoteMeta(query.Name), Options: "i"}})
+	}
+	if !query.SlotsFrom.IsZero() || !query.SlotsTo.IsZero() {
+		slotsQuery := notDeleted(bson.M{})
+		if !query.SlotsFrom.IsZero() {
+			slotsQuery["end_time"] = bson.M{"$gt": query.SlotsFrom}
+		}
+		if !query.SlotsTo.IsZero() {
+			slotsQuery["start_time"] = bson.M{"$lt": query.SlotsTo}
+		}
+		displayIds := []string{}
+		err := dal.session.DB(dbName).C(dbCollectionSlots).Find(slotsQuery).Distinct("event_display_id", &displayIds)
+		if err != nil {
+			log.Info(err)
+			return events, err
+		}
+		conditions = append(conditions, bson.M{"display_id": bson.M{"$in": displayIds}})
+	}
+	if !query.UpcomingAfter.IsZero() {
+		displayIds := []string{}
+		err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(notDeleted(bson.M{"start_time": bson.M{"$gt": query.UpcomingAfter}})).Distinct("event_display_id", &displayIds)
+		if err != nil {
+			log.Info(err)
+			return events, err
+		}
+		conditions = append(conditions, bson.M{"display_id": bson.M{"$in": displayIds}})
+	}
+	if query.After != nil {
+		var value interface{} = query.After.Time
+		if query.Sort == EventsSortName {
+			value = query.After.Name
+		}
+		conditions = append(conditions, afterCursor(query.Sort, value, query.After.DisplayId, query.Descending))
+	}
+	sort := []string{query.Sort, "display_id"}
+	if query.Descending {
+		sort = []string{"-" + query.Sort, "-display_id"}
+	}
+	err := dal.session.DB(dbName).C(dbCollectionEvents).Find(bson.M{"$and": conditions}).Sort(sort...).Limit(query.Limit).All(&events)
+	if err != nil {
+		log.Info(err)
+		return events, err
+	}
+	return events, nil
+}
+
+func (dal *MongoDAL) QuerySlots(query RangeQuery) ([]models.Slot, error) {
+	slots := []models.Slot{}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Find(rangeFilter(query)).Sort(RangeSortStartTime, "display_id").Limit(query.Limit).All(&slots)
+	if err != nil {
+		log.Info(err)
+		return slots, err
+	}
+	return slots, nil
+}
+
+func (dal *MongoDAL) QueryMeetings(query RangeQuery) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	err := dal.session.DB(dbName).C(dbCollectionMeetings).Find(rangeFilter(query)).Sort(RangeSortStartTime, "display_id").Limit(query.Limit).All(&meetings)
+	if err != nil {
+		log.Info(err)
+		return meetings, err
+	}
+	return meetings, nil
+}
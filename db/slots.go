@@ -0,0 +1,165 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+/* Slots */
+
+// overlapping matches the documents whose range overlaps [from, to)
+func overlapping(from time.Time, to time.Time) bson.M {
+	return bson.M{"start_time": bson.M{"$lt": to}, "end_time": bson.M{"$gt": from}}
+}
+
+func (dal *MongoDAL) GetSlotsForEvents(eventDisplayIds []string) ([]models.Slot, error) {
+	slots := []models.Slot{}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Find(notDeleted(bson.M{"event_display_id": bson.M{"$in": eventDisplayIds}})).Sort("start_time").All(&slots)
+	if err != nil {
+		log.Info(err)
+		return slots, err
+	}
+	return slots, nil
+}
+
+func (dal *MongoDAL) GetSlotsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Slot, error) {
+	slots := []models.Slot{}
+	query := notDeleted(overlapping(from, to))
+	query["user"] = bson.M{"$in": userDisplayIds}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Find(query).Sort("start_time").All(&slots)
+	if err != nil {
+		log.Info(err)
+		return slots, err
+	}
+	return slots, nil
+}
+
+func (dal *MongoDAL) InsertSlots(eventDisplayId string, slots []models.Slot) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	docs := []interface{}{}
+	for _, element := range slots {
+		if len(element.Id) == 0 {
+			return helpers.SlotsErrorMissingId
+		}
+		element.EventDisplayId = eventDisplayId
+		docs = append(docs, element)
+	}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Insert(docs...)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) UpdateSlot(slot models.Slot) error {
+	colQueried := bson.M{"event_display_id": slot.EventDisplayId, "display_id": slot.DisplayId}
+	change := bson.M{"$set": bson.M{
+		"start_time": slot.StartTime,
+		"end_time": slot.EndTime,
+		"user": slot.User,
+		"interval": slot.Interval,
+		"updated_at": time.Now().UTC()}}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Update(colQueried, change)
+	if err == mgo.ErrNotFound {
+		return helpers.SlotsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+// UpdateSlots edits the slots without a transaction. When an edit fails the
+// slots edited before it are written back as they were, only when that fails
+// too the edit is left partly saved, which is SlotsErrorPartialUpdate.
+func (dal *MongoDAL) UpdateSlots(eventDisplayId string, slots []models.Slot) error {
+	displayIds := []string{}
+	for _, element := range slots {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	originals := []models.Slot{}
+	colQueried := bson.M{"event_display_id": eventDisplayId, "display_id": bson.M{"$in": displayIds}}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Find(colQueried).All(&originals)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	before := make(map[string]models.Slot)
+	for _, element := range originals {
+		before[element.DisplayId] = element
+	}
+	for index, element := range slots {
+		element.EventDisplayId = eventDisplayId
+		err = dal.UpdateSlot(element)
+		if err == nil {
+			continue
+		}
+		for _, edited := range slots[:index] {
+			restoreErr := dal.UpdateSlot(before[edited.DisplayId])
+			if restoreErr != nil {
+				log.Warn(restoreErr)
+				return helpers.SlotsErrorPartialUpdate
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (dal *MongoDAL) RemoveSlots(eventDisplayId string, displayIds []string) error {
+	if len(displayIds) == 0 {
+		return nil
+	}
+	colQueried := bson.M{"event_display_id": eventDisplayId, "display_id": bson.M{"$in": displayIds}}
+	_, err := dal.session.DB(dbName).C(dbCollectionSlots).RemoveAll(colQueried)
+	if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
+
+// SaveMergedSlots applies a merge without a transaction, in an order that
+// never loses a range: the merged slots are inserted and extended before the
+// slots they absorbed are removed. A failure after the first write is
+// SlotsErrorPartialMerge, merging the same slots again completes it.
+func (dal *MongoDAL) SaveMergedSlots(eventDisplayId string, inserted []models.Slot, updated []models.Slot, removed []string) error {
+	err := dal.InsertSlots(eventDisplayId, inserted)
+	if err != nil {
+		return err
+	}
+	for _, element := range updated {
+		element.EventDisplayId = eventDisplayId
+		err = dal.UpdateSlot(element)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = dal.RemoveSlots(eventDisplayId, removed)
+	}
+	if err != nil && (len(inserted) > 0 || len(updated) > 0) {
+		log.Warn(err)
+		return helpers.SlotsErrorPartialMerge
+	}
+	return err
+}
+
+func (dal *MongoDAL) RemoveSlotFromEvent(eventDisplayId string, displayId string) error {
+	colQueried := bson.M{"event_display_id": eventDisplayId, "display_id": displayId}
+	err := dal.session.DB(dbName).C(dbCollectionSlots).Remove(colQueried)
+	if err == mgo.ErrNotFound {
+		return helpers.SlotsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,762 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+	"gopkg.in/mgo.v2/bson"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Dialects, named after the database/sql drivers
+const SQLDialectSQLite = "sqlite3"
+const SQLDialectPostgres = "postgres"
+
+// Tables
+const sqlTableUsers = "users"
+const sqlTableEvents = "events"
+const sqlTableSlots = "slots"
+const sqlTableMeetings = "meetings"
+const sqlTableBlackouts = "blackouts"
+const sqlTableDateOverrides = "date_overrides"
+const sqlTableAudit = "audit_entries"
+const sqlTableIdempotencyKeys = "idempotency_keys"
+const sqlTableMigrations = "schema_migrations"
+
+const sqlUserColumns = "id, display_id, first_name, last_name, email, hash, confirmation_token, confirmation_token_status, confirmed, status, recovery_token, recovery_token_expiry, recovery_token_status, teams, created_at, updated_at"
+const sqlEventColumns = "id, display_id, admin_user, name, intake_form, version, deleted_at, deleted_by, created_at, updated_at"
+const sqlBlackoutColumns = "id, display_id, user_display_id, event_display_id, start_time, end_time, reason, created_at, updated_at"
+const sqlDateOverrideColumns = "id, display_id, user_display_id, event_display_id, day, time_zone, start_time, end_time, created_at, updated_at"
+
+// SQLDAL stores the data in SQLite or PostgreSQL. Ids are kept as the hex of
+// their bson.ObjectId so records keep the same ids on both backends
+type SQLDAL struct {
+	db      *sql.DB
+	dialect string
+}
+
+// sqlRunner is satisfied by both *sql.DB and *sql.Tx
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func NewSQLDatabaseAccessor(dialect string, dsn string) *SQLDAL {
+	if dialect != SQLDialectSQLite && dialect != SQLDialectPostgres {
+		panic(helpers.DatabaseErrorUnknownDialect)
+	}
+	database, err := sql.Open(dialect, dsn)
+	if err != nil {
+		panic(err)
+	}
+	if dialect == SQLDialectSQLite {
+		// sqlite allows a single writer, sharing one connection avoids "database is locked" errors
+		database.SetMaxOpenConns(1)
+	}
+	return &SQLDAL{db: database, dialect: dialect}
+}
+
+// Initialize checks the connection, the tables and indexes are created by the
+// schema migrations
+func (dal *SQLDAL) Initialize() error {
+	err := dal.db.Ping()
+	if err != nil {
+		return err
+	}
+	return dal.ensureMigrationsTable()
+}
+
+func (dal *SQLDAL) Close() {
+	dal.db.Close()
+}
+
+func (dal *SQLDAL) Ping() error {
+	return dal.db.Ping()
+}
+
+/* Queries */
+
+// rebind replaces the ? placeholders with the numbered ones postgres expects
+func (dal *SQLDAL) rebind(query string) string {
+	if dal.dialect != SQLDialectPostgres {
+		return query
+	}
+	rebound := bytes.Buffer{}
+	number := 0
+	for _, char := range query {
+		if char == '?' {
+			number++
+			rebound.WriteString("$" + strconv.Itoa(number))
+			continue
+		}
+		rebound.WriteRune(char)
+	}
+	return rebound.String()
+}
+
+// exec runs the statement and returns the number of affected rows
+func (dal *SQLDAL) exec(runner sqlRunner, query string, args ...interface{}) (int64, error) {
+	result, err := runner.Exec(dal.rebind(query), args...)
+	if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (dal *SQLDAL) query(runner sqlRunner, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := runner.Query(dal.rebind(query), args...)
+	if err != nil {
+		log.Info(err)
+	}
+	return rows, err
+}
+
+func (dal *SQLDAL) queryRow(runner sqlRunner, query string, args ...interface{}) *sql.Row {
+	return runner.QueryRow(dal.rebind(query), args...)
+}
+
+// inTransaction commits when f succeeds and rolls back otherwise
+func (dal *SQLDAL) inTransaction(f func(tx *sql.Tx) error) error {
+	tx, err := dal.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlIn builds "column IN (?, ...)" for the values, an empty list matches nothing
+func sqlIn(column string, values []string) (string, []interface{}) {
+	if len(values) == 0 {
+		return "1 = 0", nil
+	}
+	args := []interface{}{}
+	for _, element := range values {
+		args = append(args, element)
+	}
+	return column + " IN (?" + strings.Repeat(", ?", len(values)-1) + ")", args
+}
+
+// sqlNotDeleted hides the rows that were moved to the trash
+const sqlNotDeleted = "deleted_at IS NULL"
+
+// sqlOverlapping matches the rows whose range overlaps [from, to)
+func sqlOverlapping(from time.Time, to time.Time) (string, []interface{}) {
+	return "start_time < ? AND end_time > ?", []interface{}{to.UTC(), from.UTC()}
+}
+
+func objectIdFromHex(hex string) bson.ObjectId {
+	if !bson.IsObjectIdHex(hex) {
+		return ""
+	}
+	return bson.ObjectIdHex(hex)
+}
+
+func objectIdHex(id bson.ObjectId) string {
+	if len(id) == 0 {
+		return ""
+	}
+	return id.Hex()
+}
+
+/* Users */
+
+func scanUser(row sqlScanner) (models.User, error) {
+	user := models.User{}
+	var id, teams string
+	err := row.Scan(&id, &user.DisplayId, &user.FirstName, &user.LastName, &user.Email, &user.Hash,
+		&user.ConfirmationToken, &user.ConfirmationTokenStatus, &user.Confirmed, &user.Status,
+		&user.RecoverToken, &user.RecoverTokenExpiry, &user.RecoverTokenStatus, &teams, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return user, err
+	}
+	user.Id = objectIdFromHex(id)
+	user.Teams = []string{}
+	err = json.Unmarshal([]byte(teams), &user.Teams)
+	return user, err
+}
+
+// findUsers loads the users matching the condition together with their availability rules
+func (dal *SQLDAL) findUsers(condition string, args ...interface{}) ([]models.User, error) {
+	users := []models.User{}
+	rows, err := dal.query(dal.db, "SELECT "+sqlUserColumns+" FROM "+sqlTableUsers+" WHERE "+condition, args...)
+	if err != nil {
+		return users, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+	displayIds := []string{}
+	for _, element := range users {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	blackouts, overrides, err := dal.findRules("user_display_id", displayIds)
+	if err != nil {
+		return users, err
+	}
+	for index := range users {
+		users[index].Blackouts = append([]models.Blackout{}, blackouts[users[index].DisplayId]...)
+		users[index].DateOverrides = append([]models.DateOverride{}, overrides[users[index].DisplayId]...)
+	}
+	return users, nil
+}
+
+// findUser returns the single user matching the condition, like the mongo
+// backend any failure is reported as a missing user
+func (dal *SQLDAL) findUser(condition string, args ...interface{}) (*models.User, error) {
+	users, err := dal.findUsers(condition, args...)
+	if err != nil {
+		log.Info(err)
+		return &models.User{}, helpers.AuthenticationErrorLoginUserNotExists
+	}
+	if len(users) == 0 {
+		return &models.User{}, helpers.AuthenticationErrorLoginUserNotExists
+	}
+	return &users[0], nil
+}
+
+// FindActiveUserByEmail fails with AuthenticationErrorLoginUserNotExists only
+// when there is no such user, storage failures are returned as they are
+func (dal *SQLDAL) FindActiveUserByEmail(email string) (*models.User, error) {
+	users, err := dal.findUsers("email = ? AND status = ?", email, models.USER_CONFIRMED)
+	if err != nil {
+		log.Warn(err)
+		return &models.User{}, err
+	}
+	if len(users) == 0 {
+		return &models.User{}, helpers.AuthenticationErrorLoginUserNotExists
+	}
+	return &users[0], nil
+}
+
+func (dal *SQLDAL) FindAnyUserByEmail(email string) (*models.User, error) {
+	return dal.findUser("email = ?", email)
+}
+
+func (dal *SQLDAL) InsertUser(email string, hash []byte, firstName string, lastName string, confirmationToken string) error {
+	query := "INSERT INTO " + sqlTableUsers + " (" + sqlUserColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := dal.exec(dal.db, query, bson.NewObjectId().Hex(), helpers.RandStringBytesMaskImprSrc(8), firstName, lastName, email, hash,
+		confirmationToken, models.CONFIRMATION_TOKEN_VALID, false, models.USER_NOT_CONFIRMED,
+		"", time.Time{}, "", "[]", time.Now().UTC(), time.Now().UTC())
+	return err
+}
+
+func (dal *SQLDAL) FindUserByConfirmationToken(confirmationToken string, email string) (*models.User, error) {
+	return dal.findUser("confirmation_token = ? AND confirmation_token_status = ? AND email = ?", confirmationToken, models.CONFIRMATION_TOKEN_VALID, email)
+}
+
+func (dal *SQLDAL) FindUserByRecoveryToken(recoveryToken string, email string) (*models.User, error) {
+	return dal.findUser("email = ? AND recovery_token = ? AND recovery_token_status = ? AND recovery_token_expiry > ?", email, recoveryToken, models.RECOVER_TOKEN_VALID, time.Now().UTC())
+}
+
+// updateOne runs an update that is expected to match a row, sql.ErrNoRows is
+// returned when it didn't
+func (dal *SQLDAL) updateOne(runner sqlRunner, query string, args ...interface{}) error {
+	affected, err := dal.exec(runner, query, args...)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (dal *SQLDAL) UpdateUserConfirmation(userId bson.ObjectId, userStatus models.UserStatusType, confirmationTokenStatus models.ConfirmationTokenStatusType, confirmed bool) error {
+	query := "UPDATE " + sqlTableUsers + " SET confirmation_token_status = ?, status = ?, updated_at = ?, confirmed = ? WHERE id = ?"
+	return dal.updateOne(dal.db, query, confirmationTokenStatus, userStatus, time.Now().UTC(), confirmed, objectIdHex(userId))
+}
+
+func (dal *SQLDAL) UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
+	query := "UPDATE " + sqlTableUsers + " SET recovery_token_status = ?, recovery_token_expiry = ?, updated_at = ?, hash = ? WHERE id = ? AND recovery_token_expiry > ? AND recovery_token_status = ?"
+	return dal.updateOne(dal.db, query, recoveryTokenStatus, recoveryTokenExpiry.UTC(), time.Now().UTC(), hash, objectIdHex(userId), time.Now().UTC(), models.RECOVER_TOKEN_VALID)
+}
+
+func (dal *SQLDAL) UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error {
+	query := "UPDATE " + sqlTableUsers + " SET updated_at = ?, recovery_token_status = ?, recovery_token_expiry = ?, recovery_token = ? WHERE id = ?"
+	return dal.updateOne(dal.db, query, time.Now().UTC(), recoveryTokenStatus, recoveryTokenExpiry.UTC(), recoveryToken, objectIdHex(userId))
+}
+
+func (dal *SQLDAL) UpdateUserTeams(userId bson.ObjectId, teams []string) error {
+	if teams == nil {
+		teams = []string{}
+	}
+	encoded, err := json.Marshal(teams)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE " + sqlTableUsers + " SET teams = ?, updated_at = ? WHERE id = ?"
+	err = dal.updateOne(dal.db, query, string(encoded), time.Now().UTC(), objectIdHex(userId))
+	if err == sql.ErrNoRows {
+		return helpers.AuthenticationErrorLoginUserNotExists
+	}
+	return err
+}
+
+func (dal *SQLDAL) FindActiveUsersByDisplayIds(displayIds []string) ([]models.User, error) {
+	condition, args := sqlIn("display_id", displayIds)
+	return dal.findUsers(condition+" AND status = ?", append(args, models.USER_CONFIRMED)...)
+}
+
+/* Events */
+
+func scanEvent(row sqlScanner) (models.Event, error) {
+	event := models.Event{}
+	var id, form string
+	err := row.Scan(&id, &event.DisplayId, &event.AdminUser, &event.Name, &form, &event.Version, &event.DeletedAt, &event.DeletedBy, &event.CreatedAt, &event.UpdatedAt)
+	if err != nil {
+		return event, err
+	}
+	event.Id = objectIdFromHex(id)
+	event.IntakeForm = []models.IntakeField{}
+	err = json.Unmarshal([]byte(form), &event.IntakeForm)
+	return event, err
+}
+
+// findEvents loads the events matching the condition together with their availability rules
+func (dal *SQLDAL) findEvents(condition string, args ...interface{}) ([]models.Event, error) {
+	return dal.findEventsOrdered(condition, "created_at", args...)
+}
+
+// findEventsOrdered is findEvents with the ORDER BY clause, and any LIMIT, given by the caller
+func (dal *SQLDAL) findEventsOrdered(condition string, order string, args ...interface{}) ([]models.Event, error) {
+	events := []models.Event{}
+	rows, err := dal.query(dal.db, "SELECT "+sqlEventColumns+" FROM "+sqlTableEvents+" WHERE "+condition+" ORDER BY "+order, args...)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return events, err
+	}
+	displayIds := []string{}
+	for _, element := range events {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	blackouts, overrides, err := dal.findRules("event_display_id", displayIds)
+	if err != nil {
+		return events, err
+	}
+	for index := range events {
+		events[index].Blackouts = append([]models.Blackout{}, blackouts[events[index].DisplayId]...)
+		events[index].DateOverrides = append([]models.DateOverride{}, overrides[events[index].DisplayId]...)
+	}
+	return events, nil
+}
+
+func (dal *SQLDAL) GetEventsForUser(displayId string) *[]models.Event {
+	events, err := dal.findEvents("admin_user = ? AND "+sqlNotDeleted, displayId)
+	if err != nil {
+		log.Info(err)
+	}
+	return &events
+}
+
+func (dal *SQLDAL) GetEventsByDisplayIds(displayIds []string) (*[]models.Event, error) {
+	condition, args := sqlIn("display_id", displayIds)
+	events, err := dal.findEvents(condition+" AND "+sqlNotDeleted, args...)
+	if err != nil {
+		log.Info(err)
+		return &events, err
+	}
+	return &events, nil
+}
+
+func (dal *SQLDAL) InsertEvent(name string, adminUser string) (*models.Event, error) {
+	event := models.Event{
+		Id: bson.NewObjectId(),
+		DisplayId: helpers.RandStringBytesMaskImprSrc(8),
+		Name: name,
+		AdminUser: adminUser,
+		Blackouts: []models.Blackout{},
+		DateOverrides: []models.DateOverride{},
+		IntakeForm: []models.IntakeField{},
+		Version: 1,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC()}
+	query := "INSERT INTO " + sqlTableEvents + " (" + sqlEventColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err := dal.exec(dal.db, query, event.Id.Hex(), event.DisplayId, event.AdminUser, event.Name, "[]", event.Version, nil, "", event.CreatedAt, event.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// versionConflict tells a stale version apart from a missing event after a
+// conditional update didn't match
+func (dal *SQLDAL) versionConflict(displayId string) error {
+	var count int
+	err := dal.queryRow(dal.db, "SELECT COUNT(*) FROM "+sqlTableEvents+" WHERE display_id = ? AND "+sqlNotDeleted, displayId).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return helpers.EventsErrorNotFound
+	}
+	return helpers.EventsErrorVersionConflict
+}
+
+func (dal *SQLDAL) UpdateEvent(displayId string, version int, name string, adminUser string) (int, error) {
+	query := "UPDATE " + sqlTableEvents + " SET name = ?, admin_user = ?, updated_at = ?, version = version + 1 WHERE display_id = ? AND version = ? AND " + sqlNotDeleted
+	err := dal.updateOne(dal.db, query, name, adminUser, time.Now().UTC(), displayId, version)
+	if err == sql.ErrNoRows {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+func (dal *SQLDAL) UpdateEventIntakeForm(displayId string, version int, form []models.IntakeField) (int, error) {
+	encoded, err := json.Marshal(form)
+	if err != nil {
+		return 0, err
+	}
+	if form == nil {
+		encoded = []byte("[]")
+	}
+	query := "UPDATE " + sqlTableEvents + " SET intake_form = ?, updated_at = ?, version = version + 1 WHERE display_id = ? AND version = ? AND " + sqlNotDeleted
+	err = dal.updateOne(dal.db, query, string(encoded), time.Now().UTC(), displayId, version)
+	if err == sql.ErrNoRows {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// IncrementEventVersion claims the next version of the event before its slots
+// or meetings are changed, it fails when the event is no longer at the
+// expected version
+func (dal *SQLDAL) IncrementEventVersion(displayId string, version int) (int, error) {
+	query := "UPDATE " + sqlTableEvents + " SET updated_at = ?, version = version + 1 WHERE display_id = ? AND version = ? AND " + sqlNotDeleted
+	err := dal.updateOne(dal.db, query, time.Now().UTC(), displayId, version)
+	if err == sql.ErrNoRows {
+		return 0, dal.versionConflict(displayId)
+	} else if err != nil {
+		return 0, err
+	}
+	return version + 1, nil
+}
+
+// RevertEventVersion moves the event back from the version claimed by
+// IncrementEventVersion when the change it was claimed for failed. The event is
+// left as it is when it moved on to a later version in the meantime.
+func (dal *SQLDAL) RevertEventVersion(displayId string, version int) error {
+	query := "UPDATE " + sqlTableEvents + " SET version = version - 1 WHERE display_id = ? AND version = ? AND " + sqlNotDeleted
+	err := dal.updateOne(dal.db, query, displayId, version)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return nil
+}
+
+// RemoveEvent moves the event to the trash together with its slots and
+// meetings, they share the deletion time so restoring the event brings back
+// exactly what was deleted with it
+func (dal *SQLDAL) RemoveEvent(displayId string, version int, deletedBy string) error {
+	now := time.Now().UTC()
+	err := dal.inTransaction(func(tx *sql.Tx) error {
+		query := "UPDATE " + sqlTableEvents + " SET deleted_at = ?, deleted_by = ?, updated_at = ?, version = version + 1 WHERE display_id = ? AND version = ? AND " + sqlNotDeleted
+		err := dal.updateOne(tx, query, now, deletedBy, now, displayId, version)
+		if err != nil {
+			return err
+		}
+		_, err = dal.exec(tx, "UPDATE "+sqlTableSlots+" SET deleted_at = ? WHERE event_display_id = ? AND "+sqlNotDeleted, now, displayId)
+		if err != nil {
+			return err
+		}
+		_, err = dal.exec(tx, "UPDATE "+sqlTableMeetings+" SET deleted_at = ?, deleted_by = ? WHERE event_display_id = ? AND "+sqlNotDeleted, now, deletedBy, displayId)
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return dal.versionConflict(displayId)
+	}
+	return err
+}
+
+func (dal *SQLDAL) GetEventByDisplayId(displayId string) (*models.Event, error) {
+	events, err := dal.findEvents("display_id = ? AND "+sqlNotDeleted, displayId)
+	if err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &events[0], nil
+}
+
+/* Availability rules */
+
+// sqlRulesOwner returns the table and the owner column of the rules, the event
+// when an event display id is given and the user otherwise
+func sqlRulesOwner(userDisplayId string, eventDisplayId string) (string, string, string) {
+	if eventDisplayId != "" {
+		return sqlTableEvents, "event_display_id", eventDisplayId
+	}
+	return sqlTableUsers, "user_display_id", userDisplayId
+}
+
+// touchRulesOwner does the bookkeeping of the owner on a change of its rules,
+// events get a new version
+func (dal *SQLDAL) touchRulesOwner(tx *sql.Tx, table string, displayId string) error {
+	query := "UPDATE " + table + " SET updated_at = ? WHERE display_id = ?"
+	if table == sqlTableEvents {
+		query = "UPDATE " + table + " SET updated_at = ?, version = version + 1 WHERE display_id = ? AND " + sqlNotDeleted
+	}
+	return dal.updateOne(tx, query, time.Now().UTC(), displayId)
+}
+
+// findRules returns the blackouts and date overrides of the owners, by owner display id
+func (dal *SQLDAL) findRules(ownerColumn string, owners []string) (map[string][]models.Blackout, map[string][]models.DateOverride, error) {
+	blackouts := make(map[string][]models.Blackout)
+	overrides := make(map[string][]models.DateOverride)
+	if len(owners) == 0 {
+		return blackouts, overrides, nil
+	}
+	condition, args := sqlIn(ownerColumn, owners)
+	rows, err := dal.query(dal.db, "SELECT "+sqlBlackoutColumns+" FROM "+sqlTableBlackouts+" WHERE "+condition+" ORDER BY start_time", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		blackout := models.Blackout{}
+		var id, userDisplayId, eventDisplayId string
+		err = rows.Scan(&id, &blackout.DisplayId, &userDisplayId, &eventDisplayId, &blackout.StartTime, &blackout.EndTime, &blackout.Reason, &blackout.CreatedAt, &blackout.UpdatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		blackout.Id = objectIdFromHex(id)
+		owner := userDisplayId
+		if ownerColumn == "event_display_id" {
+			owner = eventDisplayId
+		}
+		blackouts[owner] = append(blackouts[owner], blackout)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	overrideRows, err := dal.query(dal.db, "SELECT "+sqlDateOverrideColumns+" FROM "+sqlTableDateOverrides+" WHERE "+condition+" ORDER BY day", args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer overrideRows.Close()
+	for overrideRows.Next() {
+		override := models.DateOverride{}
+		var id, userDisplayId, eventDisplayId string
+		err = overrideRows.Scan(&id, &override.DisplayId, &userDisplayId, &eventDisplayId, &override.Date, &override.TimeZone, &override.StartTime, &override.EndTime, &override.CreatedAt, &override.UpdatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		override.Id = objectIdFromHex(id)
+		owner := userDisplayId
+		if ownerColumn == "event_display_id" {
+			owner = eventDisplayId
+		}
+		overrides[owner] = append(overrides[owner], override)
+	}
+	return blackouts, overrides, overrideRows.Err()
+}
+
+func (dal *SQLDAL) InsertBlackouts(userDisplayId string, eventDisplayId string, blackouts []models.Blackout) ([]models.Blackout, error) {
+	for index := range blackouts {
+		blackouts[index].Id = bson.NewObjectId()
+		blackouts[index].DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+		blackouts[index].CreatedAt = time.Now().UTC()
+		blackouts[index].UpdatedAt = time.Now().UTC()
+	}
+	table, _, owner := sqlRulesOwner(userDisplayId, eventDisplayId)
+	err := dal.inTransaction(func(tx *sql.Tx) error {
+		err := dal.touchRulesOwner(tx, table, owner)
+		if err != nil {
+			return err
+		}
+		query := "INSERT INTO " + sqlTableBlackouts + " (" + sqlBlackoutColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		for _, element := range blackouts {
+			_, err = dal.exec(tx, query, element.Id.Hex(), element.DisplayId, userDisplayIdOf(table, owner), eventDisplayIdOf(table, owner),
+				element.StartTime.UTC(), element.EndTime.UTC(), element.Reason, element.CreatedAt, element.UpdatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+	return blackouts, nil
+}
+
+func (dal *SQLDAL) RemoveBlackout(userDisplayId string, eventDisplayId string, displayId string) error {
+	table, column, owner := sqlRulesOwner(userDisplayId, eventDisplayId)
+	err := dal.inTransaction(func(tx *sql.Tx) error {
+		err := dal.updateOne(tx, "DELETE FROM "+sqlTableBlackouts+" WHERE "+column+" = ? AND display_id = ?", owner, displayId)
+		if err == sql.ErrNoRows {
+			return helpers.BlackoutsErrorNotFound
+		} else if err != nil {
+			return err
+		}
+		return dal.touchRulesOwner(tx, table, owner)
+	})
+	if err != nil && err != helpers.BlackoutsErrorNotFound {
+		log.Warn(err)
+	}
+	return err
+}
+
+func (dal *SQLDAL) InsertDateOverride(userDisplayId string, eventDisplayId string, override models.DateOverride) (*models.DateOverride, error) {
+	override.Id = bson.NewObjectId()
+	override.DisplayId = helpers.RandStringBytesMaskImprSrc(8)
+	override.CreatedAt = time.Now().UTC()
+	override.UpdatedAt = time.Now().UTC()
+	table, _, owner := sqlRulesOwner(userDisplayId, eventDisplayId)
+	err := dal.inTransaction(func(tx *sql.Tx) error {
+		err := dal.touchRulesOwner(tx, table, owner)
+		if err != nil {
+			return err
+		}
+		query := "INSERT INTO " + sqlTableDateOverrides + " (" + sqlDateOverrideColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err = dal.exec(tx, query, override.Id.Hex(), override.DisplayId, userDisplayIdOf(table, owner), eventDisplayIdOf(table, owner),
+			override.Date, override.TimeZone, override.StartTime.UTC(), override.EndTime.UTC(), override.CreatedAt, override.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		log.Warn(err)
+		return nil, err
+	}
+	return &override, nil
+}
+
+func (dal *SQLDAL) RemoveDateOverride(userDisplayId string, eventDisplayId string, displayId string) error {
+	table, column, owner := sqlRulesOwner(userDisplayId, eventDisplayId)
+	err := dal.inTransaction(func(tx *sql.Tx) error {
+		err := dal.updateOne(tx, "DELETE FROM "+sqlTableDateOverrides+" WHERE "+column+" = ? AND display_id = ?", owner, displayId)
+		if err == sql.ErrNoRows {
+			return helpers.DateOverridesErrorNotFound
+		} else if err != nil {
+			return err
+		}
+		return dal.touchRulesOwner(tx, table, owner)
+	})
+	if err != nil && err != helpers.DateOverridesErrorNotFound {
+		log.Warn(err)
+	}
+	return err
+}
+
+// userDisplayIdOf and eventDisplayIdOf fill the owner columns of a rule, the
+// column of the other kind of owner is left empty
+func userDisplayIdOf(table string, owner string) string {
+	if table == sqlTableUsers {
+		return owner
+	}
+	return ""
+}
+
+func eventDisplayIdOf(table string, owner string) string {
+	if table == sqlTableEvents {
+		return owner
+	}
+	return ""
+}
+
+/* Trash */
+
+func (dal *SQLDAL) GetDeletedEventsForUser(displayId string) ([]models.Event, error) {
+	events, err := dal.findEvents("admin_user = ? AND deleted_at IS NOT NULL", displayId)
+	if err != nil {
+		log.Info(err)
+		return events, err
+	}
+	return events, nil
+}
+
+// RestoreEvent takes the event of the admin out of the trash with the slots and
+// meetings that were deleted with it, and returns its new version
+func (dal *SQLDAL) RestoreEvent(displayId string, adminUser string) (int, error) {
+	events, err := dal.findEvents("display_id = ? AND admin_user = ? AND deleted_at IS NOT NULL", displayId, adminUser)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, helpers.EventsErrorNotFound
+	}
+	event := events[0]
+	err = dal.inTransaction(func(tx *sql.Tx) error {
+		query := "UPDATE " + sqlTableEvents + " SET deleted_at = NULL, deleted_by = '', updated_at = ?, version = version + 1 WHERE display_id = ? AND deleted_at = ?"
+		err := dal.updateOne(tx, query, time.Now().UTC(), displayId, event.DeletedAt.UTC())
+		if err != nil {
+			return err
+		}
+		_, err = dal.exec(tx, "UPDATE "+sqlTableSlots+" SET deleted_at = NULL WHERE event_display_id = ? AND deleted_at = ?", displayId, event.DeletedAt.UTC())
+		if err != nil {
+			return err
+		}
+		_, err = dal.exec(tx, "UPDATE "+sqlTableMeetings+" SET deleted_at = NULL, deleted_by = '' WHERE event_display_id = ? AND deleted_at = ?", displayId, event.DeletedAt.UTC())
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return 0, helpers.EventsErrorNotFound
+	} else if err != nil {
+		log.Warn(err)
+		return 0, err
+	}
+	return event.Version + 1, nil
+}
+
+// PurgeDeleted removes for good what was moved to the trash before the given
+// time, the rules of purged events go with them
+func (dal *SQLDAL) PurgeDeleted(before time.Time) error {
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		expiredEvents := "SELECT display_id FROM " + sqlTableEvents + " WHERE deleted_at < ?"
+		for _, table := range []string{sqlTableSlots, sqlTableMeetings, sqlTableBlackouts, sqlTableDateOverrides} {
+			_, err := dal.exec(tx, "DELETE FROM "+table+" WHERE event_display_id IN ("+expiredEvents+")", before.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{sqlTableSlots, sqlTableMeetings, sqlTableEvents} {
+			_, err := dal.exec(tx, "DELETE FROM "+table+" WHERE deleted_at < ?", before.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
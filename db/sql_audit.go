@@ -0,0 +1,74 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Audit */
+
+const sqlAuditColumns = "id, actor, action, target_type, target_id, event_display_id, changes, ip, created_at"
+
+func (dal *SQLDAL) InsertAuditEntry(entry models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO " + sqlTableAudit + " (" + sqlAuditColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = dal.exec(dal.db, query, entry.Id.Hex(), entry.Actor, entry.Action, entry.TargetType, entry.TargetId, entry.EventDisplayId,
+		string(changes), entry.Ip, entry.CreatedAt.UTC())
+	return err
+}
+
+func (dal *SQLDAL) GetAuditEntries(filter AuditFilter) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	condition := "1 = 1"
+	args := []interface{}{}
+	fields := []struct{ column, value string }{
+		{"actor", filter.Actor},
+		{"action", filter.Action},
+		{"target_type", filter.TargetType},
+		{"target_id", filter.TargetId},
+		{"event_display_id", filter.EventDisplayId}}
+	for _, element := range fields {
+		if element.value != "" {
+			condition += " AND " + element.column + " = ?"
+			args = append(args, element.value)
+		}
+	}
+	if !filter.From.IsZero() {
+		condition += " AND created_at >= ?"
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		condition += " AND created_at < ?"
+		args = append(args, filter.To.UTC())
+	}
+	query := "SELECT " + sqlAuditColumns + " FROM " + sqlTableAudit + " WHERE " + condition + " ORDER BY created_at DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(filter.Limit)
+	}
+	rows, err := dal.query(dal.db, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := models.AuditEntry{}
+		var id, changes string
+		err = rows.Scan(&id, &entry.Actor, &entry.Action, &entry.TargetType, &entry.TargetId, &entry.EventDisplayId, &changes, &entry.Ip, &entry.CreatedAt)
+		if err != nil {
+			log.Info(err)
+			return entries, err
+		}
+		entry.Id = objectIdFromHex(id)
+		err = json.Unmarshal([]byte(changes), &entry.Changes)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
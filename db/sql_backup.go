@@ -0,0 +1,183 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Backup */
+
+func (dal *SQLDAL) ExportUsers() ([]models.User, error) {
+	return dal.findUsers("1 = 1 ORDER BY created_at")
+}
+
+func (dal *SQLDAL) ExportEvents() ([]models.Event, error) {
+	return dal.findEvents("1 = 1")
+}
+
+func (dal *SQLDAL) ExportSlots() ([]models.Slot, error) {
+	return dal.findSlots("1 = 1")
+}
+
+func (dal *SQLDAL) ExportMeetings() ([]models.Meeting, error) {
+	return dal.findMeetings("1 = 1")
+}
+
+// ImportUser writes the user with its availability rules, which replace the
+// rules of the user when the user is replaced
+func (dal *SQLDAL) ImportUser(user models.User, replace bool) error {
+	teams, err := json.Marshal(user.Teams)
+	if err != nil {
+		return err
+	}
+	if user.Teams == nil {
+		teams = []byte("[]")
+	}
+	// users imported without their password have an empty hash, which no
+	// password matches
+	hash := user.Hash
+	if hash == nil {
+		hash = []byte{}
+	}
+	err = dal.inTransaction(func(tx *sql.Tx) error {
+		if replace {
+			err := dal.removeForImport(tx, sqlTableUsers, objectIdHex(user.Id), "user_display_id", user.DisplayId)
+			if err != nil {
+				return err
+			}
+		}
+		query := "INSERT INTO " + sqlTableUsers + " (" + sqlUserColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err := dal.exec(tx, query, objectIdHex(user.Id), user.DisplayId, user.FirstName, user.LastName, user.Email, hash,
+			user.ConfirmationToken, user.ConfirmationTokenStatus, user.Confirmed, user.Status,
+			user.RecoverToken, user.RecoverTokenExpiry.UTC(), user.RecoverTokenStatus, string(teams), user.CreatedAt.UTC(), user.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		return dal.insertRulesForImport(tx, sqlTableUsers, user.DisplayId, user.Blackouts, user.DateOverrides)
+	})
+	if err != nil {
+		log.Warn(err)
+	}
+	return err
+}
+
+// ImportEvent writes the event with its availability rules, its slots and
+// meetings are imported on their own
+func (dal *SQLDAL) ImportEvent(event models.Event, replace bool) error {
+	form, err := json.Marshal(event.IntakeForm)
+	if err != nil {
+		return err
+	}
+	if event.IntakeForm == nil {
+		form = []byte("[]")
+	}
+	err = dal.inTransaction(func(tx *sql.Tx) error {
+		if replace {
+			err := dal.removeForImport(tx, sqlTableEvents, objectIdHex(event.Id), "event_display_id", event.DisplayId)
+			if err != nil {
+				return err
+			}
+		}
+		var deletedAt interface{}
+		if event.DeletedAt != nil {
+			deletedAt = event.DeletedAt.UTC()
+		}
+		query := "INSERT INTO " + sqlTableEvents + " (" + sqlEventColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err := dal.exec(tx, query, objectIdHex(event.Id), event.DisplayId, event.AdminUser, event.Name, string(form), event.Version,
+			deletedAt, event.DeletedBy, event.CreatedAt.UTC(), event.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+		return dal.insertRulesForImport(tx, sqlTableEvents, event.DisplayId, event.Blackouts, event.DateOverrides)
+	})
+	if err != nil {
+		log.Warn(err)
+	}
+	return err
+}
+
+func (dal *SQLDAL) ImportSlots(slots []models.Slot, replace bool) error {
+	query := "INSERT INTO " + sqlTableSlots + " (" + sqlSlotColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		for _, element := range slots {
+			if replace {
+				_, err := dal.exec(tx, "DELETE FROM "+sqlTableSlots+" WHERE id = ?", objectIdHex(element.Id))
+				if err != nil {
+					return err
+				}
+			}
+			_, err := dal.exec(tx, query, objectIdHex(element.Id), element.DisplayId, element.EventDisplayId, element.StartTime.UTC(), element.EndTime.UTC(),
+				element.User, element.Interval, utcOrNil(element.DeletedAt), element.CreatedAt.UTC(), element.UpdatedAt.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (dal *SQLDAL) ImportMeetings(meetings []models.Meeting, replace bool) error {
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		for _, element := range meetings {
+			if replace {
+				_, err := dal.exec(tx, "DELETE FROM "+sqlTableMeetings+" WHERE id = ?", objectIdHex(element.Id))
+				if err != nil {
+					return err
+				}
+			}
+			err := dal.insertMeeting(tx, element)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// removeForImport deletes the record about to be replaced and the rules it owns
+func (dal *SQLDAL) removeForImport(tx *sql.Tx, table string, id string, ownerColumn string, owner string) error {
+	_, err := dal.exec(tx, "DELETE FROM "+table+" WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	for _, rules := range []string{sqlTableBlackouts, sqlTableDateOverrides} {
+		_, err = dal.exec(tx, "DELETE FROM "+rules+" WHERE "+ownerColumn+" = ?", owner)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertRulesForImport writes the rules of an owner as they are, unlike
+// InsertBlackouts and InsertDateOverride which make new rules
+func (dal *SQLDAL) insertRulesForImport(tx *sql.Tx, table string, owner string, blackouts []models.Blackout, overrides []models.DateOverride) error {
+	query := "INSERT INTO " + sqlTableBlackouts + " (" + sqlBlackoutColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	for _, element := range blackouts {
+		_, err := dal.exec(tx, query, objectIdHex(element.Id), element.DisplayId, userDisplayIdOf(table, owner), eventDisplayIdOf(table, owner),
+			element.StartTime.UTC(), element.EndTime.UTC(), element.Reason, element.CreatedAt.UTC(), element.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	query = "INSERT INTO " + sqlTableDateOverrides + " (" + sqlDateOverrideColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	for _, element := range overrides {
+		_, err := dal.exec(tx, query, objectIdHex(element.Id), element.DisplayId, userDisplayIdOf(table, owner), eventDisplayIdOf(table, owner),
+			element.Date, element.TimeZone, element.StartTime.UTC(), element.EndTime.UTC(), element.CreatedAt.UTC(), element.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// utcOrNil is the value of a nullable time column
+func utcOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Idempotency keys */
+
+const sqlIdempotencyKeyColumns = "id, idempotency_key, scope, fingerprint, status, header, body, created_at, expires_at"
+
+func (dal *SQLDAL) InsertIdempotencyKey(key models.IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		_, err := dal.exec(tx, "DELETE FROM "+sqlTableIdempotencyKeys+" WHERE scope = ? AND idempotency_key = ? AND expires_at <= ?",
+			key.Scope, key.Key, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		var count int
+		err = dal.queryRow(tx, "SELECT COUNT(*) FROM "+sqlTableIdempotencyKeys+" WHERE scope = ? AND idempotency_key = ?",
+			key.Scope, key.Key).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return helpers.IdempotencyErrorKeyInUse
+		}
+		query := "INSERT INTO " + sqlTableIdempotencyKeys + " (" + sqlIdempotencyKeyColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err = dal.exec(tx, query, key.Id.Hex(), key.Key, key.Scope, key.Fingerprint, key.Status, string(header), key.Body,
+			key.CreatedAt.UTC(), key.ExpiresAt.UTC())
+		return err
+	})
+}
+
+func (dal *SQLDAL) FindIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error) {
+	record := models.IdempotencyKey{}
+	var id, header string
+	query := "SELECT " + sqlIdempotencyKeyColumns + " FROM " + sqlTableIdempotencyKeys + " WHERE scope = ? AND idempotency_key = ? AND expires_at > ?"
+	err := dal.queryRow(dal.db, query, scope, key, time.Now().UTC()).Scan(&id, &record.Key, &record.Scope, &record.Fingerprint,
+		&record.Status, &header, &record.Body, &record.CreatedAt, &record.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, helpers.IdempotencyErrorNotFound
+	}
+	if err != nil {
+		log.Info(err)
+		return nil, err
+	}
+	record.Id = objectIdFromHex(id)
+	err = json.Unmarshal([]byte(header), &record.Header)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (dal *SQLDAL) CompleteIdempotencyKey(key models.IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE " + sqlTableIdempotencyKeys + " SET status = ?, header = ?, body = ?, expires_at = ? WHERE id = ?"
+	return dal.updateOne(dal.db, query, key.Status, string(header), key.Body, key.ExpiresAt.UTC(), key.Id.Hex())
+}
+
+func (dal *SQLDAL) RemoveIdempotencyKey(scope string, key string) error {
+	_, err := dal.exec(dal.db, "DELETE FROM "+sqlTableIdempotencyKeys+" WHERE scope = ? AND idempotency_key = ?", scope, key)
+	return err
+}
+
+func (dal *SQLDAL) PurgeIdempotencyKeys(before time.Time) error {
+	_, err := dal.exec(dal.db, "DELETE FROM "+sqlTableIdempotencyKeys+" WHERE expires_at < ?", before.UTC())
+	return err
+}
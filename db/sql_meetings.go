@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Meetings */
+
+// the guest is flattened into guest_ columns, its free-form details are kept as JSON
+const sqlMeetingColumns = "id, display_id, event_display_id, start_time, end_time, user_id, deleted_at, deleted_by, guest_id, guest_display_id, guest_first_name, guest_last_name, guest_email, guest_phone, guest_details, guest_created_at, guest_updated_at, created_at, updated_at"
+
+func (dal *SQLDAL) findMeetings(condition string, args ...interface{}) ([]models.Meeting, error) {
+	return dal.findMeetingsOrdered(condition, "start_time", args...)
+}
+
+func (dal *SQLDAL) findMeetingsOrdered(condition string, order string, args ...interface{}) ([]models.Meeting, error) {
+	meetings := []models.Meeting{}
+	rows, err := dal.query(dal.db, "SELECT "+sqlMeetingColumns+" FROM "+sqlTableMeetings+" WHERE "+condition+" ORDER BY "+order, args...)
+	if err != nil {
+		return meetings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		meeting := models.Meeting{}
+		var id, guestId, details string
+		err = rows.Scan(&id, &meeting.DisplayId, &meeting.EventDisplayId, &meeting.StartTime, &meeting.EndTime, &meeting.UserId, &meeting.DeletedAt, &meeting.DeletedBy,
+			&guestId, &meeting.Guest.DisplayId, &meeting.Guest.FirstName, &meeting.Guest.LastName, &meeting.Guest.Email, &meeting.Guest.Phone,
+			&details, &meeting.Guest.CreatedAt, &meeting.Guest.UpdatedAt, &meeting.CreatedAt, &meeting.UpdatedAt)
+		if err != nil {
+			log.Info(err)
+			return meetings, err
+		}
+		meeting.Id = objectIdFromHex(id)
+		meeting.Guest.Id = objectIdFromHex(guestId)
+		err = json.Unmarshal([]byte(details), &meeting.Guest.Details)
+		if err != nil {
+			return meetings, err
+		}
+		meetings = append(meetings, meeting)
+	}
+	return meetings, rows.Err()
+}
+
+func (dal *SQLDAL) GetMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	condition, args := sqlIn("event_display_id", eventDisplayIds)
+	return dal.findMeetings(condition+" AND "+sqlNotDeleted, args...)
+}
+
+func (dal *SQLDAL) GetMeetingsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	condition, args := sqlIn("user_id", userDisplayIds)
+	overlap, overlapArgs := sqlOverlapping(from, to)
+	return dal.findMeetings(condition+" AND "+overlap+" AND "+sqlNotDeleted, append(args, overlapArgs...)...)
+}
+
+// GetMeetingsForGuests returns the meetings booked by the guests inside the given events
+func (dal *SQLDAL) GetMeetingsForGuests(emails []string, eventDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error) {
+	guests, args := sqlIn("guest_email", emails)
+	events, eventArgs := sqlIn("event_display_id", eventDisplayIds)
+	overlap, overlapArgs := sqlOverlapping(from, to)
+	args = append(append(args, eventArgs...), overlapArgs...)
+	return dal.findMeetings(guests+" AND "+events+" AND "+overlap+" AND "+sqlNotDeleted, args...)
+}
+
+// InsertMeeting checks the meetings of the user and inserts the meeting in one
+// transaction. The row of the user is written first, which locks it, so
+// bookings of the same user, through any of the events, check and insert one
+// after the other.
+func (dal *SQLDAL) InsertMeeting(meeting models.Meeting) error {
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		_, err := dal.exec(tx, "UPDATE "+sqlTableUsers+" SET updated_at = updated_at WHERE display_id = ?", meeting.UserId)
+		if err != nil {
+			return err
+		}
+		var count int
+		overlap, args := sqlOverlapping(meeting.StartTime, meeting.EndTime)
+		query := "SELECT COUNT(*) FROM " + sqlTableMeetings + " WHERE user_id = ? AND " + overlap + " AND " + sqlNotDeleted
+		err = dal.queryRow(tx, query, append([]interface{}{meeting.UserId}, args...)...).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return helpers.MeetingsErrorTimeTaken
+		}
+		return dal.insertMeeting(tx, meeting)
+	})
+}
+
+// insertMeeting writes the meeting with its guest, used by inserts and imports
+func (dal *SQLDAL) insertMeeting(tx *sql.Tx, meeting models.Meeting) error {
+	details, err := json.Marshal(meeting.Guest.Details)
+	if err != nil {
+		return err
+	}
+	if meeting.Guest.Details == nil {
+		details = []byte("{}")
+	}
+	guest := meeting.Guest
+	query := "INSERT INTO " + sqlTableMeetings + " (" + sqlMeetingColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = dal.exec(tx, query, objectIdHex(meeting.Id), meeting.DisplayId, meeting.EventDisplayId, meeting.StartTime.UTC(), meeting.EndTime.UTC(),
+		meeting.UserId, utcOrNil(meeting.DeletedAt), meeting.DeletedBy,
+		objectIdHex(guest.Id), guest.DisplayId, guest.FirstName, guest.LastName, guest.Email, guest.Phone, string(details),
+		guest.CreatedAt.UTC(), guest.UpdatedAt.UTC(), meeting.CreatedAt.UTC(), meeting.UpdatedAt.UTC())
+	return err
+}
+
+// RemoveMeeting moves the meeting to the trash
+func (dal *SQLDAL) RemoveMeeting(eventDisplayId string, displayId string, deletedBy string) error {
+	query := "UPDATE " + sqlTableMeetings + " SET deleted_at = ?, deleted_by = ? WHERE event_display_id = ? AND display_id = ? AND " + sqlNotDeleted
+	err := dal.updateOne(dal.db, query, time.Now().UTC(), deletedBy, eventDisplayId, displayId)
+	if err == sql.ErrNoRows {
+		return helpers.MeetingsErrorNotFound
+	}
+	return err
+}
+
+// GetDeletedMeetingsForEvents returns the meetings of the events that are in the trash
+func (dal *SQLDAL) GetDeletedMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error) {
+	condition, args := sqlIn("event_display_id", eventDisplayIds)
+	return dal.findMeetings(condition+" AND deleted_at IS NOT NULL", args...)
+}
+
+func (dal *SQLDAL) RestoreMeeting(eventDisplayId string, displayId string) error {
+	query := "UPDATE " + sqlTableMeetings + " SET deleted_at = NULL, deleted_by = '' WHERE event_display_id = ? AND display_id = ? AND deleted_at IS NOT NULL"
+	err := dal.updateOne(dal.db, query, eventDisplayId, displayId)
+	if err == sql.ErrNoRows {
+		return helpers.MeetingsErrorNotFound
+	}
+	return err
+}
+
+func (dal *SQLDAL) CountMeetings(from time.Time) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM " + sqlTableMeetings + " WHERE start_time >= ? AND " + sqlNotDeleted
+	err := dal.queryRow(dal.db, query, from.UTC()).Scan(&count)
+	if err != nil {
+		log.Info(err)
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// testMeeting is a meeting of u1 on March 4th 2030 between two times
+func testMeeting(eventDisplayId string, start time.Duration, end time.Duration) models.Meeting {
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	now := time.Now().UTC()
+	return models.Meeting{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), EventDisplayId: eventDisplayId,
+		StartTime: day.Add(start), EndTime: day.Add(end), UserId: "u1",
+		Guest: models.Guest{Id: bson.NewObjectId(), DisplayId: helpers.RandStringBytesMaskImprSrc(8), Email: "guest@example.com", CreatedAt: now, UpdatedAt: now},
+		CreatedAt: now, UpdatedAt: now}
+}
+
+func TestInsertMeetingRejectsOverlaps(t *testing.T) {
+	dal := newTestDAL(t)
+	if err := dal.InsertMeeting(testMeeting("a", 9*time.Hour, 10*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	other := testMeeting("a", 9*time.Hour, 10*time.Hour)
+	other.UserId = "u2"
+	tests := []struct {
+		name    string
+		meeting models.Meeting
+		want    error
+	}{
+		{"same time of another event", testMeeting("b", 9*time.Hour, 10*time.Hour), helpers.MeetingsErrorTimeTaken},
+		{"overlapping", testMeeting("a", 9*time.Hour+30*time.Minute, 10*time.Hour+30*time.Minute), helpers.MeetingsErrorTimeTaken},
+		{"adjacent", testMeeting("a", 10*time.Hour, 11*time.Hour), nil},
+		{"another user", other, nil},
+	}
+	for _, test := range tests {
+		if err := dal.InsertMeeting(test.meeting); err != test.want {
+			t.Errorf("%s: InsertMeeting() = %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// a meeting in the trash frees its time
+	meetings, err := dal.GetMeetingsForUsers([]string{"u1"}, time.Time{}, time.Now().AddDate(10, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.RemoveMeeting("a", meetings[0].DisplayId, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.InsertMeeting(testMeeting("b", 9*time.Hour, 10*time.Hour)); err != nil {
+		t.Errorf("InsertMeeting() over a deleted meeting = %v, want it booked", err)
+	}
+}
+
+func TestInsertMeetingRace(t *testing.T) {
+	dal := newTestDAL(t)
+	var wait sync.WaitGroup
+	errs := make(chan error, 10)
+	for index := 0; index < 10; index++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			errs <- dal.InsertMeeting(testMeeting("a", 9*time.Hour, 9*time.Hour+30*time.Minute))
+		}()
+	}
+	wait.Wait()
+	close(errs)
+	booked := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			booked++
+		case helpers.MeetingsErrorTimeTaken:
+		default:
+			t.Errorf("InsertMeeting() = %v, want it booked or the time taken", err)
+		}
+	}
+	if booked != 1 {
+		t.Errorf("%d of the concurrent bookings went through, want 1", booked)
+	}
+}
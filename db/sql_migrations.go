@@ -0,0 +1,295 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+// sqlMigration changes the schema from one version to the next, the
+// statements use the TIMESTAMP and BLOB placeholders for the column types
+// that differ between the dialects
+type sqlMigration struct {
+	Migration
+	Up   []string
+	Down []string
+}
+
+// sqlMigrations must be kept in version order, new migrations are appended
+var sqlMigrations = []sqlMigration{
+	{
+		Migration: Migration{Version: 1, Name: "create the schema"},
+		Up: []string{
+			`CREATE TABLE users (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				first_name TEXT NOT NULL DEFAULT '',
+				last_name TEXT NOT NULL DEFAULT '',
+				email TEXT NOT NULL,
+				hash BLOB NOT NULL,
+				confirmation_token TEXT NOT NULL DEFAULT '',
+				confirmation_token_status TEXT NOT NULL DEFAULT '',
+				confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+				status TEXT NOT NULL DEFAULT '',
+				recovery_token TEXT NOT NULL DEFAULT '',
+				recovery_token_expiry TIMESTAMP NOT NULL,
+				recovery_token_status TEXT NOT NULL DEFAULT '',
+				teams TEXT NOT NULL DEFAULT '[]',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX users_email ON users (email)`,
+			`CREATE UNIQUE INDEX users_display_id ON users (display_id)`,
+
+			`CREATE TABLE events (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				admin_user TEXT NOT NULL,
+				name TEXT NOT NULL DEFAULT '',
+				version INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX events_display_id ON events (display_id)`,
+			`CREATE INDEX events_admin_user ON events (admin_user)`,
+
+			`CREATE TABLE slots (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				event_display_id TEXT NOT NULL,
+				start_time TIMESTAMP NOT NULL,
+				end_time TIMESTAMP NOT NULL,
+				user_display_id TEXT NOT NULL,
+				interval_minutes INTEGER NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX slots_display_id ON slots (display_id)`,
+			`CREATE INDEX slots_event_start ON slots (event_display_id, start_time)`,
+			`CREATE INDEX slots_user_range ON slots (user_display_id, start_time, end_time)`,
+
+			`CREATE TABLE meetings (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				event_display_id TEXT NOT NULL,
+				start_time TIMESTAMP NOT NULL,
+				end_time TIMESTAMP NOT NULL,
+				user_id TEXT NOT NULL,
+				guest_id TEXT NOT NULL DEFAULT '',
+				guest_display_id TEXT NOT NULL DEFAULT '',
+				guest_first_name TEXT NOT NULL DEFAULT '',
+				guest_last_name TEXT NOT NULL DEFAULT '',
+				guest_email TEXT NOT NULL DEFAULT '',
+				guest_phone TEXT NOT NULL DEFAULT '',
+				guest_details TEXT NOT NULL DEFAULT '{}',
+				guest_created_at TIMESTAMP NOT NULL,
+				guest_updated_at TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX meetings_display_id ON meetings (display_id)`,
+			`CREATE INDEX meetings_event_start ON meetings (event_display_id, start_time)`,
+			`CREATE INDEX meetings_user_range ON meetings (user_id, start_time, end_time)`,
+			`CREATE INDEX meetings_guest_range ON meetings (guest_email, start_time, end_time)`,
+
+			// rules belong either to a user or to an event, the other owner column is empty
+			`CREATE TABLE blackouts (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				user_display_id TEXT NOT NULL DEFAULT '',
+				event_display_id TEXT NOT NULL DEFAULT '',
+				start_time TIMESTAMP NOT NULL,
+				end_time TIMESTAMP NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX blackouts_display_id ON blackouts (display_id)`,
+			`CREATE INDEX blackouts_user ON blackouts (user_display_id, start_time)`,
+			`CREATE INDEX blackouts_event ON blackouts (event_display_id, start_time)`,
+
+			`CREATE TABLE date_overrides (
+				id TEXT PRIMARY KEY,
+				display_id TEXT NOT NULL,
+				user_display_id TEXT NOT NULL DEFAULT '',
+				event_display_id TEXT NOT NULL DEFAULT '',
+				day TEXT NOT NULL,
+				time_zone TEXT NOT NULL DEFAULT '',
+				start_time TIMESTAMP NOT NULL,
+				end_time TIMESTAMP NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX date_overrides_display_id ON date_overrides (display_id)`,
+			`CREATE INDEX date_overrides_user ON date_overrides (user_display_id, day)`,
+			`CREATE INDEX date_overrides_event ON date_overrides (event_display_id, day)`,
+		},
+		Down: []string{
+			`DROP TABLE date_overrides`,
+			`DROP TABLE blackouts`,
+			`DROP TABLE meetings`,
+			`DROP TABLE slots`,
+			`DROP TABLE events`,
+			`DROP TABLE users`,
+		},
+	},
+	{
+		Migration: Migration{Version: 2, Name: "add soft delete columns"},
+		Up: []string{
+			`ALTER TABLE events ADD COLUMN deleted_at TIMESTAMP NULL`,
+			`ALTER TABLE events ADD COLUMN deleted_by TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE slots ADD COLUMN deleted_at TIMESTAMP NULL`,
+			`ALTER TABLE meetings ADD COLUMN deleted_at TIMESTAMP NULL`,
+			`ALTER TABLE meetings ADD COLUMN deleted_by TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX events_deleted_at ON events (deleted_at)`,
+		},
+		Down: []string{
+			`DROP INDEX events_deleted_at`,
+			`ALTER TABLE meetings DROP COLUMN deleted_by`,
+			`ALTER TABLE meetings DROP COLUMN deleted_at`,
+			`ALTER TABLE slots DROP COLUMN deleted_at`,
+			`ALTER TABLE events DROP COLUMN deleted_by`,
+			`ALTER TABLE events DROP COLUMN deleted_at`,
+		},
+	},
+	{
+		Migration: Migration{Version: 3, Name: "create the audit log"},
+		Up: []string{
+			`CREATE TABLE audit_entries (
+				id TEXT PRIMARY KEY,
+				actor TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target_type TEXT NOT NULL,
+				target_id TEXT NOT NULL DEFAULT '',
+				event_display_id TEXT NOT NULL DEFAULT '',
+				changes TEXT NOT NULL DEFAULT '{}',
+				ip TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL)`,
+			`CREATE INDEX audit_entries_event ON audit_entries (event_display_id, created_at)`,
+			`CREATE INDEX audit_entries_target ON audit_entries (target_id, created_at)`,
+			`CREATE INDEX audit_entries_created_at ON audit_entries (created_at)`,
+		},
+		Down: []string{
+			`DROP TABLE audit_entries`,
+		},
+	},
+	{
+		Migration: Migration{Version: 4, Name: "create the idempotency keys"},
+		Up: []string{
+			`CREATE TABLE idempotency_keys (
+				id TEXT PRIMARY KEY,
+				idempotency_key TEXT NOT NULL,
+				scope TEXT NOT NULL DEFAULT '',
+				fingerprint TEXT NOT NULL,
+				status INTEGER NOT NULL DEFAULT 0,
+				header TEXT NOT NULL DEFAULT '{}',
+				body BLOB,
+				created_at TIMESTAMP NOT NULL,
+				expires_at TIMESTAMP NOT NULL)`,
+			`CREATE UNIQUE INDEX idempotency_keys_scope_key ON idempotency_keys (scope, idempotency_key)`,
+			`CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at)`,
+		},
+		Down: []string{
+			`DROP TABLE idempotency_keys`,
+		},
+	},
+	{
+		Migration: Migration{Version: 5, Name: "add event intake forms"},
+		Up: []string{
+			`ALTER TABLE events ADD COLUMN intake_form TEXT NOT NULL DEFAULT '[]'`,
+		},
+		Down: []string{
+			`ALTER TABLE events DROP COLUMN intake_form`,
+		},
+	},
+}
+
+// sqlTypes maps the column type placeholders to the types of each dialect,
+// postgres keeps the time zone and stores binary data as BYTEA
+var sqlTypes = map[string]*strings.Replacer{
+	SQLDialectSQLite:   strings.NewReplacer("TIMESTAMP", "TIMESTAMP", "BLOB", "BLOB"),
+	SQLDialectPostgres: strings.NewReplacer("TIMESTAMP", "TIMESTAMPTZ", "BLOB", "BYTEA"),
+}
+
+func (dal *SQLDAL) CheckSchemaVersion() (bool, error) {
+	return checkSchemaVersion(dal)
+}
+
+func (dal *SQLDAL) MigrateUp() error {
+	return migrateUp(dal)
+}
+
+func (dal *SQLDAL) MigrateDown(steps int) error {
+	return migrateDown(dal, steps)
+}
+
+func (dal *SQLDAL) MigrationStatus() ([]MigrationStatus, error) {
+	return migrationStatus(dal)
+}
+
+func (dal *SQLDAL) ensureMigrationsTable() error {
+	query := "CREATE TABLE IF NOT EXISTS " + sqlTableMigrations + " (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMP NOT NULL)"
+	_, err := dal.exec(dal.db, sqlTypes[dal.dialect].Replace(query))
+	return err
+}
+
+func (dal *SQLDAL) migrations() []Migration {
+	known := []Migration{}
+	for _, element := range sqlMigrations {
+		known = append(known, element.Migration)
+	}
+	return known
+}
+
+func (dal *SQLDAL) appliedMigrations() ([]AppliedMigration, error) {
+	applied := []AppliedMigration{}
+	err := dal.ensureMigrationsTable()
+	if err != nil {
+		return applied, err
+	}
+	rows, err := dal.query(dal.db, "SELECT version, name, applied_at FROM "+sqlTableMigrations+" ORDER BY version")
+	if err != nil {
+		return applied, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		migration := AppliedMigration{}
+		err = rows.Scan(&migration.Version, &migration.Name, &migration.AppliedAt)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, rows.Err()
+}
+
+// run executes the statements of a migration and its record in one
+// transaction, both dialects support transactional schema changes
+func (dal *SQLDAL) run(statements []string, record string, args ...interface{}) error {
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			_, err := dal.exec(tx, sqlTypes[dal.dialect].Replace(statement))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := dal.exec(tx, record, args...)
+		return err
+	})
+}
+
+func (dal *SQLDAL) up(version int) error {
+	for _, element := range sqlMigrations {
+		if element.Version != version {
+			continue
+		}
+		record := "INSERT INTO " + sqlTableMigrations + " (version, name, applied_at) VALUES (?, ?, ?)"
+		return dal.run(element.Up, record, element.Version, element.Name, time.Now().UTC())
+	}
+	return helpers.MigrationsErrorSchemaTooNew
+}
+
+func (dal *SQLDAL) down(version int) error {
+	for _, element := range sqlMigrations {
+		if element.Version != version {
+			continue
+		}
+		return dal.run(element.Down, "DELETE FROM "+sqlTableMigrations+" WHERE version = ?", element.Version)
+	}
+	return helpers.MigrationsErrorSchemaTooNew
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// sqlLike escapes the LIKE wildcards of a value matched as a substring
+var sqlLike = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// sqlAfterCursor matches the rows that come after the cursor in the order of
+// the column, ties are broken by display id
+func sqlAfterCursor(column string, value interface{}, displayId string, descending bool) (string, []interface{}) {
+	operator := ">"
+	if descending {
+		operator = "<"
+	}
+	condition := "(" + column + " " + operator + " ? OR (" + column + " = ? AND display_id " + operator + " ?))"
+	return condition, []interface{}{value, value, displayId}
+}
+
+// sqlRange builds the condition and the ordering of a page of the slots or
+// meetings of an event
+func sqlRange(query RangeQuery) (string, string, []interface{}) {
+	conditions := []string{"event_display_id = ?", sqlNotDeleted}
+	args := []interface{}{query.EventDisplayId}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "end_time > ?")
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "start_time < ?")
+		args = append(args, query.To.UTC())
+	}
+	if query.After != nil {
+		condition, cursorArgs := sqlAfterCursor("start_time", query.After.Time.UTC(), query.After.DisplayId, false)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	return strings.Join(conditions, " AND "), "start_time, display_id LIMIT " + strconv.Itoa(query.Limit), args
+}
+
+func (dal *SQLDAL) QueryEvents(query EventsQuery) ([]models.Event, error) {
+	conditions := []string{"admin_user = ?", sqlNotDeleted}
+	args := []interface{}{query.AdminUser}
+	if query.Name != "" {
+		conditions = append(conditions, `LOWER(name) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+sqlLike.Replace(strings.ToLower(query.Name))+"%")
+	}
+	if !query.SlotsFrom.IsZero() || !query.SlotsTo.IsZero() {
+		slotConditions := []string{sqlNotDeleted}
+		if !query.SlotsFrom.IsZero() {
+			slotConditions = append(slotConditions, "end_time > ?")
+			args = append(args, query.SlotsFrom.UTC())
+		}
+		if !query.SlotsTo.IsZero() {
+			slotConditions = append(slotConditions, "start_time < ?")
+			args = append(args, query.SlotsTo.UTC())
+		}
+		conditions = append(conditions, "display_id IN (SELECT event_display_id FROM "+sqlTableSlots+" WHERE "+strings.Join(slotConditions, " AND ")+")")
+	}
+	if !query.UpcomingAfter.IsZero() {
+		conditions = append(conditions, "display_id IN (SELECT event_display_id FROM "+sqlTableMeetings+" WHERE "+sqlNotDeleted+" AND start_time > ?)")
+		args = append(args, query.UpcomingAfter.UTC())
+	}
+	if query.After != nil {
+		var value interface{} = query.After.Time.UTC()
+		if query.Sort == EventsSortName {
+			value = query.After.Name
+		}
+		condition, cursorArgs := sqlAfterCursor(query.Sort, value, query.After.DisplayId, query.Descending)
+		conditions = append(conditions, condition)
+		args = append(args, cursorArgs...)
+	}
+	order := query.Sort + ", display_id"
+	if query.Descending {
+		order = query.Sort + " DESC, display_id DESC"
+	}
+	return dal.findEventsOrdered(strings.Join(conditions, " AND "), order+" LIMIT "+strconv.Itoa(query.Limit), args...)
+}
+
+func (dal *SQLDAL) QuerySlots(query RangeQuery) ([]models.Slot, error) {
+	condition, order, args := sqlRange(query)
+	return dal.findSlotsOrdered(condition, order, args...)
+}
+
+func (dal *SQLDAL) QueryMeetings(query RangeQuery) ([]models.Meeting, error) {
+	condition, order, args := sqlRange(query)
+	return dal.findMeetingsOrdered(condition, order, args...)
+}
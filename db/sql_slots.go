@@ -0,0 +1,148 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+/* Slots */
+
+const sqlSlotColumns = "id, display_id, event_display_id, start_time, end_time, user_display_id, interval_minutes, deleted_at, created_at, updated_at"
+
+func (dal *SQLDAL) findSlots(condition string, args ...interface{}) ([]models.Slot, error) {
+	return dal.findSlotsOrdered(condition, "start_time", args...)
+}
+
+func (dal *SQLDAL) findSlotsOrdered(condition string, order string, args ...interface{}) ([]models.Slot, error) {
+	slots := []models.Slot{}
+	rows, err := dal.query(dal.db, "SELECT "+sqlSlotColumns+" FROM "+sqlTableSlots+" WHERE "+condition+" ORDER BY "+order, args...)
+	if err != nil {
+		return slots, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		slot := models.Slot{}
+		var id string
+		err = rows.Scan(&id, &slot.DisplayId, &slot.EventDisplayId, &slot.StartTime, &slot.EndTime, &slot.User, &slot.Interval, &slot.DeletedAt, &slot.CreatedAt, &slot.UpdatedAt)
+		if err != nil {
+			log.Info(err)
+			return slots, err
+		}
+		slot.Id = objectIdFromHex(id)
+		slots = append(slots, slot)
+	}
+	return slots, rows.Err()
+}
+
+func (dal *SQLDAL) GetSlotsForEvents(eventDisplayIds []string) ([]models.Slot, error) {
+	condition, args := sqlIn("event_display_id", eventDisplayIds)
+	return dal.findSlots(condition+" AND "+sqlNotDeleted, args...)
+}
+
+func (dal *SQLDAL) GetSlotsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Slot, error) {
+	condition, args := sqlIn("user_display_id", userDisplayIds)
+	overlap, overlapArgs := sqlOverlapping(from, to)
+	return dal.findSlots(condition+" AND "+overlap+" AND "+sqlNotDeleted, append(args, overlapArgs...)...)
+}
+
+func (dal *SQLDAL) InsertSlots(eventDisplayId string, slots []models.Slot) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	for _, element := range slots {
+		if len(element.Id) == 0 {
+			return helpers.SlotsErrorMissingId
+		}
+	}
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		return dal.insertSlots(tx, eventDisplayId, slots)
+	})
+}
+
+func (dal *SQLDAL) insertSlots(runner sqlRunner, eventDisplayId string, slots []models.Slot) error {
+	query := "INSERT INTO " + sqlTableSlots + " (" + sqlSlotColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	for _, element := range slots {
+		_, err := dal.exec(runner, query, element.Id.Hex(), element.DisplayId, eventDisplayId, element.StartTime.UTC(), element.EndTime.UTC(),
+			element.User, element.Interval, nil, element.CreatedAt.UTC(), element.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dal *SQLDAL) UpdateSlot(slot models.Slot) error {
+	return dal.updateSlot(dal.db, slot)
+}
+
+func (dal *SQLDAL) updateSlot(runner sqlRunner, slot models.Slot) error {
+	query := "UPDATE " + sqlTableSlots + " SET start_time = ?, end_time = ?, user_display_id = ?, interval_minutes = ?, updated_at = ? WHERE event_display_id = ? AND display_id = ?"
+	err := dal.updateOne(runner, query, slot.StartTime.UTC(), slot.EndTime.UTC(), slot.User, slot.Interval, time.Now().UTC(), slot.EventDisplayId, slot.DisplayId)
+	if err == sql.ErrNoRows {
+		return helpers.SlotsErrorNotFound
+	}
+	return err
+}
+
+// UpdateSlots edits the slots in a single transaction, so a failure leaves the
+// slots of the event as they were
+func (dal *SQLDAL) UpdateSlots(eventDisplayId string, slots []models.Slot) error {
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		for _, element := range slots {
+			element.EventDisplayId = eventDisplayId
+			err := dal.updateSlot(tx, element)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (dal *SQLDAL) RemoveSlots(eventDisplayId string, displayIds []string) error {
+	return dal.removeSlots(dal.db, eventDisplayId, displayIds)
+}
+
+func (dal *SQLDAL) removeSlots(runner sqlRunner, eventDisplayId string, displayIds []string) error {
+	if len(displayIds) == 0 {
+		return nil
+	}
+	condition, args := sqlIn("display_id", displayIds)
+	_, err := dal.exec(runner, "DELETE FROM "+sqlTableSlots+" WHERE event_display_id = ? AND "+condition, append([]interface{}{eventDisplayId}, args...)...)
+	return err
+}
+
+// SaveMergedSlots applies a merge in a single transaction, so a failure leaves
+// the slots of the event as they were
+func (dal *SQLDAL) SaveMergedSlots(eventDisplayId string, inserted []models.Slot, updated []models.Slot, removed []string) error {
+	for _, element := range inserted {
+		if len(element.Id) == 0 {
+			return helpers.SlotsErrorMissingId
+		}
+	}
+	return dal.inTransaction(func(tx *sql.Tx) error {
+		err := dal.insertSlots(tx, eventDisplayId, inserted)
+		if err != nil {
+			return err
+		}
+		for _, element := range updated {
+			element.EventDisplayId = eventDisplayId
+			err = dal.updateSlot(tx, element)
+			if err != nil {
+				return err
+			}
+		}
+		return dal.removeSlots(tx, eventDisplayId, removed)
+	})
+}
+
+func (dal *SQLDAL) RemoveSlotFromEvent(eventDisplayId string, displayId string) error {
+	err := dal.updateOne(dal.db, "DELETE FROM "+sqlTableSlots+" WHERE event_display_id = ? AND display_id = ?", eventDisplayId, displayId)
+	if err == sql.ErrNoRows {
+		return helpers.SlotsErrorNotFound
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// newTestDAL opens an empty SQLite database with the schema migrated
+func newTestDAL(t *testing.T) *SQLDAL {
+	dal := NewSQLDatabaseAccessor(SQLDialectSQLite, filepath.Join(t.TempDir(), "meetings.db"))
+	if err := dal.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dal.Close)
+	return dal
+}
+
+// testSlot is a slot of u1 on March 4th 2030 between two hours
+func testSlot(displayId string, start int, end int) models.Slot {
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	now := time.Now().UTC()
+	return models.Slot{Id: bson.NewObjectId(), DisplayId: displayId, StartTime: day.Add(time.Duration(start) * time.Hour),
+		EndTime: day.Add(time.Duration(end) * time.Hour), User: "u1", Interval: 30, CreatedAt: now, UpdatedAt: now}
+}
+
+func TestUpdateSlotsIsAllOrNothing(t *testing.T) {
+	dal := newTestDAL(t)
+	if err := dal.InsertSlots("event", []models.Slot{testSlot("a", 9, 10), testSlot("b", 11, 12)}); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := testSlot("a", 8, 10)
+	err := dal.UpdateSlots("event", []models.Slot{edited, testSlot("missing", 13, 14)})
+	if err != helpers.SlotsErrorNotFound {
+		t.Errorf("UpdateSlots() with a missing slot = %v, want SlotsErrorNotFound", err)
+	}
+	slots, err := dal.GetSlotsForEvents([]string{"event"})
+	if err != nil || len(slots) != 2 || slots[0].StartTime.Hour() != 9 {
+		t.Errorf("slots after a failed edit = %+v %v, want them as they were", slots, err)
+	}
+
+	second := testSlot("b", 11, 13)
+	second.User = "u2"
+	if err = dal.UpdateSlots("event", []models.Slot{edited, second}); err != nil {
+		t.Fatal(err)
+	}
+	slots, err = dal.GetSlotsForEvents([]string{"event"})
+	if err != nil || len(slots) != 2 || slots[0].StartTime.Hour() != 8 || slots[1].EndTime.Hour() != 13 || slots[1].User != "u2" {
+		t.Errorf("slots after the edit = %+v %v, want both edited", slots, err)
+	}
+}
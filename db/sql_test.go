@@ -0,0 +1,309 @@
+package db
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func TestRebind(t *testing.T) {
+	query := "SELECT id FROM users WHERE email = ? AND status IN (?, ?) AND note = '??'"
+	sqlite := &SQLDAL{dialect: SQLDialectSQLite}
+	if got := sqlite.rebind(query); got != query {
+		t.Errorf("sqlite rebind() = %q, want the query unchanged", got)
+	}
+	postgres := &SQLDAL{dialect: SQLDialectPostgres}
+	// rebind numbers every question mark, queries keep them out of literals
+	want := "SELECT id FROM users WHERE email = $1 AND status IN ($2, $3) AND note = '$4$5'"
+	if got := postgres.rebind(query); got != want {
+		t.Errorf("postgres rebind() = %q, want %q", got, want)
+	}
+}
+
+func TestSqlIn(t *testing.T) {
+	tests := []struct {
+		values    []string
+		condition string
+		args      []interface{}
+	}{
+		{nil, "1 = 0", nil},
+		{[]string{}, "1 = 0", nil},
+		{[]string{"a"}, "display_id IN (?)", []interface{}{"a"}},
+		{[]string{"a", "b", "c"}, "display_id IN (?, ?, ?)", []interface{}{"a", "b", "c"}},
+	}
+	for _, test := range tests {
+		condition, args := sqlIn("display_id", test.values)
+		if condition != test.condition || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("sqlIn(%v) = %q %v, want %q %v", test.values, condition, args, test.condition, test.args)
+		}
+	}
+
+	// an empty list matches no row rather than failing the query
+	dal := newTestDAL(t)
+	if _, err := dal.InsertEvent("Interviews", "u1"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := dal.GetEventsByDisplayIds([]string{})
+	if err != nil || len(*events) != 0 {
+		t.Errorf("GetEventsByDisplayIds() of no ids = %v %v, want none", *events, err)
+	}
+}
+
+func TestUserTeams(t *testing.T) {
+	dal := newTestDAL(t)
+	if err := dal.InsertUser("host@example.com", []byte("hash"), "Host", "User", "token"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := dal.FindAnyUserByEmail("host@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Teams == nil || len(user.Teams) != 0 {
+		t.Errorf("teams of a new user = %#v, want an empty list", user.Teams)
+	}
+
+	if err = dal.UpdateUserTeams(user.Id, []string{"sales", "support"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err = dal.FindAnyUserByEmail("host@example.com")
+	if err != nil || !reflect.DeepEqual(user.Teams, []string{"sales", "support"}) {
+		t.Errorf("teams = %#v %v, want sales and support", user.Teams, err)
+	}
+
+	if err = dal.UpdateUserTeams(user.Id, nil); err != nil {
+		t.Fatal(err)
+	}
+	var stored string
+	if err = dal.queryRow(dal.db, "SELECT teams FROM "+sqlTableUsers+" WHERE id = ?", user.Id.Hex()).Scan(&stored); err != nil || stored != "[]" {
+		t.Errorf("teams column after clearing = %q %v, want []", stored, err)
+	}
+
+	if err = dal.UpdateUserTeams(objectIdFromHex("5a0c5f7e9d1b2c3d4e5f6a7b"), []string{"sales"}); err != helpers.AuthenticationErrorLoginUserNotExists {
+		t.Errorf("UpdateUserTeams() of a missing user = %v, want AuthenticationErrorLoginUserNotExists", err)
+	}
+
+	// a row that can't be read is reported like a missing user
+	if _, err = dal.exec(dal.db, "UPDATE "+sqlTableUsers+" SET teams = 'sales' WHERE id = ?", user.Id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dal.FindAnyUserByEmail("host@example.com"); err != helpers.AuthenticationErrorLoginUserNotExists {
+		t.Errorf("FindAnyUserByEmail() with teams that aren't JSON = %v, want AuthenticationErrorLoginUserNotExists", err)
+	}
+}
+
+// trashFixture is an event of u1 with a slot and two meetings
+func trashFixture(t *testing.T, dal *SQLDAL) (*models.Event, models.Meeting, models.Meeting) {
+	event, err := dal.InsertEvent("Interviews", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.InsertSlots(event.DisplayId, []models.Slot{testSlot("slot", 9, 12)}); err != nil {
+		t.Fatal(err)
+	}
+	first := testMeeting(event.DisplayId, 9*time.Hour, 10*time.Hour)
+	second := testMeeting(event.DisplayId, 10*time.Hour, 11*time.Hour)
+	for _, element := range []models.Meeting{first, second} {
+		if err = dal.InsertMeeting(element); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return event, first, second
+}
+
+// counts returns how many slots and meetings of the event are visible
+func counts(t *testing.T, dal *SQLDAL, eventDisplayId string) (int, int) {
+	slots, err := dal.GetSlotsForEvents([]string{eventDisplayId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meetings, err := dal.GetMeetingsForEvents([]string{eventDisplayId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(slots), len(meetings)
+}
+
+func TestRemovedEventIsHidden(t *testing.T) {
+	dal := newTestDAL(t)
+	event, _, _ := trashFixture(t, dal)
+	if err := dal.RemoveEvent(event.DisplayId, 1, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dal.GetEventByDisplayId(event.DisplayId); err != sql.ErrNoRows {
+		t.Errorf("GetEventByDisplayId() of a removed event = %v, want sql.ErrNoRows", err)
+	}
+	if events := dal.GetEventsForUser("u1"); len(*events) != 0 {
+		t.Errorf("GetEventsForUser() = %v, want the removed event left out", *events)
+	}
+	if events, err := dal.GetEventsByDisplayIds([]string{event.DisplayId}); err != nil || len(*events) != 0 {
+		t.Errorf("GetEventsByDisplayIds() = %v %v, want the removed event left out", events, err)
+	}
+	if slots, meetings := counts(t, dal, event.DisplayId); slots != 0 || meetings != 0 {
+		t.Errorf("removed event still shows %d slots and %d meetings", slots, meetings)
+	}
+	day := time.Date(2030, time.March, 4, 0, 0, 0, 0, time.UTC)
+	if slots, err := dal.GetSlotsForUsers([]string{"u1"}, day, day.Add(24*time.Hour)); err != nil || len(slots) != 0 {
+		t.Errorf("GetSlotsForUsers() = %v %v, want the removed slots left out", slots, err)
+	}
+	if meetings, err := dal.GetMeetingsForUsers([]string{"u1"}, day, day.Add(24*time.Hour)); err != nil || len(meetings) != 0 {
+		t.Errorf("GetMeetingsForUsers() = %v %v, want the removed meetings left out", meetings, err)
+	}
+	if count, err := dal.CountMeetings(day); err != nil || count != 0 {
+		t.Errorf("CountMeetings() = %d %v, want 0", count, err)
+	}
+	if _, err := dal.IncrementEventVersion(event.DisplayId, 2); err != helpers.EventsErrorNotFound {
+		t.Errorf("IncrementEventVersion() of a removed event = %v, want EventsErrorNotFound", err)
+	}
+	if deleted, err := dal.GetDeletedEventsForUser("u1"); err != nil || len(deleted) != 1 || deleted[0].DeletedBy != "u1" {
+		t.Errorf("GetDeletedEventsForUser() = %+v %v, want the removed event", deleted, err)
+	}
+}
+
+func TestRemoveEventWithStaleVersion(t *testing.T) {
+	dal := newTestDAL(t)
+	event, _, _ := trashFixture(t, dal)
+	if err := dal.RemoveEvent(event.DisplayId, 7, "u1"); err != helpers.EventsErrorVersionConflict {
+		t.Errorf("RemoveEvent() at a stale version = %v, want EventsErrorVersionConflict", err)
+	}
+	if slots, meetings := counts(t, dal, event.DisplayId); slots != 1 || meetings != 2 {
+		t.Errorf("after a failed removal the event shows %d slots and %d meetings, want 1 and 2", slots, meetings)
+	}
+}
+
+func TestRestoreEvent(t *testing.T) {
+	dal := newTestDAL(t)
+	event, first, _ := trashFixture(t, dal)
+	// the meeting cancelled before the event was removed stays cancelled
+	if err := dal.RemoveMeeting(event.DisplayId, first.DisplayId, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := dal.RemoveEvent(event.DisplayId, 1, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dal.RestoreEvent(event.DisplayId, "u2"); err != helpers.EventsErrorNotFound {
+		t.Errorf("RestoreEvent() by another user = %v, want EventsErrorNotFound", err)
+	}
+	version, err := dal.RestoreEvent(event.DisplayId, "u1")
+	if err != nil || version != 3 {
+		t.Fatalf("RestoreEvent() = %d %v, want version 3", version, err)
+	}
+	if slots, meetings := counts(t, dal, event.DisplayId); slots != 1 || meetings != 1 {
+		t.Errorf("restored event shows %d slots and %d meetings, want 1 and 1", slots, meetings)
+	}
+	deleted, err := dal.GetDeletedMeetingsForEvents([]string{event.DisplayId})
+	if err != nil || len(deleted) != 1 || deleted[0].DisplayId != first.DisplayId {
+		t.Errorf("GetDeletedMeetingsForEvents() = %+v %v, want the meeting cancelled before", deleted, err)
+	}
+	if _, err = dal.RestoreEvent(event.DisplayId, "u1"); err != helpers.EventsErrorNotFound {
+		t.Errorf("RestoreEvent() twice = %v, want EventsErrorNotFound", err)
+	}
+
+	if err = dal.RestoreMeeting(event.DisplayId, first.DisplayId); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.RestoreMeeting(event.DisplayId, first.DisplayId); err != helpers.MeetingsErrorNotFound {
+		t.Errorf("RestoreMeeting() of a meeting that isn't deleted = %v, want MeetingsErrorNotFound", err)
+	}
+	if _, meetings := counts(t, dal, event.DisplayId); meetings != 2 {
+		t.Errorf("event shows %d meetings after restoring the cancelled one, want 2", meetings)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	dal := newTestDAL(t)
+	removed, _, _ := trashFixture(t, dal)
+	if _, err := dal.InsertBlackouts("", removed.DisplayId, []models.Blackout{{StartTime: time.Now(), EndTime: time.Now().Add(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.RemoveEvent(removed.DisplayId, 2, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := dal.InsertEvent("Demos", "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := testMeeting(kept.DisplayId, 9*time.Hour, 10*time.Hour)
+	cancelled.DisplayId = "cancelled"
+	cancelled.UserId = "u2"
+	if err = dal.InsertMeeting(cancelled); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.RemoveMeeting(kept.DisplayId, "cancelled", "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing was deleted before yesterday
+	if err = dal.PurgeDeleted(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := dal.RestoreEvent(removed.DisplayId, "u1"); err != nil {
+		t.Fatalf("RestoreEvent() after an early purge = %d %v", version, err)
+	}
+	if err = dal.RemoveEvent(removed.DisplayId, 4, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dal.PurgeDeleted(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dal.RestoreEvent(removed.DisplayId, "u1"); err != helpers.EventsErrorNotFound {
+		t.Errorf("RestoreEvent() after the purge = %v, want EventsErrorNotFound", err)
+	}
+	for _, table := range []string{sqlTableSlots, sqlTableMeetings, sqlTableBlackouts} {
+		var count int
+		if err = dal.queryRow(dal.db, "SELECT COUNT(*) FROM "+table+" WHERE event_display_id = ?", removed.DisplayId).Scan(&count); err != nil || count != 0 {
+			t.Errorf("%s of the purged event: %d %v, want none", table, count, err)
+		}
+	}
+	if err = dal.RestoreMeeting(kept.DisplayId, "cancelled"); err != helpers.MeetingsErrorNotFound {
+		t.Errorf("RestoreMeeting() of a purged meeting = %v, want MeetingsErrorNotFound", err)
+	}
+	if _, err = dal.GetEventByDisplayId(kept.DisplayId); err != nil {
+		t.Errorf("the event that wasn't removed was purged: %v", err)
+	}
+}
+
+func TestSaveMergedSlots(t *testing.T) {
+	dal := newTestDAL(t)
+	if err := dal.InsertSlots("event", []models.Slot{testSlot("a", 9, 10), testSlot("b", 10, 11)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.InsertSlots("event", []models.Slot{{DisplayId: "no id"}}); err != helpers.SlotsErrorMissingId {
+		t.Errorf("InsertSlots() without an id = %v, want SlotsErrorMissingId", err)
+	}
+
+	// a failed merge leaves the slots as they were
+	err := dal.SaveMergedSlots("event", []models.Slot{testSlot("c", 13, 14)}, []models.Slot{testSlot("missing", 9, 11)}, []string{"b"})
+	if err != helpers.SlotsErrorNotFound {
+		t.Errorf("SaveMergedSlots() of a missing slot = %v, want SlotsErrorNotFound", err)
+	}
+	slots, err := dal.GetSlotsForEvents([]string{"event"})
+	if err != nil || len(slots) != 2 {
+		t.Fatalf("slots after a failed merge = %+v %v, want a and b", slots, err)
+	}
+
+	if err = dal.SaveMergedSlots("event", []models.Slot{testSlot("c", 13, 14)}, []models.Slot{testSlot("a", 9, 11)}, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	slots, err = dal.GetSlotsForEvents([]string{"event"})
+	if err != nil || len(slots) != 2 || slots[0].DisplayId != "a" || slots[0].EndTime.Hour() != 11 || slots[1].DisplayId != "c" {
+		t.Errorf("slots after the merge = %+v %v, want a until 11 and c", slots, err)
+	}
+
+	if err = dal.RemoveSlotFromEvent("event", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if err = dal.RemoveSlotFromEvent("event", "c"); err != helpers.SlotsErrorNotFound {
+		t.Errorf("RemoveSlotFromEvent() twice = %v, want SlotsErrorNotFound", err)
+	}
+	if err = dal.RemoveSlotFromEvent("other", "a"); err != helpers.SlotsErrorNotFound {
+		t.Errorf("RemoveSlotFromEvent() of another event's slot = %v, want SlotsErrorNotFound", err)
+	}
+}
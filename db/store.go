@@ -0,0 +1,141 @@
+package db
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// DAL is the storage layer used by the server, it is implemented on top of
+// MongoDB by MongoDAL and on top of database/sql by SQLDAL
+type DAL interface {
+	Initialize() error
+	Close()
+	// Ping checks that the database answers
+	Ping() error
+
+	// users
+	FindActiveUserByEmail(email string) (*models.User, error)
+	FindAnyUserByEmail(email string) (*models.User, error)
+	InsertUser(email string, hash []byte, firstName string, lastName string, confirmationToken string) error
+	FindUserByConfirmationToken(confirmationToken string, email string) (*models.User, error)
+	FindUserByRecoveryToken(recoveryToken string, email string) (*models.User, error)
+	UpdateUserConfirmation(userId bson.ObjectId, userStatus models.UserStatusType, confirmationTokenStatus models.ConfirmationTokenStatusType, confirmed bool) error
+	UpdateUserPassword(userId bson.ObjectId, hash []byte, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error
+	UpdateUserRecovery(userId bson.ObjectId, recoveryToken string, recoveryTokenStatus models.RecoverTokenStatusType, recoveryTokenExpiry time.Time) error
+	// UpdateUserTeams replaces the teams of the user, users who share a team
+	// may query each other's free/busy times
+	UpdateUserTeams(userId bson.ObjectId, teams []string) error
+	FindActiveUsersByDisplayIds(displayIds []string) ([]models.User, error)
+
+	// events
+	GetEventsForUser(displayId string) *[]models.Event
+	GetEventsByDisplayIds(displayIds []string) (*[]models.Event, error)
+	InsertEvent(name string, adminUser string) (*models.Event, error)
+	UpdateEvent(displayId string, version int, name string, adminUser string) (int, error)
+	UpdateEventIntakeForm(displayId string, version int, form []models.IntakeField) (int, error)
+	IncrementEventVersion(displayId string, version int) (int, error)
+	// RevertEventVersion gives back a claimed version whose change failed
+	RevertEventVersion(displayId string, version int) error
+	RemoveEvent(displayId string, version int, deletedBy string) error
+	GetEventByDisplayId(displayId string) (*models.Event, error)
+	QueryEvents(query EventsQuery) ([]models.Event, error)
+
+	// availability rules, owned by the event when an event display id is given and by the user otherwise
+	InsertBlackouts(userDisplayId string, eventDisplayId string, blackouts []models.Blackout) ([]models.Blackout, error)
+	RemoveBlackout(userDisplayId string, eventDisplayId string, displayId string) error
+	InsertDateOverride(userDisplayId string, eventDisplayId string, override models.DateOverride) (*models.DateOverride, error)
+	RemoveDateOverride(userDisplayId string, eventDisplayId string, displayId string) error
+
+	// slots
+	GetSlotsForEvents(eventDisplayIds []string) ([]models.Slot, error)
+	GetSlotsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Slot, error)
+	InsertSlots(eventDisplayId string, slots []models.Slot) error
+	UpdateSlot(slot models.Slot) error
+	// UpdateSlots edits several slots of the event at once
+	UpdateSlots(eventDisplayId string, slots []models.Slot) error
+	RemoveSlots(eventDisplayId string, displayIds []string) error
+	// SaveMergedSlots inserts, extends and removes the slots of a merge at once
+	SaveMergedSlots(eventDisplayId string, inserted []models.Slot, updated []models.Slot, removed []string) error
+	RemoveSlotFromEvent(eventDisplayId string, displayId string) error
+	QuerySlots(query RangeQuery) ([]models.Slot, error)
+
+	// meetings
+	GetMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error)
+	GetMeetingsForUsers(userDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error)
+	GetMeetingsForGuests(emails []string, eventDisplayIds []string, from time.Time, to time.Time) ([]models.Meeting, error)
+	// InsertMeeting books the meeting, it fails with MeetingsErrorTimeTaken when
+	// its user already has a meeting overlapping it
+	InsertMeeting(meeting models.Meeting) error
+	RemoveMeeting(eventDisplayId string, displayId string, deletedBy string) error
+	QueryMeetings(query RangeQuery) ([]models.Meeting, error)
+	// CountMeetings counts the booked meetings starting at from or later
+	CountMeetings(from time.Time) (int, error)
+
+	// trash, removed events and meetings are hidden from the queries above until they are restored or purged
+	GetDeletedEventsForUser(displayId string) ([]models.Event, error)
+	GetDeletedMeetingsForEvents(eventDisplayIds []string) ([]models.Meeting, error)
+	RestoreEvent(displayId string, adminUser string) (int, error)
+	RestoreMeeting(eventDisplayId string, displayId string) error
+	PurgeDeleted(before time.Time) error
+
+	// audit log, entries can only be added and listed
+	InsertAuditEntry(entry models.AuditEntry) error
+	GetAuditEntries(filter AuditFilter) ([]models.AuditEntry, error)
+
+	// idempotency keys, a key is reserved by the first request using it and keeps its response until it expires
+	InsertIdempotencyKey(key models.IdempotencyKey) error
+	FindIdempotencyKey(scope string, key string) (*models.IdempotencyKey, error)
+	CompleteIdempotencyKey(key models.IdempotencyKey) error
+	RemoveIdempotencyKey(scope string, key string) error
+	PurgeIdempotencyKeys(before time.Time) error
+
+	// backup, records are read and written whole, deleted ones and availability rules included, so they move
+	// between backends unchanged. An import replaces the record with the same id when replace is set.
+	ExportUsers() ([]models.User, error)
+	ExportEvents() ([]models.Event, error)
+	ExportSlots() ([]models.Slot, error)
+	ExportMeetings() ([]models.Meeting, error)
+	ImportUser(user models.User, replace bool) error
+	ImportEvent(event models.Event, replace bool) error
+	ImportSlots(slots []models.Slot, replace bool) error
+	ImportMeetings(meetings []models.Meeting, replace bool) error
+
+	// schema migrations
+	CheckSchemaVersion() (bool, error)
+	MigrateUp() error
+	MigrateDown(steps int) error
+	MigrationStatus() ([]MigrationStatus, error)
+}
+
+// AttachSlotsAndMeetings loads the slots and meetings of the events into them
+func AttachSlotsAndMeetings(dal DAL, events []models.Event) error {
+	displayIds := []string{}
+	for _, element := range events {
+		displayIds = append(displayIds, element.DisplayId)
+	}
+	slots, err := dal.GetSlotsForEvents(displayIds)
+	if err != nil {
+		return err
+	}
+	meetings, err := dal.GetMeetingsForEvents(displayIds)
+	if err != nil {
+		return err
+	}
+	for index := range events {
+		events[index].Slots = []models.Slot{}
+		events[index].Meetings = []models.Meeting{}
+		for _, slot := range slots {
+			if slot.EventDisplayId == events[index].DisplayId {
+				events[index].Slots = append(events[index].Slots, slot)
+			}
+		}
+		for _, meeting := range meetings {
+			if meeting.EventDisplayId == events[index].DisplayId {
+				events[index].Meetings = append(events[index].Meetings, meeting)
+			}
+		}
+	}
+	return nil
+}
+
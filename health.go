@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/gorilla/mux"
+	"github.com/asafron/meetings-scheduler/config"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/mailer"
+	"github.com/asafron/meetings-scheduler/metrics"
+	"github.com/asafron/meetings-scheduler/tracing"
+)
+
+// mailCheckInterval keeps readiness probes from opening an SMTP connection
+// every few seconds
+const mailCheckInterval = time.Minute
+const mailCheckTimeout = 3 * time.Second
+
+var httpRequests = metrics.NewCounter("http_requests_total", "HTTP requests by method, route and status", "method", "route", "status")
+var httpDuration = metrics.NewHistogram("http_request_duration_seconds", "Time to answer HTTP requests by method and route", metrics.DefaultBuckets, "method", "route")
+var dbDuration = metrics.NewHistogram("db_operation_duration_seconds", "Time spent in storage operations", metrics.DefaultBuckets, "operation")
+var dbErrors = metrics.NewCounter("db_operation_errors_total", "Storage operations that failed or found nothing", "operation")
+
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Health answers the liveness and readiness probes
+type Health struct {
+	dal db.DAL
+	cfg *config.EnvConfig
+
+	mutex       sync.Mutex
+	mailChecked time.Time
+	mailErr     error
+}
+
+func NewHealth(dal db.DAL, cfg *config.EnvConfig) *Health {
+	return &Health{dal: dal, cfg: cfg}
+}
+
+/**
+Answers as long as the process is able to serve requests
+ */
+func (h *Health) Live(writer http.ResponseWriter, req *http.Request) {
+	helpers.JsonResponse(writer, http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+/**
+Checks the database and the mail transport, answers 503 until both work
+ */
+func (h *Health) Ready(writer http.ResponseWriter, req *http.Request) {
+	response := HealthResponse{Status: "ready", Checks: map[string]string{}}
+	status := http.StatusOK
+	checks := map[string]error{"database": db.WithContext(h.dal, req.Context()).Ping()}
+	if h.cfg.EmailServerAddress != "" {
+		checks["mail"] = h.checkMail()
+	} else {
+		response.Checks["mail"] = "not configured"
+	}
+	for name, err := range checks {
+		if err != nil {
+			response.Checks[name] = err.Error()
+			response.Status = "not ready"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+	helpers.JsonResponse(writer, status, response)
+}
+
+func (h *Health) checkMail() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if time.Since(h.mailChecked) < mailCheckInterval {
+		return h.mailErr
+	}
+	h.mailErr = mailer.CheckTransport(h.cfg.EmailServerAddress, h.cfg.EmailServerPort, mailCheckTimeout)
+	h.mailChecked = time.Now()
+	return h.mailErr
+}
+
+// registerMeetingMetrics reports the booked meetings on every scrape
+func registerMeetingMetrics(dal db.DAL) {
+	metrics.NewGaugeFunc("meetings_booked", "Meetings booked and not deleted", func() (float64, error) {
+		count, err := dal.CountMeetings(time.Time{})
+		return float64(count), err
+	})
+	metrics.NewGaugeFunc("meetings_upcoming", "Booked meetings that didn't start yet", func() (float64, error) {
+		count, err := dal.CountMeetings(time.Now().UTC())
+		return float64(count), err
+	})
+}
+
+// observeDatabase times the storage operations and traces them as part of
+// the requests they are made for
+func observeDatabase(storage string) db.Observer {
+	return func(ctx context.Context, operation string) func(err error) {
+		start := time.Now()
+		_, span := tracing.Start(ctx, "db "+operation, tracing.KIND_CLIENT)
+		span.SetAttribute("db.system", storage)
+		span.SetAttribute("db.operation", operation)
+		return func(err error) {
+			dbDuration.Observe(time.Since(start).Seconds(), operation)
+			if err != nil {
+				dbErrors.Inc(operation)
+				span.RecordError(err)
+			}
+			span.Finish()
+		}
+	}
+}
+
+// instrument counts and times the requests by the template of the route they
+// matched, so paths with ids don't make a series each
+func instrument(h http.Handler, r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		h.ServeHTTP(recorder, req)
+		route := routeOf(r, req)
+		httpRequests.Inc(req.Method, route, strconv.Itoa(recorder.status))
+		httpDuration.Observe(time.Since(start).Seconds(), req.Method, route)
+	})
+}
+
+func routeOf(r *mux.Router, req *http.Request) string {
+	var match mux.RouteMatch
+	if r.Match(req, &match) && match.Route != nil {
+		if path, err := match.Route.GetPathTemplate(); err == nil {
+			return path
+		}
+	}
+	return "unmatched"
+}
+
+// statusRecorder remembers the status of the response it passes on
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,166 @@
+package helpers
+
+import (
+	"net/http"
+	log "github.com/Sirupsen/logrus"
+)
+
+// ApiError is the error of every failed API response. Code is stable for
+// clients to branch on, Message is meant to be shown to people and Fields
+// points at the parts of the request that were rejected.
+type ApiError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Status  int          `json:"-"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+type apiErrorKind struct {
+	code   string
+	status int
+	field  string
+}
+
+// apiErrors gives every error of this package its code and status, errors
+// that aren't listed are reported as internal errors
+var apiErrors = map[error]apiErrorKind{
+	GeneralErrorInternal:    {"internal_error", http.StatusInternalServerError, ""},
+	GeneralErrorInvalidBody: {"invalid_body", http.StatusBadRequest, ""},
+	GeneralErrorNotFound:    {"not_found", http.StatusNotFound, ""},
+	GeneralErrorBodyTooLarge: {"body_too_large", http.StatusRequestEntityTooLarge, ""},
+	GeneralErrorInvalidRequest: {"invalid_request", http.StatusBadRequest, ""},
+
+	AuthenticationErrorRegisterNoEmail:            {"missing_email", http.StatusBadRequest, "email"},
+	AuthenticationErrorRegisterNoPassword:         {"missing_password", http.StatusBadRequest, "password"},
+	AuthenticationErrorRegisterPasswordNotValid:   {"invalid_password", http.StatusBadRequest, "password"},
+	AuthenticationErrorRegisterUserCreationFailed: {"user_creation_failed", http.StatusInternalServerError, ""},
+	AuthenticationErrorLoginAlreadyAuthenticated:  {"already_authenticated", http.StatusConflict, ""},
+	AuthenticationErrorLoginWrongEmailPassword:    {"wrong_credentials", http.StatusUnauthorized, ""},
+	AuthenticationErrorLoginUserNotExists:         {"user_not_found", http.StatusNotFound, "email"},
+	AuthenticationErrorAuthorizeNewSession:        {"unauthenticated", http.StatusUnauthorized, ""},
+	AuthenticationErrorAuthorizeUserNotLoggedIn:   {"unauthenticated", http.StatusUnauthorized, ""},
+	AuthenticationErrorConfirmationTokenNotValid:  {"invalid_confirmation_token", http.StatusBadRequest, "token"},
+
+	UsersErrorMissingFields:           {"missing_fields", http.StatusBadRequest, ""},
+	UsersErrorLoginMissingFields:      {"missing_fields", http.StatusBadRequest, ""},
+	UsersErrorInvalidPassword:         {"invalid_password", http.StatusBadRequest, "password"},
+	UsersErrorEmailTaken:              {"email_taken", http.StatusConflict, "email"},
+	UsersErrorInvalidConfirmationLink: {"invalid_link", http.StatusBadRequest, ""},
+	UsersErrorInvalidRecoveryLink:     {"invalid_link", http.StatusBadRequest, ""},
+	UsersErrorConfirmationNotSent:     {"email_not_sent", http.StatusInternalServerError, ""},
+	UsersErrorRecoveryNotSent:         {"email_not_sent", http.StatusInternalServerError, ""},
+	UsersErrorDisabled:                {"user_disabled", http.StatusForbidden, ""},
+	UsersErrorAlreadyConfirmed:        {"already_confirmed", http.StatusConflict, ""},
+
+	EventsErrorNotFound:        {"event_not_found", http.StatusNotFound, ""},
+	EventsErrorNotAllowed:      {"event_not_allowed", http.StatusForbidden, ""},
+	EventsErrorVersionConflict: {"version_conflict", http.StatusConflict, ""},
+	EventsErrorStaleVersion:    {"stale_version", http.StatusPreconditionFailed, "If-Match"},
+	EventsErrorInvalidIfMatch:  {"invalid_if_match", http.StatusBadRequest, "If-Match"},
+	EventsErrorInvalidSort:     {"invalid_sort", http.StatusBadRequest, "sort"},
+	EventsErrorInvalidFields:   {"invalid_fields", http.StatusBadRequest, "fields"},
+	EventsErrorInvalidIntakeForm: {"invalid_intake_form", http.StatusBadRequest, ""},
+
+	PagesErrorInvalidCursor: {"invalid_cursor", http.StatusBadRequest, "cursor"},
+	PagesErrorInvalidLimit:  {"invalid_limit", http.StatusBadRequest, "limit"},
+	PagesErrorInvalidFilter: {"invalid_filter", http.StatusBadRequest, ""},
+
+	SlotsErrorNotFound:         {"slot_not_found", http.StatusNotFound, ""},
+	SlotsErrorInvalid:          {"invalid_slots", http.StatusBadRequest, ""},
+	SlotsErrorInvalidRange:     {"invalid_slot_range", http.StatusBadRequest, ""},
+	SlotsErrorOverlap:          {"slot_overlap", http.StatusBadRequest, ""},
+	SlotsErrorDuplicate:        {"slot_duplicate", http.StatusBadRequest, ""},
+	SlotsErrorNoUser:           {"missing_slot_user", http.StatusBadRequest, ""},
+	SlotsErrorNoInterval:       {"invalid_slot_interval", http.StatusBadRequest, ""},
+	SlotsErrorIntervalTooLong:  {"invalid_slot_interval", http.StatusBadRequest, ""},
+	SlotsErrorMissingId:        {"missing_slot_id", http.StatusBadRequest, ""},
+	SlotsErrorOrphansMeetings:  {"slots_orphan_meetings", http.StatusConflict, ""},
+	SlotsErrorIncompleteUpdate: {"incomplete_slot_update", http.StatusBadRequest, ""},
+	SlotsErrorInvalidCSV:       {"invalid_slots_csv", http.StatusBadRequest, ""},
+	SlotsErrorInvalidTime:      {"invalid_slot_time", http.StatusBadRequest, ""},
+	SlotsErrorUnknownUser:      {"unknown_slot_user", http.StatusBadRequest, ""},
+	SlotsErrorPartialMerge:     {"partial_slot_merge", http.StatusInternalServerError, ""},
+	SlotsErrorPartialUpdate:    {"partial_slot_update", http.StatusInternalServerError, ""},
+
+	MeetingsErrorNotFound:  {"meeting_not_found", http.StatusNotFound, ""},
+	MeetingsErrorTimeTaken: {"meeting_time_taken", http.StatusConflict, ""},
+	MeetingsErrorInvalidAnswers: {"invalid_intake_answers", http.StatusBadRequest, ""},
+	MeetingsErrorUnavailable: {"meeting_time_unavailable", http.StatusConflict, "start_time"},
+
+	FreeBusyErrorNoUsers:       {"missing_users", http.StatusBadRequest, "users"},
+	FreeBusyErrorInvalidRange:  {"invalid_range", http.StatusBadRequest, "start_time"},
+	FreeBusyErrorUserNotFound:  {"user_not_found", http.StatusBadRequest, "users"},
+	FreeBusyErrorNotColleague:  {"not_colleague", http.StatusForbidden, ""},
+
+	SuggestionsErrorNoAttendees:         {"missing_attendees", http.StatusBadRequest, "required"},
+	SuggestionsErrorInvalidDuration:     {"invalid_duration", http.StatusBadRequest, "duration"},
+	SuggestionsErrorInvalidWorkingHours: {"invalid_working_hours", http.StatusBadRequest, "working_hours"},
+	SuggestionsErrorInvalidTimeZone:     {"invalid_time_zone", http.StatusBadRequest, "time_zone"},
+	SuggestionsErrorWindowTooLong:       {"window_too_long", http.StatusBadRequest, "end_time"},
+
+	BlackoutsErrorNotFound:        {"blackout_not_found", http.StatusNotFound, ""},
+	BlackoutsErrorInvalidRange:    {"invalid_blackout_range", http.StatusBadRequest, "start_time"},
+	BlackoutsErrorInvalidCalendar: {"invalid_calendar", http.StatusBadRequest, ""},
+	BlackoutsErrorUnsupportedRecurrence: {"unsupported_recurrence", http.StatusBadRequest, ""},
+
+	DateOverridesErrorNotFound:     {"date_override_not_found", http.StatusNotFound, ""},
+	DateOverridesErrorInvalidDate:  {"invalid_date", http.StatusBadRequest, "date"},
+	DateOverridesErrorInvalidHours: {"invalid_hours", http.StatusBadRequest, "start"},
+
+	AuditErrorNotAllowed:    {"audit_not_allowed", http.StatusForbidden, ""},
+	AuditErrorInvalidFilter: {"invalid_filter", http.StatusBadRequest, ""},
+
+	IdempotencyErrorInvalidKey: {"invalid_idempotency_key", http.StatusBadRequest, "Idempotency-Key"},
+	IdempotencyErrorKeyInUse:   {"idempotency_key_in_use", http.StatusConflict, "Idempotency-Key"},
+	IdempotencyErrorMismatch:   {"idempotency_key_mismatch", http.StatusUnprocessableEntity, "Idempotency-Key"},
+
+	DatabaseErrorUnknownStorage: {"internal_error", http.StatusInternalServerError, ""},
+	DatabaseErrorUnknownDialect: {"internal_error", http.StatusInternalServerError, ""},
+
+	MigrationsErrorSchemaTooNew: {"internal_error", http.StatusInternalServerError, ""},
+	MigrationsErrorPending:      {"internal_error", http.StatusInternalServerError, ""},
+}
+
+// ToApiError maps an error to the error sent to clients, errors that aren't
+// known are logged and hidden behind GeneralErrorInternal
+func ToApiError(err error) *ApiError {
+	if apiError, ok := err.(*ApiError); ok {
+		return apiError
+	}
+	kind, ok := apiErrors[err]
+	if !ok {
+		log.Warn(err)
+		err = GeneralErrorInternal
+		kind = apiErrors[err]
+	}
+	apiError := &ApiError{Code: kind.code, Message: err.Error(), Status: kind.status}
+	if kind.field != "" {
+		apiError.Fields = []FieldError{{Field: kind.field, Message: err.Error()}}
+	}
+	return apiError
+}
+
+// ErrorResponse writes the error as the error of a failed response
+func ErrorResponse(writer http.ResponseWriter, err error) {
+	ApiErrorResponse(writer, ToApiError(err), nil)
+}
+
+// ApiErrorResponse writes a failed response, data carries whatever else helps
+// the client fix the request
+func ApiErrorResponse(writer http.ResponseWriter, apiError *ApiError, data map[string]interface{}) {
+	JsonResponse(writer, apiError.Status, &GeneralResponse{
+		Success: false,
+		Message: apiError.Message,
+		Error: apiError,
+		Data: data,
+	})
+}
@@ -4,6 +4,10 @@ import "errors"
 
 var (
 	GeneralErrorInternal = MakeError("An error has aoccured")
+	GeneralErrorInvalidBody = MakeError("Request body is not valid JSON")
+	GeneralErrorNotFound = MakeError("Not found")
+	GeneralErrorBodyTooLarge = MakeError("Request body is too large")
+	GeneralErrorInvalidRequest = MakeError("Request doesn't match the API specification, see /openapi.json")
 
 	AuthenticationErrorRegisterNoEmail = MakeError("Email is empty")
 	AuthenticationErrorRegisterNoPassword = MakeError("Password is empty")
@@ -16,9 +20,85 @@ var (
 	AuthenticationErrorAuthorizeUserNotLoggedIn = MakeError("user not logged in")
 	AuthenticationErrorConfirmationTokenNotValid = MakeError("Confirmation token is not valid")
 
+	UsersErrorMissingFields = MakeError("Email, password or password confirmation are missing")
+	UsersErrorLoginMissingFields = MakeError("Email or password are missing")
+	UsersErrorInvalidPassword = MakeError("Password is to short or doesn't match the password confirmation")
+	UsersErrorEmailTaken = MakeError("A user with this email already exists, please try another email")
+	UsersErrorInvalidConfirmationLink = MakeError("Confirmation link is invalid")
+	UsersErrorInvalidRecoveryLink = MakeError("Forgot Password link is invalid")
+	UsersErrorConfirmationNotSent = MakeError("The user has been registered but the confirmation email sending has failed , please try again or contect the system administrator with this message")
+	UsersErrorRecoveryNotSent = MakeError("We couldn't send your password recovery email, please try again or contect the system administrator with this message")
+	UsersErrorDisabled = MakeError("The user is disabled")
+	UsersErrorAlreadyConfirmed = MakeError("The user is already confirmed")
+
 	EventsErrorNotFound = MakeError("Event not found")
+	EventsErrorNotAllowed = MakeError("Only the event admin can change this event")
+	EventsErrorVersionConflict = MakeError("The event was changed by someone else, reload it and try again")
+	EventsErrorStaleVersion = MakeError("The event is no longer at the version of If-Match, reload it and try again")
+	EventsErrorInvalidIfMatch = MakeError("If-Match must be the ETag of the event")
+	EventsErrorInvalidSort = MakeError("Events can be sorted by created_at, updated_at or name, prefixed with - for descending order")
+	EventsErrorInvalidFields = MakeError("One or more of the requested event fields don't exist")
+	EventsErrorInvalidIntakeForm = MakeError("One or more fields of the intake form are invalid")
+
+	PagesErrorInvalidCursor = MakeError("Cursor is not valid for this listing")
+	PagesErrorInvalidLimit = MakeError("Limit must be between 1 and 200")
+	PagesErrorInvalidFilter = MakeError("Time filters must be unix times and flags true or false")
 
 	SlotsErrorNotFound = MakeError("Slot not found")
+	SlotsErrorInvalid = MakeError("One or more slots are invalid")
+	SlotsErrorInvalidRange = MakeError("Slot start time must be before its end time")
+	SlotsErrorOverlap = MakeError("Slots of the same user can't overlap")
+	SlotsErrorDuplicate = MakeError("Slot duplicates another slot of the same user")
+	SlotsErrorNoUser = MakeError("Slot user is missing")
+	SlotsErrorNoInterval = MakeError("Slot interval must be positive")
+	SlotsErrorIntervalTooLong = MakeError("Slot interval is longer than the slot")
+	SlotsErrorMissingId = MakeError("Slot has no id")
+	SlotsErrorOrphansMeetings = MakeError("The change would leave booked meetings outside of the slots")
+	SlotsErrorIncompleteUpdate = MakeError("Replacing a slot requires start time, end time, user and interval")
+	SlotsErrorInvalidCSV = MakeError("Slots file must be CSV with a header naming the start, end, user and interval columns")
+	SlotsErrorInvalidTime = MakeError("Slot time must be RFC 3339 or YYYY-MM-DD HH:MM")
+	SlotsErrorUnknownUser = MakeError("Slot user doesn't exist")
+	SlotsErrorPartialMerge = MakeError("Only part of the slot merge was saved, merge the same slots again to complete it")
+	SlotsErrorPartialUpdate = MakeError("Only part of the slot edit was saved, reload the event and edit the slots again")
+
+	MeetingsErrorNotFound = MakeError("Meeting not found")
+	MeetingsErrorTimeTaken = MakeError("The meeting time was booked again in the meantime")
+	MeetingsErrorInvalidAnswers = MakeError("One or more answers to the intake form are invalid")
+	MeetingsErrorUnavailable = MakeError("The meeting must take one interval of a slot the user is free in")
+
+	FreeBusyErrorNoUsers = MakeError("No users were requested")
+	FreeBusyErrorInvalidRange = MakeError("Start time must be before end time")
+	FreeBusyErrorUserNotFound = MakeError("One or more of the requested users doesn't exist")
+	FreeBusyErrorNotColleague = MakeError("You can only query users who share a team with you")
+
+	SuggestionsErrorNoAttendees = MakeError("No attendees were requested")
+	SuggestionsErrorInvalidDuration = MakeError("Meeting duration must be positive")
+	SuggestionsErrorInvalidWorkingHours = MakeError("Working hours must be HH:MM and start before they end")
+	SuggestionsErrorInvalidTimeZone = MakeError("Unknown time zone")
+	SuggestionsErrorWindowTooLong = MakeError("Suggestions can be searched for up to 90 days at a time")
+
+	BlackoutsErrorNotFound = MakeError("Blackout not found")
+	BlackoutsErrorInvalidRange = MakeError("Blackout start time must be before its end time")
+	BlackoutsErrorInvalidCalendar = MakeError("Holiday calendar is not a valid ICS file")
+	BlackoutsErrorUnsupportedRecurrence = MakeError("Holiday calendar has entries that repeat in a way that can't be imported")
+
+	DateOverridesErrorNotFound = MakeError("Date override not found")
+	DateOverridesErrorInvalidDate = MakeError("Date override date must be YYYY-MM-DD in a known time zone")
+	DateOverridesErrorInvalidHours = MakeError("Date override hours must be HH:MM and start before they end")
+
+	AuditErrorNotAllowed = MakeError("Only admins can list the audit log without an event you own")
+	AuditErrorInvalidFilter = MakeError("Audit filters must be unix times and a limit between 1 and 1000")
+
+	IdempotencyErrorInvalidKey = MakeError("Idempotency-Key must be between 1 and 255 characters")
+	IdempotencyErrorKeyInUse = MakeError("A request with this Idempotency-Key is still in progress")
+	IdempotencyErrorMismatch = MakeError("Idempotency-Key was already used with a different request")
+	IdempotencyErrorNotFound = MakeError("Idempotency-Key not found")
+
+	DatabaseErrorUnknownStorage = MakeError("Unknown storage, expected mongo, sqlite or postgres")
+	DatabaseErrorUnknownDialect = MakeError("Unknown SQL dialect, expected sqlite3 or postgres")
+
+	MigrationsErrorSchemaTooNew = MakeError("Database schema is newer than this version supports, upgrade before starting")
+	MigrationsErrorPending = MakeError("Database schema migrations are pending, run the migrate up command")
 )
 
 func MakeError(msg string) error {
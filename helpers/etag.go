@@ -0,0 +1,28 @@
+package helpers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"fmt"
+)
+
+// ETag formats an event version as an entity tag
+func ETag(version int) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// IfMatchVersion reads the version the client expects from the If-Match
+// header, ok is false when the header is missing or matches any version
+func IfMatchVersion(req *http.Request) (int, bool, error) {
+	header := strings.TrimSpace(req.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(header, "\""))
+	if err != nil {
+		return 0, false, EventsErrorInvalidIfMatch
+	}
+	return version, true, nil
+}
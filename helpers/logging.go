@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	log "github.com/Sirupsen/logrus"
+)
+
+type requestLogKey struct{}
+
+// RequestLog collects the fields logged along with a request. It travels in
+// the context of the request, so handlers deeper in the chain, which get
+// copies of the request, can add to the fields logged when it is over.
+type RequestLog struct {
+	mutex  sync.Mutex
+	fields log.Fields
+}
+
+// WithRequestLog starts the log of a request with its id
+func WithRequestLog(r *http.Request, requestId string) (*http.Request, *RequestLog) {
+	requestLog := &RequestLog{fields: log.Fields{"request_id": requestId}}
+	return r.WithContext(context.WithValue(r.Context(), requestLogKey{}, requestLog)), requestLog
+}
+
+func (l *RequestLog) Set(key string, value interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.fields[key] = value
+}
+
+// Fields returns a copy of the fields collected so far
+func (l *RequestLog) Fields() log.Fields {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	fields := log.Fields{}
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	return fields
+}
+
+// SetLogField adds a field to the log of the request, requests that aren't
+// logged are left alone
+func SetLogField(r *http.Request, key string, value interface{}) {
+	if requestLog, ok := r.Context().Value(requestLogKey{}).(*RequestLog); ok {
+		requestLog.Set(key, value)
+	}
+}
+
+// RequestLogger logs with the fields of the request, like its id and user
+func RequestLogger(r *http.Request) *log.Entry {
+	if requestLog, ok := r.Context().Value(requestLogKey{}).(*RequestLog); ok {
+		return log.WithFields(requestLog.Fields())
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// RequestId is the id the request is logged with, empty for requests that
+// aren't logged
+func RequestId(r *http.Request) string {
+	if requestLog, ok := r.Context().Value(requestLogKey{}).(*RequestLog); ok {
+		id, _ := requestLog.Fields()["request_id"].(string)
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIp is the address of the client, as reported by the first proxy in
+// front of the server when there is one
+func ClientIp(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if realIp := r.Header.Get("X-Real-Ip"); realIp != "" {
+		return realIp
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -9,6 +9,7 @@ type GeneralResponse struct {
 	Success bool                   `json:"success"`
 	Message string                 `json:"message,omitempty"`
 	Data    map[string]interface{} `json:"data,omitempty"`
+	Error   *ApiError              `json:"error,omitempty"`
 }
 
 func JsonResponse(writer http.ResponseWriter, statusCode int, responseObject interface{}) {
@@ -5,9 +5,12 @@ import (
 	"math/rand"
 	"os/exec"
 	"strings"
+	"sync"
 )
 
+// src isn't safe for concurrent use, srcLock guards it between requests
 var src = rand.NewSource(time.Now().UnixNano())
+var srcLock sync.Mutex
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 const (
@@ -18,6 +21,8 @@ const (
 
 func RandStringBytesMaskImprSrc(n int) string {
 	b := make([]byte, n)
+	srcLock.Lock()
+	defer srcLock.Unlock()
 	for i, cache, remain := n-1, src.Int63(), letterIdxMax; i >= 0; {
 		if remain == 0 {
 			cache, remain = src.Int63(), letterIdxMax
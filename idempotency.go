@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2/bson"
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+const idempotencyReplayedHeader = "Idempotent-Replayed"
+const idempotencyKeyMaxLength = 255
+
+// idempotencyKeptHeaders are the response headers replayed with the body,
+// cookies are left out so a replay never signs anybody in
+var idempotencyKeptHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency makes POST requests sent with an Idempotency-Key header safe to
+// retry. The first request reserves the key for inProgressTtl and its response
+// is kept for ttl, retries with the same key and request get that response
+// back while retries with a different request are rejected. Server errors
+// release the key so the request can be tried again, and so does the short
+// expiry when the server stops before answering. Keys belong to the client
+// that sent them: the signed in user, found by identity, or else the client
+// address.
+type Idempotency struct {
+	dal           db.DAL
+	ttl           time.Duration
+	inProgressTtl time.Duration
+	identity      func(req *http.Request) string
+}
+
+func NewIdempotency(dal db.DAL, ttlHours int, inProgressTtl time.Duration, identity func(req *http.Request) string) *Idempotency {
+	return &Idempotency{dal: dal, ttl: time.Duration(ttlHours) * time.Hour, inProgressTtl: inProgressTtl, identity: identity}
+}
+
+// Handle serves the request through h unless it is the retry of a request
+// that was already answered
+func (i *Idempotency) Handle(writer http.ResponseWriter, req *http.Request, h http.Handler) {
+	key := req.Header.Get(idempotencyKeyHeader)
+	if req.Method != "POST" || key == "" {
+		h.ServeHTTP(writer, req)
+		return
+	}
+	if len(key) > idempotencyKeyMaxLength {
+		helpers.ErrorResponse(writer, helpers.IdempotencyErrorInvalidKey)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		// reading only fails past the body size limit or when the client is gone
+		helpers.ErrorResponse(writer, helpers.GeneralErrorBodyTooLarge)
+		return
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	scope := i.scope(req)
+	fingerprint := idempotencyFingerprint(req, body)
+
+	record := models.IdempotencyKey{
+		Id: bson.NewObjectId(),
+		Key: key,
+		Scope: scope,
+		Fingerprint: fingerprint,
+		Header: map[string]string{},
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: time.Now().UTC().Add(i.inProgressTtl),
+	}
+	err = db.WithContext(i.dal, req.Context()).InsertIdempotencyKey(record)
+	if err == helpers.IdempotencyErrorKeyInUse {
+		i.replay(writer, req, scope, key, fingerprint)
+		return
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+	h.ServeHTTP(recorder, req)
+
+	if recorder.status >= http.StatusInternalServerError {
+		err = db.WithContext(i.dal, req.Context()).RemoveIdempotencyKey(scope, key)
+	} else {
+		record.Status = recorder.status
+		for _, name := range idempotencyKeptHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				record.Header[name] = value
+			}
+		}
+		record.Body = recorder.body.Bytes()
+		record.ExpiresAt = time.Now().UTC().Add(i.ttl)
+		err = db.WithContext(i.dal, req.Context()).CompleteIdempotencyKey(record)
+	}
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+// replay answers a retry with the response kept for its key
+func (i *Idempotency) replay(writer http.ResponseWriter, req *http.Request, scope string, key string, fingerprint string) {
+	record, err := db.WithContext(i.dal, req.Context()).FindIdempotencyKey(scope, key)
+	if err == helpers.IdempotencyErrorNotFound {
+		// the key expired or was released since it was reserved
+		err = helpers.IdempotencyErrorKeyInUse
+	}
+	if err != nil {
+		helpers.ErrorResponse(writer, err)
+		return
+	}
+	if record.Fingerprint != fingerprint {
+		helpers.ErrorResponse(writer, helpers.IdempotencyErrorMismatch)
+		return
+	}
+	if record.Status == 0 {
+		helpers.ErrorResponse(writer, helpers.IdempotencyErrorKeyInUse)
+		return
+	}
+	for name, value := range record.Header {
+		writer.Header().Set(name, value)
+	}
+	writer.Header().Set(idempotencyReplayedHeader, "true")
+	writer.WriteHeader(record.Status)
+	writer.Write(record.Body)
+}
+
+// scope keeps the keys of every client apart: those of a signed in user are
+// shared by their sessions, those of anonymous requests by their address
+func (i *Idempotency) scope(req *http.Request) string {
+	client := "address " + helpers.ClientIp(req)
+	if email := i.identity(req); email != "" {
+		client = "user " + email
+	}
+	sum := sha256.Sum256([]byte(client))
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyFingerprint(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func purgeIdempotencyKeys(dal db.DAL) {
+	err := dal.PurgeIdempotencyKeys(time.Now().UTC())
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+// responseRecorder passes the response on while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
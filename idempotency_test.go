@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asafron/meetings-scheduler/db"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+func newTestIdempotency(t *testing.T) (*Idempotency, db.DAL) {
+	dal := db.NewSQLDatabaseAccessor(db.SQLDialectSQLite, filepath.Join(t.TempDir(), "meetings.db"))
+	if err := dal.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dal.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dal.Close)
+	// the tests sign requests in with an X-Test-User header
+	identity := func(req *http.Request) string {
+		return req.Header.Get("X-Test-User")
+	}
+	return NewIdempotency(dal, 24, time.Minute, identity), dal
+}
+
+// countingHandler creates an event, it answers with the number of events created so far
+func countingHandler(count *int32) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		created := atomic.AddInt32(count, 1)
+		writer.Header().Set("ETag", `"1"`)
+		http.SetCookie(writer, &http.Cookie{Name: "auth", Value: "session"})
+		helpers.JsonResponse(writer, http.StatusCreated, &helpers.GeneralResponse{Success: true, Data: map[string]interface{}{"created": created}})
+	})
+}
+
+func idempotentRequest(i *Idempotency, h http.Handler, key string, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:4000"
+	req.Header.Set(idempotencyKeyHeader, key)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	i.Handle(recorder, req, h)
+	return recorder
+}
+
+func responseErrorCode(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	var response helpers.GeneralResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	if response.Error == nil {
+		return ""
+	}
+	return response.Error.Code
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	i, _ := newTestIdempotency(t)
+	var count int32
+	h := countingHandler(&count)
+
+	first := idempotentRequest(i, h, "k1", `{"name": "Interviews"}`, nil)
+	retry := idempotentRequest(i, h, "k1", `{"name": "Interviews"}`, nil)
+	if count != 1 {
+		t.Errorf("the handler ran %d times, want once", count)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry got %d %s, want the first response %d %s", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+	if retry.Header().Get(idempotencyReplayedHeader) != "true" || retry.Header().Get("ETag") != `"1"` {
+		t.Errorf("retry headers = %v, want the ETag replayed and marked as a replay", retry.Header())
+	}
+	if retry.Header().Get("Set-Cookie") != "" {
+		t.Errorf("retry set a cookie: %q", retry.Header().Get("Set-Cookie"))
+	}
+
+	idempotentRequest(i, h, "k2", `{"name": "Interviews"}`, nil)
+	idempotentRequest(i, h, "", `{"name": "Interviews"}`, nil)
+	if count != 3 {
+		t.Errorf("the handler ran %d times for a new key and no key, want 3 in all", count)
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	i, _ := newTestIdempotency(t)
+	var count int32
+	h := countingHandler(&count)
+
+	idempotentRequest(i, h, "k1", `{"name": "Interviews"}`, nil)
+	recorder := idempotentRequest(i, h, "k1", `{"name": "Demos"}`, nil)
+	if recorder.Code != http.StatusUnprocessableEntity || responseErrorCode(t, recorder) != "idempotency_key_mismatch" {
+		t.Errorf("another request with the key got %d %s, want 422 idempotency_key_mismatch", recorder.Code, recorder.Body.String())
+	}
+	if count != 1 {
+		t.Errorf("the handler ran %d times, want once", count)
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	i, dal := newTestIdempotency(t)
+	var count int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		countingHandler(&count).ServeHTTP(writer, req)
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- idempotentRequest(i, slow, "k1", `{"name": "Interviews"}`, nil)
+	}()
+	<-started
+
+	record, err := dal.FindIdempotencyKey(i.scope(httptest.NewRequest("POST", "/", nil)), "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != 0 || record.ExpiresAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("key of a running request expires at %v, want within the in-progress minute", record.ExpiresAt)
+	}
+	recorder := idempotentRequest(i, countingHandler(&count), "k1", `{"name": "Interviews"}`, nil)
+	if recorder.Code != http.StatusConflict || responseErrorCode(t, recorder) != "idempotency_key_in_use" {
+		t.Errorf("retry while running got %d %s, want 409 idempotency_key_in_use", recorder.Code, recorder.Body.String())
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first request got %d %s", first.Code, first.Body.String())
+	}
+	record, err = dal.FindIdempotencyKey(record.Scope, "k1")
+	if err != nil || record.Status != http.StatusCreated || record.ExpiresAt.Before(time.Now().Add(23*time.Hour)) {
+		t.Errorf("completed key = %+v %v, want the response kept for a day", record, err)
+	}
+	if recorder = idempotentRequest(i, countingHandler(&count), "k1", `{"name": "Interviews"}`, nil); recorder.Code != http.StatusCreated || count != 1 {
+		t.Errorf("retry after completion got %d with the handler run %d times, want the replay of the single run", recorder.Code, count)
+	}
+}
+
+// A request that never completes, as when the server stops during it, holds
+// its key only for the in-progress expiry.
+func TestIdempotencyInProgressExpires(t *testing.T) {
+	i, _ := newTestIdempotency(t)
+	i.inProgressTtl = time.Millisecond
+	var count int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	stuck := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- idempotentRequest(i, stuck, "k1", `{"name": "Interviews"}`, nil)
+	}()
+	<-started
+
+	time.Sleep(5 * time.Millisecond)
+	recorder := idempotentRequest(i, countingHandler(&count), "k1", `{"name": "Interviews"}`, nil)
+	if recorder.Code != http.StatusCreated || count != 1 {
+		t.Errorf("retry after the reservation expired got %d %s with the handler run %d times, want it served", recorder.Code, recorder.Body.String(), count)
+	}
+	close(release)
+	<-done
+}
+
+func TestIdempotencyScopes(t *testing.T) {
+	i, _ := newTestIdempotency(t)
+	var count int32
+	h := countingHandler(&count)
+
+	requests := []http.Header{
+		nil,
+		{"X-Forwarded-For": {"198.51.100.7"}},
+		{"X-Test-User": {"host@example.com"}},
+		{"X-Test-User": {"colleague@example.com"}},
+	}
+	for _, header := range requests {
+		if recorder := idempotentRequest(i, h, "k1", `{"name": "Interviews"}`, header); recorder.Header().Get(idempotencyReplayedHeader) != "" {
+			t.Errorf("request of another client with %v was answered with a replay", header)
+		}
+	}
+	if count != int32(len(requests)) {
+		t.Errorf("the handler ran %d times for %d clients", count, len(requests))
+	}
+
+	// a signed in user's keys follow them to another address
+	header := http.Header{"X-Test-User": {"host@example.com"}, "X-Forwarded-For": {"203.0.113.9"}}
+	if recorder := idempotentRequest(i, h, "k1", `{"name": "Interviews"}`, header); recorder.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("retry of a signed in user from another address wasn't replayed")
+	}
+}
+
+func TestIdempotencyServerErrorReleasesKey(t *testing.T) {
+	i, _ := newTestIdempotency(t)
+	var count int32
+	failing := http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&count, 1)
+		helpers.ErrorResponse(writer, helpers.GeneralErrorInternal)
+	})
+	idempotentRequest(i, failing, "k1", `{"name": "Interviews"}`, nil)
+	recorder := idempotentRequest(i, countingHandler(&count), "k1", `{"name": "Interviews"}`, nil)
+	if recorder.Code != http.StatusCreated || count != 2 {
+		t.Errorf("retry after a server error got %d with the handler run %d times, want it run again", recorder.Code, count)
+	}
+}
@@ -0,0 +1,173 @@
+package intake
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+// MaxFields bounds the questions of a form, MaxAnswerLength the answers
+const MaxFields = 50
+const MaxAnswerLength = 2000
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ().-]{3,30}$`)
+
+// ValidateForm checks the fields of an intake form as a host defined them,
+// the errors name the offending field by its position
+func ValidateForm(fields []models.IntakeField) []helpers.FieldError {
+	errors := []helpers.FieldError{}
+	if len(fields) > MaxFields {
+		return append(errors, helpers.FieldError{Field: "fields", Message: fmt.Sprintf("must have at most %d fields", MaxFields)})
+	}
+	keys := make(map[string]bool)
+	for index, element := range fields {
+		fail := func(name string, message string) {
+			errors = append(errors, helpers.FieldError{Field: fmt.Sprintf("fields[%d].%s", index, name), Message: message})
+		}
+		switch {
+		case !keyPattern.MatchString(element.Key):
+			fail("key", "must be lowercase letters, digits and underscores, starting with a letter")
+		case keys[element.Key]:
+			fail("key", "is used by another field")
+		}
+		keys[element.Key] = true
+		if strings.TrimSpace(element.Label) == "" {
+			fail("label", "is required")
+		}
+		switch element.Type {
+		case models.INTAKE_FIELD_SELECT:
+			if len(element.Options) == 0 {
+				fail("options", "are required for a select field")
+			}
+			seen := make(map[string]bool)
+			for _, option := range element.Options {
+				if strings.TrimSpace(option) == "" || seen[option] {
+					fail("options", "must be distinct and not empty")
+					break
+				}
+				seen[option] = true
+			}
+		case models.INTAKE_FIELD_TEXT, models.INTAKE_FIELD_EMAIL, models.INTAKE_FIELD_PHONE, models.INTAKE_FIELD_CHECKBOX:
+			if len(element.Options) > 0 {
+				fail("options", "are only allowed for a select field")
+			}
+		default:
+			fail("type", "must be text, email, phone, select or checkbox")
+		}
+		if element.Pattern != "" {
+			if element.Type == models.INTAKE_FIELD_SELECT || element.Type == models.INTAKE_FIELD_CHECKBOX {
+				fail("pattern", "is only allowed for text, email and phone fields")
+			} else if _, err := compilePattern(element.Pattern); err != nil {
+				fail("pattern", "is not a valid regular expression")
+			}
+		}
+	}
+	return errors
+}
+
+// ValidateAnswers checks the answers of a guest against the intake form and
+// returns them as they are stored in the guest details: trimmed, checkboxes as
+// true or false and unanswered optional fields left out. Events without a form
+// keep the free-form details of before.
+func ValidateAnswers(fields []models.IntakeField, answers map[string]string) (map[string]string, []helpers.FieldError) {
+	details := make(map[string]string)
+	errors := []helpers.FieldError{}
+	if len(fields) == 0 {
+		for key, value := range answers {
+			details[key] = value
+		}
+		return details, errors
+	}
+	known := make(map[string]bool)
+	for _, element := range fields {
+		known[element.Key] = true
+		fail := func(message string) {
+			errors = append(errors, helpers.FieldError{Field: "details." + element.Key, Message: message})
+		}
+		value := strings.TrimSpace(answers[element.Key])
+		if element.Type == models.INTAKE_FIELD_CHECKBOX {
+			checked := false
+			if value != "" {
+				parsed, err := strconv.ParseBool(value)
+				if err != nil {
+					fail("must be true or false")
+					continue
+				}
+				checked = parsed
+			}
+			if element.Required && !checked {
+				fail("must be checked")
+				continue
+			}
+			details[element.Key] = strconv.FormatBool(checked)
+			continue
+		}
+		if value == "" {
+			if element.Required {
+				fail("is required")
+			}
+			continue
+		}
+		if len(value) > MaxAnswerLength {
+			fail(fmt.Sprintf("must be at most %d characters", MaxAnswerLength))
+			continue
+		}
+		switch element.Type {
+		case models.INTAKE_FIELD_EMAIL:
+			address, err := mail.ParseAddress(value)
+			if err != nil || address.Address != value {
+				fail("must be an email address")
+				continue
+			}
+		case models.INTAKE_FIELD_PHONE:
+			if !phonePattern.MatchString(value) {
+				fail("must be a phone number")
+				continue
+			}
+		case models.INTAKE_FIELD_SELECT:
+			if !contains(element.Options, value) {
+				fail("must be one of " + strings.Join(element.Options, ", "))
+				continue
+			}
+		}
+		if element.Pattern != "" {
+			pattern, err := compilePattern(element.Pattern)
+			if err != nil || !pattern.MatchString(value) {
+				fail("doesn't have the expected format")
+				continue
+			}
+		}
+		details[element.Key] = value
+	}
+	unknown := []string{}
+	for key := range answers {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		errors = append(errors, helpers.FieldError{Field: "details." + key, Message: "is not a question of the intake form"})
+	}
+	return details, errors
+}
+
+// compilePattern anchors the pattern so it has to match the whole answer
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+func contains(values []string, value string) bool {
+	for _, element := range values {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
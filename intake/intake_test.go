@@ -0,0 +1,147 @@
+package intake
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/models"
+)
+
+func TestValidateForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []models.IntakeField
+		want   []string
+	}{
+		{"no fields", []models.IntakeField{}, []string{}},
+		{
+			"valid fields",
+			[]models.IntakeField{
+				{Key: "company", Label: "Company", Type: models.INTAKE_FIELD_TEXT, Required: true, Pattern: "[A-Za-z ]+"},
+				{Key: "size", Label: "Team size", Type: models.INTAKE_FIELD_SELECT, Options: []string{"1-10", "11-50"}},
+				{Key: "terms", Label: "I agree", Type: models.INTAKE_FIELD_CHECKBOX, Required: true},
+			},
+			[]string{},
+		},
+		{
+			"bad and duplicate keys",
+			[]models.IntakeField{
+				{Key: "Company", Label: "Company", Type: models.INTAKE_FIELD_TEXT},
+				{Key: "phone", Label: "Phone", Type: models.INTAKE_FIELD_PHONE},
+				{Key: "phone", Label: "Other phone", Type: models.INTAKE_FIELD_PHONE},
+			},
+			[]string{"fields[0].key", "fields[2].key"},
+		},
+		{"missing label", []models.IntakeField{{Key: "company", Label: " ", Type: models.INTAKE_FIELD_TEXT}}, []string{"fields[0].label"}},
+		{"unknown type", []models.IntakeField{{Key: "company", Label: "Company", Type: "date"}}, []string{"fields[0].type"}},
+		{"select without options", []models.IntakeField{{Key: "size", Label: "Size", Type: models.INTAKE_FIELD_SELECT}}, []string{"fields[0].options"}},
+		{
+			"select with duplicate or empty options",
+			[]models.IntakeField{
+				{Key: "size", Label: "Size", Type: models.INTAKE_FIELD_SELECT, Options: []string{"small", "small"}},
+				{Key: "color", Label: "Color", Type: models.INTAKE_FIELD_SELECT, Options: []string{"red", ""}},
+			},
+			[]string{"fields[0].options", "fields[1].options"},
+		},
+		{"options on a text field", []models.IntakeField{{Key: "company", Label: "Company", Type: models.INTAKE_FIELD_TEXT, Options: []string{"a"}}}, []string{"fields[0].options"}},
+		{"pattern on a checkbox", []models.IntakeField{{Key: "terms", Label: "Terms", Type: models.INTAKE_FIELD_CHECKBOX, Pattern: "true"}}, []string{"fields[0].pattern"}},
+		{"invalid pattern", []models.IntakeField{{Key: "company", Label: "Company", Type: models.INTAKE_FIELD_TEXT, Pattern: "[a-z"}}, []string{"fields[0].pattern"}},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, element := range ValidateForm(test.fields) {
+			got = append(got, element.Field)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ValidateForm() fields = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateFormTooManyFields(t *testing.T) {
+	fields := make([]models.IntakeField, MaxFields+1)
+	got := ValidateForm(fields)
+	if len(got) != 1 || got[0].Field != "fields" {
+		t.Errorf("ValidateForm() = %v, want a single error on fields", got)
+	}
+}
+
+func TestValidateAnswers(t *testing.T) {
+	form := []models.IntakeField{
+		{Key: "company", Label: "Company", Type: models.INTAKE_FIELD_TEXT, Required: true, Pattern: "[A-Za-z ]+"},
+		{Key: "work_email", Label: "Work email", Type: models.INTAKE_FIELD_EMAIL},
+		{Key: "phone", Label: "Phone", Type: models.INTAKE_FIELD_PHONE},
+		{Key: "size", Label: "Team size", Type: models.INTAKE_FIELD_SELECT, Required: true, Options: []string{"1-10", "11-50"}},
+		{Key: "terms", Label: "I agree", Type: models.INTAKE_FIELD_CHECKBOX, Required: true},
+		{Key: "newsletter", Label: "Newsletter", Type: models.INTAKE_FIELD_CHECKBOX},
+	}
+	valid := map[string]string{"company": " Acme ", "size": "1-10", "terms": "true"}
+	with := func(changes map[string]string) map[string]string {
+		answers := make(map[string]string)
+		for key, value := range valid {
+			answers[key] = value
+		}
+		for key, value := range changes {
+			answers[key] = value
+		}
+		return answers
+	}
+	tests := []struct {
+		name    string
+		answers map[string]string
+		details map[string]string
+		errors  []helpers.FieldError
+	}{
+		{
+			"valid answers are trimmed and checkboxes normalized",
+			with(map[string]string{"terms": "1", "phone": "+1 (555) 010-9999"}),
+			map[string]string{"company": "Acme", "size": "1-10", "terms": "true", "newsletter": "false", "phone": "+1 (555) 010-9999"},
+			[]helpers.FieldError{},
+		},
+		{
+			"required answers missing",
+			map[string]string{},
+			map[string]string{"newsletter": "false"},
+			[]helpers.FieldError{
+				{Field: "details.company", Message: "is required"},
+				{Field: "details.size", Message: "is required"},
+				{Field: "details.terms", Message: "must be checked"},
+			},
+		},
+		{"required checkbox unchecked", with(map[string]string{"terms": "false"}), nil, []helpers.FieldError{{Field: "details.terms", Message: "must be checked"}}},
+		{"checkbox not a boolean", with(map[string]string{"newsletter": "sure"}), nil, []helpers.FieldError{{Field: "details.newsletter", Message: "must be true or false"}}},
+		{"option not offered", with(map[string]string{"size": "1-100"}), nil, []helpers.FieldError{{Field: "details.size", Message: "must be one of 1-10, 11-50"}}},
+		{"pattern must match the whole answer", with(map[string]string{"company": "Acme 42"}), nil, []helpers.FieldError{{Field: "details.company", Message: "doesn't have the expected format"}}},
+		{"invalid email", with(map[string]string{"work_email": "Bob <bob@acme.io>"}), nil, []helpers.FieldError{{Field: "details.work_email", Message: "must be an email address"}}},
+		{"invalid phone", with(map[string]string{"phone": "call me"}), nil, []helpers.FieldError{{Field: "details.phone", Message: "must be a phone number"}}},
+		{"too long", with(map[string]string{"company": strings.Repeat("a", MaxAnswerLength+1)}), nil, []helpers.FieldError{{Field: "details.company", Message: "must be at most 2000 characters"}}},
+		{
+			"unknown keys are reported in order",
+			with(map[string]string{"zip": "1", "age": "2"}),
+			nil,
+			[]helpers.FieldError{
+				{Field: "details.age", Message: "is not a question of the intake form"},
+				{Field: "details.zip", Message: "is not a question of the intake form"},
+			},
+		},
+	}
+	for _, test := range tests {
+		details, errors := ValidateAnswers(form, test.answers)
+		if !reflect.DeepEqual(errors, test.errors) {
+			t.Errorf("%s: ValidateAnswers() errors = %v, want %v", test.name, errors, test.errors)
+		}
+		if test.details != nil && !reflect.DeepEqual(details, test.details) {
+			t.Errorf("%s: ValidateAnswers() details = %v, want %v", test.name, details, test.details)
+		}
+	}
+}
+
+func TestValidateAnswersWithoutForm(t *testing.T) {
+	answers := map[string]string{"anything": "goes"}
+	details, errors := ValidateAnswers(nil, answers)
+	if len(errors) != 0 || !reflect.DeepEqual(details, answers) {
+		t.Errorf("ValidateAnswers() = %v %v, want the answers as they are", details, errors)
+	}
+}
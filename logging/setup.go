@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/config"
+)
+
+// Setup sends the logs to the configured log file, or to standard error when
+// there is none, in the configured format. What is still logged with the
+// standard library ends up there too. The returned closer closes the file.
+func Setup(cfg *config.EnvConfig) (io.Closer, error) {
+	level, err := log.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	log.SetLevel(level)
+	if cfg.LogFormat == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+
+	var closer io.Closer = ioutil.NopCloser(nil)
+	log.SetOutput(os.Stderr)
+	if cfg.LogPath != "" {
+		file, err := NewRotatingFile(cfg.LogPath, int64(cfg.LogMaxSizeMb) << 20, cfg.LogMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		log.SetOutput(file)
+		closer = file
+	}
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.StandardLogger().Writer())
+	return closer, nil
+}
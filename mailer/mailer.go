@@ -1,13 +1,24 @@
 package mailer
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"strings"
 	"net/smtp"
-	"log"
+	log "github.com/Sirupsen/logrus"
+	"time"
+	"github.com/asafron/meetings-scheduler/metrics"
+	"github.com/asafron/meetings-scheduler/tracing"
 )
 
-func SendMail(recipients []string, subject string, messageBody string, from string, username string, password string, host string, port int, bcc string) error {
+// mails are sent while the request waits, so the queue is made of the mails
+// whose SMTP exchange is still going on
+var queueDepth = metrics.NewGauge("mail_queue_depth", "Emails being sent right now")
+var sent = metrics.NewCounter("mail_sent_total", "Emails handed to the SMTP server, by result", "result")
+var sendDuration = metrics.NewHistogram("mail_send_duration_seconds", "Time spent sending an email", metrics.DefaultBuckets)
+
+func SendMail(ctx context.Context, recipients []string, subject string, messageBody string, from string, username string, password string, host string, port int, bcc string) error {
 	headers := make(map[string]string)
 	headers["From"] = from
 	headers["To"] = strings.Join(recipients,",")
@@ -31,6 +42,13 @@ func SendMail(recipients []string, subject string, messageBody string, from stri
 
 
 	serverAddressAndPort := fmt.Sprint(host , ":" , port)
+	_, span := tracing.Start(ctx, "smtp send", tracing.KIND_CLIENT)
+	defer span.Finish()
+	span.SetAttribute("net.peer.name", host)
+	span.SetAttribute("net.peer.port", port)
+	span.SetAttribute("mail.recipients", len(recipients))
+	queueDepth.Add(1)
+	start := time.Now()
 	err := smtp.SendMail(
 		serverAddressAndPort,
 		auth,
@@ -38,6 +56,29 @@ func SendMail(recipients []string, subject string, messageBody string, from stri
 		recipients,
 		[]byte(message),
 	)
-	log.Println(err)
+	sendDuration.Observe(time.Since(start).Seconds())
+	queueDepth.Add(-1)
+	if err != nil {
+		span.RecordError(err)
+		sent.Inc("error")
+		log.WithField("subject", subject).Warnf("failed to send email: %s", err)
+	} else {
+		sent.Inc("ok")
+	}
 	return err
+}
+
+// CheckTransport connects to the SMTP server and waits for its greeting
+func CheckTransport(host string, port int, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", fmt.Sprint(host, ":", port), timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	return client.Quit()
 }
\ No newline at end of file
@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds,
+// from a fast database lookup to a slow SMTP exchange
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics []metric
+}{}
+
+func register(m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// series keeps the label values of a metric next to its value
+type series struct {
+	labels []string
+	value  float64
+}
+
+// Counter only goes up, there is a value for every combination of its labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, series: make(map[string]*series)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values, given in the order of the labels
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *Counter) Add(delta float64, values ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := strings.Join(values, "\xff")
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = &series{labels: values}
+	}
+	c.series[key].value += delta
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	header(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		sample(w, c.name, c.labels, c.series[key].labels, "", c.series[key].value)
+	}
+}
+
+// Gauge goes up and down
+type Gauge struct {
+	name  string
+	help  string
+	mutex sync.Mutex
+	value float64
+}
+
+func NewGauge(name string, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value += delta
+}
+
+func (g *Gauge) Set(value float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value = value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	header(w, g.name, g.help, "gauge")
+	sample(w, g.name, nil, nil, "", g.value)
+}
+
+// GaugeFunc is a gauge whose value is asked for on every scrape, it is left
+// out of the scrape when the value can't be had
+type GaugeFunc struct {
+	name  string
+	help  string
+	value func() (float64, error)
+}
+
+func NewGaugeFunc(name string, help string, value func() (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, value: value}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	value, err := g.value()
+	if err != nil {
+		log.Warnf("failed to collect %s: %s", g.name, err)
+		return
+	}
+	header(w, g.name, g.help, "gauge")
+	sample(w, g.name, nil, nil, "", value)
+}
+
+// Histogram counts observations in buckets, for every combination of its labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+// Observe records a value for the label values, given in the order of the labels
+func (h *Histogram) Observe(value float64, values ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := strings.Join(values, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for index, bound := range h.buckets {
+		if value <= bound {
+			s.counts[index]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	header(w, h.name, h.help, "histogram")
+	keys := []string{}
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	labels := append(append([]string{}, h.labels...), "le")
+	for _, key := range keys {
+		s := h.series[key]
+		for index, bound := range h.buckets {
+			values := append(append([]string{}, s.labels...), formatFloat(bound))
+			sample(w, h.name, labels, values, "_bucket", float64(s.counts[index]))
+		}
+		sample(w, h.name, labels, append(append([]string{}, s.labels...), "+Inf"), "_bucket", float64(s.count))
+		sample(w, h.name, h.labels, s.labels, "_sum", s.sum)
+		sample(w, h.name, h.labels, s.labels, "_count", float64(s.count))
+	}
+}
+
+// Write writes every metric in the Prometheus text format
+func Write(w io.Writer) {
+	registry.Lock()
+	metrics := append([]metric{}, registry.metrics...)
+	registry.Unlock()
+	for _, element := range metrics {
+		element.write(w)
+	}
+}
+
+// Handler serves the metrics to Prometheus
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		var buffer bytes.Buffer
+		Write(&buffer)
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writer.Write(buffer.Bytes())
+	})
+}
+
+func header(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.Replace(help, "\n", " ", -1), name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sample(w io.Writer, name string, labels []string, values []string, suffix string, value float64) {
+	pairs := []string{}
+	for index, label := range labels {
+		if index < len(values) {
+			pairs = append(pairs, label+`="`+labelEscaper.Replace(values[index])+`"`)
+		}
+	}
+	if len(pairs) > 0 {
+		fmt.Fprintf(w, "%s%s{%s} %s\n", name, suffix, strings.Join(pairs, ","), formatFloat(value))
+		return
+	}
+	fmt.Fprintf(w, "%s%s %s\n", name, suffix, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]*series) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
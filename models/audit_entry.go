@@ -0,0 +1,48 @@
+package models
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// AuditEntry records a single mutation, entries are only ever appended.
+// Changes holds the fields that differ between the target before and after
+// the mutation, by their JSON names.
+type AuditEntry struct {
+	Id             bson.ObjectId          `json:"id" bson:"_id"`
+	Actor          string                 `json:"actor" bson:"actor"`
+	Action         AuditActionType        `json:"action" bson:"action"`
+	TargetType     AuditTargetType        `json:"target_type" bson:"target_type"`
+	TargetId       string                 `json:"target_id" bson:"target_id"`
+	EventDisplayId string                 `json:"event_display_id" bson:"event_display_id"`
+	Changes        map[string]AuditChange `json:"changes" bson:"changes"`
+	Ip             string                 `json:"ip" bson:"ip"`
+	CreatedAt      time.Time              `json:"created_at" bson:"created_at"`
+}
+
+type AuditChange struct {
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+type AuditActionType string
+type AuditTargetType string
+
+const (
+	AUDIT_CREATE AuditActionType = "create"
+	AUDIT_UPDATE AuditActionType = "update"
+	AUDIT_DELETE AuditActionType = "delete"
+	AUDIT_RESTORE AuditActionType = "restore"
+	AUDIT_CONFIRM AuditActionType = "confirm"
+	AUDIT_PASSWORD_RECOVERY AuditActionType = "password_recovery"
+	AUDIT_PASSWORD_RESET AuditActionType = "password_reset"
+)
+
+const (
+	AUDIT_TARGET_USER AuditTargetType = "user"
+	AUDIT_TARGET_EVENT AuditTargetType = "event"
+	AUDIT_TARGET_SLOT AuditTargetType = "slot"
+	AUDIT_TARGET_MEETING AuditTargetType = "meeting"
+	AUDIT_TARGET_BLACKOUT AuditTargetType = "blackout"
+	AUDIT_TARGET_DATE_OVERRIDE AuditTargetType = "date_override"
+)
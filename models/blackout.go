@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+type Blackout struct {
+	Id        bson.ObjectId `json:"id" bson:"_id"`
+	DisplayId string        `json:"display_id" bson:"display_id"`
+	StartTime time.Time     `json:"start_time" bson:"start_time"`
+	EndTime   time.Time     `json:"end_time" bson:"end_time"`
+	Reason    string        `json:"reason" bson:"reason"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
+}
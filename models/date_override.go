@@ -0,0 +1,20 @@
+package models
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// DateOverride limits the hours of a single day, the slots of that day are
+// only free between StartTime and EndTime. When they are equal the whole day
+// is unavailable.
+type DateOverride struct {
+	Id        bson.ObjectId `json:"id" bson:"_id"`
+	DisplayId string        `json:"display_id" bson:"display_id"`
+	Date      string        `json:"date" bson:"date"`
+	TimeZone  string        `json:"time_zone" bson:"time_zone"`
+	StartTime time.Time     `json:"start_time" bson:"start_time"`
+	EndTime   time.Time     `json:"end_time" bson:"end_time"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" bson:"updated_at"`
+}
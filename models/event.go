@@ -5,14 +5,24 @@ import (
 	"time"
 )
 
+// Event holds the metadata of an event, its slots and meetings are stored in
+// their own collections and are only attached when needed. A deleted event
+// stays in the trash, with its slots and meetings, until it is purged. The
+// intake form lists the questions guests answer when they book a meeting.
 type Event struct {
-	Id           bson.ObjectId `json:"id" bson:"_id"`
-	DisplayId    string        `json:"display_id" bson:"display_id"`
-	AdminUser    string        `json:"admin_user" bson:"admin_user"`
-	Slots        []Slot        `json:"slots" bson:"slots"`
-	Name         string        `json:"name" bson:"name"`
-	Meetings     []Meeting     `json:"meetings" bson:"meetings"`
-	GuestWebsite string        `json:"guest_website" bson:"-"`
-	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time     `json:"updated_at" bson:"updated_at"`
+	Id            bson.ObjectId  `json:"id" bson:"_id"`
+	DisplayId     string         `json:"display_id" bson:"display_id"`
+	AdminUser     string         `json:"admin_user" bson:"admin_user"`
+	Slots         []Slot         `json:"slots" bson:"-"`
+	Name          string         `json:"name" bson:"name"`
+	Meetings      []Meeting      `json:"meetings" bson:"-"`
+	Blackouts     []Blackout     `json:"blackouts" bson:"blackouts"`
+	DateOverrides []DateOverride `json:"date_overrides" bson:"date_overrides"`
+	IntakeForm    []IntakeField  `json:"intake_form" bson:"intake_form"`
+	GuestWebsite  string         `json:"guest_website" bson:"-"`
+	Version       int            `json:"version" bson:"version"`
+	DeletedAt     *time.Time     `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy     string         `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	CreatedAt     time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" bson:"updated_at"`
 }
\ No newline at end of file
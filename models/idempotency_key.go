@@ -0,0 +1,24 @@
+package models
+
+import (
+	"gopkg.in/mgo.v2/bson"
+	"time"
+)
+
+// IdempotencyKey keeps the response of the first request sent with an
+// Idempotency-Key header so retries get the same response. Status is 0 while
+// the first request is still running, ExpiresAt is then short so the key is
+// released if that request never completes. Scope separates the keys of
+// different clients and Fingerprint identifies the method, path and body of
+// the request.
+type IdempotencyKey struct {
+	Id          bson.ObjectId     `json:"id" bson:"_id"`
+	Key         string            `json:"key" bson:"key"`
+	Scope       string            `json:"scope" bson:"scope"`
+	Fingerprint string            `json:"fingerprint" bson:"fingerprint"`
+	Status      int               `json:"status" bson:"status"`
+	Header      map[string]string `json:"header" bson:"header"`
+	Body        []byte            `json:"body" bson:"body"`
+	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at" bson:"expires_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// IntakeField is a question of the intake form of an event, the answer of the
+// guest is stored in the guest details under its key. Pattern is a regular
+// expression the whole answer of a text, email or phone field must match.
+type IntakeField struct {
+	Key      string          `json:"key" bson:"key"`
+	Label    string          `json:"label" bson:"label"`
+	Type     IntakeFieldType `json:"type" bson:"type"`
+	Required bool            `json:"required" bson:"required"`
+	Options  []string        `json:"options,omitempty" bson:"options,omitempty"`
+	Pattern  string          `json:"pattern,omitempty" bson:"pattern,omitempty"`
+}
+
+type IntakeFieldType string
+
+const (
+	INTAKE_FIELD_TEXT IntakeFieldType = "text"
+	INTAKE_FIELD_EMAIL IntakeFieldType = "email"
+	INTAKE_FIELD_PHONE IntakeFieldType = "phone"
+	INTAKE_FIELD_SELECT IntakeFieldType = "select"
+	INTAKE_FIELD_CHECKBOX IntakeFieldType = "checkbox"
+)
@@ -8,10 +8,13 @@ import (
 type Meeting struct {
 	Id                     bson.ObjectId `json:"id" bson:"_id"`
 	DisplayId              string        `json:"display_id" bson:"display_id"`
+	EventDisplayId         string        `json:"event_display_id" bson:"event_display_id"`
 	StartTime              time.Time     `json:"start_time" bson:"start_time"`
 	EndTime                time.Time     `json:"end_time" bson:"end_time"`
 	Guest                  Guest         `json:"guest" bson:"guest"`
 	UserId                 string        `json:"user_id" bson:"user_id"`
+	DeletedAt              *time.Time    `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy              string        `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
 	CreatedAt              time.Time     `json:"created_at" bson:"created_at"`
 	UpdatedAt              time.Time     `json:"updated_at" bson:"updated_at"`
 }
\ No newline at end of file
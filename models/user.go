@@ -19,10 +19,25 @@ type User struct {
 	RecoverToken		string                      `json:"-" bson:"recovery_token"`
 	RecoverTokenExpiry      time.Time                   `json:"-" bson:"recovery_token_expiry"`
 	RecoverTokenStatus	RecoverTokenStatusType      `json:"-" bson:"recovery_token_status"`
+	Teams                   []string                    `json:"teams" bson:"teams"`
+	Blackouts               []Blackout                  `json:"blackouts" bson:"blackouts"`
+	DateOverrides           []DateOverride              `json:"date_overrides" bson:"date_overrides"`
 	CreatedAt               time.Time                   `json:"created_at" bson:"created_at"`
 	UpdatedAt               time.Time                   `json:"updated_at" bson:"updated_at"`
 }
 
+// SharesTeamWith reports whether both users are members of at least one common team
+func (user User) SharesTeamWith(other User) bool {
+	for _, team := range user.Teams {
+		for _, otherTeam := range other.Teams {
+			if team == otherTeam {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type UserStatusType string
 type ConfirmationTokenStatusType string
 type RecoverTokenStatusType string
@@ -30,6 +45,7 @@ type RecoverTokenStatusType string
 const (
 	USER_NOT_CONFIRMED UserStatusType = "not_confirmed"
 	USER_CONFIRMED UserStatusType = "confirmed"
+	USER_DISABLED UserStatusType = "disabled"
 )
 
 const (
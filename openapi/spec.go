@@ -0,0 +1,298 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Schema is a JSON schema object of the document
+type Schema map[string]interface{}
+
+// Param is a query parameter of an operation
+type Param struct {
+	Name        string
+	Description string
+	// Type is the JSON type of the parameter, string when empty
+	Type     string
+	Required bool
+}
+
+// Operation documents one method of a route. Request and the values of Data
+// are zero values of the Go types the handler decodes and answers with, their
+// schemas are generated from the types.
+type Operation struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	// Public operations don't need a session
+	Public bool
+	Query  []Param
+	// Headers are the request headers of the operation
+	Headers []Param
+	// Request is the JSON body, RequestType is set for bodies that aren't JSON
+	// and aren't validated
+	Request     interface{}
+	RequestType string
+	// Data describes the data of a successful GeneralResponse, Response is the
+	// body of operations that don't answer with a GeneralResponse
+	Data     map[string]interface{}
+	Response interface{}
+	// ResponseType is set for bodies that aren't JSON, such as downloads
+	ResponseType string
+	// Redirect operations answer by sending browsers elsewhere
+	Redirect bool
+}
+
+// Spec collects the operations of the API and generates its OpenAPI 3
+// document, the schemas of the Go types are shared as components
+type Spec struct {
+	Title         string
+	Version       string
+	General       interface{}
+	operations    []Operation
+	schemas       map[string]Schema
+	schemaTypes   map[string]reflect.Type
+	requestSchema map[string]Schema
+}
+
+// NewSpec starts a document, general is the envelope all the JSON responses
+// are wrapped in
+func NewSpec(title string, version string, general interface{}) *Spec {
+	return &Spec{
+		Title: title,
+		Version: version,
+		General: general,
+		schemas: make(map[string]Schema),
+		schemaTypes: make(map[string]reflect.Type),
+		requestSchema: make(map[string]Schema),
+	}
+}
+
+func operationKey(method string, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// Add documents an operation, its request schema is generated right away so
+// requests can be validated against it
+func (s *Spec) Add(op Operation) {
+	s.operations = append(s.operations, op)
+	if op.Request != nil && op.RequestType == "" {
+		s.requestSchema[operationKey(op.Method, op.Path)] = s.SchemaOf(reflect.TypeOf(op.Request))
+	}
+}
+
+// Operation finds the operation of a method and a route path template
+func (s *Spec) Operation(method string, path string) (Operation, bool) {
+	for _, element := range s.operations {
+		if operationKey(element.Method, element.Path) == operationKey(method, path) {
+			return element, true
+		}
+	}
+	return Operation{}, false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var objectIdType = reflect.TypeOf(bson.ObjectId(""))
+
+// SchemaOf generates the schema of a Go type the way encoding/json encodes
+// it, named structs become components and are referenced
+func (s *Spec) SchemaOf(t reflect.Type) Schema {
+	switch {
+	case t == timeType:
+		return Schema{"type": "string", "format": "date-time"}
+	case t == objectIdType:
+		return Schema{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.SchemaOf(t.Elem())
+		if _, ok := schema["$ref"]; !ok {
+			schema["nullable"] = true
+		}
+		return schema
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Schema{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer", "format": "int64", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "format": "byte"}
+		}
+		return Schema{"type": "array", "items": s.SchemaOf(t.Elem()), "nullable": true}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": s.SchemaOf(t.Elem()), "nullable": true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		name := t.Name()
+		if known, ok := s.schemaTypes[name]; ok && known != t {
+			name = strings.Replace(t.PkgPath(), "/", ".", -1) + "." + name
+		}
+		if _, ok := s.schemas[name]; !ok {
+			s.schemaTypes[name] = t
+			// registered before the fields so recursive types end up as references
+			s.schemas[name] = Schema{}
+			s.schemas[name] = s.structSchema(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + name}
+	}
+	return Schema{}
+}
+
+// structSchema lists the exported fields by their JSON names, embedded
+// structs are flattened and fields tagged validate:"required" are required
+func (s *Spec) structSchema(t reflect.Type) Schema {
+	properties := Schema{}
+	required := []string{}
+	for index := 0; index < t.NumField(); index++ {
+		field := t.Field(index)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.structSchema(field.Type)
+			for key, value := range embedded["properties"].(Schema) {
+				properties[key] = value
+			}
+			if list, ok := embedded["required"].([]string); ok {
+				required = append(required, list...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.SchemaOf(field.Type)
+		if field.Tag.Get("validate") == "required" {
+			required = append(required, name)
+		}
+	}
+	schema := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// resolve follows a component reference
+func (s *Spec) resolve(schema Schema) Schema {
+	if ref, ok := schema["$ref"].(string); ok {
+		return s.schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// Document generates the OpenAPI 3 document of the operations added so far
+func (s *Spec) Document() map[string]interface{} {
+	paths := map[string]Schema{}
+	for _, op := range s.operations {
+		if _, ok := paths[op.Path]; !ok {
+			paths[op.Path] = Schema{}
+		}
+		operation := Schema{"summary": op.Summary, "operationId": operationId(op)}
+		if op.Tag != "" {
+			operation["tags"] = []string{op.Tag}
+		}
+		if op.Public {
+			operation["security"] = []Schema{}
+		}
+		parameters := []Schema{}
+		for _, name := range pathParams(op.Path) {
+			parameters = append(parameters, Schema{"name": name, "in": "path", "required": true, "schema": Schema{"type": "string"}})
+		}
+		for _, param := range op.Query {
+			paramType := param.Type
+			if paramType == "" {
+				paramType = "string"
+			}
+			parameters = append(parameters, Schema{"name": param.Name, "in": "query", "required": param.Required,
+				"description": param.Description, "schema": Schema{"type": paramType}})
+		}
+		for _, param := range op.Headers {
+			parameters = append(parameters, Schema{"name": param.Name, "in": "header", "required": param.Required,
+				"description": param.Description, "schema": Schema{"type": "string"}})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if op.RequestType != "" {
+			operation["requestBody"] = Schema{"required": true, "content": Schema{op.RequestType: Schema{"schema": Schema{"type": "string"}}}}
+		} else if op.Request != nil {
+			operation["requestBody"] = Schema{"required": true, "content": Schema{"application/json": Schema{"schema": s.SchemaOf(reflect.TypeOf(op.Request))}}}
+		}
+		operation["responses"] = s.responses(op)
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": Schema{"title": s.Title, "version": s.Version},
+		"paths": paths,
+		"components": Schema{
+			"schemas": s.schemas,
+			"securitySchemes": Schema{"session": Schema{"type": "apiKey", "in": "cookie", "name": "auth"}},
+		},
+		"security": []Schema{{"session": []string{}}},
+	}
+}
+
+// responses documents the successful response and the error envelope
+func (s *Spec) responses(op Operation) Schema {
+	if op.Redirect {
+		return Schema{"303": Schema{"description": "Redirects to the dashboard"}}
+	}
+	general := s.SchemaOf(reflect.TypeOf(s.General))
+	success := general
+	if op.Response != nil {
+		success = s.SchemaOf(reflect.TypeOf(op.Response))
+	} else if len(op.Data) > 0 {
+		data := Schema{}
+		for key, value := range op.Data {
+			data[key] = s.SchemaOf(reflect.TypeOf(value))
+		}
+		success = Schema{"allOf": []Schema{general, {"type": "object", "properties": Schema{"data": Schema{"type": "object", "properties": data}}}}}
+	}
+	successType := "application/json"
+	if op.ResponseType != "" {
+		successType = op.ResponseType
+		success = Schema{"type": "string"}
+	}
+	return Schema{
+		"200": Schema{"description": "Success", "content": Schema{successType: Schema{"schema": success}}},
+		"default": Schema{"description": "Error, the error field of the response describes it", "content": Schema{"application/json": Schema{"schema": general}}},
+	}
+}
+
+func pathParams(path string) []string {
+	params := []string{}
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			params = append(params, strings.Split(strings.Trim(part, "{}"), ":")[0])
+		}
+	}
+	return params
+}
+
+// operationId names the operation after its method and path, e.g.
+// delete_v2_events_id_slots_slot_id
+func operationId(op Operation) string {
+	replacer := strings.NewReplacer("/", "_", "{", "", "}", "")
+	return strings.ToLower(op.Method) + replacer.Replace(op.Path)
+}
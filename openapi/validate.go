@@ -0,0 +1,141 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+// ValidateRequest checks a JSON body against the request schema of the
+// operation, operations without a JSON body accept anything
+func (s *Spec) ValidateRequest(op Operation, body []byte) []helpers.FieldError {
+	schema, ok := s.requestSchema[operationKey(op.Method, op.Path)]
+	if !ok {
+		return nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return []helpers.FieldError{{Field: "", Message: helpers.GeneralErrorInvalidBody.Error()}}
+	}
+	return s.validate(value, schema, "")
+}
+
+// ValidateQuery checks the documented query parameters that aren't strings
+func (s *Spec) ValidateQuery(op Operation, query url.Values) []helpers.FieldError {
+	errors := []helpers.FieldError{}
+	for _, param := range op.Query {
+		value := query.Get(param.Name)
+		if value == "" {
+			if param.Required {
+				errors = append(errors, helpers.FieldError{Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		switch param.Type {
+		case "integer":
+			if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+				errors = append(errors, mismatch(param.Name, "an integer")...)
+			}
+		case "boolean":
+			if _, err := strconv.ParseBool(value); err != nil {
+				errors = append(errors, mismatch(param.Name, "a boolean")...)
+			}
+		}
+	}
+	return errors
+}
+
+func (s *Spec) validate(value interface{}, schema Schema, path string) []helpers.FieldError {
+	schema = s.resolve(schema)
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable || len(schema) == 0 {
+			return nil
+		}
+		return []helpers.FieldError{{Field: path, Message: "must not be null"}}
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch(path, "an object")
+		}
+		errors := []helpers.FieldError{}
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, ok := object[name]; !ok {
+					errors = append(errors, helpers.FieldError{Field: join(path, name), Message: "is required"})
+				}
+			}
+		}
+		names := []string{}
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		properties, _ := schema["properties"].(Schema)
+		additional, _ := schema["additionalProperties"].(Schema)
+		for _, name := range names {
+			if property, ok := properties[name].(Schema); ok {
+				errors = append(errors, s.validate(object[name], property, join(path, name))...)
+			} else if additional != nil {
+				errors = append(errors, s.validate(object[name], additional, join(path, name))...)
+			}
+		}
+		return errors
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return mismatch(path, "an array")
+		}
+		errors := []helpers.FieldError{}
+		items, _ := schema["items"].(Schema)
+		for index, element := range array {
+			errors = append(errors, s.validate(element, items, fmt.Sprintf("%s[%d]", path, index))...)
+		}
+		return errors
+	case "string":
+		if _, ok := value.(string); !ok {
+			return mismatch(path, "a string")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch(path, "a boolean")
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch(path, "a number")
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return mismatch(path, "an integer")
+		}
+		float, err := number.Float64()
+		if err != nil || float != math.Trunc(float) {
+			return mismatch(path, "an integer")
+		}
+		if minimum, ok := schema["minimum"].(int); ok && float < float64(minimum) {
+			return []helpers.FieldError{{Field: path, Message: fmt.Sprintf("must be at least %d", minimum)}}
+		}
+	}
+	return nil
+}
+
+func mismatch(path string, expected string) []helpers.FieldError {
+	return []helpers.FieldError{{Field: path, Message: "must be " + expected}}
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+	"github.com/gorilla/mux"
+	log "github.com/Sirupsen/logrus"
+	"github.com/asafron/meetings-scheduler/helpers"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// requestIdPattern accepts the ids proxies and clients usually send, uuids
+// included, anything else is replaced so it can't garble the logs
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// logRequests gives every request an id, the one sent in X-Request-Id when
+// there is a usable one, answers with it and logs the request once it is over
+func logRequests(h http.Handler, r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		requestId := req.Header.Get(requestIdHeader)
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = helpers.RandStringBytesMaskImprSrc(16)
+		}
+		writer.Header().Set(requestIdHeader, requestId)
+		req, requestLog := helpers.WithRequestLog(req, requestId)
+
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		h.ServeHTTP(recorder, req)
+
+		fields := requestLog.Fields()
+		fields["method"] = req.Method
+		fields["path"] = req.URL.Path
+		fields["route"] = routeOf(r, req)
+		fields["status"] = recorder.status
+		fields["latency_ms"] = float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond)
+		fields["ip"] = helpers.ClientIp(req)
+		entry := log.WithFields(fields)
+		switch {
+		case recorder.status >= http.StatusInternalServerError:
+			entry.Error("request failed")
+		case recorder.status >= http.StatusBadRequest:
+			entry.Warn("request rejected")
+		default:
+			entry.Info("request served")
+		}
+	})
+}
@@ -9,31 +9,99 @@ import (
 	"github.com/asafron/meetings-scheduler/controllers"
 	"github.com/asafron/meetings-scheduler/config"
 	"github.com/asafron/meetings-scheduler/auth"
+	"context"
 	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
+	"time"
 	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/logging"
+	"github.com/asafron/meetings-scheduler/metrics"
+	"github.com/asafron/meetings-scheduler/openapi"
+	"github.com/asafron/meetings-scheduler/tracing"
 )
 
 
 func main() {
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:])
+	if err != nil {
+		// printed as is, the problems are listed a line each
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	// logging
-	log.SetFormatter(&log.TextFormatter{})
+	logFile, err := logging.Setup(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer logFile.Close()
 
-	configWrapper := config.GetConfigWrapper()
+	// tracing
+	spans, err := tracing.Setup(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer spans.Close()
 
 	// db
-	dal := initMongo(configWrapper.GetCurrent().MongoHost)
+	dal := db.DAL(db.NewObservedDAL(initDatabase(cfg), observeDatabase(cfg.Storage)))
 	log.Info("DB connection was established")
 	defer dal.Close()
 
-	authorizer := auth.NewAuthenticator(dal, config.GetConfigWrapper().GetCurrent().SessionKey)
+	// commands given after the flags run instead of the server
+	if len(args) > 0 {
+		err := runCommand(dal, cfg, args)
+		if err != nil {
+			// printed as is, usages span several lines
+			fmt.Fprintln(os.Stderr, err)
+			dal.Close()
+			spans.Close()
+			os.Exit(1)
+		}
+		return
+	}
+	migrateOnStartup(dal, cfg.DisableStartupMigrations)
+	workers := newBackgroundWorkers()
+	workers.every(time.Hour, func() { purgeTrash(dal, cfg.TrashRetentionDays) })
+	workers.every(time.Hour, func() { purgeIdempotencyKeys(dal) })
+
+	authorizer := auth.NewAuthenticator(dal, cfg.SessionKey, cfg.DashboardBaseUrl)
 
 	// controllers
-	ec := controllers.NewEventsController(dal)
-	uc := controllers.NewUserController(dal, authorizer)
+	ec := controllers.NewEventsController(dal, cfg.GuestWebsiteUrl)
+	uc := controllers.NewUserController(dal, authorizer, cfg)
 	sc := controllers.NewSlotsController(dal)
+	fc := controllers.NewFreeBusyController(dal)
+	sgc := controllers.NewSuggestionsController(dal)
+	ac := controllers.NewAvailabilityController(dal)
+	tc := controllers.NewTrashController(dal)
+	adc := controllers.NewAuditController(dal, cfg.Admins)
 
 	r := mux.NewRouter()
+	server := &MyServer{
+		r: r,
+		// a request outlives the write timeout only when it is stuck, its key is released a minute later
+		idempotency: NewIdempotency(dal, cfg.IdempotencyKeyTtlHours, seconds(cfg.WriteTimeoutSeconds)+time.Minute, authorizer.SessionEmail),
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+	r.NotFoundHandler = http.HandlerFunc(notFound)
 	r.Handle("/ws/version", requestQueueHandler(http.HandlerFunc(Version))).Methods("GET")
+	r.Handle("/openapi.json", RecoverWrap(http.HandlerFunc(server.OpenApiDocument))).Methods("GET")
+	r.Handle("/docs", RecoverWrap(http.HandlerFunc(server.Docs))).Methods("GET")
+
+	// operations
+	health := NewHealth(dal, cfg)
+	registerMeetingMetrics(dal)
+	r.Handle("/healthz", RecoverWrap(http.HandlerFunc(health.Live))).Methods("GET")
+	r.Handle("/readyz", RecoverWrap(http.HandlerFunc(health.Ready))).Methods("GET")
+	r.Handle("/metrics", RecoverWrap(metrics.Handler())).Methods("GET")
 
 	// users
 	r.Handle("/users", http.HandlerFunc(cors)).Methods("OPTIONS")
@@ -50,46 +118,123 @@ func main() {
 	r.Handle("/events", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventsForUser)))).Methods("GET")
 	r.Handle("/events", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.AddEventForUser)))).Methods("POST")
 	r.Handle("/events", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.RemoveEvent)))).Methods("DELETE")
+	r.Handle("/events/{id}/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventSlots)))).Methods("GET")
+	r.Handle("/events/{id}/meetings", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventMeetings)))).Methods("GET")
 
 	// slots
 	r.Handle("/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.AddSlotsToEvent)))).Methods("POST")
+	r.Handle("/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.UpdateSlots)))).Methods("PUT", "PATCH")
 	r.Handle("/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.RemoveSlotFromEvent)))).Methods("DELETE")
 
+	// meetings
+	r.Handle("/meetings", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(tc.RemoveMeeting)))).Methods("DELETE")
+
+	// trash
+	r.Handle("/trash", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(tc.GetTrash)))).Methods("GET")
+	r.Handle("/trash/restore", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(tc.Restore)))).Methods("POST")
+
+	// audit log
+	r.Handle("/audit", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(adc.GetAuditEntries)))).Methods("GET")
+
+	// blackouts and date overrides
+	r.Handle("/blackouts", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.GetBlackouts)))).Methods("GET")
+	r.Handle("/blackouts", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.AddBlackout)))).Methods("POST")
+	r.Handle("/blackouts", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.RemoveBlackout)))).Methods("DELETE")
+	r.Handle("/blackouts/import", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.ImportHolidays)))).Methods("POST")
+	r.Handle("/overrides", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.GetDateOverrides)))).Methods("GET")
+	r.Handle("/overrides", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.AddDateOverride)))).Methods("POST")
+	r.Handle("/overrides", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ac.RemoveDateOverride)))).Methods("DELETE")
+
+	// free/busy
+	r.Handle("/freebusy", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(fc.QueryFreeBusy)))).Methods("POST")
+
+	// suggestions
+	r.Handle("/suggestions", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sgc.SuggestMeetingTimes)))).Methods("POST")
+
+	// v2, resources are addressed by their path instead of ids in the body
+	r.Handle("/v2/events", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.ListEventsForUser)))).Methods("GET")
+	r.Handle("/v2/events", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.AddEventForUser)))).Methods("POST")
+	r.Handle("/v2/events/{id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEvent)))).Methods("GET")
+	r.Handle("/v2/events/{id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.UpdateEvent)))).Methods("PATCH")
+	r.Handle("/v2/events/{id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.RemoveEventById)))).Methods("DELETE")
+	r.Handle("/v2/events/{id}/intake_form", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.UpdateEventIntakeForm)))).Methods("PUT")
+	r.Handle("/v2/events/{id}/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventSlots)))).Methods("GET")
+	r.Handle("/v2/events/{id}/slots", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.AddEventSlots)))).Methods("POST")
+	r.Handle("/v2/events/{id}/slots/import", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.ImportEventSlots)))).Methods("POST")
+	r.Handle("/v2/events/{id}/slots/{slot_id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.GetEventSlot)))).Methods("GET")
+	r.Handle("/v2/events/{id}/slots/{slot_id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.UpdateEventSlot)))).Methods("PUT", "PATCH")
+	r.Handle("/v2/events/{id}/slots/{slot_id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(sc.RemoveEventSlot)))).Methods("DELETE")
+	r.Handle("/v2/events/{id}/meetings", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventMeetings)))).Methods("GET")
+	r.Handle("/v2/events/{id}/meetings/export", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.ExportEventMeetings)))).Methods("GET")
+	r.Handle("/v2/events/{id}/meetings/{meeting_id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(ec.GetEventMeeting)))).Methods("GET")
+	r.Handle("/v2/events/{id}/meetings/{meeting_id}", RecoverWrap(authorizer.AuthMiddleware(http.HandlerFunc(tc.RemoveEventMeeting)))).Methods("DELETE")
+
+	// public, guests read the event they book a meeting of
+	r.Handle("/v2/public/events/{id}", RecoverWrap(http.HandlerFunc(ec.GetPublicEvent))).Methods("GET")
+	r.Handle("/v2/public/events/{id}/intake_form/validate", RecoverWrap(http.HandlerFunc(ec.ValidateIntakeAnswers))).Methods("POST")
+	r.Handle("/v2/public/events/{id}/meetings", RecoverWrap(http.HandlerFunc(ec.BookMeeting))).Methods("POST")
+
+	// requests are validated against the document of the routes above
+	server.spec = buildSpec(r)
+
 	// http setup
-	http.Handle("/", &MyServer{r})
-	log.Info("starting server, listening on port 4000...")
-	err := http.ListenAndServe(":4000",nil)
-	if err!=nil {
-		panic(err)
+	httpServer := newHttpServer(cfg, logRequests(instrument(traceRequests(server, r), r), r))
+	err = serve(httpServer, cfg)
+	workers.Stop()
+	if err != nil && err != http.ErrServerClosed {
+		log.Error(err)
+		dal.Close()
+		spans.Close()
+		os.Exit(1)
 	}
+	log.Info("server stopped")
 }
 
 type MyServer struct {
-	r *mux.Router
+	r            *mux.Router
+	spec         *openapi.Spec
+	idempotency  *Idempotency
+	maxBodyBytes int64
 }
 
 func (s *MyServer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	if origin := req.Header.Get("Origin"); origin != "" {
 		rw.Header().Set("Access-Control-Allow-Origin", origin)
 		rw.Header().Set("Access-Control-Allow-Credentials","true")
-		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		rw.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		rw.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Sdk-Key, Authorization, Cache-control")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Sdk-Key, Authorization, Cache-control, If-Match, Idempotency-Key, X-Request-Id, Traceparent")
+		rw.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, X-Request-Id")
 	}
 	// Stop here if its Pre-flighted OPTIONS request
 	if req.Method == "OPTIONS" {
 		return
 	}
+	if s.maxBodyBytes > 0 {
+		if req.ContentLength > s.maxBodyBytes {
+			helpers.ErrorResponse(rw, helpers.GeneralErrorBodyTooLarge)
+			return
+		}
+		req.Body = http.MaxBytesReader(rw, req.Body, s.maxBodyBytes)
+	}
+	if s.spec != nil && !validateRequest(s.spec, s.r, rw, req) {
+		return
+	}
 	// Lets Gorilla work
+	if s.idempotency != nil {
+		s.idempotency.Handle(rw, req, s.r)
+		return
+	}
 	s.r.ServeHTTP(rw, req)
 }
 
 func cors(writer http.ResponseWriter, req *http.Request) {
 	if origin := req.Header.Get("Origin"); origin != "" {
 		writer.Header().Set("Access-Control-Allow-Origin", origin)
-		writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		writer.Header().Set("Access-Control-Allow-Headers",
-			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, Idempotency-Key, X-Request-Id, Traceparent")
+		writer.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, X-Request-Id")
 		writer.Header().Set("Access-Control-Allow-Credentials", "true")
 	}
 	if req.Method == "OPTIONS" {
@@ -103,6 +248,11 @@ func requestQueueHandler(fn http.Handler) http.HandlerFunc {
 	}
 }
 
+// notFound answers the paths no route matched with the JSON error model
+func notFound(writer http.ResponseWriter, req *http.Request) {
+	helpers.ErrorResponse(writer, helpers.GeneralErrorNotFound)
+}
+
 type VersionResponse struct {
 	Version string `json:"version"`
 }
@@ -112,15 +262,27 @@ func Version(writer http.ResponseWriter, req *http.Request) {
 	res := VersionResponse{ Version: "4"}
 	js, err := json.Marshal(res)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		helpers.ErrorResponse(writer, err)
 		return
 	}
 	writer.Header().Set("Content-Type", "application/json")
 	writer.Write(js)
 }
 
-func initMongo(dbUrl string) *db.DAL{
-	dal := db.NewDatabaseAccessor(dbUrl)
+// initDatabase connects to the configured storage, mongo unless sqlite or
+// postgres were chosen, in which case sql_dsn is passed to the driver
+func initDatabase(cfg *config.EnvConfig) db.DAL {
+	var dal db.DAL
+	switch cfg.Storage {
+	case "", "mongo":
+		dal = db.NewDatabaseAccessor(cfg.MongoHost)
+	case "sqlite":
+		dal = db.NewSQLDatabaseAccessor(db.SQLDialectSQLite, cfg.SqlDsn)
+	case "postgres":
+		dal = db.NewSQLDatabaseAccessor(db.SQLDialectPostgres, cfg.SqlDsn)
+	default:
+		panic(helpers.DatabaseErrorUnknownStorage)
+	}
 	err:= dal.Initialize()
 	if err!=nil {
 		panic(err)
@@ -128,6 +290,114 @@ func initMongo(dbUrl string) *db.DAL{
 	return dal
 }
 
+// migrateOnStartup brings the database schema up to date, when startup
+// migrations are disabled it refuses to start until they were run by hand
+func migrateOnStartup(dal db.DAL, disabled bool) {
+	pending, err := dal.CheckSchemaVersion()
+	if err != nil {
+		panic(err)
+	}
+	if !pending {
+		return
+	}
+	if disabled {
+		panic(helpers.MigrationsErrorPending)
+	}
+	err = dal.MigrateUp()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// purgeTrash removes for good what stayed in the trash longer than the
+// retention period
+func purgeTrash(dal db.DAL, retentionDays int) {
+	retention := time.Duration(retentionDays) * 24 * time.Hour
+	err := dal.PurgeDeleted(time.Now().UTC().Add(-retention))
+	if err != nil {
+		log.Warn(err)
+	}
+}
+
+// backgroundWorkers runs the periodic jobs of the server until it shuts down
+type backgroundWorkers struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newBackgroundWorkers() *backgroundWorkers {
+	return &backgroundWorkers{stop: make(chan struct{})}
+}
+
+// every runs job right away and then once every interval
+func (w *backgroundWorkers) every(interval time.Duration, job func()) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			job()
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the running jobs to finish and doesn't start new ones
+func (w *backgroundWorkers) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// newHttpServer builds the server from the config
+func newHttpServer(cfg *config.EnvConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr: cfg.ListenAddress,
+		Handler: handler,
+		ReadTimeout: seconds(cfg.ReadTimeoutSeconds),
+		WriteTimeout: seconds(cfg.WriteTimeoutSeconds),
+		IdleTimeout: seconds(cfg.IdleTimeoutSeconds),
+	}
+}
+
+// serve answers requests until the process is asked to stop with SIGINT or
+// SIGTERM, requests in flight are then given the shutdown timeout to finish
+func serve(server *http.Server, cfg *config.EnvConfig) error {
+	failed := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TlsCertFile != "" {
+			log.Info("starting server, listening with TLS on ", server.Addr)
+			err = server.ListenAndServeTLS(cfg.TlsCertFile, cfg.TlsKeyFile)
+		} else {
+			log.Info("starting server, listening on ", server.Addr)
+			err = server.ListenAndServe()
+		}
+		failed <- err
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case err := <-failed:
+		return err
+	case received := <-signals:
+		log.Info("received ", received, ", draining requests")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), seconds(cfg.ShutdownTimeoutSeconds))
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+func seconds(count int) time.Duration {
+	return time.Duration(count) * time.Second
+}
+
 func RecoverWrap(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		var err error
@@ -142,7 +412,8 @@ func RecoverWrap(h http.Handler) http.Handler {
 				default:
 					err = helpers.GeneralErrorInternal
 				}
-				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				helpers.RequestLogger(req).WithField("stack", string(debug.Stack())).Errorf("panic: %v", r)
+				helpers.ErrorResponse(w, err)
 			}
 		}()
 		h.ServeHTTP(w, req)
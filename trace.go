@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"github.com/asafron/meetings-scheduler/helpers"
+	"github.com/asafron/meetings-scheduler/tracing"
+)
+
+// traceRequests runs every request in a server span, named after the template
+// of the route it matched, continuing the trace of the caller when it sent a
+// traceparent header. The trace id is logged with the request.
+func traceRequests(h http.Handler, r *mux.Router) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		route := routeOf(r, req)
+		ctx, span := tracing.Start(tracing.Extract(req.Context(), req.Header), req.Method+" "+route, tracing.KIND_SERVER)
+		defer span.Finish()
+		if span != nil {
+			helpers.SetLogField(req, "trace_id", span.TraceId())
+		}
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", req.URL.RequestURI())
+		span.SetAttribute("http.client_ip", helpers.ClientIp(req))
+
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+		h.ServeHTTP(recorder, req.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", recorder.status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(recorder.status)))
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	log "github.com/Sirupsen/logrus"
+)
+
+const batchSize = 512
+const batchInterval = 5 * time.Second
+
+// queueSize bounds the spans waiting for the exporter, spans finished while
+// the queue is full are dropped rather than slowing the requests down
+const queueSize = 4096
+
+// Exporter sends finished spans out of the process
+type Exporter interface {
+	Export(serviceName string, spans []*Span) error
+}
+
+// StdoutExporter writes the spans as JSON, a line each, for local runs
+type StdoutExporter struct {
+	writer io.Writer
+}
+
+func NewStdoutExporter(writer io.Writer) *StdoutExporter {
+	return &StdoutExporter{writer: writer}
+}
+
+type stdoutSpan struct {
+	Service    string                 `json:"service"`
+	Name       string                 `json:"name"`
+	TraceId    string                 `json:"trace_id"`
+	SpanId     string                 `json:"span_id"`
+	ParentId   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	DurationMs float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+func (e *StdoutExporter) Export(serviceName string, spans []*Span) error {
+	encoder := json.NewEncoder(e.writer)
+	for _, span := range spans {
+		line := stdoutSpan{
+			Service: serviceName,
+			Name: span.Name,
+			TraceId: span.Context.TraceId.String(),
+			SpanId: span.Context.SpanId.String(),
+			Start: span.Start.UTC(),
+			DurationMs: float64(span.End.Sub(span.Start).Nanoseconds()) / float64(time.Millisecond),
+			Attributes: span.Attributes,
+			Error: span.Message,
+		}
+		if span.ParentId != (SpanId{}) {
+			line.ParentId = span.ParentId.String()
+		}
+		err := encoder.Encode(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OtlpExporter posts the spans to an OTLP/HTTP collector endpoint, usually
+// http://collector:4318/v1/traces, in the JSON encoding of the protocol. It
+// writes the few messages it needs itself rather than pulling in the
+// OpenTelemetry SDK, export_test.go checks them against the protocol.
+type OtlpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewOtlpExporter(endpoint string) *OtlpExporter {
+	return &OtlpExporter{endpoint: endpoint, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpStatus is left unset, code 0, unless the span failed
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+func (e *OtlpExporter) Export(serviceName string, spans []*Span) error {
+	scope := otlpScopeSpans{Spans: []otlpSpan{}}
+	scope.Scope.Name = "github.com/asafron/meetings-scheduler/tracing"
+	for _, span := range spans {
+		converted := otlpSpan{
+			TraceId: span.Context.TraceId.String(),
+			SpanId: span.Context.SpanId.String(),
+			Name: span.Name,
+			Kind: span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano: strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		if span.ParentId != (SpanId{}) {
+			converted.ParentSpanId = span.ParentId.String()
+		}
+		if span.Failed {
+			converted.Status = otlpStatus{Code: 2, Message: span.Message}
+		}
+		for key, value := range span.Attributes {
+			converted.Attributes = append(converted.Attributes, otlpAttribute{Key: key, Value: toOtlpValue(value)})
+		}
+		scope.Spans = append(scope.Spans, converted)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{{Key: "service.name", Value: toOtlpValue(serviceName)}}
+
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+	response, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("collector answered %s", response.Status)
+	}
+	return nil
+}
+
+func toOtlpValue(value interface{}) otlpValue {
+	switch typed := value.(type) {
+	case string:
+		return otlpValue{StringValue: &typed}
+	case int:
+		formatted := strconv.Itoa(typed)
+		return otlpValue{IntValue: &formatted}
+	case int64:
+		formatted := strconv.FormatInt(typed, 10)
+		return otlpValue{IntValue: &formatted}
+	case float64:
+		return otlpValue{DoubleValue: &typed}
+	case bool:
+		return otlpValue{BoolValue: &typed}
+	}
+	formatted := fmt.Sprint(value)
+	return otlpValue{StringValue: &formatted}
+}
+
+// batcher exports the spans in the background, in batches, so requests
+// don't wait for the collector
+type batcher struct {
+	exporter    Exporter
+	serviceName string
+	queue       chan *Span
+	done        sync.WaitGroup
+	mutex       sync.RWMutex
+	closed      bool
+}
+
+func newBatcher(exporter Exporter, serviceName string) *batcher {
+	b := &batcher{exporter: exporter, serviceName: serviceName, queue: make(chan *Span, queueSize)}
+	b.done.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(span *Span) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	if b.closed {
+		return
+	}
+	select {
+	case b.queue <- span:
+	default:
+		droppedSpans.Inc()
+	}
+}
+
+func (b *batcher) run() {
+	defer b.done.Done()
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	batch := []*Span{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := b.exporter.Export(b.serviceName, batch)
+		if err != nil {
+			log.WithField("spans", len(batch)).Warnf("failed to export spans: %s", err)
+		}
+		batch = []*Span{}
+	}
+	for {
+		select {
+		case span, ok := <-b.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close exports the spans still queued and stops, spans finished afterwards
+// are dropped
+func (b *batcher) Close() error {
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mutex.Unlock()
+	b.done.Wait()
+	return nil
+}
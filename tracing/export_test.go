@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// The messages of opentelemetry-proto's collector/trace/v1 service in the
+// OTLP/HTTP JSON encoding, with only the fields the exporter may send. They
+// are written from the protocol rather than shared with the exporter, so a
+// field the collector doesn't know fails the decoding.
+type otlpTestAnyValue struct {
+	StringValue *string  `json:"stringValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	IntValue    *string  `json:"intValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+}
+
+type otlpTestKeyValue struct {
+	Key   string           `json:"key"`
+	Value otlpTestAnyValue `json:"value"`
+}
+
+type otlpTestExportTraceServiceRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []otlpTestKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Scope struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"scope"`
+			Spans []struct {
+				TraceId           string             `json:"traceId"`
+				SpanId            string             `json:"spanId"`
+				ParentSpanId      string             `json:"parentSpanId"`
+				Name              string             `json:"name"`
+				Kind              int                `json:"kind"`
+				StartTimeUnixNano string             `json:"startTimeUnixNano"`
+				EndTimeUnixNano   string             `json:"endTimeUnixNano"`
+				Attributes        []otlpTestKeyValue `json:"attributes"`
+				Status            struct {
+					Message string `json:"message"`
+					Code    int    `json:"code"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+func TestOtlpExporterPayloadDecodesAsOtlp(t *testing.T) {
+	var payload otlpTestExportTraceServiceRequest
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		contentType = req.Header.Get("Content-Type")
+		decoder := json.NewDecoder(req.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&payload); err != nil {
+			t.Errorf("payload isn't an OTLP ExportTraceServiceRequest: %v", err)
+			writer.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Date(2030, time.March, 4, 9, 0, 0, 0, time.UTC)
+	parent := &Span{Name: "PATCH /events/{id}", Kind: KIND_SERVER, Start: start, End: start.Add(40 * time.Millisecond),
+		Attributes: map[string]interface{}{"http.status_code": 200, "http.method": "PATCH"}}
+	parent.Context.TraceId = TraceId{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	parent.Context.SpanId = SpanId{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	child := &Span{Name: "db.UpdateEvent", Kind: KIND_CLIENT, Context: parent.Context, ParentId: parent.Context.SpanId,
+		Start: start.Add(time.Millisecond), End: start.Add(30 * time.Millisecond), Attributes: map[string]interface{}{}}
+	child.Context.SpanId = SpanId{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	child.RecordError(errors.New("version conflict"))
+
+	if err := NewOtlpExporter(server.URL+"/v1/traces").Export("meetings-scheduler", []*Span{parent, child}); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if len(payload.ResourceSpans) != 1 || len(payload.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("payload = %+v, want one resource with one scope", payload)
+	}
+	resource := payload.ResourceSpans[0]
+	attributes := resource.Resource.Attributes
+	if len(attributes) != 1 || attributes[0].Key != "service.name" || attributes[0].Value.StringValue == nil || *attributes[0].Value.StringValue != "meetings-scheduler" {
+		t.Errorf("resource attributes = %+v, want the service name", attributes)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	for _, span := range spans {
+		// ids are hex in the JSON encoding, not base64 as protobuf bytes usually are
+		if id, err := hex.DecodeString(span.TraceId); err != nil || len(id) != 16 {
+			t.Errorf("%s: traceId %q isn't 16 bytes of hex", span.Name, span.TraceId)
+		}
+		if id, err := hex.DecodeString(span.SpanId); err != nil || len(id) != 8 {
+			t.Errorf("%s: spanId %q isn't 8 bytes of hex", span.Name, span.SpanId)
+		}
+		// fixed64 fields are strings of decimal digits
+		startNano, startErr := strconv.ParseUint(span.StartTimeUnixNano, 10, 64)
+		endNano, endErr := strconv.ParseUint(span.EndTimeUnixNano, 10, 64)
+		if startErr != nil || endErr != nil || endNano < startNano {
+			t.Errorf("%s: times %q to %q aren't unix nanoseconds", span.Name, span.StartTimeUnixNano, span.EndTimeUnixNano)
+		}
+	}
+
+	serverSpan, clientSpan := spans[0], spans[1]
+	if serverSpan.Kind != 2 || serverSpan.ParentSpanId != "" || serverSpan.Status.Code != 0 || serverSpan.StartTimeUnixNano != strconv.FormatInt(start.UnixNano(), 10) {
+		t.Errorf("server span = %+v, want SPAN_KIND_SERVER, a root with STATUS_CODE_UNSET", serverSpan)
+	}
+	for _, attribute := range serverSpan.Attributes {
+		if attribute.Key == "http.status_code" && (attribute.Value.IntValue == nil || *attribute.Value.IntValue != "200") {
+			t.Errorf("http.status_code = %+v, want the intValue \"200\"", attribute.Value)
+		}
+	}
+	if clientSpan.Kind != 3 || clientSpan.ParentSpanId != serverSpan.SpanId || clientSpan.TraceId != serverSpan.TraceId {
+		t.Errorf("client span = %+v, want SPAN_KIND_CLIENT under the server span", clientSpan)
+	}
+	if clientSpan.Status.Code != 2 || clientSpan.Status.Message != "version conflict" {
+		t.Errorf("failed span status = %+v, want STATUS_CODE_ERROR with the message", clientSpan.Status)
+	}
+}
+
+func TestOtlpExporterCollectorError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		ioutil.ReadAll(req.Body)
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	span := &Span{Name: "GET /events", Kind: KIND_SERVER, Start: time.Now(), End: time.Now()}
+	if err := NewOtlpExporter(server.URL).Export("meetings-scheduler", []*Span{span}); err == nil {
+		t.Errorf("Export() to a failing collector succeeded")
+	}
+}
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C trace context header
+const TraceparentHeader = "traceparent"
+
+// ParseTraceparent reads a traceparent value, version-traceid-parentid-flags
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var result SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return result, false
+	}
+	// version 00 has exactly four parts, later ones may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return result, false
+	}
+	if !decodeHex(parts[1], result.TraceId[:]) || !decodeHex(parts[2], result.SpanId[:]) {
+		return result, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) || !result.Valid() {
+		return result, false
+	}
+	result.Sampled = flags[0]&1 == 1
+	return result, true
+}
+
+// Traceparent formats the span context as a version 00 traceparent value
+func (c SpanContext) Traceparent() string {
+	flags := 0
+	if c.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", c.TraceId, c.SpanId, flags)
+}
+
+// Extract continues the trace of the caller, when the headers carry a valid
+// traceparent
+func Extract(ctx context.Context, header http.Header) context.Context {
+	remote, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remote)
+}
+
+// Inject passes the trace of the context on to the callee
+func Inject(ctx context.Context, header http.Header) {
+	if current := SpanContextFrom(ctx); current.Valid() {
+		header.Set(TraceparentHeader, current.Traceparent())
+	}
+}
+
+// decodeHex decodes lower case hex of exactly the length of the destination
+func decodeHex(value string, destination []byte) bool {
+	if len(value) != 2*len(destination) || strings.ToLower(value) != value {
+		return false
+	}
+	_, err := hex.Decode(destination, []byte(value))
+	return err == nil
+}
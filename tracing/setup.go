@@ -0,0 +1,28 @@
+package tracing
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"github.com/asafron/meetings-scheduler/config"
+	"github.com/asafron/meetings-scheduler/metrics"
+)
+
+var droppedSpans = metrics.NewCounter("trace_spans_dropped_total", "Spans dropped because the export queue was full")
+
+// Setup starts exporting spans to the configured exporter, tracing stays off
+// when there is none. The returned closer exports the spans still queued.
+func Setup(cfg *config.EnvConfig) (io.Closer, error) {
+	var exporter Exporter
+	switch cfg.TraceExporter {
+	case "stdout":
+		exporter = NewStdoutExporter(os.Stdout)
+	case "otlp":
+		exporter = NewOtlpExporter(cfg.TraceEndpoint)
+	default:
+		return ioutil.NopCloser(nil), nil
+	}
+	b := newBatcher(exporter, cfg.TraceServiceName)
+	tracer = &Tracer{samplePercent: cfg.TraceSamplePercent, batcher: b}
+	return b, nil
+}
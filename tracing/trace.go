@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type TraceId [16]byte
+type SpanId [8]byte
+
+func (id TraceId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanId) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span across processes, it is what travels in the
+// traceparent header
+type SpanContext struct {
+	TraceId TraceId
+	SpanId  SpanId
+	Sampled bool
+}
+
+func (c SpanContext) Valid() bool {
+	return c.TraceId != TraceId{} && c.SpanId != SpanId{}
+}
+
+// SpanKind numbers the kinds as OTLP does
+type SpanKind int
+
+const (
+	KIND_INTERNAL SpanKind = 1
+	KIND_SERVER   SpanKind = 2
+	KIND_CLIENT   SpanKind = 3
+)
+
+// Span is a timed operation of a trace. Spans of requests that aren't
+// sampled are carried around for their context but never exported, and every
+// method can be called on a nil span, which is what Start returns while
+// tracing is off.
+type Span struct {
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	ParentId   SpanId
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Failed     bool
+	Message    string
+
+	mutex sync.Mutex
+	ended bool
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start begins a span, the child of the span of the context or of the remote
+// span the context was extracted from
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), Attributes: map[string]interface{}{}}
+	parent := SpanContextFrom(ctx)
+	if parent.Valid() {
+		span.Context.TraceId = parent.TraceId
+		span.Context.Sampled = parent.Sampled
+		span.ParentId = parent.SpanId
+	} else {
+		rand.Read(span.Context.TraceId[:])
+		span.Context.Sampled = tracer.sample(span.Context.TraceId)
+	}
+	rand.Read(span.Context.SpanId[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span running in the context, if any
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFrom returns the context of the span running in the context, or
+// of the remote span the context was extracted from
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if span := FromContext(ctx); span != nil {
+		return span.Context
+	}
+	remote, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return remote
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Attributes[key] = value
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Failed = true
+	s.Message = err.Error()
+}
+
+// Finish ends the span and hands it to the exporter when it is sampled, only
+// the first call counts
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mutex.Unlock()
+	if s.Context.Sampled && tracer != nil {
+		tracer.batcher.add(s)
+	}
+}
+
+// TraceId is the id of the trace of the span, empty for nil spans
+func (s *Span) TraceId() string {
+	if s == nil {
+		return ""
+	}
+	return s.Context.TraceId.String()
+}
+
+// Tracer holds the settings of the process
+type Tracer struct {
+	samplePercent int
+	batcher       *batcher
+}
+
+// tracer is set up once at startup, tracing is off while it is nil
+var tracer *Tracer
+
+// sample decides on new traces by their id, so the decision is the same
+// wherever it is taken
+func (t *Tracer) sample(id TraceId) bool {
+	return binary.BigEndian.Uint64(id[8:])%100 < uint64(t.samplePercent)
+}